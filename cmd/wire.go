@@ -14,6 +14,41 @@ type Server struct {
 	FileHandler    *handlers.FileHandler
 	LogService     services.LogService
 	JanitorService *services.Janitor
+	ScrubService   *services.Scrubber
+	MoverService   services.MoverService
+	JobService     services.JobService
+	JobHandler     *handlers.JobHandler
+	UploadService  services.UploadService
+	UploadHandler  *handlers.UploadHandler
+	ArchiveService services.ArchiveService
+	MavenService   services.MavenService
+	MavenHandler   *handlers.MavenHandler
+	NpmService     services.NpmService
+	NpmHandler     *handlers.NpmHandler
+	PypiService    services.PypiService
+	PypiHandler    *handlers.PypiHandler
+	GoproxyService services.GoproxyService
+	GoproxyHandler *handlers.GoproxyHandler
+	OciService     services.OciService
+	OciHandler     *handlers.OciHandler
+	HelmService    services.HelmService
+	HelmHandler    *handlers.HelmHandler
+	DebianService  services.DebianService
+	DebianHandler  *handlers.DebianHandler
+	RpmService     services.RpmService
+	RpmHandler     *handlers.RpmHandler
+	NugetService   services.NugetService
+	NugetHandler   *handlers.NugetHandler
+	CargoService   services.CargoService
+	CargoHandler   *handlers.CargoHandler
+	RemoteService  services.RemoteService
+	VirtualService services.VirtualService
+	VersionService services.VersionService
+	VersionHandler *handlers.VersionHandler
+	TrashService   services.TrashService
+	TrashHandler   *handlers.TrashHandler
+	KeyService     services.KeyService
+	KeyHandler     *handlers.KeyHandler
 }
 
 func NewServer(
@@ -25,7 +60,41 @@ func NewServer(
 	fileHandler *handlers.FileHandler,
 	logService services.LogService,
 	janitorService *services.Janitor,
-
+	scrubService *services.Scrubber,
+	moverService services.MoverService,
+	jobService services.JobService,
+	jobHandler *handlers.JobHandler,
+	uploadService services.UploadService,
+	uploadHandler *handlers.UploadHandler,
+	archiveService services.ArchiveService,
+	mavenService services.MavenService,
+	mavenHandler *handlers.MavenHandler,
+	npmService services.NpmService,
+	npmHandler *handlers.NpmHandler,
+	pypiService services.PypiService,
+	pypiHandler *handlers.PypiHandler,
+	goproxyService services.GoproxyService,
+	goproxyHandler *handlers.GoproxyHandler,
+	ociService services.OciService,
+	ociHandler *handlers.OciHandler,
+	helmService services.HelmService,
+	helmHandler *handlers.HelmHandler,
+	debianService services.DebianService,
+	debianHandler *handlers.DebianHandler,
+	rpmService services.RpmService,
+	rpmHandler *handlers.RpmHandler,
+	nugetService services.NugetService,
+	nugetHandler *handlers.NugetHandler,
+	cargoService services.CargoService,
+	cargoHandler *handlers.CargoHandler,
+	remoteService services.RemoteService,
+	virtualService services.VirtualService,
+	versionService services.VersionService,
+	versionHandler *handlers.VersionHandler,
+	trashService services.TrashService,
+	trashHandler *handlers.TrashHandler,
+	keyService services.KeyService,
+	keyHandler *handlers.KeyHandler,
 ) *Server {
 	return &Server{
 		BoxService:     boxService,
@@ -36,5 +105,40 @@ func NewServer(
 		FileHandler:    fileHandler,
 		LogService:     logService,
 		JanitorService: janitorService,
+		ScrubService:   scrubService,
+		MoverService:   moverService,
+		JobService:     jobService,
+		JobHandler:     jobHandler,
+		UploadService:  uploadService,
+		UploadHandler:  uploadHandler,
+		ArchiveService: archiveService,
+		MavenService:   mavenService,
+		MavenHandler:   mavenHandler,
+		NpmService:     npmService,
+		NpmHandler:     npmHandler,
+		PypiService:    pypiService,
+		PypiHandler:    pypiHandler,
+		GoproxyService: goproxyService,
+		GoproxyHandler: goproxyHandler,
+		OciService:     ociService,
+		OciHandler:     ociHandler,
+		HelmService:    helmService,
+		HelmHandler:    helmHandler,
+		DebianService:  debianService,
+		DebianHandler:  debianHandler,
+		RpmService:     rpmService,
+		RpmHandler:     rpmHandler,
+		NugetService:   nugetService,
+		NugetHandler:   nugetHandler,
+		CargoService:   cargoService,
+		CargoHandler:   cargoHandler,
+		RemoteService:  remoteService,
+		VirtualService: virtualService,
+		VersionService: versionService,
+		VersionHandler: versionHandler,
+		TrashService:   trashService,
+		TrashHandler:   trashHandler,
+		KeyService:     keyService,
+		KeyHandler:     keyHandler,
 	}
 }
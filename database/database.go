@@ -34,10 +34,13 @@ func SetupDatabase() (*gorm.DB, error) {
 	db.Exec("CREATE EXTENSION IF NOT EXISTS ltree;")
 	db.Exec("ALTER TABLE items ALTER COLUMN path TYPE ltree USING path::ltree;")
 	db.Exec("CREATE INDEX path_gist_idx ON items USING gist(path);")
-	err = db.AutoMigrate(models.Box{}, models.Item{})
+	err = db.AutoMigrate(models.Box{}, models.Item{}, models.Job{}, models.UploadSession{}, models.ItemVersion{}, models.DataKey{})
 	if err != nil {
 		return nil, err
 	}
+	if err := RunMigrations(db); err != nil {
+		return nil, err
+	}
 	return db, nil
 }
 
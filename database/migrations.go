@@ -0,0 +1,110 @@
+package database
+
+import (
+	"Boxed/internal/helpers"
+	"Boxed/internal/models"
+	"fmt"
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
+
+// SchemaMigration records a data migration that ran, so it runs once per database
+type SchemaMigration struct {
+	Name      string `gorm:"primaryKey"`
+	AppliedAt time.Time
+}
+
+type migration struct {
+	name string
+	run  func(tx *gorm.DB) error
+}
+
+// migrations run in order after the tables are migrated, new ones are appended at the end
+var migrations = []migration{
+	{name: "encode_item_paths", run: encodeItemPaths},
+}
+
+// RunMigrations runs the migrations the database has not seen yet, each in a transaction of its own
+func RunMigrations(db *gorm.DB) error {
+	if err := db.AutoMigrate(&SchemaMigration{}); err != nil {
+		return err
+	}
+	for _, m := range migrations {
+		var count int64
+		if err := db.Model(&SchemaMigration{}).Where("name = ?", m.name).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			continue
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := m.run(tx); err != nil {
+				return err
+			}
+			return tx.Create(&SchemaMigration{Name: m.name, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return fmt.Errorf("migration %s failed: %w", m.name, err)
+		}
+	}
+	return nil
+}
+
+// encodeItemPaths rebuilds the stored paths with helpers.EncodeLtreeLabel. The earlier labels turned
+// hyphens into underscores and split names at their dots, so names differing in those characters shared
+// a path. The new path is built from the names along the parent chain, trashed items included.
+func encodeItemPaths(tx *gorm.DB) error {
+	var items []models.Item
+	if err := tx.Unscoped().Order("id").Find(&items).Error; err != nil {
+		return err
+	}
+	byID := make(map[uint]*models.Item, len(items))
+	for i := range items {
+		byID[items[i].ID] = &items[i]
+	}
+
+	paths := make(map[uint]string, len(items))
+	var pathOf func(item *models.Item, seen map[uint]bool) string
+	pathOf = func(item *models.Item, seen map[uint]bool) string {
+		if path, ok := paths[item.ID]; ok {
+			return path
+		}
+		label := helpers.EncodeLtreeLabel(item.Name)
+		path := label
+		if item.ParentID != nil {
+			parent, ok := byID[*item.ParentID]
+			if ok && !seen[parent.ID] {
+				seen[item.ID] = true
+				path = pathOf(parent, seen) + "." + label
+			} else if prefix := oldParentLabels(item); prefix != "" {
+				// The parent is gone, the item keeps the place its old path gave it
+				path = prefix + "." + label
+			}
+		}
+		paths[item.ID] = path
+		return path
+	}
+
+	for i := range items {
+		path := pathOf(&items[i], make(map[uint]bool))
+		if path == items[i].Path {
+			continue
+		}
+		err := tx.Unscoped().Model(&models.Item{}).Where("id = ?", items[i].ID).UpdateColumn("path", path).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// oldParentLabels returns the labels of the old path above the item, its name took one label per dot
+func oldParentLabels(item *models.Item) string {
+	labels := strings.Split(item.Path, ".")
+	nameLabels := strings.Count(item.Name, ".") + 1
+	if len(labels) <= nameLabels {
+		return ""
+	}
+	return strings.Join(labels[:len(labels)-nameLabels], ".")
+}
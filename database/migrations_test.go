@@ -0,0 +1,53 @@
+package database
+
+import (
+	"Boxed/internal/models"
+	"Boxed/internal/testdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	"testing"
+)
+
+func TestRunMigrations_EncodesItemPaths(t *testing.T) {
+	db, err := gorm.Open(testdb.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.Item{}))
+
+	// Paths as the earlier labels stored them
+	scope := &models.Item{Name: "@scope", Path: "@scope", Type: "folder", BoxID: 1}
+	require.NoError(t, db.Create(scope).Error)
+	folder := &models.Item{Name: "my-lib", Path: "@scope.my_lib", Type: "folder", BoxID: 1, ParentID: &scope.ID}
+	require.NoError(t, db.Create(folder).Error)
+	file := &models.Item{Name: "my-lib-1.0.tgz", Path: "@scope.my_lib.my_lib_1.0.tgz", Type: "file", BoxID: 1, ParentID: &folder.ID}
+	require.NoError(t, db.Create(file).Error)
+	trashed := &models.Item{Name: "old.txt", Path: "@scope.old.txt", Type: "file", BoxID: 1, ParentID: &scope.ID}
+	require.NoError(t, db.Create(trashed).Error)
+	require.NoError(t, db.Delete(trashed).Error)
+	missingParent := uint(99)
+	orphan := &models.Item{Name: "a.b", Path: "lost.a.b", Type: "file", BoxID: 1, ParentID: &missingParent}
+	require.NoError(t, db.Create(orphan).Error)
+
+	require.NoError(t, RunMigrations(db))
+
+	paths := make(map[uint]string)
+	var items []models.Item
+	require.NoError(t, db.Unscoped().Find(&items).Error)
+	for _, item := range items {
+		paths[item.ID] = item.Path
+	}
+	assert.Equal(t, map[uint]string{
+		scope.ID:   "_40scope",
+		folder.ID:  "_40scope.my_2dlib",
+		file.ID:    "_40scope.my_2dlib.my_2dlib_2d1_2e0_2etgz",
+		trashed.ID: "_40scope.old_2etxt",
+		orphan.ID:  "lost.a_2eb",
+	}, paths)
+
+	// A migration that ran does not run again
+	require.NoError(t, db.Unscoped().Model(&models.Item{}).Where("id = ?", scope.ID).UpdateColumn("path", "kept").Error)
+	require.NoError(t, RunMigrations(db))
+	var kept models.Item
+	require.NoError(t, db.First(&kept, scope.ID).Error)
+	assert.Equal(t, "kept", kept.Path)
+}
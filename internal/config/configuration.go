@@ -11,7 +11,35 @@ type Configuration struct {
 }
 
 type StorageConfig struct {
-	Path string `yaml:"path"`
+	Path       string           `yaml:"path"`
+	Backend    string           `yaml:"backend"`
+	S3         S3Config         `yaml:"s3"`
+	Encryption EncryptionConfig `yaml:"encryption"`
+}
+
+// S3Config locates the bucket of the s3 storage backend, any S3 compatible service works
+type S3Config struct {
+	Endpoint  string `yaml:"endpoint"`
+	Region    string `yaml:"region"`
+	Bucket    string `yaml:"bucket"`
+	Prefix    string `yaml:"prefix"`
+	AccessKey string `yaml:"accessKey"`
+	SecretKey string `yaml:"secretKey"`
+	PathStyle bool   `yaml:"pathStyle"`
+}
+
+// EncryptionConfig holds the master keys wrapping the data keys of encrypted boxes. New data keys are
+// wrapped with the active key, the other keys are kept to unwrap older data keys until they are rotated.
+type EncryptionConfig struct {
+	ActiveKey string            `yaml:"activeKey"`
+	Keys      []MasterKeyConfig `yaml:"keys"`
+}
+
+// MasterKeyConfig is a master key given as the base64 of 32 bytes, either inline or in a file
+type MasterKeyConfig struct {
+	ID      string `yaml:"id"`
+	Key     string `yaml:"key"`
+	KeyFile string `yaml:"keyFile"`
 }
 
 type ServerConfig struct {
@@ -19,7 +47,12 @@ type ServerConfig struct {
 	RequestConfig RequestConfig `yaml:"request"`
 	Concurrency   int           `yaml:"concurrency"`
 	CleanConfig   CleanConfig   `yaml:"clean"`
+	ScrubConfig   ScrubConfig   `yaml:"scrub"`
 	LogConfig     LogConfig     `yaml:"log"`
+	JobConfig     JobConfig     `yaml:"jobs"`
+	UploadConfig  UploadConfig  `yaml:"upload"`
+	DebianConfig  DebianConfig  `yaml:"debian"`
+	RemoteConfig  RemoteConfig  `yaml:"remote"`
 }
 
 type RequestConfig struct {
@@ -27,9 +60,44 @@ type RequestConfig struct {
 }
 
 type CleanConfig struct {
+	Schedule       string `yaml:"schedule"`
+	TrashRetention string `yaml:"trashRetention"`
+}
+
+// ScrubConfig schedules the integrity scrub, which is only run on demand when there is no schedule
+type ScrubConfig struct {
 	Schedule string `yaml:"schedule"`
 }
 
+type JobConfig struct {
+	Workers int `yaml:"workers"`
+}
+
+type UploadConfig struct {
+	SessionExpiry string        `yaml:"sessionExpiry"`
+	Explode       ExplodeConfig `yaml:"explode"`
+}
+
+type ExplodeConfig struct {
+	MaxEntries int   `yaml:"maxEntries"`
+	MaxSize    int64 `yaml:"maxSize"`
+	MaxRatio   int64 `yaml:"maxRatio"`
+}
+
+// DebianConfig holds the key the Release files of debian boxes are signed with
+type DebianConfig struct {
+	SigningKey string `yaml:"signingKey"`
+	Passphrase string `yaml:"passphrase"`
+}
+
+// RemoteConfig holds the defaults of remote boxes, a box overrides them with its properties
+type RemoteConfig struct {
+	Timeout     string `yaml:"timeout"`
+	MetadataTTL string `yaml:"metadataTTL"`
+	NegativeTTL string `yaml:"negativeTTL"`
+	Offline     bool   `yaml:"offline"`
+}
+
 type LogConfig struct {
 	Output  string `yaml:"output"`
 	Format  string `yaml:"format"`
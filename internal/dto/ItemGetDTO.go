@@ -10,7 +10,12 @@ type ItemGetDTO struct {
 	SHA512     string                 `json:"sha512"`
 	Type       string                 `json:"type"`
 	Size       int64                  `json:"size"`
+	StoredSize int64                  `json:"stored_size,omitempty"`
 	Properties map[string]interface{} `json:"properties,omitempty"`
 	Children   []*ItemGetDTO          `json:"children,omitempty"`
 	Extension  string                 `json:"extension,omitempty"`
+	Version    int                    `json:"version"`
+	Uploader   string                 `json:"uploader,omitempty"`
+	// Quarantined is set when the content failed the integrity scrub
+	Quarantined bool `json:"quarantined,omitempty"`
 }
@@ -0,0 +1,11 @@
+package dto
+
+import "time"
+
+// TrashItemDTO is an item in the trash of a box. The items deleted along with a folder are not
+// listed, restoring the folder brings them back.
+type TrashItemDTO struct {
+	ItemGetDTO
+	DeletedAt time.Time `json:"deleted_at"`
+	DeletedBy string    `json:"deleted_by,omitempty"`
+}
@@ -1,7 +1,9 @@
 package handlers
 
 import (
+	"Boxed/internal/models"
 	"Boxed/internal/services"
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -21,6 +23,7 @@ func (h *BoxHandler) CreateBox(c *fiber.Ctx) error {
 		Name       string                 `json:"name"`
 		Properties map[string]interface{} `json:"properties"`
 		Path       string                 `json:"path"`
+		Type       string                 `json:"type"`
 	}
 	if err := c.BodyParser(&req); err != nil {
 		return c.Status(http.StatusBadRequest).JSON(map[string]interface{}{"error": "invalid input"})
@@ -40,7 +43,14 @@ func (h *BoxHandler) CreateBox(c *fiber.Ctx) error {
 		return c.Status(http.StatusBadRequest).JSON(map[string]interface{}{"error": "path is required"})
 	}
 
-	box, err := h.service.CreateBox(req.Name, req.Properties, req.Path)
+	if !models.IsValidBoxType(req.Type) {
+		return c.Status(http.StatusBadRequest).JSON(map[string]interface{}{"error": "unknown box type"})
+	}
+
+	box, err := h.service.CreateBox(req.Name, req.Properties, req.Path, req.Type)
+	if errors.Is(err, services.ErrReservedBoxPath) {
+		return c.Status(http.StatusBadRequest).JSON(map[string]interface{}{"error": err.Error()})
+	}
 	if err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(map[string]interface{}{"error": err.Error()})
 	}
@@ -62,6 +72,24 @@ func (h *BoxHandler) GetBoxByID(c *fiber.Ctx) error {
 	return c.JSON(box)
 }
 
+// GetBoxUsage reports the logical and the physical size of the content of a box
+func (h *BoxHandler) GetBoxUsage(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]interface{}{"error": "invalid box ID"})
+	}
+
+	usage, err := h.service.GetBoxUsage(uint(id))
+	if errors.Is(err, services.ErrBoxNotFound) {
+		return c.Status(http.StatusNotFound).JSON(map[string]interface{}{"error": "box not found"})
+	}
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]interface{}{"error": "could not compute usage"})
+	}
+
+	return c.JSON(usage)
+}
+
 func (h *BoxHandler) UpdateBox(c *fiber.Ctx) error {
 	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
 	if err != nil {
@@ -82,6 +110,9 @@ func (h *BoxHandler) UpdateBox(c *fiber.Ctx) error {
 	}
 
 	box, err := h.service.UpdateBox(uint(id), req.Name, req.Properties)
+	if errors.Is(err, services.ErrReservedBoxPath) {
+		return c.Status(http.StatusBadRequest).JSON(map[string]interface{}{"error": err.Error()})
+	}
 	if err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(map[string]interface{}{"error": "could not update box"})
 	}
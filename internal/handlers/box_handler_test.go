@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"Boxed/internal/models"
+	"Boxed/internal/repository"
 	"bytes"
 	"encoding/json"
 	"errors"
@@ -19,8 +20,8 @@ type MockBoxService struct {
 	mock.Mock
 }
 
-func (m *MockBoxService) CreateBox(name string, properties map[string]interface{}) (*models.Box, error) {
-	args := m.Called(name, properties)
+func (m *MockBoxService) CreateBox(name string, properties map[string]interface{}, path string, boxType string) (*models.Box, error) {
+	args := m.Called(name, properties, path, boxType)
 	if box, ok := args.Get(0).(*models.Box); ok {
 		return box, args.Error(1)
 	}
@@ -66,6 +67,14 @@ func (m *MockBoxService) GetDeletedBoxes() ([]models.Box, error) {
 	return args.Get(0).([]models.Box), args.Error(1)
 }
 
+func (m *MockBoxService) GetBoxUsage(id uint) (*repository.BoxUsage, error) {
+	args := m.Called(id)
+	if usage, ok := args.Get(0).(*repository.BoxUsage); ok {
+		return usage, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
 func TestCreateBox_ValidInput(t *testing.T) {
 	app := fiber.New()
 	mockService := new(MockBoxService)
@@ -84,6 +93,7 @@ func TestCreateBox_ValidInput(t *testing.T) {
 			name: "Successfully create box",
 			input: map[string]interface{}{
 				"name": "Test Box",
+				"path": "test-box",
 				"properties": map[string]interface{}{
 					"description": "Test Description",
 				},
@@ -99,6 +109,7 @@ func TestCreateBox_ValidInput(t *testing.T) {
 			name: "Create box with empty properties",
 			input: map[string]interface{}{
 				"name":       "Test Box",
+				"path":       "test-box",
 				"properties": map[string]interface{}{},
 			},
 			expectedBox: &models.Box{
@@ -113,7 +124,7 @@ func TestCreateBox_ValidInput(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			reqBody, _ := json.Marshal(tt.input)
-			mockService.On("CreateBox", tt.input["name"].(string), tt.input["properties"]).
+			mockService.On("CreateBox", tt.input["name"].(string), tt.input["properties"], "test-box", "").
 				Return(tt.expectedBox, tt.expectedError).Once()
 
 			req := httptest.NewRequest(http.MethodPost, "/boxes", bytes.NewReader(reqBody))
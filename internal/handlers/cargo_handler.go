@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"Boxed/internal/models"
+	"Boxed/internal/services"
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"net/http"
+	"strings"
+)
+
+// CargoHandler serves boxes of type cargo through the sparse index protocol and the publish, yank
+// and download endpoints of the registry web API. Cargo shows the detail of the errors it gets back,
+// so they are reported in the format of that API.
+type CargoHandler struct {
+	service     services.CargoService
+	fileService services.FileService
+}
+
+func NewCargoHandler(service services.CargoService, fileService services.FileService) *CargoHandler {
+	return &CargoHandler{service: service, fileService: fileService}
+}
+
+// GetConfig serves config.json, cargo finds the download and API locations of the registry in it
+func (h *CargoHandler) GetConfig(c *fiber.Ctx) error {
+	box := h.cargoBox(c)
+	if box == nil {
+		return cargoErrorResponse(c, http.StatusNotFound, "Cargo box not found")
+	}
+	baseURL := c.BaseURL() + "/cargo/" + box.Name
+	return c.JSON(map[string]interface{}{
+		"dl":  baseURL + "/api/v1/crates",
+		"api": baseURL,
+	})
+}
+
+func (h *CargoHandler) GetIndexFile(c *fiber.Ctx) error {
+	box := h.cargoBox(c)
+	if box == nil {
+		return cargoErrorResponse(c, http.StatusNotFound, "Cargo box not found")
+	}
+	item, err := h.service.IndexFile(box, strings.Trim(c.Params("*"), "/"))
+	if err != nil {
+		return cargoError(c, err)
+	}
+	return sendBlob(c, h.fileService, box, item)
+}
+
+func (h *CargoHandler) Publish(c *fiber.Ctx) error {
+	box := h.cargoBox(c)
+	if box == nil {
+		return cargoErrorResponse(c, http.StatusNotFound, "Cargo box not found")
+	}
+	if _, err := h.service.Publish(box, requestBody(c)); err != nil {
+		return cargoError(c, err)
+	}
+	return c.JSON(map[string]interface{}{
+		"warnings": map[string][]string{"invalid_categories": {}, "invalid_badges": {}, "other": {}},
+	})
+}
+
+func (h *CargoHandler) Yank(c *fiber.Ctx) error {
+	return h.setYanked(c, true)
+}
+
+func (h *CargoHandler) Unyank(c *fiber.Ctx) error {
+	return h.setYanked(c, false)
+}
+
+func (h *CargoHandler) setYanked(c *fiber.Ctx, yanked bool) error {
+	box := h.cargoBox(c)
+	if box == nil {
+		return cargoErrorResponse(c, http.StatusNotFound, "Cargo box not found")
+	}
+	if err := h.service.SetYanked(box, c.Params("crate"), c.Params("version"), yanked); err != nil {
+		return cargoError(c, err)
+	}
+	return c.JSON(map[string]interface{}{"ok": true})
+}
+
+func (h *CargoHandler) Download(c *fiber.Ctx) error {
+	box := h.cargoBox(c)
+	if box == nil {
+		return cargoErrorResponse(c, http.StatusNotFound, "Cargo box not found")
+	}
+	item, err := h.service.Crate(box, c.Params("crate"), c.Params("version"))
+	if err != nil {
+		return cargoError(c, err)
+	}
+	return sendBlob(c, h.fileService, box, item)
+}
+
+// cargoBox resolves the box of the request, nil unless it is a cargo box
+func (h *CargoHandler) cargoBox(c *fiber.Ctx) *models.Box {
+	box, err := h.fileService.FindBoxByPath(c.Params("box"))
+	if err != nil || box == nil || box.Type != models.BoxTypeCargo {
+		return nil
+	}
+	return box
+}
+
+func cargoError(c *fiber.Ctx, err error) error {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrPackageNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidPackage):
+		status = http.StatusBadRequest
+	case errors.Is(err, services.ErrVersionExists):
+		status = http.StatusConflict
+	}
+	return cargoErrorResponse(c, status, err.Error())
+}
+
+func cargoErrorResponse(c *fiber.Ctx, status int, detail string) error {
+	return c.Status(status).JSON(map[string]interface{}{
+		"errors": []map[string]string{{"detail": detail}},
+	})
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"Boxed/internal/models"
+	"Boxed/internal/services"
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func cargoCrate(t *testing.T, name string, version string) []byte {
+	var buffer bytes.Buffer
+	gzipWriter := gzip.NewWriter(&buffer)
+	tarWriter := tar.NewWriter(gzipWriter)
+	manifest := []byte("[package]\nname = \"" + name + "\"\nversion = \"" + version + "\"\n")
+	require.NoError(t, tarWriter.WriteHeader(&tar.Header{
+		Name:     name + "-" + version + "/Cargo.toml",
+		Mode:     0644,
+		Size:     int64(len(manifest)),
+		Typeflag: tar.TypeReg,
+	}))
+	_, err := tarWriter.Write(manifest)
+	require.NoError(t, err)
+	require.NoError(t, tarWriter.Close())
+	require.NoError(t, gzipWriter.Close())
+	return buffer.Bytes()
+}
+
+// cargoPublishBody frames the metadata and the crate the way cargo publish sends them
+func cargoPublishBody(t *testing.T, metadata map[string]interface{}, crate []byte) *bytes.Buffer {
+	metadataJSON, err := json.Marshal(metadata)
+	require.NoError(t, err)
+	var body bytes.Buffer
+	require.NoError(t, binary.Write(&body, binary.LittleEndian, uint32(len(metadataJSON))))
+	body.Write(metadataJSON)
+	require.NoError(t, binary.Write(&body, binary.LittleEndian, uint32(len(crate))))
+	body.Write(crate)
+	return &body
+}
+
+func cargoIndexEntries(t *testing.T, content string) map[string]services.CargoIndexEntry {
+	entries := make(map[string]services.CargoIndexEntry)
+	for _, line := range strings.Split(strings.TrimSpace(content), "\n") {
+		var entry services.CargoIndexEntry
+		require.NoError(t, json.Unmarshal([]byte(line), &entry))
+		entries[entry.Vers] = entry
+	}
+	return entries
+}
+
+func TestCargoHandler_PublishThenSparseIndex(t *testing.T) {
+	ts := setupTestServer(t)
+	handler := NewCargoHandler(services.NewCargoService(ts.itemService, ts.fileService, ts.logService), ts.fileService)
+	ts.app.Get("/cargo/:box/index/config.json", handler.GetConfig)
+	ts.app.Get("/cargo/:box/index/*", handler.GetIndexFile)
+	ts.app.Put("/cargo/:box/api/v1/crates/new", handler.Publish)
+	ts.app.Delete("/cargo/:box/api/v1/crates/:crate/:version/yank", handler.Yank)
+	ts.app.Get("/cargo/:box/api/v1/crates/:crate/:version/download", handler.Download)
+	ts.createBox(t, "crates", models.BoxTypeCargo, nil)
+
+	// cargo reads the locations of the registry from config.json
+	resp, content := ts.request(t, http.MethodGet, "/cargo/crates/index/config.json", nil, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.JSONEq(t, `{"dl":"http://example.com/cargo/crates/api/v1/crates","api":"http://example.com/cargo/crates"}`, content)
+
+	crates := make(map[string][]byte)
+	for _, version := range []string{"0.1.0", "0.2.0"} {
+		crates[version] = cargoCrate(t, "My_Crate", version)
+		metadata := map[string]interface{}{
+			"name": "My_Crate",
+			"vers": version,
+			"deps": []map[string]interface{}{
+				{"name": "serde", "version_req": "^1.0", "features": []string{}, "default_features": true, "kind": "normal"},
+			},
+			"features": map[string][]string{},
+		}
+		resp, content = ts.request(t, http.MethodPut, "/cargo/crates/api/v1/crates/new", cargoPublishBody(t, metadata, crates[version]), nil)
+		require.Equal(t, http.StatusOK, resp.StatusCode, content)
+	}
+
+	// The sparse index has one line per version under the lower case name
+	resp, content = ts.request(t, http.MethodGet, "/cargo/crates/index/my/_c/my_crate", nil, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	entries := cargoIndexEntries(t, content)
+	require.Len(t, entries, 2)
+	sum := sha256.Sum256(crates["0.2.0"])
+	assert.Equal(t, hex.EncodeToString(sum[:]), entries["0.2.0"].Cksum)
+	assert.Equal(t, "My_Crate", entries["0.2.0"].Name)
+	require.Len(t, entries["0.2.0"].Deps, 1)
+	assert.Equal(t, "serde", entries["0.2.0"].Deps[0].Name)
+	assert.Equal(t, "^1.0", entries["0.2.0"].Deps[0].Req)
+	assert.False(t, entries["0.1.0"].Yanked)
+
+	// The download serves the crate the checksum was taken of
+	resp, content = ts.request(t, http.MethodGet, "/cargo/crates/api/v1/crates/My_Crate/0.2.0/download", nil, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, string(crates["0.2.0"]), content)
+
+	// Yanking is a flag in the index, the version stays
+	resp, _ = ts.request(t, http.MethodDelete, "/cargo/crates/api/v1/crates/My_Crate/0.1.0/yank", nil, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp, content = ts.request(t, http.MethodGet, "/cargo/crates/index/my/_c/my_crate", nil, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	entries = cargoIndexEntries(t, content)
+	assert.True(t, entries["0.1.0"].Yanked)
+	assert.False(t, entries["0.2.0"].Yanked)
+
+	// Yanked versions cannot be published again
+	metadata := map[string]interface{}{"name": "My_Crate", "vers": "0.1.0", "deps": []interface{}{}, "features": map[string][]string{}}
+	resp, content = ts.request(t, http.MethodPut, "/cargo/crates/api/v1/crates/new", cargoPublishBody(t, metadata, crates["0.1.0"]), nil)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	assert.Contains(t, content, `"detail"`)
+	resp, _ = ts.request(t, http.MethodGet, "/cargo/crates/index/ot/he/other", nil, nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"Boxed/internal/models"
+	"Boxed/internal/services"
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// DebianHandler serves boxes of type debian as APT repositories, the box URL is the archive root of a
+// sources.list entry such as "deb https://host/debian/<box> stable main"
+type DebianHandler struct {
+	service     services.DebianService
+	fileService services.FileService
+}
+
+func NewDebianHandler(service services.DebianService, fileService services.FileService) *DebianHandler {
+	return &DebianHandler{service: service, fileService: fileService}
+}
+
+// Get serves the files below dists/ and pool/
+func (h *DebianHandler) Get(c *fiber.Ctx) error {
+	box := h.debianBox(c)
+	if box == nil {
+		return c.Status(http.StatusNotFound).JSON(map[string]interface{}{"error": "Debian box not found"})
+	}
+	filePath, err := url.PathUnescape(c.Params("*"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]interface{}{"error": "Invalid path"})
+	}
+	item, err := h.service.File(box, strings.Trim(filePath, "/"))
+	if err != nil {
+		return debianError(c, err)
+	}
+	return sendBlob(c, h.fileService, box, item)
+}
+
+// GetKey serves the public key the Release files are signed with
+func (h *DebianHandler) GetKey(c *fiber.Ctx) error {
+	if h.debianBox(c) == nil {
+		return c.Status(http.StatusNotFound).JSON(map[string]interface{}{"error": "Debian box not found"})
+	}
+	key, err := h.service.PublicKey()
+	if err != nil {
+		return debianError(c, err)
+	}
+	c.Set(fiber.HeaderContentType, "application/pgp-keys")
+	return c.Send(key)
+}
+
+// Upload takes a .deb either as the raw body or as the first file of a multipart form
+func (h *DebianHandler) Upload(c *fiber.Ctx) error {
+	box := h.debianBox(c)
+	if box == nil {
+		return c.Status(http.StatusNotFound).JSON(map[string]interface{}{"error": "Debian box not found"})
+	}
+	distribution, component := c.Params("distribution"), c.Params("component")
+
+	boundary := string(c.Request().Header.MultipartFormBoundary())
+	if boundary == "" {
+		debianPackage, err := h.service.Upload(box, distribution, component, requestBody(c))
+		if err != nil {
+			return debianError(c, err)
+		}
+		return c.Status(http.StatusCreated).JSON(debianPackage)
+	}
+
+	reader := multipart.NewReader(requestBody(c), boundary)
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(map[string]interface{}{"error": "Invalid multipart body"})
+		}
+		if part.FileName() != "" {
+			debianPackage, err := h.service.Upload(box, distribution, component, part)
+			if err != nil {
+				return debianError(c, err)
+			}
+			return c.Status(http.StatusCreated).JSON(debianPackage)
+		}
+		_ = part.Close()
+	}
+	return c.Status(http.StatusBadRequest).JSON(map[string]interface{}{"error": "Missing package file"})
+}
+
+func (h *DebianHandler) Remove(c *fiber.Ctx) error {
+	box := h.debianBox(c)
+	if box == nil {
+		return c.Status(http.StatusNotFound).JSON(map[string]interface{}{"error": "Debian box not found"})
+	}
+	// Epochs arrive escaped, "1%3A2.0-1" is version 1:2.0-1
+	version, err := url.PathUnescape(c.Params("version"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]interface{}{"error": "Invalid version"})
+	}
+	err = h.service.Remove(box, c.Params("distribution"), c.Params("component"), c.Params("package"), version, c.Params("architecture"))
+	if err != nil {
+		return debianError(c, err)
+	}
+	return c.JSON(map[string]interface{}{"deleted": true})
+}
+
+// debianBox resolves the box of the request, nil unless it is a debian box
+func (h *DebianHandler) debianBox(c *fiber.Ctx) *models.Box {
+	box, err := h.fileService.FindBoxByPath(c.Params("box"))
+	if err != nil || box == nil || box.Type != models.BoxTypeDebian {
+		return nil
+	}
+	return box
+}
+
+func debianError(c *fiber.Ctx, err error) error {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrPackageNotFound), errors.Is(err, services.ErrNoSigningKey):
+		status = http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidPackage):
+		status = http.StatusBadRequest
+	case errors.Is(err, services.ErrVersionExists):
+		status = http.StatusConflict
+	}
+	return c.Status(status).JSON(map[string]interface{}{"error": err.Error()})
+}
@@ -1,64 +1,218 @@
 package handlers
 
 import (
+	"Boxed/internal/dto"
 	"Boxed/internal/helpers"
+	"Boxed/internal/models"
 	"Boxed/internal/services"
+	"Boxed/internal/storage"
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
 	"fmt"
 	"github.com/gofiber/fiber/v2"
+	"io"
+	"mime/multipart"
 	"net/http"
+	"net/textproto"
 	"os"
-	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 )
 
+// maxFormValueSize limits the form fields read next to the file of a streamed upload
+const maxFormValueSize = 1 << 20
+
 type FileHandler struct {
-	service services.FileService
+	service        services.FileService
+	archiveService services.ArchiveService
+	remoteService  services.RemoteService
+	virtualService services.VirtualService
 }
 
-func NewFileHandler(service services.FileService) *FileHandler {
-	return &FileHandler{service: service}
+func NewFileHandler(
+	service services.FileService,
+	archiveService services.ArchiveService,
+	remoteService services.RemoteService,
+	virtualService services.VirtualService,
+) *FileHandler {
+	return &FileHandler{
+		service:        service,
+		archiveService: archiveService,
+		remoteService:  remoteService,
+		virtualService: virtualService,
+	}
 }
 
+// DeleteFile moves a file to the trash of its box, a folder needs ?force=true and takes everything
+// below it along
 func (h *FileHandler) DeleteFile(c *fiber.Ctx) error {
-	itemParam := c.Params("item")
+	itemParam := strings.Trim(c.Params("*"), "/")
 	boxParam := c.Params("box")
 
 	box, err := h.service.FindBoxByPath(boxParam)
-	if err != nil {
+	if err != nil || box == nil {
 		return fiber.NewError(fiber.StatusNotFound, "Box not found")
 	}
 	item, err := h.service.GetFileItem(box, itemParam)
 	if err != nil {
 		return fiber.NewError(fiber.StatusNotFound, "Item not found")
 	}
-	return h.service.DeleteItemOnDisk(*item, box)
+	if err := h.service.TrashItem(item, box, c.Query("force") == "true", c.IP()); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]interface{}{"error": err.Error()})
+	}
+	return c.SendStatus(http.StatusNoContent)
 }
 
 func (h *FileHandler) UploadFile(c *fiber.Ctx) error {
 	boxName := c.Params("box")
 	filePath := c.Params("*")
-	properties := c.FormValue("properties")
 
 	box, err := h.service.FindBoxByPath(boxName)
 	if err != nil || box == nil {
 		return c.Status(http.StatusBadRequest).JSON(map[string]interface{}{"error": "Box not found"})
 	}
+	// A virtual box stores what is written to it in its default member
+	if box.Type == models.BoxTypeVirtual {
+		if box, err = h.virtualService.WriteTarget(box, filePath); err != nil {
+			return resolveError(c, err)
+		}
+	}
+
+	flat := c.Query("flat") == "true"
+	explode := c.Query("explode") == "true"
+
+	if stream := c.Context().RequestBodyStream(); stream != nil {
+		return h.uploadStream(c, box, filePath, flat, explode, stream)
+	}
 
+	properties := c.FormValue("properties")
 	fileHeader, err := c.FormFile("file")
 	if err != nil {
 		return c.Status(http.StatusBadRequest).JSON(map[string]interface{}{"error": "Invalid file"})
 	}
 
-	flat := c.Query("flat") == "true"
+	if explode {
+		src, err := fileHeader.Open()
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(map[string]interface{}{"error": "Invalid file"})
+		}
+		defer src.Close()
+		archivePath, err := h.archiveService.StageArchive(src)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(map[string]interface{}{"error": err.Error()})
+		}
+		return h.explodeArchive(c, box, filePath, archivePath, properties)
+	}
 
 	item, err := h.service.CreateFileStructure(box, filePath, fileHeader, flat, properties)
 	if err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(map[string]interface{}{"error": err.Error()})
 	}
+	recordUploader(c, h.service, item)
+
+	return c.Status(http.StatusCreated).JSON(item)
+}
+
+// uploadStream reads the multipart body part by part, so the file goes straight into the hash storage
+// instead of being buffered by fasthttp first. Properties may be sent before or after the file.
+func (h *FileHandler) uploadStream(c *fiber.Ctx, box *models.Box, filePath string, flat bool, explode bool, stream io.Reader) error {
+	boundary := string(c.Request().Header.MultipartFormBoundary())
+	if boundary == "" {
+		return c.Status(http.StatusBadRequest).JSON(map[string]interface{}{"error": "Invalid file"})
+	}
+
+	reader := multipart.NewReader(stream, boundary)
+	properties := c.Query("properties")
+	var blob *services.StoredBlob
+	var archivePath string
+	defer func() {
+		if archivePath != "" {
+			_ = os.Remove(archivePath)
+		}
+	}()
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(map[string]interface{}{"error": "Invalid multipart body"})
+		}
+
+		switch part.FormName() {
+		case "file":
+			if blob != nil || archivePath != "" {
+				break
+			}
+			if explode {
+				archivePath, err = h.archiveService.StageArchive(part)
+			} else {
+				blob, err = h.service.StoreBlob(box, filePath, part)
+			}
+			if err != nil {
+				return resolveError(c, err)
+			}
+		case "properties":
+			value, err := io.ReadAll(io.LimitReader(part, maxFormValueSize))
+			if err != nil {
+				return c.Status(http.StatusBadRequest).JSON(map[string]interface{}{"error": "Invalid multipart body"})
+			}
+			properties = string(value)
+		}
+		_ = part.Close()
+	}
+	if archivePath != "" {
+		return h.explodeArchive(c, box, filePath, archivePath, properties)
+	}
+	if blob == nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]interface{}{"error": "Invalid file"})
+	}
 
+	item, err := h.service.CreateFileFromBlob(box, filePath, blob, flat, properties)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]interface{}{"error": err.Error()})
+	}
+	recordUploader(c, h.service, item)
 	return c.Status(http.StatusCreated).JSON(item)
 }
 
+// explodeArchive extracts a staged archive below targetPath and answers with the summary of the extracted items
+func (h *FileHandler) explodeArchive(c *fiber.Ctx, box *models.Box, targetPath string, archivePath string, properties string) error {
+	defer os.Remove(archivePath)
+	summary, err := h.archiveService.ExplodeArchive(box, targetPath, archivePath, properties)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, services.ErrArchiveRejected):
+			status = http.StatusUnprocessableEntity
+		case errors.Is(err, services.ErrUnsupportedArchive), errors.Is(err, zip.ErrFormat),
+			errors.Is(err, gzip.ErrHeader), errors.Is(err, tar.ErrHeader), errors.Is(err, io.ErrUnexpectedEOF):
+			status = http.StatusBadRequest
+		}
+		return c.Status(status).JSON(map[string]interface{}{"error": err.Error(), "summary": summary})
+	}
+	return c.Status(http.StatusCreated).JSON(summary)
+}
+
+// recordUploader notes the client address as the uploader of the stored file, Boxed has no users of its own
+func recordUploader(c *fiber.Ctx, fileService services.FileService, item *dto.ItemGetDTO) {
+	if err := fileService.RecordUploader(item.ID, c.IP()); err == nil {
+		item.Uploader = c.IP()
+	}
+}
+
+// requestBody returns the request body as a stream when fasthttp streams it, the buffered body otherwise
+func requestBody(c *fiber.Ctx) io.Reader {
+	if stream := c.Context().RequestBodyStream(); stream != nil {
+		return stream
+	}
+	return bytes.NewReader(c.Body())
+}
+
 func (h *FileHandler) ListFileOrFolder(c *fiber.Ctx) error {
 	boxName := c.Params("box")
 	itemPath := c.Params("*")
@@ -75,6 +229,13 @@ func (h *FileHandler) ListFileOrFolder(c *fiber.Ctx) error {
 		if err != nil {
 			return c.Status(http.StatusBadRequest).JSON(map[string]interface{}{"error": "Box not found"})
 		}
+		if box != nil && box.Type == models.BoxTypeVirtual {
+			_, item, err := h.virtualService.Find(box, itemPath)
+			if err != nil {
+				return resolveError(c, err)
+			}
+			return c.Status(http.StatusOK).JSON(item.Properties)
+		}
 		item, err := h.service.GetFileItem(box, itemPath)
 		if err != nil {
 			return c.Status(http.StatusInternalServerError).JSON(map[string]interface{}{"error": err.Error()})
@@ -82,6 +243,31 @@ func (h *FileHandler) ListFileOrFolder(c *fiber.Ctx) error {
 		return c.Status(http.StatusOK).JSON(item.Properties)
 	}
 
+	// A file a remote box has not cached yet is fetched from its upstream
+	if box, err := h.service.FindBoxByPath(boxName); err == nil && box != nil && box.Type == models.BoxTypeRemote && itemPath != "" {
+		if cached, _ := h.service.GetFileItem(box, itemPath); cached == nil {
+			return h.downloadRemote(c, box, itemPath)
+		}
+	}
+	// A virtual box lists the folders of all its members merged and shows the file of the first member having it
+	if box, err := h.service.FindBoxByPath(boxName); err == nil && box != nil && box.Type == models.BoxTypeVirtual {
+		folder, err := h.virtualService.List(box, itemPath)
+		if err == nil {
+			return c.Status(http.StatusOK).JSON(folder)
+		}
+		if !errors.Is(err, services.ErrVirtualNotFound) || itemPath == "" {
+			return resolveError(c, err)
+		}
+		_, item, download, err := h.virtualService.Open(box, itemPath)
+		if err != nil {
+			return resolveError(c, err)
+		}
+		if download != nil {
+			return h.sendDownload(c, itemPath, download)
+		}
+		return c.Status(http.StatusOK).JSON(item)
+	}
+
 	item, err := h.service.ListFileOrFolder(boxName, itemPath)
 	if err != nil {
 		return c.Status(http.StatusNotFound).JSON(map[string]interface{}{"error": err.Error()})
@@ -103,33 +289,249 @@ func (h *FileHandler) DownloadFile(c *fiber.Ctx) error {
 		return c.Status(http.StatusBadRequest).JSON(map[string]interface{}{"error": "Box not found"})
 	}
 
+	if box.Type == models.BoxTypeRemote && filePath != "" {
+		return h.downloadRemote(c, box, filePath)
+	}
+	if box.Type == models.BoxTypeVirtual && filePath != "" {
+		member, item, download, err := h.virtualService.Open(box, filePath)
+		if err != nil {
+			return resolveError(c, err)
+		}
+		return h.sendResolved(c, member, filePath, item, download)
+	}
 	item, err := h.service.GetFileItem(box, filePath)
 	if err != nil {
 		return c.Status(http.StatusNotFound).JSON(map[string]interface{}{"error": err.Error()})
 	}
 
 	if item.Type == "folder" {
-		return c.Status(http.StatusNotFound).JSON(map[string]interface{}{"error": "Not a file"})
+		return h.downloadFolder(c, box, item)
+	}
+	return sendBlob(c, h.service, box, item)
+}
+
+// downloadRemote serves a file of a remote box, from the cache when it is fresh and from the upstream otherwise
+func (h *FileHandler) downloadRemote(c *fiber.Ctx, box *models.Box, filePath string) error {
+	item, download, err := h.remoteService.Open(box, filePath)
+	if err != nil {
+		return resolveError(c, err)
+	}
+	return h.sendResolved(c, box, filePath, item, download)
+}
+
+// sendResolved answers with the item a remote or virtual box resolved filePath to, or with the
+// download when the file comes from an upstream
+func (h *FileHandler) sendResolved(c *fiber.Ctx, box *models.Box, filePath string, item *models.Item, download *services.RemoteDownload) error {
+	if download != nil {
+		return h.sendDownload(c, filePath, download)
+	}
+	if item.Type == "folder" {
+		return h.downloadFolder(c, box, item)
+	}
+	return sendBlob(c, h.service, box, item)
+}
+
+// sendDownload streams a file coming from an upstream, it is cached once it was read to the end
+func (h *FileHandler) sendDownload(c *fiber.Ctx, filePath string, download *services.RemoteDownload) error {
+	if download.ContentType != "" {
+		c.Set(fiber.HeaderContentType, download.ContentType)
+	}
+	if download.LastModified != "" {
+		c.Set(fiber.HeaderLastModified, download.LastModified)
+	}
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf("attachment; filename=\"%s\"", filePath[strings.LastIndex(filePath, "/")+1:]))
+	if c.Method() == fiber.MethodHead {
+		// Nobody reads the body, so the file is not cached
+		_ = download.Body.Close()
+		if download.Size >= 0 {
+			c.Response().Header.SetContentLength(int(download.Size))
+		}
+		return nil
+	}
+	return c.SendStream(download.Body, int(download.Size))
+}
+
+// resolveError answers for a path a remote or virtual box could not resolve
+func resolveError(c *fiber.Ctx, err error) error {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrRemoteNotFound), errors.Is(err, services.ErrVirtualNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, services.ErrUpstreamUnavailable):
+		status = http.StatusBadGateway
+	case errors.Is(err, services.ErrVirtualNotWritable):
+		status = http.StatusForbidden
+	case errors.Is(err, services.ErrKeyUnavailable):
+		status = http.StatusServiceUnavailable
+	}
+	return c.Status(status).JSON(map[string]interface{}{"error": err.Error()})
+}
+
+// sendBlob answers with the content of a file item. It handles HEAD, conditional and range requests
+// and sets the checksum headers.
+func sendBlob(c *fiber.Ctx, fileService services.FileService, box *models.Box, item *models.Item) error {
+	if item.Quarantined {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]interface{}{
+			"error": "File content failed its integrity check and was quarantined, upload the file again",
+		})
+	}
+	file, err := fileService.OpenBlob(box, item.SHA256)
+	if err != nil {
+		if errors.Is(err, storage.ErrBlobNotFound) {
+			return c.Status(http.StatusNotFound).JSON(map[string]interface{}{"error": "File content not found"})
+		}
+		return resolveError(c, err)
+	}
+	size := file.Size()
+
+	// The content is addressed by its hash, which makes the SHA256 a strong validator
+	etag := `"` + item.SHA256 + `"`
+	lastModified := item.UpdatedAt.UTC().Truncate(time.Second)
+	c.Set(fiber.HeaderETag, etag)
+	c.Set(fiber.HeaderLastModified, lastModified.Format(http.TimeFormat))
+	c.Set(fiber.HeaderAcceptRanges, "bytes")
+	c.Set("X-Checksum-Sha256", item.SHA256)
+	c.Set("X-Checksum-Sha512", item.SHA512)
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf("attachment; filename=\"%s\"", item.Name))
+
+	if notModified(c, etag, lastModified) {
+		_ = file.Close()
+		c.Status(http.StatusNotModified)
+		return nil
+	}
+
+	var ranges []helpers.ByteRange
+	if rangeHeader := c.Get(fiber.HeaderRange); rangeHeader != "" && rangeApplies(c, etag, lastModified) {
+		ranges, err = helpers.ParseRange(rangeHeader, size)
+		if err != nil {
+			_ = file.Close()
+			c.Set(fiber.HeaderContentRange, fmt.Sprintf("bytes */%d", size))
+			return c.Status(http.StatusRequestedRangeNotSatisfiable).JSON(map[string]interface{}{"error": err.Error()})
+		}
 	}
 
-	// For hash-based storage, construct the path based on the hash
-	firstHashPrefix := item.SHA256[:2]
-	secondHashPrefix := item.SHA256[2:4]
-	storageBasePath := h.service.GetStoragePath()
-	hashFilePath := filepath.Join(storageBasePath, firstHashPrefix, secondHashPrefix, item.SHA256)
+	switch {
+	case c.Method() == fiber.MethodHead:
+		_ = file.Close()
+		c.Set(fiber.HeaderContentType, fiber.MIMEOctetStream)
+		c.Response().Header.SetContentLength(int(size))
+		c.Status(http.StatusOK)
+		return nil
+	case len(ranges) == 1:
+		c.Set(fiber.HeaderContentType, fiber.MIMEOctetStream)
+		c.Set(fiber.HeaderContentRange, ranges[0].ContentRange(size))
+		// Seeking keeps a remote blob to a single request for the range
+		if _, err := file.Seek(ranges[0].Start, io.SeekStart); err != nil {
+			_ = file.Close()
+			return c.Status(http.StatusInternalServerError).JSON(map[string]interface{}{"error": err.Error()})
+		}
+		section := io.LimitReader(file, ranges[0].Length)
+		return c.Status(http.StatusPartialContent).SendStream(readCloser{section, file}, int(ranges[0].Length))
+	case len(ranges) > 1:
+		return sendRanges(c, file, ranges, size)
+	default:
+		c.Set(fiber.HeaderContentType, fiber.MIMEOctetStream)
+		return c.SendStream(file, int(size))
+	}
+}
 
-	// Check if the file exists
-	if _, err := os.Stat(hashFilePath); os.IsNotExist(err) {
-		return c.Status(http.StatusNotFound).JSON(map[string]interface{}{"error": "File content not found"})
+// downloadFolder streams the files below a folder as an archive built on the fly
+func (h *FileHandler) downloadFolder(c *fiber.Ctx, box *models.Box, folder *models.Item) error {
+	format, err := services.NormalizeArchiveFormat(c.Query("format"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]interface{}{"error": err.Error()})
+	}
+	depth, err := strconv.Atoi(c.Query("depth", "0"))
+	if err != nil || depth < 0 {
+		return c.Status(http.StatusBadRequest).JSON(map[string]interface{}{"error": "Invalid depth"})
 	}
 
-	mimeType := fiber.MIMEOctetStream
+	entries, err := h.archiveService.ListFolderEntries(box, folder, services.ArchiveOptions{
+		Include: helpers.SplitGlobs(c.Query("include")),
+		Exclude: helpers.SplitGlobs(c.Query("exclude")),
+		Depth:   depth,
+	})
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]interface{}{"error": err.Error()})
+	}
 
-	// Set the correct content type for the download
-	c.Set("Content-Type", mimeType)
-	c.Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", item.Name))
+	contentType := "application/zip"
+	if format == services.ArchiveFormatTarGz {
+		contentType = "application/gzip"
+	}
+	c.Set(fiber.HeaderContentType, contentType)
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf("attachment; filename=\"%s.%s\"", folder.Name, format))
+	if c.Method() == fiber.MethodHead {
+		c.Status(http.StatusOK)
+		return nil
+	}
+
+	// The archive is written while it is sent, a failure midway truncates the response
+	pipeReader, pipeWriter := io.Pipe()
+	go func() {
+		_ = pipeWriter.CloseWithError(h.archiveService.WriteArchive(pipeWriter, box, format, entries))
+	}()
+	return c.Status(http.StatusOK).SendStream(pipeReader)
+}
+
+// notModified evaluates If-None-Match, or If-Modified-Since when no entity tag was sent
+func notModified(c *fiber.Ctx, etag string, lastModified time.Time) bool {
+	if ifNoneMatch := c.Get(fiber.HeaderIfNoneMatch); ifNoneMatch != "" {
+		return helpers.MatchETag(ifNoneMatch, etag)
+	}
+	since, err := http.ParseTime(c.Get(fiber.HeaderIfModifiedSince))
+	return err == nil && !lastModified.After(since)
+}
+
+// rangeApplies evaluates If-Range, a range is only served while the client's copy is still current
+func rangeApplies(c *fiber.Ctx, etag string, lastModified time.Time) bool {
+	ifRange := c.Get(fiber.HeaderIfRange)
+	if ifRange == "" {
+		return true
+	}
+	if strings.HasPrefix(ifRange, `"`) {
+		return ifRange == etag
+	}
+	date, err := http.ParseTime(ifRange)
+	return err == nil && date.Equal(lastModified)
+}
+
+// sendRanges streams several ranges of the file as multipart/byteranges
+func sendRanges(c *fiber.Ctx, file storage.Blob, ranges []helpers.ByteRange, size int64) error {
+	pipeReader, pipeWriter := io.Pipe()
+	writer := multipart.NewWriter(pipeWriter)
+	c.Set(fiber.HeaderContentType, "multipart/byteranges; boundary="+writer.Boundary())
+
+	go func() {
+		defer file.Close()
+		for _, byteRange := range ranges {
+			part, err := writer.CreatePart(textproto.MIMEHeader{
+				fiber.HeaderContentType:  {fiber.MIMEOctetStream},
+				fiber.HeaderContentRange: {byteRange.ContentRange(size)},
+			})
+			if err != nil {
+				_ = pipeWriter.CloseWithError(err)
+				return
+			}
+			if _, err := file.Seek(byteRange.Start, io.SeekStart); err != nil {
+				_ = pipeWriter.CloseWithError(err)
+				return
+			}
+			if _, err := io.Copy(part, io.LimitReader(file, byteRange.Length)); err != nil {
+				_ = pipeWriter.CloseWithError(err)
+				return
+			}
+		}
+		_ = pipeWriter.CloseWithError(writer.Close())
+	}()
+
+	return c.Status(http.StatusPartialContent).SendStream(pipeReader)
+}
 
-	return c.SendFile(hashFilePath)
+// readCloser closes the underlying blob of a limited reader once the response is sent
+type readCloser struct {
+	io.Reader
+	io.Closer
 }
 
 func (h *FileHandler) UpdateItem(c *fiber.Ctx) error {
@@ -1,16 +1,15 @@
 package handlers
 
 import (
-	"Boxed/internal/config"
 	"Boxed/internal/dto"
 	"Boxed/internal/models"
 	"Boxed/internal/services"
+	"Boxed/internal/storage"
 	"bytes"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"github.com/sirupsen/logrus"
 	"io"
 	"math/rand"
 	"mime/multipart"
@@ -18,7 +17,6 @@ import (
 	"net/http/httptest"
 	"os"
 	"path/filepath"
-	"strconv"
 	"strings"
 	"sync"
 	"testing"
@@ -27,6 +25,7 @@ import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 // Enhanced MockFileService for hash-based storage tests
@@ -37,15 +36,25 @@ type MockHashFileService struct {
 	UploadedObjects map[string]bool // Track uploaded object hashes
 }
 
+// uploadedFile hands the file header to the mock, which formats the arguments of every call it matches.
+// Formatting the header itself would print its whole content.
+type uploadedFile struct {
+	*multipart.FileHeader
+}
+
+func (f uploadedFile) String() string {
+	return f.Filename
+}
+
 func (m *MockHashFileService) CreateFileStructure(box *models.Box, filePath string, fileHeader *multipart.FileHeader, flat bool, properties string) (*dto.ItemGetDTO, error) {
-	args := m.Called(box, filePath, fileHeader, flat, properties)
+	args := m.Called(box, filePath, uploadedFile{fileHeader}, flat, properties)
 	if dto, ok := args.Get(0).(*dto.ItemGetDTO); ok {
 		return dto, args.Error(1)
 	}
 	return nil, args.Error(1)
 }
 
-func (m *MockBoxService) FindBoxByPath(boxPath string) (*models.Box, error) {
+func (m *MockHashFileService) FindBoxByPath(boxPath string) (*models.Box, error) {
 	args := m.Called(boxPath)
 	if box, ok := args.Get(0).(*models.Box); ok {
 		return box, args.Error(1)
@@ -87,9 +96,125 @@ func (m *MockHashFileService) GetItemProperties(itemPath string, boxId uint) (js
 	return nil, args.Error(1)
 }
 
+// OpenBlob serves the content from the objects directory the tests lay out
+func (m *MockHashFileService) OpenBlob(box *models.Box, sha256sum string) (storage.Blob, error) {
+	args := m.Called(box, sha256sum)
+	if err := args.Error(0); err != nil {
+		return nil, err
+	}
+	file, err := os.Open(filepath.Join(m.ObjectsPath, sha256sum[:2], sha256sum))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", storage.ErrBlobNotFound, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return fileBlob{File: file, size: info.Size()}, nil
+}
+
+type fileBlob struct {
+	*os.File
+	size int64
+}
+
+func (b fileBlob) Size() int64 {
+	return b.size
+}
+
+func (m *MockHashFileService) TrashItem(item *models.Item, box *models.Box, force bool, deletedBy string) error {
+	args := m.Called(item, box, force, deletedBy)
+	return args.Error(0)
+}
+
+func (m *MockHashFileService) RestoreItem(item *models.Item, box *models.Box) error {
+	args := m.Called(item, box)
+	return args.Error(0)
+}
+
+func (m *MockHashFileService) UpdateItem(item *models.Item) (*dto.ItemGetDTO, error) {
+	args := m.Called(item)
+	if itemDTO, ok := args.Get(0).(*dto.ItemGetDTO); ok {
+		return itemDTO, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockHashFileService) CreateFileFromPath(box *models.Box, filePath string, localPath string, flat bool, properties string) (*dto.ItemGetDTO, error) {
+	args := m.Called(box, filePath, localPath, flat, properties)
+	if itemDTO, ok := args.Get(0).(*dto.ItemGetDTO); ok {
+		return itemDTO, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockHashFileService) EnsureBlob(source *models.Box, destination *models.Box, sha256sum string) error {
+	args := m.Called(source, destination, sha256sum)
+	return args.Error(0)
+}
+
+func (m *MockHashFileService) StoreBlob(box *models.Box, name string, reader io.Reader) (*services.StoredBlob, error) {
+	args := m.Called(box, name, reader)
+	if blob, ok := args.Get(0).(*services.StoredBlob); ok {
+		return blob, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockHashFileService) CreateFileFromBlob(box *models.Box, filePath string, blob *services.StoredBlob, flat bool, properties string) (*dto.ItemGetDTO, error) {
+	args := m.Called(box, filePath, blob, flat, properties)
+	if itemDTO, ok := args.Get(0).(*dto.ItemGetDTO); ok {
+		return itemDTO, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockHashFileService) CreateFileFromReader(box *models.Box, filePath string, reader io.Reader, flat bool, properties string) (*dto.ItemGetDTO, error) {
+	args := m.Called(box, filePath, reader, flat, properties)
+	if itemDTO, ok := args.Get(0).(*dto.ItemGetDTO); ok {
+		return itemDTO, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockHashFileService) CreateFileFromVersion(box *models.Box, filePath string, version *models.ItemVersion) (*dto.ItemGetDTO, error) {
+	args := m.Called(box, filePath, version)
+	if itemDTO, ok := args.Get(0).(*dto.ItemGetDTO); ok {
+		return itemDTO, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockHashFileService) ReleaseBlob(box *models.Box, sha256sum string) error {
+	args := m.Called(box, sha256sum)
+	return args.Error(0)
+}
+
+func (m *MockHashFileService) RecordUploader(itemID uint, uploader string) error {
+	args := m.Called(itemID, uploader)
+	return args.Error(0)
+}
+
+func (m *MockHashFileService) AddFileListener(listener services.FileListener) {
+	m.Called(listener)
+}
+
+// newMockHashFileService returns a mock that lets uploads record their uploader
+func newMockHashFileService(storagePath string, objectsPath string) *MockHashFileService {
+	mockService := &MockHashFileService{
+		StoragePath:     storagePath,
+		ObjectsPath:     objectsPath,
+		UploadedObjects: make(map[string]bool),
+	}
+	mockService.On("RecordUploader", mock.Anything, mock.Anything).Return(nil).Maybe()
+	return mockService
+}
+
 // Setup a test environment for hash-based storage
 func setupHashTestEnv(t *testing.T) (*fiber.App, *MockHashFileService, *FileHandler, string) {
-	app := fiber.New()
+	// The bodies are buffered, so uploads go through CreateFileStructure, large enough for the large file tests
+	app := fiber.New(fiber.Config{BodyLimit: 256 * 1024 * 1024})
 
 	// Create temporary directories
 	tempDir := t.TempDir()
@@ -97,12 +222,8 @@ func setupHashTestEnv(t *testing.T) (*fiber.App, *MockHashFileService, *FileHand
 	err := os.MkdirAll(objectsDir, 0755)
 	assert.NoError(t, err)
 
-	mockService := &MockHashFileService{
-		StoragePath:     tempDir,
-		ObjectsPath:     objectsDir,
-		UploadedObjects: make(map[string]bool),
-	}
-	handler := NewFileHandler(mockService)
+	mockService := newMockHashFileService(tempDir, objectsDir)
+	handler := NewFileHandler(mockService, nil, nil, nil)
 
 	return app, mockService, handler, tempDir
 }
@@ -197,12 +318,12 @@ func TestHashBasedUploadFile_Success(t *testing.T) {
 	mockService.On("CreateFileStructure",
 		box,
 		filePath,
-		mock.AnythingOfType("*multipart.FileHeader"),
+		mock.AnythingOfType("handlers.uploadedFile"),
 		false,
 		properties,
 	).Run(func(args mock.Arguments) {
 		// Get the file header from the arguments
-		fileHeader := args.Get(2).(*multipart.FileHeader)
+		fileHeader := args.Get(2).(uploadedFile).FileHeader
 
 		// Open the uploaded file
 		src, err := fileHeader.Open()
@@ -242,7 +363,7 @@ func TestHashBasedUploadFile_Success(t *testing.T) {
 	req.Header.Set("Content-Type", contentType)
 
 	// Test the request
-	resp, err := app.Test(req)
+	resp, err := app.Test(req, -1)
 	assert.NoError(t, err)
 	assert.Equal(t, http.StatusCreated, resp.StatusCode)
 
@@ -292,7 +413,7 @@ func TestHashBasedUploadFile_Deduplication(t *testing.T) {
 	mockService.On("CreateFileStructure",
 		box,
 		filePath1,
-		mock.AnythingOfType("*multipart.FileHeader"),
+		mock.AnythingOfType("handlers.uploadedFile"),
 		false,
 		properties,
 	).Return(&dto.ItemGetDTO{
@@ -308,7 +429,7 @@ func TestHashBasedUploadFile_Deduplication(t *testing.T) {
 	mockService.On("CreateFileStructure",
 		box,
 		filePath2,
-		mock.AnythingOfType("*multipart.FileHeader"),
+		mock.AnythingOfType("handlers.uploadedFile"),
 		false,
 		properties,
 	).Return(&dto.ItemGetDTO{
@@ -324,7 +445,7 @@ func TestHashBasedUploadFile_Deduplication(t *testing.T) {
 	body1, contentType1 := createHashMultipartFormData(t, "file", "test1.txt", fileTempPath, properties)
 	req1 := httptest.NewRequest(http.MethodPost, "/upload/"+boxName+"/"+filePath1, body1)
 	req1.Header.Set("Content-Type", contentType1)
-	resp1, err := app.Test(req1)
+	resp1, err := app.Test(req1, -1)
 	assert.NoError(t, err)
 	assert.Equal(t, http.StatusCreated, resp1.StatusCode)
 
@@ -332,7 +453,7 @@ func TestHashBasedUploadFile_Deduplication(t *testing.T) {
 	body2, contentType2 := createHashMultipartFormData(t, "file", "test2.txt", fileTempPath, properties)
 	req2 := httptest.NewRequest(http.MethodPost, "/upload/"+boxName+"/"+filePath2, body2)
 	req2.Header.Set("Content-Type", contentType2)
-	resp2, err := app.Test(req2)
+	resp2, err := app.Test(req2, -1)
 	assert.NoError(t, err)
 	assert.Equal(t, http.StatusCreated, resp2.StatusCode)
 
@@ -392,11 +513,11 @@ func TestHashBasedDownloadFile(t *testing.T) {
 	// Setup mock expectations
 	mockService.On("FindBoxByPath", boxName).Return(box, nil).Once()
 	mockService.On("GetFileItem", box, filePath).Return(item, nil).Once()
-	mockService.On("GetStoragePath").Return(mockService.StoragePath).Once()
+	mockService.On("OpenBlob", box, mock.Anything).Return(nil).Once()
 
 	// Create the request
 	req := httptest.NewRequest(http.MethodGet, "/download/"+boxName+"/"+filePath, nil)
-	resp, err := app.Test(req)
+	resp, err := app.Test(req, -1)
 
 	// Verify the response
 	assert.NoError(t, err)
@@ -472,7 +593,7 @@ func TestHashBasedDeleteFile(t *testing.T) {
 
 	// Create the request
 	req := httptest.NewRequest(http.MethodDelete, "/files/"+boxName+"/"+filePath, nil)
-	resp, err := app.Test(req)
+	resp, err := app.Test(req, -1)
 
 	// Verify the response
 	assert.NoError(t, err)
@@ -546,7 +667,7 @@ func TestHashBasedDeleteFileWithReferences(t *testing.T) {
 
 	// Create the request
 	req := httptest.NewRequest(http.MethodDelete, "/files/"+boxName+"/"+filePath, nil)
-	resp, err := app.Test(req)
+	resp, err := app.Test(req, -1)
 
 	// Verify the response
 	assert.NoError(t, err)
@@ -612,7 +733,7 @@ func TestHashBasedPerformanceWithManyFiles(t *testing.T) {
 		mockService.On("CreateFileStructure",
 			box,
 			testFiles[i].path,
-			mock.AnythingOfType("*multipart.FileHeader"),
+			mock.AnythingOfType("handlers.uploadedFile"),
 			false,
 			"key=value",
 		).Return(&dto.ItemGetDTO{
@@ -634,8 +755,8 @@ func TestHashBasedPerformanceWithManyFiles(t *testing.T) {
 			Size:      int64(len(testFiles[i].content)),
 		}, nil).Once()
 
-		// Mock storage path
-		mockService.On("GetStoragePath").Return(mockService.StoragePath).Once()
+		// Mock opening the content
+		mockService.On("OpenBlob", box, mock.Anything).Return(nil).Once()
 	}
 
 	// Measure upload performance
@@ -646,7 +767,7 @@ func TestHashBasedPerformanceWithManyFiles(t *testing.T) {
 		req := httptest.NewRequest(http.MethodPost, "/upload/"+boxName+"/"+testFiles[i].path, body)
 		req.Header.Set("Content-Type", contentType)
 
-		resp, err := app.Test(req)
+		resp, err := app.Test(req, -1)
 		assert.NoError(t, err)
 		assert.Equal(t, http.StatusCreated, resp.StatusCode)
 
@@ -666,7 +787,7 @@ func TestHashBasedPerformanceWithManyFiles(t *testing.T) {
 
 	for i := 0; i < fileCount; i++ {
 		req := httptest.NewRequest(http.MethodGet, "/download/"+boxName+"/"+testFiles[i].path, nil)
-		resp, err := app.Test(req)
+		resp, err := app.Test(req, -1)
 
 		assert.NoError(t, err)
 		assert.Equal(t, http.StatusOK, resp.StatusCode)
@@ -699,12 +820,8 @@ func BenchmarkHashBasedUpload(b *testing.B) {
 		b.Fatal(err)
 	}
 
-	mockService := &MockHashFileService{
-		StoragePath:     tempDir,
-		ObjectsPath:     objectsDir,
-		UploadedObjects: make(map[string]bool),
-	}
-	handler := NewFileHandler(mockService)
+	mockService := newMockHashFileService(tempDir, objectsDir)
+	handler := NewFileHandler(mockService, nil, nil, nil)
 
 	app.Post("/upload/:box/*", handler.UploadFile)
 
@@ -723,7 +840,7 @@ func BenchmarkHashBasedUpload(b *testing.B) {
 	mockService.On("CreateFileStructure",
 		box,
 		mock.Anything,
-		mock.AnythingOfType("*multipart.FileHeader"),
+		mock.AnythingOfType("handlers.uploadedFile"),
 		false,
 		"",
 	).Return(&dto.ItemGetDTO{
@@ -749,7 +866,7 @@ func BenchmarkHashBasedUpload(b *testing.B) {
 		req.Header.Set("Content-Type", contentType)
 
 		// Test the request (ignore response for benchmark)
-		app.Test(req)
+		app.Test(req, -1)
 	}
 }
 
@@ -768,12 +885,8 @@ func BenchmarkHashBasedDownload(b *testing.B) {
 		b.Fatal(err)
 	}
 
-	mockService := &MockHashFileService{
-		StoragePath:     tempDir,
-		ObjectsPath:     objectsDir,
-		UploadedObjects: make(map[string]bool),
-	}
-	handler := NewFileHandler(mockService)
+	mockService := newMockHashFileService(tempDir, objectsDir)
+	handler := NewFileHandler(mockService, nil, nil, nil)
 
 	app.Get("/download/:box/*", handler.DownloadFile)
 
@@ -813,7 +926,7 @@ func BenchmarkHashBasedDownload(b *testing.B) {
 	// Setup mocks (using runtime counting for benchmark)
 	mockService.On("FindBoxByPath", "testbox").Return(box, nil)
 	mockService.On("GetFileItem", box, mock.Anything).Return(item, nil)
-	mockService.On("GetStoragePath").Return(mockService.StoragePath)
+	mockService.On("OpenBlob", box, mock.Anything).Return(nil)
 
 	b.ResetTimer()
 
@@ -823,7 +936,7 @@ func BenchmarkHashBasedDownload(b *testing.B) {
 
 		// Create the request
 		req := httptest.NewRequest(http.MethodGet, "/download/testbox/"+filePath, nil)
-		resp, _ := app.Test(req)
+		resp, _ := app.Test(req, -1)
 
 		// Read the full response to measure complete download
 		io.Copy(io.Discard, resp.Body)
@@ -831,124 +944,6 @@ func BenchmarkHashBasedDownload(b *testing.B) {
 	}
 }
 
-func TestHashBasedDeleteItemOnDisk(t *testing.T) {
-	_, mockService, _, _ := setupHashTestEnv(t)
-
-	// Generate files with different content
-	_, hash1, content1 := generateRandomFile(t, 1024*64)
-	_, hash2, content2 := generateRandomFile(t, 1024*64)
-
-	// Setup hash-based storage with both files
-	setupHashFile(t, mockService, hash1, content1)
-	setupHashFile(t, mockService, hash2, content2)
-
-	// Setup box
-	box := &models.Box{
-		BaseModel: models.BaseModel{ID: 1},
-		Name:      "testbox",
-	}
-
-	// Test cases for different deletion scenarios
-	tests := []struct {
-		name            string
-		item            models.Item
-		otherReferences bool
-		checkExistence  bool
-	}{
-		{
-			name: "Delete file with no other references",
-			item: models.Item{
-				BaseModel: models.BaseModel{ID: 1},
-				Name:      "unique.txt",
-				Path:      "folder/unique.txt",
-				Type:      "file",
-				SHA256:    hash1,
-				Size:      int64(len(content1)),
-			},
-			otherReferences: false,
-			checkExistence:  false, // File should be deleted
-		},
-		{
-			name: "Delete file with other references",
-			item: models.Item{
-				BaseModel: models.BaseModel{ID: 2},
-				Name:      "duplicate.txt",
-				Path:      "folder/duplicate.txt",
-				Type:      "file",
-				SHA256:    hash2,
-				Size:      int64(len(content2)),
-			},
-			otherReferences: true,
-			checkExistence:  true, // File should still exist
-		},
-		{
-			name: "Delete folder",
-			item: models.Item{
-				BaseModel: models.BaseModel{ID: 3},
-				Name:      "testfolder",
-				Path:      "testfolder",
-				Type:      "folder",
-			},
-			otherReferences: false,
-			checkExistence:  false, // No physical folder in hash-based storage
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			// Mock the service methods
-			mockService.On("HardDelete", &tt.item).Return(nil).Once()
-
-			if tt.item.Type == "file" && !tt.otherReferences {
-				// If no other references, the file should be deleted
-				mockService.On("ItemsSearch",
-					"sha256 eq \""+tt.item.SHA256+"\"",
-					mock.Anything, mock.Anything, mock.Anything,
-				).Return([]models.Item{}, nil).Once()
-			} else if tt.item.Type == "file" && tt.otherReferences {
-				// If other references exist, the file should not be deleted
-				mockService.On("ItemsSearch",
-					"sha256 eq \""+tt.item.SHA256+"\"",
-					mock.Anything, mock.Anything, mock.Anything,
-				).Return([]models.Item{
-					{ID: 999, SHA256: tt.item.SHA256}, // Another item with same hash
-				}, nil).Once()
-			}
-
-			// Create a file handler instance with our mocked service
-			handler := &services.FileServiceImpl{
-				itemService: mockService,
-				boxService:  mockService,
-				logService:  &services.LogService{Log: &logrus.Logger{}},
-				configuration: config.Configuration{
-					Storage: config.StorageConfig{
-						Path: mockService.StoragePath,
-					},
-				},
-			}
-
-			// Execute the delete operation
-			err := handler.DeleteItemOnDisk(tt.item)
-			assert.NoError(t, err)
-
-			// Verify file existence based on test case
-			if tt.item.Type == "file" {
-				hashPath := tt.item.SHA256[:2] + "/" + tt.item.SHA256
-				fullPath := filepath.Join(mockService.ObjectsPath, hashPath)
-
-				_, err := os.Stat(fullPath)
-				if tt.checkExistence {
-					assert.NoError(t, err, "File should still exist")
-				} else {
-					assert.True(t, os.IsNotExist(err), "File should not exist")
-				}
-			}
-
-			mockService.AssertExpectations(t)
-		})
-	}
-}
-
 func TestLargeFileTransfers(t *testing.T) {
 	if testing.Short() {
 		t.Skip("Skipping large file test in short mode")
@@ -979,12 +974,12 @@ func TestLargeFileTransfers(t *testing.T) {
 	mockService.On("CreateFileStructure",
 		box,
 		filePath,
-		mock.AnythingOfType("*multipart.FileHeader"),
+		mock.AnythingOfType("handlers.uploadedFile"),
 		false,
 		"",
 	).Run(func(args mock.Arguments) {
 		// Get the file header and save it to hash storage
-		fileHeader := args.Get(2).(*multipart.FileHeader)
+		fileHeader := args.Get(2).(uploadedFile).FileHeader
 		src, err := fileHeader.Open()
 		assert.NoError(t, err)
 		defer src.Close()
@@ -1025,7 +1020,7 @@ func TestLargeFileTransfers(t *testing.T) {
 		SHA256:    fileHash,
 		Size:      int64(fileSizeBytes),
 	}, nil).Once()
-	mockService.On("GetStoragePath").Return(mockService.StoragePath).Once()
+	mockService.On("OpenBlob", box, mock.Anything).Return(nil).Once()
 
 	// 1. Test uploading the large file
 	t.Logf("Testing upload of %dMB file...", fileSizeMB)
@@ -1109,7 +1104,7 @@ func TestConcurrentHashFileAccess(t *testing.T) {
 		mockService.On("CreateFileStructure",
 			box,
 			filePath,
-			mock.AnythingOfType("*multipart.FileHeader"),
+			mock.AnythingOfType("handlers.uploadedFile"),
 			false,
 			"",
 		).Return(&dto.ItemGetDTO{
@@ -1132,7 +1127,7 @@ func TestConcurrentHashFileAccess(t *testing.T) {
 		}, nil).Once()
 
 		// Setup mock for getting storage path
-		mockService.On("GetStoragePath").Return(mockService.StoragePath).Once()
+		mockService.On("OpenBlob", box, mock.Anything).Return(nil).Once()
 	}
 
 	// Run concurrent uploads
@@ -1154,7 +1149,7 @@ func TestConcurrentHashFileAccess(t *testing.T) {
 			req.Header.Set("Content-Type", contentType)
 
 			// Test the request
-			resp, err := app.Test(req)
+			resp, err := app.Test(req, -1)
 			assert.NoError(t, err)
 			assert.Equal(t, http.StatusCreated, resp.StatusCode)
 		}(i)
@@ -1177,7 +1172,7 @@ func TestConcurrentHashFileAccess(t *testing.T) {
 
 			// Create the request
 			req := httptest.NewRequest(http.MethodGet, "/download/"+boxName+"/"+filePath, nil)
-			resp, err := app.Test(req)
+			resp, err := app.Test(req, -1)
 
 			assert.NoError(t, err)
 			assert.Equal(t, http.StatusOK, resp.StatusCode)
@@ -1222,10 +1217,14 @@ func TestCollisionHandling(t *testing.T) {
 	mockService.On("FindBoxByPath", boxName).Return(box, nil).Times(len(filePaths))
 
 	for i, path := range filePaths {
+		// The first upload stores the content, its expectation is set up below
+		if i == 0 {
+			continue
+		}
 		mockService.On("CreateFileStructure",
 			box,
 			path,
-			mock.AnythingOfType("*multipart.FileHeader"),
+			mock.AnythingOfType("handlers.uploadedFile"),
 			false,
 			"",
 		).Return(&dto.ItemGetDTO{
@@ -1239,6 +1238,7 @@ func TestCollisionHandling(t *testing.T) {
 	}
 
 	// Upload the same file to all paths
+	results := make([]dto.ItemGetDTO, len(filePaths))
 	for i, path := range filePaths {
 		// First upload needs to actually create the file
 		if i == 0 {
@@ -1246,7 +1246,7 @@ func TestCollisionHandling(t *testing.T) {
 			mockService.On("CreateFileStructure",
 				box,
 				path,
-				mock.AnythingOfType("*multipart.FileHeader"),
+				mock.AnythingOfType("handlers.uploadedFile"),
 				false,
 				"",
 			).Run(func(args mock.Arguments) {
@@ -1279,9 +1279,11 @@ func TestCollisionHandling(t *testing.T) {
 		req.Header.Set("Content-Type", contentType)
 
 		// Test the request
-		resp, err := app.Test(req)
+		resp, err := app.Test(req, -1)
 		assert.NoError(t, err)
 		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		respBody, _ := io.ReadAll(resp.Body)
+		assert.NoError(t, json.Unmarshal(respBody, &results[i]))
 	}
 
 	// Verify only one copy of the file exists in storage
@@ -1295,26 +1297,69 @@ func TestCollisionHandling(t *testing.T) {
 	assert.Equal(t, 1, len(files), "Should have exactly one file in hash storage")
 	assert.Equal(t, fileHash, files[0].Name(), "File name should match the hash")
 
-	// Verify the database has entries for all paths but they point to the same hash
+	// Verify the items of all paths point to the same hash
 	for i, path := range filePaths {
-		var result dto.ItemGetDTO
-		req := httptest.NewRequest(http.MethodGet, "/items/"+strconv.Itoa(i+1), nil)
-		resp, err := app.Test(req)
-
-		if !assert.NoError(t, err) || !assert.Equal(t, http.StatusOK, resp.StatusCode) {
-			continue
-		}
+		assert.Equal(t, path, results[i].Path, "Path should match original")
+		assert.Equal(t, fileHash, results[i].SHA256, "All entries should reference the same hash")
+	}
 
-		respBody, _ := io.ReadAll(resp.Body)
-		err = json.Unmarshal(respBody, &result)
+	mockService.AssertExpectations(t)
+}
 
-		if !assert.NoError(t, err) {
-			continue
+func TestFileHandler_VirtualBoxResolvesAcrossMembers(t *testing.T) {
+	ts := setupTestServer(t)
+	ts.fileHandler()
+	releases := ts.createBox(t, "releases", models.BoxTypeGeneric, nil)
+	staging := ts.createBox(t, "staging", models.BoxTypeGeneric, nil)
+	ts.createBox(t, "all", models.BoxTypeVirtual, map[string]interface{}{
+		"members": []map[string]interface{}{
+			{"box": "staging", "exclude": "*.tmp"},
+			{"box": "releases"},
+		},
+		"default": "staging",
+	})
+	for box, files := range map[string]map[string]string{
+		"releases": {"libs/a.txt": "release a", "libs/b.txt": "release b"},
+		"staging":  {"libs/a.txt": "staging a", "libs/c.tmp": "staging c"},
+	} {
+		for filePath, content := range files {
+			resp, body := ts.upload(t, box, filePath, content)
+			require.Equal(t, http.StatusCreated, resp.StatusCode, body)
 		}
+	}
 
-		assert.Equal(t, path, result.Path, "Path should match original")
-		assert.Equal(t, fileHash, result.SHA256, "All entries should reference the same hash")
+	// The folder lists the children of all members, a.txt of the member listed first wins
+	resp, content := ts.request(t, http.MethodGet, "/all/libs", nil, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var folder models.Item
+	require.NoError(t, json.Unmarshal([]byte(content), &folder))
+	children := make(map[string]uint)
+	for _, child := range folder.Children {
+		children[child.Name] = child.BoxID
 	}
+	assert.Equal(t, map[string]uint{"a.txt": staging.ID, "b.txt": releases.ID}, children)
 
-	mockService.AssertExpectations(t)
+	// Files resolve against the members in order, a member only sees the paths its patterns let through
+	resp, content = ts.request(t, http.MethodGet, "/download/all/libs/a.txt", nil, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "staging a", content)
+	resp, content = ts.request(t, http.MethodGet, "/download/all/libs/b.txt", nil, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "release b", content)
+	resp, _ = ts.request(t, http.MethodGet, "/download/all/libs/c.tmp", nil, nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	var item models.Item
+	resp, content = ts.request(t, http.MethodGet, "/all/libs/b.txt", nil, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NoError(t, json.Unmarshal([]byte(content), &item))
+	assert.Equal(t, releases.ID, item.BoxID)
+
+	// Writes go to the default member, unless its patterns turn the path away
+	resp, content = ts.upload(t, "all", "libs/d.txt", "staging d")
+	require.Equal(t, http.StatusCreated, resp.StatusCode, content)
+	resp, content = ts.request(t, http.MethodGet, "/download/staging/libs/d.txt", nil, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "staging d", content)
+	resp, _ = ts.upload(t, "all", "libs/e.tmp", "staging e")
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
 }
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"Boxed/internal/helpers"
+	"Boxed/internal/models"
+	"Boxed/internal/services"
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// GoproxyHandler serves boxes of type goproxy through the GOPROXY protocol
+type GoproxyHandler struct {
+	service     services.GoproxyService
+	fileService services.FileService
+}
+
+func NewGoproxyHandler(service services.GoproxyService, fileService services.FileService) *GoproxyHandler {
+	return &GoproxyHandler{service: service, fileService: fileService}
+}
+
+func (h *GoproxyHandler) Get(c *fiber.Ctx) error {
+	box := h.goproxyBox(c)
+	if box == nil {
+		return c.Status(http.StatusNotFound).JSON(map[string]interface{}{"error": "Go proxy box not found"})
+	}
+	requestPath, err := url.PathUnescape(c.Params("*"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]interface{}{"error": "Invalid path"})
+	}
+	requestPath = strings.Trim(requestPath, "/")
+
+	if escapedModule, ok := strings.CutSuffix(requestPath, "/@latest"); ok {
+		modulePath, ok := helpers.UnescapeModulePath(escapedModule)
+		if !ok {
+			return c.Status(http.StatusBadRequest).JSON(map[string]interface{}{"error": "Invalid module path"})
+		}
+		info, err := h.service.Latest(box, modulePath)
+		if err != nil {
+			return goproxyError(c, err)
+		}
+		return c.JSON(info)
+	}
+
+	escapedModule, file, ok := strings.Cut(requestPath, "/@v/")
+	if !ok {
+		return c.Status(http.StatusNotFound).JSON(map[string]interface{}{"error": "Not found"})
+	}
+	modulePath, ok := helpers.UnescapeModulePath(escapedModule)
+	if !ok {
+		return c.Status(http.StatusBadRequest).JSON(map[string]interface{}{"error": "Invalid module path"})
+	}
+	if file == "list" {
+		versions, err := h.service.Versions(box, modulePath)
+		if err != nil {
+			return goproxyError(c, err)
+		}
+		var list strings.Builder
+		for _, version := range versions {
+			list.WriteString(version + "\n")
+		}
+		return c.SendString(list.String())
+	}
+
+	extension := path.Ext(file)
+	version, ok := helpers.UnescapeModulePath(strings.TrimSuffix(file, extension))
+	if !ok {
+		return c.Status(http.StatusBadRequest).JSON(map[string]interface{}{"error": "Invalid version"})
+	}
+	switch extension {
+	case ".info":
+		info, err := h.service.Info(box, modulePath, version)
+		if err != nil {
+			return goproxyError(c, err)
+		}
+		return c.JSON(info)
+	case ".mod", ".zip":
+		item, err := h.service.File(box, modulePath, version, extension)
+		if err != nil {
+			return goproxyError(c, err)
+		}
+		return sendBlob(c, h.fileService, box, item)
+	}
+	return c.Status(http.StatusNotFound).JSON(map[string]interface{}{"error": "Not found"})
+}
+
+// Put uploads a module zip to <module>/@v/<version>.zip
+func (h *GoproxyHandler) Put(c *fiber.Ctx) error {
+	box := h.goproxyBox(c)
+	if box == nil {
+		return c.Status(http.StatusNotFound).JSON(map[string]interface{}{"error": "Go proxy box not found"})
+	}
+	requestPath, err := url.PathUnescape(c.Params("*"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]interface{}{"error": "Invalid path"})
+	}
+	escapedModule, file, ok := strings.Cut(strings.Trim(requestPath, "/"), "/@v/")
+	escapedVersion, isZip := strings.CutSuffix(file, ".zip")
+	if !ok || !isZip {
+		return c.Status(http.StatusBadRequest).JSON(map[string]interface{}{"error": "Expected <module>/@v/<version>.zip"})
+	}
+	modulePath, moduleOk := helpers.UnescapeModulePath(escapedModule)
+	version, versionOk := helpers.UnescapeModulePath(escapedVersion)
+	if !moduleOk || !versionOk {
+		return c.Status(http.StatusBadRequest).JSON(map[string]interface{}{"error": "Invalid module path or version"})
+	}
+
+	info, err := h.service.Upload(box, modulePath, version, requestBody(c))
+	if err != nil {
+		return goproxyError(c, err)
+	}
+	return c.Status(http.StatusCreated).JSON(info)
+}
+
+// goproxyBox resolves the box of the request, nil unless it is a goproxy box
+func (h *GoproxyHandler) goproxyBox(c *fiber.Ctx) *models.Box {
+	box, err := h.fileService.FindBoxByPath(c.Params("box"))
+	if err != nil || box == nil || box.Type != models.BoxTypeGoproxy {
+		return nil
+	}
+	return box
+}
+
+func goproxyError(c *fiber.Ctx, err error) error {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrPackageNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidPackage):
+		status = http.StatusBadRequest
+	case errors.Is(err, services.ErrVersionExists):
+		status = http.StatusConflict
+	}
+	return c.Status(status).JSON(map[string]interface{}{"error": err.Error()})
+}
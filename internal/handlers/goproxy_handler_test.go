@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"Boxed/internal/models"
+	"Boxed/internal/services"
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// goModuleZip builds a module zip the way the go command lays it out
+func goModuleZip(t *testing.T, modulePath string, version string, files map[string]string) []byte {
+	var buffer bytes.Buffer
+	archive := zip.NewWriter(&buffer)
+	for name, content := range files {
+		file, err := archive.Create(modulePath + "@" + version + "/" + name)
+		require.NoError(t, err)
+		_, err = file.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, archive.Close())
+	return buffer.Bytes()
+}
+
+func TestGoproxyHandler_UploadThenResolve(t *testing.T) {
+	ts := setupTestServer(t)
+	handler := NewGoproxyHandler(services.NewGoproxyService(ts.itemService, ts.fileService, ts.logService), ts.fileService)
+	ts.app.Get("/goproxy/:box/*", handler.Get)
+	ts.app.Put("/goproxy/:box/*", handler.Put)
+	ts.createBox(t, "modules", models.BoxTypeGoproxy, nil)
+
+	// Upper case letters of the module path are escaped as "!" and the lower case letter
+	goMod := "module example.com/Foo/bar\n\ngo 1.21\n"
+	for _, version := range []string{"v1.2.0", "v1.10.0-rc.1", "v1.0.0"} {
+		moduleZip := goModuleZip(t, "example.com/Foo/bar", version, map[string]string{"go.mod": goMod, "bar.go": "package bar\n"})
+		resp, content := ts.request(t, http.MethodPut, "/goproxy/modules/example.com/!foo/bar/@v/"+version+".zip", bytes.NewReader(moduleZip), nil)
+		require.Equal(t, http.StatusCreated, resp.StatusCode, content)
+	}
+
+	// @v/list has one version per line, in semver order
+	resp, content := ts.request(t, http.MethodGet, "/goproxy/modules/example.com/!foo/bar/@v/list", nil, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "v1.0.0\nv1.2.0\nv1.10.0-rc.1\n", content)
+
+	var info struct {
+		Version string
+		Time    string
+	}
+	resp, content = ts.request(t, http.MethodGet, "/goproxy/modules/example.com/!foo/bar/@v/v1.2.0.info", nil, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NoError(t, json.Unmarshal([]byte(content), &info))
+	assert.Equal(t, "v1.2.0", info.Version)
+	assert.NotEmpty(t, info.Time)
+
+	// A release wins over a higher pre-release
+	resp, content = ts.request(t, http.MethodGet, "/goproxy/modules/example.com/!foo/bar/@latest", nil, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NoError(t, json.Unmarshal([]byte(content), &info))
+	assert.Equal(t, "v1.2.0", info.Version)
+
+	resp, content = ts.request(t, http.MethodGet, "/goproxy/modules/example.com/!foo/bar/@v/v1.0.0.mod", nil, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, goMod, content)
+	resp, content = ts.request(t, http.MethodGet, "/goproxy/modules/example.com/!foo/bar/@v/v1.0.0.zip", nil, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	_, err := zip.NewReader(bytes.NewReader([]byte(content)), int64(len(content)))
+	assert.NoError(t, err)
+
+	// The lower case path is another module
+	resp, _ = ts.request(t, http.MethodGet, "/goproxy/modules/example.com/foo/bar/@v/list", nil, nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	resp, _ = ts.request(t, http.MethodGet, "/goproxy/modules/example.com/!foo/bar/@v/v1.3.0.info", nil, nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// Versions are immutable
+	moduleZip := goModuleZip(t, "example.com/Foo/bar", "v1.0.0", map[string]string{"go.mod": goMod})
+	resp, _ = ts.request(t, http.MethodPut, "/goproxy/modules/example.com/!foo/bar/@v/v1.0.0.zip", bytes.NewReader(moduleZip), nil)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+}
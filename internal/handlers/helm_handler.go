@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"Boxed/internal/models"
+	"Boxed/internal/services"
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"io"
+	"mime/multipart"
+	"net/http"
+)
+
+// HelmHandler serves boxes of type helm as chart repositories. Uploads and deletions follow the
+// ChartMuseum API, so the usual push plugins and curl recipes work against it.
+type HelmHandler struct {
+	service     services.HelmService
+	fileService services.FileService
+}
+
+func NewHelmHandler(service services.HelmService, fileService services.FileService) *HelmHandler {
+	return &HelmHandler{service: service, fileService: fileService}
+}
+
+func (h *HelmHandler) GetIndex(c *fiber.Ctx) error {
+	box := h.helmBox(c)
+	if box == nil {
+		return c.Status(http.StatusNotFound).JSON(map[string]interface{}{"error": "Helm box not found"})
+	}
+	item, err := h.service.Index(box)
+	if err != nil {
+		return helmError(c, err)
+	}
+	return sendBlob(c, h.fileService, box, item)
+}
+
+func (h *HelmHandler) GetChart(c *fiber.Ctx) error {
+	box := h.helmBox(c)
+	if box == nil {
+		return c.Status(http.StatusNotFound).JSON(map[string]interface{}{"error": "Helm box not found"})
+	}
+	item, err := h.service.Chart(box, c.Params("file"))
+	if err != nil {
+		return helmError(c, err)
+	}
+	return sendBlob(c, h.fileService, box, item)
+}
+
+// Upload takes a packaged chart either as the raw body or as the "chart" part of a multipart form
+func (h *HelmHandler) Upload(c *fiber.Ctx) error {
+	box := h.helmBox(c)
+	if box == nil {
+		return c.Status(http.StatusNotFound).JSON(map[string]interface{}{"error": "Helm box not found"})
+	}
+
+	boundary := string(c.Request().Header.MultipartFormBoundary())
+	if boundary == "" {
+		if _, err := h.service.Upload(box, requestBody(c)); err != nil {
+			return helmError(c, err)
+		}
+		return c.Status(http.StatusCreated).JSON(map[string]interface{}{"saved": true})
+	}
+
+	reader := multipart.NewReader(requestBody(c), boundary)
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(map[string]interface{}{"error": "Invalid multipart body"})
+		}
+		if part.FormName() == "chart" {
+			if _, err := h.service.Upload(box, part); err != nil {
+				return helmError(c, err)
+			}
+			return c.Status(http.StatusCreated).JSON(map[string]interface{}{"saved": true})
+		}
+		_ = part.Close()
+	}
+	return c.Status(http.StatusBadRequest).JSON(map[string]interface{}{"error": "Missing chart"})
+}
+
+func (h *HelmHandler) Delete(c *fiber.Ctx) error {
+	box := h.helmBox(c)
+	if box == nil {
+		return c.Status(http.StatusNotFound).JSON(map[string]interface{}{"error": "Helm box not found"})
+	}
+	if err := h.service.Delete(box, c.Params("name"), c.Params("version")); err != nil {
+		return helmError(c, err)
+	}
+	return c.JSON(map[string]interface{}{"deleted": true})
+}
+
+// helmBox resolves the box of the request, nil unless it is a helm box
+func (h *HelmHandler) helmBox(c *fiber.Ctx) *models.Box {
+	box, err := h.fileService.FindBoxByPath(c.Params("box"))
+	if err != nil || box == nil || box.Type != models.BoxTypeHelm {
+		return nil
+	}
+	return box
+}
+
+func helmError(c *fiber.Ctx, err error) error {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrChartNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidPackage):
+		status = http.StatusBadRequest
+	case errors.Is(err, services.ErrVersionExists):
+		status = http.StatusConflict
+	}
+	return c.Status(status).JSON(map[string]interface{}{"error": err.Error()})
+}
@@ -4,17 +4,19 @@ import (
 	"Boxed/internal/models"
 	"Boxed/internal/services"
 	"encoding/json"
+	"errors"
 	"github.com/gofiber/fiber/v2"
 	"net/http"
 	"strconv"
 )
 
 type ItemHandler struct {
-	service services.ItemService
+	service      services.ItemService
+	moverService services.MoverService
 }
 
-func NewItemHandler(service services.ItemService) *ItemHandler {
-	return &ItemHandler{service: service}
+func NewItemHandler(service services.ItemService, moverService services.MoverService) *ItemHandler {
+	return &ItemHandler{service: service, moverService: moverService}
 }
 
 func (h *ItemHandler) CreateItem(c *fiber.Ctx) error {
@@ -136,8 +138,23 @@ func (h *ItemHandler) ItemMove(c *fiber.Ctx) error {
 	if err := c.BodyParser(&req); err != nil {
 		return c.Status(http.StatusBadRequest).JSON(map[string]interface{}{"error": err.Error()})
 	}
+	if req.From == "" || req.To == "" {
+		return c.Status(http.StatusBadRequest).JSON(map[string]interface{}{"error": "from and to are required"})
+	}
+
+	if c.Query("async") == "true" {
+		job, err := h.moverService.MoveItemAsync(req.From, req.To, req.Force)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(map[string]interface{}{"error": err.Error()})
+		}
+		return c.Status(http.StatusAccepted).JSON(job)
+	}
 
-	return nil
+	item, err := h.moverService.MoveItem(req.From, req.To, req.Force)
+	if err != nil {
+		return c.Status(moverErrorStatus(err)).JSON(map[string]interface{}{"error": err.Error()})
+	}
+	return c.Status(http.StatusOK).JSON(item)
 }
 
 func (h *ItemHandler) ItemCopy(c *fiber.Ctx) error {
@@ -150,6 +167,34 @@ func (h *ItemHandler) ItemCopy(c *fiber.Ctx) error {
 	if err := c.BodyParser(&req); err != nil {
 		return c.Status(http.StatusBadRequest).JSON(map[string]interface{}{"error": err.Error()})
 	}
+	if req.From == "" || req.To == "" {
+		return c.Status(http.StatusBadRequest).JSON(map[string]interface{}{"error": "from and to are required"})
+	}
+
+	if c.Query("async") == "true" {
+		job, err := h.moverService.CopyItemAsync(req.From, req.To, req.Force, req.Properties)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(map[string]interface{}{"error": err.Error()})
+		}
+		return c.Status(http.StatusAccepted).JSON(job)
+	}
 
-	return nil
+	item, err := h.moverService.CopyItem(req.From, req.To, req.Force, req.Properties)
+	if err != nil {
+		return c.Status(moverErrorStatus(err)).JSON(map[string]interface{}{"error": err.Error()})
+	}
+	return c.Status(http.StatusCreated).JSON(item)
+}
+
+func moverErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrBoxNotFound), errors.Is(err, services.ErrSourceNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrDestinationExists):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrInvalidMovePath):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
 }
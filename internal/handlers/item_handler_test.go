@@ -10,6 +10,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/stretchr/testify/assert"
@@ -73,6 +74,14 @@ func (m *MockItemService) FindFolderByNameAndParent(name string, parentID *uint,
 	return nil, args.Error(1)
 }
 
+func (m *MockItemService) FindByNameAndParent(name string, parentID *uint, boxID uint) (*models.Item, error) {
+	args := m.Called(name, parentID, boxID)
+	if item, ok := args.Get(0).(*models.Item); ok {
+		return item, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
 func (m *MockItemService) GetAllDescendants(parentID uint, maxLevel int) ([]models.Item, error) {
 	args := m.Called(parentID, maxLevel)
 	return args.Get(0).([]models.Item), args.Error(1)
@@ -98,10 +107,106 @@ func (m *MockItemService) ItemsSearch(filter string, order string, limit int, of
 	return args.Get(0).([]models.Item), args.Error(1)
 }
 
+func (m *MockItemService) DeleteItemBy(id uint, force bool, deletedBy string) error {
+	args := m.Called(id, force, deletedBy)
+	return args.Error(0)
+}
+
+func (m *MockItemService) FindDeletedBefore(before time.Time) ([]models.Item, error) {
+	args := m.Called(before)
+	return args.Get(0).([]models.Item), args.Error(1)
+}
+
+func (m *MockItemService) FindDeletedByID(id uint) (*models.Item, error) {
+	args := m.Called(id)
+	if item, ok := args.Get(0).(*models.Item); ok {
+		return item, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockItemService) FindTrash(boxID uint) ([]models.Item, error) {
+	args := m.Called(boxID)
+	return args.Get(0).([]models.Item), args.Error(1)
+}
+
+func (m *MockItemService) RestoreItem(item *models.Item) ([]models.Item, error) {
+	args := m.Called(item)
+	return args.Get(0).([]models.Item), args.Error(1)
+}
+
+func (m *MockItemService) PurgeItem(item *models.Item) error {
+	args := m.Called(item)
+	return args.Error(0)
+}
+
+func (m *MockItemService) UpdateProperties(id uint, properties json.RawMessage) error {
+	args := m.Called(id, properties)
+	return args.Error(0)
+}
+
+func (m *MockItemService) UpdateUploader(id uint, uploader string) error {
+	args := m.Called(id, uploader)
+	return args.Error(0)
+}
+
+func (m *MockItemService) MoveItem(item *models.Item, newParentID *uint, newBoxID uint, newName string) error {
+	args := m.Called(item, newParentID, newBoxID, newName)
+	return args.Error(0)
+}
+
+func (m *MockItemService) RecordVersion(item *models.Item) error {
+	args := m.Called(item)
+	return args.Error(0)
+}
+
+func (m *MockItemService) FindVersions(itemID uint) ([]models.ItemVersion, error) {
+	args := m.Called(itemID)
+	return args.Get(0).([]models.ItemVersion), args.Error(1)
+}
+
+func (m *MockItemService) FindVersion(itemID uint, version int) (*models.ItemVersion, error) {
+	args := m.Called(itemID, version)
+	if itemVersion, ok := args.Get(0).(*models.ItemVersion); ok {
+		return itemVersion, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockItemService) FindItemIDsWithMoreVersions(boxID uint, keep int) ([]uint, error) {
+	args := m.Called(boxID, keep)
+	return args.Get(0).([]uint), args.Error(1)
+}
+
+func (m *MockItemService) DeleteVersion(version *models.ItemVersion) error {
+	args := m.Called(version)
+	return args.Error(0)
+}
+
+func (m *MockItemService) CountBlobReferences(boxID uint, sha256sum string) (int64, error) {
+	args := m.Called(boxID, sha256sum)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockItemService) FindBlobReferences(boxID uint, sha256sum string) ([]models.Item, []models.ItemVersion, error) {
+	args := m.Called(boxID, sha256sum)
+	return args.Get(0).([]models.Item), args.Get(1).([]models.ItemVersion), args.Error(2)
+}
+
+func (m *MockItemService) FindReferencedBlobs(boxID uint) ([]string, error) {
+	args := m.Called(boxID)
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *MockItemService) SetQuarantined(boxID uint, sha256sum string, quarantined bool) error {
+	args := m.Called(boxID, sha256sum, quarantined)
+	return args.Error(0)
+}
+
 func TestCreateItem_Success(t *testing.T) {
 	app := fiber.New()
 	mockService := new(MockItemService)
-	handler := NewItemHandler(mockService)
+	handler := NewItemHandler(mockService, nil)
 
 	app.Post("/items", handler.CreateItem)
 
@@ -160,7 +265,7 @@ func TestCreateItem_Success(t *testing.T) {
 func TestGetItemByID_Scenarios(t *testing.T) {
 	app := fiber.New()
 	mockService := new(MockItemService)
-	handler := NewItemHandler(mockService)
+	handler := NewItemHandler(mockService, nil)
 
 	app.Get("/items/:id", handler.GetItemByID)
 
@@ -226,7 +331,7 @@ func TestGetItemByID_Scenarios(t *testing.T) {
 func TestListItems_Scenarios(t *testing.T) {
 	app := fiber.New()
 	mockService := new(MockItemService)
-	handler := NewItemHandler(mockService)
+	handler := NewItemHandler(mockService, nil)
 
 	app.Get("/items", handler.ListItems)
 
@@ -280,7 +385,7 @@ func TestListItems_Scenarios(t *testing.T) {
 func TestDeleteItem_Scenarios(t *testing.T) {
 	app := fiber.New()
 	mockService := new(MockItemService)
-	handler := NewItemHandler(mockService)
+	handler := NewItemHandler(mockService, nil)
 
 	app.Delete("/items/:id", handler.DeleteItem)
 
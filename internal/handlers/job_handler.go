@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"Boxed/internal/services"
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"net/http"
+	"strconv"
+)
+
+type JobHandler struct {
+	service services.JobService
+}
+
+func NewJobHandler(service services.JobService) *JobHandler {
+	return &JobHandler{service: service}
+}
+
+func (h *JobHandler) ListJobs(c *fiber.Ctx) error {
+	limit, err := strconv.Atoi(c.Query("$limit", "50"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]interface{}{"error": "Invalid limit"})
+	}
+	offset, err := strconv.Atoi(c.Query("$skip", "0"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]interface{}{"error": "Invalid skip"})
+	}
+	jobs, err := h.service.ListJobs(c.Query("status"), limit, offset)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]interface{}{"error": "could not list jobs"})
+	}
+	return c.JSON(jobs)
+}
+
+func (h *JobHandler) GetJob(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]interface{}{"error": "invalid job ID"})
+	}
+	job, err := h.service.GetJob(uint(id))
+	if err != nil {
+		return c.Status(http.StatusNotFound).JSON(map[string]interface{}{"error": "job not found"})
+	}
+	return c.JSON(job)
+}
+
+func (h *JobHandler) CancelJob(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]interface{}{"error": "invalid job ID"})
+	}
+	job, err := h.service.CancelJob(uint(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrJobNotFound):
+			return c.Status(http.StatusNotFound).JSON(map[string]interface{}{"error": "job not found"})
+		case errors.Is(err, services.ErrJobFinished):
+			return c.Status(http.StatusConflict).JSON(map[string]interface{}{"error": err.Error()})
+		default:
+			return c.Status(http.StatusInternalServerError).JSON(map[string]interface{}{"error": err.Error()})
+		}
+	}
+	return c.Status(http.StatusAccepted).JSON(job)
+}
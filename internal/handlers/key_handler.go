@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"Boxed/internal/services"
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"net/http"
+)
+
+// KeyHandler reports on the encryption keys and starts their rotation
+type KeyHandler struct {
+	service services.KeyService
+}
+
+func NewKeyHandler(service services.KeyService) *KeyHandler {
+	return &KeyHandler{service: service}
+}
+
+// GetKeys reports the active master key and how many data keys each master key wraps
+func (h *KeyHandler) GetKeys(c *fiber.Ctx) error {
+	status, err := h.service.Status()
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]interface{}{"error": err.Error()})
+	}
+	return c.JSON(status)
+}
+
+// RotateKeys starts a job re-wrapping every data key with the active master key
+func (h *KeyHandler) RotateKeys(c *fiber.Ctx) error {
+	job, err := h.service.RotateAsync()
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrKeyUnavailable) {
+			status = http.StatusConflict
+		}
+		return c.Status(status).JSON(map[string]interface{}{"error": err.Error()})
+	}
+	return c.Status(http.StatusAccepted).JSON(job)
+}
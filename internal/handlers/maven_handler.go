@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"Boxed/internal/helpers"
+	"Boxed/internal/models"
+	"Boxed/internal/services"
+	"bytes"
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// MavenHandler serves boxes of type maven as Maven 2 repositories over plain GET and PUT
+type MavenHandler struct {
+	service     services.MavenService
+	fileService services.FileService
+}
+
+func NewMavenHandler(service services.MavenService, fileService services.FileService) *MavenHandler {
+	return &MavenHandler{service: service, fileService: fileService}
+}
+
+func (h *MavenHandler) Get(c *fiber.Ctx) error {
+	box := h.mavenBox(c)
+	if box == nil {
+		return c.Status(http.StatusNotFound).JSON(map[string]interface{}{"error": "Maven box not found"})
+	}
+	artifactPath := strings.Trim(c.Params("*"), "/")
+	if strings.Contains(artifactPath, "..") {
+		return c.Status(http.StatusBadRequest).JSON(map[string]interface{}{"error": "Invalid path"})
+	}
+
+	base, algorithm := services.SplitChecksumPath(artifactPath)
+	if path.Base(base) == services.MavenMetadataFile {
+		metadata, err := h.service.Metadata(box, path.Dir(base))
+		if err != nil {
+			return mavenError(c, err)
+		}
+		if algorithm != "" {
+			checksum, err := helpers.ChecksumOf(algorithm, bytes.NewReader(metadata))
+			if err != nil {
+				return mavenError(c, err)
+			}
+			return c.SendString(checksum)
+		}
+		c.Set(fiber.HeaderContentType, fiber.MIMEApplicationXMLCharsetUTF8)
+		return c.Send(metadata)
+	}
+
+	item, err := h.service.GetArtifact(box, base)
+	if err != nil {
+		return mavenError(c, err)
+	}
+	if item.Type == "folder" {
+		if algorithm != "" {
+			return mavenError(c, services.ErrArtifactNotFound)
+		}
+		item, err = h.fileService.ListFileOrFolder(box.Name, base)
+		if err != nil {
+			return mavenError(c, err)
+		}
+		return c.JSON(item)
+	}
+	if algorithm != "" {
+		checksum, err := h.service.Checksum(box, item, algorithm)
+		if err != nil {
+			return mavenError(c, err)
+		}
+		return c.SendString(checksum)
+	}
+	return sendBlob(c, h.fileService, box, item)
+}
+
+func (h *MavenHandler) Put(c *fiber.Ctx) error {
+	box := h.mavenBox(c)
+	if box == nil {
+		return c.Status(http.StatusNotFound).JSON(map[string]interface{}{"error": "Maven box not found"})
+	}
+	item, err := h.service.Deploy(box, c.Params("*"), requestBody(c))
+	if err != nil {
+		return mavenError(c, err)
+	}
+	if item == nil {
+		return c.SendStatus(http.StatusCreated)
+	}
+	return c.Status(http.StatusCreated).JSON(item)
+}
+
+// mavenBox resolves the box of the request, nil unless it is a maven box
+func (h *MavenHandler) mavenBox(c *fiber.Ctx) *models.Box {
+	box, err := h.fileService.FindBoxByPath(c.Params("box"))
+	if err != nil || box == nil || box.Type != models.BoxTypeMaven {
+		return nil
+	}
+	return box
+}
+
+func mavenError(c *fiber.Ctx, err error) error {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrArtifactNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidMavenPath), errors.Is(err, services.ErrChecksumMismatch):
+		status = http.StatusBadRequest
+	}
+	return c.Status(status).JSON(map[string]interface{}{"error": err.Error()})
+}
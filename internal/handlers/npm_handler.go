@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"Boxed/internal/models"
+	"Boxed/internal/services"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// NpmHandler serves boxes of type npm through the npm registry API
+type NpmHandler struct {
+	service     services.NpmService
+	fileService services.FileService
+}
+
+func NewNpmHandler(service services.NpmService, fileService services.FileService) *NpmHandler {
+	return &NpmHandler{service: service, fileService: fileService}
+}
+
+func (h *NpmHandler) Get(c *fiber.Ctx) error {
+	box := h.npmBox(c)
+	if box == nil {
+		return c.Status(http.StatusNotFound).JSON(map[string]interface{}{"error": "npm box not found"})
+	}
+	requestPath, err := npmPath(c)
+	if err != nil {
+		return npmError(c, err)
+	}
+
+	if requestPath == "-/ping" {
+		return c.JSON(map[string]interface{}{})
+	}
+	if name, _, ok := npmDistTagPath(requestPath); ok {
+		distTags, err := h.service.DistTags(box, name)
+		if err != nil {
+			return npmError(c, err)
+		}
+		return c.JSON(distTags)
+	}
+	if name, filename, ok := strings.Cut(requestPath, "/-/"); ok {
+		item, err := h.service.Tarball(box, name, filename)
+		if err != nil {
+			return npmError(c, err)
+		}
+		return sendBlob(c, h.fileService, box, item)
+	}
+
+	name, version := npmPackageAndVersion(requestPath)
+	packument, err := h.service.Packument(box, name, c.BaseURL()+"/npm/"+box.Name)
+	if err != nil {
+		return npmError(c, err)
+	}
+	if version == "" {
+		return c.JSON(packument)
+	}
+	if tagged, ok := packument.DistTags[version]; ok {
+		version = tagged
+	}
+	manifest, ok := packument.Versions[version]
+	if !ok {
+		return npmError(c, services.ErrPackageNotFound)
+	}
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	return c.Send(manifest)
+}
+
+func (h *NpmHandler) Put(c *fiber.Ctx) error {
+	box := h.npmBox(c)
+	if box == nil {
+		return c.Status(http.StatusNotFound).JSON(map[string]interface{}{"error": "npm box not found"})
+	}
+	requestPath, err := npmPath(c)
+	if err != nil {
+		return npmError(c, err)
+	}
+
+	if name, tag, ok := npmDistTagPath(requestPath); ok {
+		var version string
+		if tag == "" || json.Unmarshal(c.Body(), &version) != nil {
+			return c.Status(http.StatusBadRequest).JSON(map[string]interface{}{"error": "Expected a tag and a JSON string version"})
+		}
+		if err := h.service.SetDistTag(box, name, tag, version); err != nil {
+			return npmError(c, err)
+		}
+		return c.Status(http.StatusCreated).JSON(map[string]interface{}{"ok": true})
+	}
+
+	if err := h.service.Publish(box, requestPath, requestBody(c)); err != nil {
+		return npmError(c, err)
+	}
+	return c.Status(http.StatusCreated).JSON(map[string]interface{}{"ok": true})
+}
+
+func (h *NpmHandler) Delete(c *fiber.Ctx) error {
+	box := h.npmBox(c)
+	if box == nil {
+		return c.Status(http.StatusNotFound).JSON(map[string]interface{}{"error": "npm box not found"})
+	}
+	requestPath, err := npmPath(c)
+	if err != nil {
+		return npmError(c, err)
+	}
+	name, tag, ok := npmDistTagPath(requestPath)
+	if !ok || tag == "" {
+		return c.Status(http.StatusMethodNotAllowed).JSON(map[string]interface{}{"error": "Only dist-tags can be deleted"})
+	}
+	if err := h.service.RemoveDistTag(box, name, tag); err != nil {
+		return npmError(c, err)
+	}
+	return c.JSON(map[string]interface{}{"ok": true})
+}
+
+// npmBox resolves the box of the request, nil unless it is an npm box
+func (h *NpmHandler) npmBox(c *fiber.Ctx) *models.Box {
+	box, err := h.fileService.FindBoxByPath(c.Params("box"))
+	if err != nil || box == nil || box.Type != models.BoxTypeNpm {
+		return nil
+	}
+	return box
+}
+
+// npmPath unescapes the wildcard, npm sends scoped names as @scope%2fname
+func npmPath(c *fiber.Ctx) (string, error) {
+	requestPath, err := url.PathUnescape(c.Params("*"))
+	if err != nil || strings.Contains(requestPath, "..") {
+		return "", fmt.Errorf("%w: invalid path", services.ErrInvalidPackage)
+	}
+	return strings.Trim(requestPath, "/"), nil
+}
+
+// npmDistTagPath matches -/package/<name>/dist-tags and -/package/<name>/dist-tags/<tag>
+func npmDistTagPath(requestPath string) (string, string, bool) {
+	rest, ok := strings.CutPrefix(requestPath, "-/package/")
+	if !ok {
+		return "", "", false
+	}
+	if name, tag, ok := strings.Cut(rest, "/dist-tags/"); ok {
+		return name, tag, true
+	}
+	if name, ok := strings.CutSuffix(rest, "/dist-tags"); ok {
+		return name, "", true
+	}
+	return "", "", false
+}
+
+// npmPackageAndVersion splits <name>/<version>, the name of a scoped package spans two segments
+func npmPackageAndVersion(requestPath string) (string, string) {
+	segments := strings.SplitN(requestPath, "/", 3)
+	if strings.HasPrefix(requestPath, "@") && len(segments) >= 2 {
+		if len(segments) == 3 {
+			return segments[0] + "/" + segments[1], segments[2]
+		}
+		return requestPath, ""
+	}
+	if len(segments) > 1 {
+		return segments[0], strings.Join(segments[1:], "/")
+	}
+	return requestPath, ""
+}
+
+func npmError(c *fiber.Ctx, err error) error {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrPackageNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidPackage):
+		status = http.StatusBadRequest
+	case errors.Is(err, services.ErrVersionExists):
+		status = http.StatusConflict
+	}
+	return c.Status(status).JSON(map[string]interface{}{"error": err.Error()})
+}
@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"Boxed/internal/models"
+	"Boxed/internal/services"
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+)
+
+// nugetRegistrationTypes are the versions of the registration resource the feed announces. The
+// registrations are served without pages to fetch separately, which every version supports.
+var nugetRegistrationTypes = []string{
+	"RegistrationsBaseUrl",
+	"RegistrationsBaseUrl/3.0.0-beta",
+	"RegistrationsBaseUrl/3.0.0-rc",
+	"RegistrationsBaseUrl/3.4.0",
+	"RegistrationsBaseUrl/3.6.0",
+}
+
+// NugetHandler serves boxes of type nuget as NuGet v3 feeds: the service index, the package publish
+// resource used by dotnet nuget push, the package base address (flat container) and the registrations
+type NugetHandler struct {
+	service     services.NugetService
+	fileService services.FileService
+}
+
+func NewNugetHandler(service services.NugetService, fileService services.FileService) *NugetHandler {
+	return &NugetHandler{service: service, fileService: fileService}
+}
+
+func (h *NugetHandler) GetServiceIndex(c *fiber.Ctx) error {
+	box := h.nugetBox(c)
+	if box == nil {
+		return c.Status(http.StatusNotFound).JSON(map[string]interface{}{"error": "NuGet box not found"})
+	}
+	baseURL := h.baseURL(c, box)
+	resources := []map[string]string{
+		{"@id": baseURL + "/api/v2/package", "@type": "PackagePublish/2.0.0"},
+		{"@id": baseURL + "/v3-flatcontainer/", "@type": "PackageBaseAddress/3.0.0"},
+	}
+	for _, resourceType := range nugetRegistrationTypes {
+		resources = append(resources, map[string]string{"@id": baseURL + "/registration/", "@type": resourceType})
+	}
+	return c.JSON(map[string]interface{}{"version": "3.0.0", "resources": resources})
+}
+
+// Push takes the package from the first file of the multipart body dotnet nuget push sends
+func (h *NugetHandler) Push(c *fiber.Ctx) error {
+	box := h.nugetBox(c)
+	if box == nil {
+		return c.Status(http.StatusNotFound).JSON(map[string]interface{}{"error": "NuGet box not found"})
+	}
+
+	boundary := string(c.Request().Header.MultipartFormBoundary())
+	if boundary == "" {
+		return c.Status(http.StatusBadRequest).JSON(map[string]interface{}{"error": "Expected a multipart body"})
+	}
+	reader := multipart.NewReader(requestBody(c), boundary)
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(map[string]interface{}{"error": "Invalid multipart body"})
+		}
+		if part.FileName() != "" {
+			pkg, err := h.service.Push(box, part)
+			if err != nil {
+				return nugetError(c, err)
+			}
+			return c.Status(http.StatusCreated).JSON(pkg)
+		}
+		_ = part.Close()
+	}
+	return c.Status(http.StatusBadRequest).JSON(map[string]interface{}{"error": "Missing package"})
+}
+
+func (h *NugetHandler) Delete(c *fiber.Ctx) error {
+	box := h.nugetBox(c)
+	if box == nil {
+		return c.Status(http.StatusNotFound).JSON(map[string]interface{}{"error": "NuGet box not found"})
+	}
+	if err := h.service.Delete(box, c.Params("id"), c.Params("version")); err != nil {
+		return nugetError(c, err)
+	}
+	return c.JSON(map[string]interface{}{"deleted": true})
+}
+
+func (h *NugetHandler) GetVersions(c *fiber.Ctx) error {
+	box := h.nugetBox(c)
+	if box == nil {
+		return c.Status(http.StatusNotFound).JSON(map[string]interface{}{"error": "NuGet box not found"})
+	}
+	versions, err := h.service.Versions(box, c.Params("id"))
+	if err != nil {
+		return nugetError(c, err)
+	}
+	return c.JSON(map[string]interface{}{"versions": versions})
+}
+
+func (h *NugetHandler) GetFile(c *fiber.Ctx) error {
+	box := h.nugetBox(c)
+	if box == nil {
+		return c.Status(http.StatusNotFound).JSON(map[string]interface{}{"error": "NuGet box not found"})
+	}
+	item, err := h.service.File(box, c.Params("id"), c.Params("version"), c.Params("file"))
+	if err != nil {
+		return nugetError(c, err)
+	}
+	return sendBlob(c, h.fileService, box, item)
+}
+
+func (h *NugetHandler) GetRegistration(c *fiber.Ctx) error {
+	box := h.nugetBox(c)
+	if box == nil {
+		return c.Status(http.StatusNotFound).JSON(map[string]interface{}{"error": "NuGet box not found"})
+	}
+	registration, err := h.service.Registration(box, c.Params("id"), h.baseURL(c, box))
+	if err != nil {
+		return nugetError(c, err)
+	}
+	return c.JSON(registration)
+}
+
+func (h *NugetHandler) GetRegistrationLeaf(c *fiber.Ctx) error {
+	box := h.nugetBox(c)
+	if box == nil {
+		return c.Status(http.StatusNotFound).JSON(map[string]interface{}{"error": "NuGet box not found"})
+	}
+	version, ok := strings.CutSuffix(c.Params("leaf"), ".json")
+	if !ok {
+		return c.Status(http.StatusNotFound).JSON(map[string]interface{}{"error": "Not found"})
+	}
+	leaf, err := h.service.RegistrationLeaf(box, c.Params("id"), version, h.baseURL(c, box))
+	if err != nil {
+		return nugetError(c, err)
+	}
+	return c.JSON(leaf)
+}
+
+// nugetBox resolves the box of the request, nil unless it is a nuget box
+func (h *NugetHandler) nugetBox(c *fiber.Ctx) *models.Box {
+	box, err := h.fileService.FindBoxByPath(c.Params("box"))
+	if err != nil || box == nil || box.Type != models.BoxTypeNuget {
+		return nil
+	}
+	return box
+}
+
+func (h *NugetHandler) baseURL(c *fiber.Ctx, box *models.Box) string {
+	return c.BaseURL() + "/nuget/" + box.Name
+}
+
+func nugetError(c *fiber.Ctx, err error) error {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrPackageNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidPackage):
+		status = http.StatusBadRequest
+	case errors.Is(err, services.ErrVersionExists):
+		status = http.StatusConflict
+	}
+	return c.Status(status).JSON(map[string]interface{}{"error": err.Error()})
+}
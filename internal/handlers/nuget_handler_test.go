@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"Boxed/internal/models"
+	"Boxed/internal/services"
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func nugetPackage(t *testing.T, id string, version string) []byte {
+	var buffer bytes.Buffer
+	archive := zip.NewWriter(&buffer)
+	nuspec, err := archive.Create(id + ".nuspec")
+	require.NoError(t, err)
+	_, err = nuspec.Write([]byte(`<?xml version="1.0"?>
+<package xmlns="http://schemas.microsoft.com/packaging/2013/05/nuspec.xsd">
+  <metadata>
+    <id>` + id + `</id>
+    <version>` + version + `</version>
+    <authors>Contoso</authors>
+    <description>Utilities</description>
+  </metadata>
+</package>`))
+	require.NoError(t, err)
+	require.NoError(t, archive.Close())
+	return buffer.Bytes()
+}
+
+// nugetPush builds the multipart body dotnet nuget push sends
+func nugetPush(t *testing.T, nupkg []byte) (*bytes.Buffer, http.Header) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("package", "package.nupkg")
+	require.NoError(t, err)
+	_, err = part.Write(nupkg)
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	return &body, http.Header{"Content-Type": {writer.FormDataContentType()}}
+}
+
+func TestNugetHandler_PushThenFeed(t *testing.T) {
+	ts := setupTestServer(t)
+	handler := NewNugetHandler(services.NewNugetService(ts.itemService, ts.fileService, ts.logService), ts.fileService)
+	ts.app.Get("/nuget/:box/index.json", handler.GetServiceIndex)
+	ts.app.Put("/nuget/:box/api/v2/package", handler.Push)
+	ts.app.Delete("/nuget/:box/api/v2/package/:id/:version", handler.Delete)
+	ts.app.Get("/nuget/:box/v3-flatcontainer/:id/index.json", handler.GetVersions)
+	ts.app.Get("/nuget/:box/v3-flatcontainer/:id/:version/:file", handler.GetFile)
+	ts.app.Get("/nuget/:box/registration/:id/index.json", handler.GetRegistration)
+	ts.app.Get("/nuget/:box/registration/:id/:leaf", handler.GetRegistrationLeaf)
+	ts.createBox(t, "feed", models.BoxTypeNuget, nil)
+
+	packages := map[string][]byte{}
+	for _, version := range []string{"1.0.0", "1.2.0-beta.1"} {
+		packages[version] = nugetPackage(t, "Contoso.Utils", version)
+		body, header := nugetPush(t, packages[version])
+		resp, content := ts.request(t, http.MethodPut, "/nuget/feed/api/v2/package", body, header)
+		require.Equal(t, http.StatusCreated, resp.StatusCode, content)
+	}
+
+	// The service index announces the resources the client goes on with
+	resp, content := ts.request(t, http.MethodGet, "/nuget/feed/index.json", nil, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var index struct {
+		Resources []map[string]string `json:"resources"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(content), &index))
+	resources := make(map[string]string)
+	for _, resource := range index.Resources {
+		resources[resource["@type"]] = resource["@id"]
+	}
+	assert.Equal(t, "http://example.com/nuget/feed/v3-flatcontainer/", resources["PackageBaseAddress/3.0.0"])
+	assert.Equal(t, "http://example.com/nuget/feed/registration/", resources["RegistrationsBaseUrl/3.6.0"])
+	assert.Equal(t, "http://example.com/nuget/feed/api/v2/package", resources["PackagePublish/2.0.0"])
+
+	// The flat container lists the versions and serves the package under lower case names
+	resp, content = ts.request(t, http.MethodGet, "/nuget/feed/v3-flatcontainer/contoso.utils/index.json", nil, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.JSONEq(t, `{"versions":["1.0.0","1.2.0-beta.1"]}`, content)
+	resp, content = ts.request(t, http.MethodGet, "/nuget/feed/v3-flatcontainer/contoso.utils/1.0.0/contoso.utils.1.0.0.nupkg", nil, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, string(packages["1.0.0"]), content)
+	resp, content = ts.request(t, http.MethodGet, "/nuget/feed/v3-flatcontainer/contoso.utils/1.0.0/contoso.utils.nuspec", nil, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, content, "<id>Contoso.Utils</id>")
+
+	// The registration carries the metadata of every version
+	resp, content = ts.request(t, http.MethodGet, "/nuget/feed/registration/contoso.utils/index.json", nil, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var registration services.NugetRegistrationIndex
+	require.NoError(t, json.Unmarshal([]byte(content), &registration))
+	require.Len(t, registration.Items, 1)
+	assert.Equal(t, "1.0.0", registration.Items[0].Lower)
+	assert.Equal(t, "1.2.0-beta.1", registration.Items[0].Upper)
+	require.Len(t, registration.Items[0].Items, 2)
+	leaf := registration.Items[0].Items[0]
+	assert.Equal(t, "Contoso.Utils", leaf.CatalogEntry.NugetPackage.ID)
+	assert.Equal(t, "Contoso", leaf.CatalogEntry.Authors)
+	assert.Equal(t, "http://example.com/nuget/feed/v3-flatcontainer/contoso.utils/1.0.0/contoso.utils.1.0.0.nupkg", leaf.PackageContent)
+	resp, _ = ts.request(t, http.MethodGet, "/nuget/feed/registration/contoso.utils/1.0.0.json", nil, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// A version is pushed once, deleting it takes it out of the feed
+	body, header := nugetPush(t, packages["1.0.0"])
+	resp, _ = ts.request(t, http.MethodPut, "/nuget/feed/api/v2/package", body, header)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	resp, _ = ts.request(t, http.MethodDelete, "/nuget/feed/api/v2/package/Contoso.Utils/1.0.0", nil, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp, content = ts.request(t, http.MethodGet, "/nuget/feed/v3-flatcontainer/contoso.utils/index.json", nil, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.JSONEq(t, `{"versions":["1.2.0-beta.1"]}`, content)
+	resp, _ = ts.request(t, http.MethodGet, "/nuget/feed/v3-flatcontainer/contoso.utils/1.0.0/contoso.utils.1.0.0.nupkg", nil, nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
@@ -0,0 +1,321 @@
+package handlers
+
+import (
+	"Boxed/internal/models"
+	"Boxed/internal/services"
+	"errors"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	ociRouteBase     = "base"
+	ociRouteBlob     = "blob"
+	ociRouteUpload   = "upload"
+	ociRouteManifest = "manifest"
+	ociRouteTags     = "tags"
+)
+
+// ociRoute is a parsed request path below /v2/, the name is <box>/<repository>
+type ociRoute struct {
+	kind       string
+	box        *models.Box
+	repository string
+	reference  string
+}
+
+// OciHandler serves boxes of type oci through the OCI distribution API, the first component
+// of a repository name selects the box
+type OciHandler struct {
+	service     services.OciService
+	fileService services.FileService
+}
+
+func NewOciHandler(service services.OciService, fileService services.FileService) *OciHandler {
+	return &OciHandler{service: service, fileService: fileService}
+}
+
+func (h *OciHandler) Get(c *fiber.Ctx) error {
+	route, err := h.parseRoute(c)
+	if err != nil {
+		return ociError(c, err)
+	}
+
+	switch route.kind {
+	case ociRouteBase:
+		return c.JSON(map[string]interface{}{})
+	case ociRouteBlob:
+		item, err := h.service.Blob(route.box, route.repository, route.reference)
+		if err != nil {
+			return ociError(c, err)
+		}
+		c.Set("Docker-Content-Digest", route.reference)
+		return sendBlob(c, h.fileService, route.box, item)
+	case ociRouteUpload:
+		session, err := h.service.GetUpload(route.box, route.repository, route.reference)
+		if err != nil {
+			return ociError(c, err)
+		}
+		setOciUploadHeaders(c, route, session)
+		return c.SendStatus(http.StatusNoContent)
+	case ociRouteManifest:
+		manifest, err := h.service.Manifest(route.box, route.repository, route.reference)
+		if err != nil {
+			return ociError(c, err)
+		}
+		c.Set(fiber.HeaderContentType, manifest.MediaType)
+		c.Set(fiber.HeaderETag, `"`+manifest.Digest+`"`)
+		c.Set("Docker-Content-Digest", manifest.Digest)
+		if c.Method() == fiber.MethodHead {
+			c.Response().Header.SetContentLength(len(manifest.Content))
+			return nil
+		}
+		return c.Send(manifest.Content)
+	case ociRouteTags:
+		return h.tags(c, route)
+	}
+	return ociUnsupported(c)
+}
+
+func (h *OciHandler) tags(c *fiber.Ctx, route *ociRoute) error {
+	tags, err := h.service.Tags(route.box, route.repository)
+	if err != nil {
+		return ociError(c, err)
+	}
+	if last := c.Query("last"); last != "" {
+		tags = tags[sort.SearchStrings(tags, last):]
+		if len(tags) > 0 && tags[0] == last {
+			tags = tags[1:]
+		}
+	}
+	if limit, err := strconv.Atoi(c.Query("n")); err == nil && limit >= 0 && limit < len(tags) {
+		tags = tags[:limit]
+		if limit > 0 {
+			c.Set(fiber.HeaderLink, fmt.Sprintf(`<%s/tags/list?n=%d&last=%s>; rel="next"`,
+				ociNamePath(route), limit, url.QueryEscape(tags[limit-1])))
+		}
+	}
+	return c.JSON(map[string]interface{}{
+		"name": route.box.Name + "/" + route.repository,
+		"tags": tags,
+	})
+}
+
+// Post starts an upload, mounts a blob from another repository with ?mount=&from=, or
+// uploads a whole blob at once with ?digest=
+func (h *OciHandler) Post(c *fiber.Ctx) error {
+	route, err := h.parseRoute(c)
+	if err != nil {
+		return ociError(c, err)
+	}
+	if route.kind != ociRouteUpload || route.reference != "" {
+		return ociUnsupported(c)
+	}
+
+	if digest, from := c.Query("mount"), c.Query("from"); digest != "" && from != "" {
+		if mounted := h.mount(route, digest, from); mounted {
+			c.Location(ociNamePath(route) + "/blobs/" + digest)
+			c.Set("Docker-Content-Digest", digest)
+			return c.SendStatus(http.StatusCreated)
+		}
+	}
+
+	session, err := h.service.StartUpload(route.box, route.repository)
+	if err != nil {
+		return ociError(c, err)
+	}
+	route.reference = session.UUID
+	if digest := c.Query("digest"); digest != "" {
+		return h.completeUpload(c, route, digest, true)
+	}
+	setOciUploadHeaders(c, route, session)
+	return c.SendStatus(http.StatusAccepted)
+}
+
+// mount links the blob of from into the repository of route, failures fall back to a regular upload
+func (h *OciHandler) mount(route *ociRoute, digest string, from string) bool {
+	boxName, fromRepository, _ := strings.Cut(from, "/")
+	fromBox, err := h.fileService.FindBoxByPath(boxName)
+	if err != nil || fromBox == nil || fromBox.Type != models.BoxTypeOci {
+		return false
+	}
+	_, err = h.service.MountBlob(route.box, route.repository, digest, fromBox, fromRepository)
+	return err == nil
+}
+
+// Patch appends a chunk, Content-Range gives the position of the chunk when the client sends it
+func (h *OciHandler) Patch(c *fiber.Ctx) error {
+	route, err := h.parseRoute(c)
+	if err != nil {
+		return ociError(c, err)
+	}
+	if route.kind != ociRouteUpload || route.reference == "" {
+		return ociUnsupported(c)
+	}
+
+	offset := int64(-1)
+	if contentRange := c.Get(fiber.HeaderContentRange); contentRange != "" {
+		start, _, _ := strings.Cut(strings.TrimPrefix(contentRange, "bytes="), "-")
+		offset, err = strconv.ParseInt(start, 10, 64)
+		if err != nil || offset < 0 {
+			return ociError(c, services.ErrUploadOffsetMismatch)
+		}
+	}
+	session, err := h.service.WriteUpload(route.box, route.repository, route.reference, offset, requestBody(c))
+	if err != nil {
+		return ociError(c, err)
+	}
+	setOciUploadHeaders(c, route, session)
+	return c.SendStatus(http.StatusAccepted)
+}
+
+// Put completes an upload, optionally with a last chunk, or pushes a manifest
+func (h *OciHandler) Put(c *fiber.Ctx) error {
+	route, err := h.parseRoute(c)
+	if err != nil {
+		return ociError(c, err)
+	}
+
+	switch {
+	case route.kind == ociRouteUpload && route.reference != "":
+		return h.completeUpload(c, route, c.Query("digest"), c.Request().Header.ContentLength() != 0)
+	case route.kind == ociRouteManifest:
+		digest, err := h.service.PutManifest(route.box, route.repository, route.reference, c.Get(fiber.HeaderContentType), requestBody(c))
+		if err != nil {
+			return ociError(c, err)
+		}
+		c.Location(ociNamePath(route) + "/manifests/" + digest)
+		c.Set("Docker-Content-Digest", digest)
+		return c.SendStatus(http.StatusCreated)
+	}
+	return ociUnsupported(c)
+}
+
+func (h *OciHandler) completeUpload(c *fiber.Ctx, route *ociRoute, digest string, withBody bool) error {
+	if withBody {
+		if _, err := h.service.WriteUpload(route.box, route.repository, route.reference, -1, requestBody(c)); err != nil {
+			return ociError(c, err)
+		}
+	}
+	if err := h.service.CompleteUpload(route.box, route.repository, route.reference, digest); err != nil {
+		if errors.Is(err, services.ErrDigestInvalid) {
+			_ = h.service.CancelUpload(route.box, route.repository, route.reference)
+		}
+		return ociError(c, err)
+	}
+	c.Location(ociNamePath(route) + "/blobs/" + digest)
+	c.Set("Docker-Content-Digest", digest)
+	return c.SendStatus(http.StatusCreated)
+}
+
+// Delete cancels an upload, deleting blobs and manifests is not supported
+func (h *OciHandler) Delete(c *fiber.Ctx) error {
+	route, err := h.parseRoute(c)
+	if err != nil {
+		return ociError(c, err)
+	}
+	if route.kind != ociRouteUpload || route.reference == "" {
+		return ociUnsupported(c)
+	}
+	if err := h.service.CancelUpload(route.box, route.repository, route.reference); err != nil {
+		return ociError(c, err)
+	}
+	return c.SendStatus(http.StatusNoContent)
+}
+
+// parseRoute splits the path after /v2/ from the end, since repository names may contain
+// components such as "blobs" or "manifests" themselves
+func (h *OciHandler) parseRoute(c *fiber.Ctx) (*ociRoute, error) {
+	c.Set("Docker-Distribution-API-Version", "registry/2.0")
+	requestPath, err := url.PathUnescape(c.Params("*"))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", services.ErrNameInvalid, c.Params("*"))
+	}
+	requestPath = strings.Trim(requestPath, "/")
+	if requestPath == "" {
+		return &ociRoute{kind: ociRouteBase}, nil
+	}
+
+	segments := strings.Split(requestPath, "/")
+	route := &ociRoute{}
+	var name []string
+	switch count := len(segments); {
+	case count > 2 && segments[count-2] == "tags" && segments[count-1] == "list":
+		route.kind, name = ociRouteTags, segments[:count-2]
+	case count > 2 && segments[count-2] == "manifests":
+		route.kind, route.reference, name = ociRouteManifest, segments[count-1], segments[:count-2]
+	case count > 2 && segments[count-2] == "blobs" && segments[count-1] == "uploads":
+		route.kind, name = ociRouteUpload, segments[:count-2]
+	case count > 3 && segments[count-3] == "blobs" && segments[count-2] == "uploads":
+		route.kind, route.reference, name = ociRouteUpload, segments[count-1], segments[:count-3]
+	case count > 2 && segments[count-2] == "blobs":
+		route.kind, route.reference, name = ociRouteBlob, segments[count-1], segments[:count-2]
+	default:
+		return nil, fmt.Errorf("%w: %s", services.ErrNameUnknown, requestPath)
+	}
+
+	route.repository = strings.Join(name[1:], "/")
+	if err := services.CheckOciRepository(route.repository); err != nil {
+		return nil, err
+	}
+	box, err := h.fileService.FindBoxByPath(name[0])
+	if err != nil || box == nil || box.Type != models.BoxTypeOci {
+		return nil, fmt.Errorf("%w: %s", services.ErrNameUnknown, name[0])
+	}
+	route.box = box
+	return route, nil
+}
+
+func ociNamePath(route *ociRoute) string {
+	return "/v2/" + route.box.Name + "/" + route.repository
+}
+
+// setOciUploadHeaders describes the state of an upload, Range holds the inclusive range received so far
+func setOciUploadHeaders(c *fiber.Ctx, route *ociRoute, session *models.UploadSession) {
+	c.Location(ociNamePath(route) + "/blobs/uploads/" + session.UUID)
+	c.Set("Docker-Upload-UUID", session.UUID)
+	c.Set(fiber.HeaderRange, fmt.Sprintf("0-%d", max(session.Offset-1, 0)))
+}
+
+func ociUnsupported(c *fiber.Ctx) error {
+	return ociErrorResponse(c, http.StatusMethodNotAllowed, "UNSUPPORTED", "The operation is unsupported")
+}
+
+func ociError(c *fiber.Ctx, err error) error {
+	status, code := http.StatusInternalServerError, "UNKNOWN"
+	switch {
+	case errors.Is(err, services.ErrBlobUnknown):
+		status, code = http.StatusNotFound, "BLOB_UNKNOWN"
+	case errors.Is(err, services.ErrManifestUnknown):
+		status, code = http.StatusNotFound, "MANIFEST_UNKNOWN"
+	case errors.Is(err, services.ErrNameUnknown):
+		status, code = http.StatusNotFound, "NAME_UNKNOWN"
+	case errors.Is(err, services.ErrUploadNotFound):
+		status, code = http.StatusNotFound, "BLOB_UPLOAD_UNKNOWN"
+	case errors.Is(err, services.ErrDigestInvalid):
+		status, code = http.StatusBadRequest, "DIGEST_INVALID"
+	case errors.Is(err, services.ErrManifestInvalid):
+		status, code = http.StatusBadRequest, "MANIFEST_INVALID"
+	case errors.Is(err, services.ErrManifestBlobUnknown):
+		status, code = http.StatusBadRequest, "MANIFEST_BLOB_UNKNOWN"
+	case errors.Is(err, services.ErrNameInvalid):
+		status, code = http.StatusBadRequest, "NAME_INVALID"
+	case errors.Is(err, services.ErrTagInvalid):
+		status, code = http.StatusBadRequest, "TAG_INVALID"
+	case errors.Is(err, services.ErrUploadOffsetMismatch):
+		status, code = http.StatusRequestedRangeNotSatisfiable, "BLOB_UPLOAD_INVALID"
+	}
+	return ociErrorResponse(c, status, code, err.Error())
+}
+
+// ociErrorResponse answers with the error body of the distribution spec
+func ociErrorResponse(c *fiber.Ctx, status int, code string, message string) error {
+	return c.Status(status).JSON(map[string]interface{}{
+		"errors": []map[string]interface{}{{"code": code, "message": message}},
+	})
+}
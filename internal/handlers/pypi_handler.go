@@ -0,0 +1,252 @@
+package handlers
+
+import (
+	"Boxed/internal/helpers"
+	"Boxed/internal/models"
+	"Boxed/internal/services"
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"html/template"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	pypiSimpleJSON     = "application/vnd.pypi.simple.v1+json"
+	pypiSimpleHTML     = "application/vnd.pypi.simple.v1+html"
+	pypiSimpleVersion  = "1.1"
+	pypiSimpleTemplate = `<!DOCTYPE html>
+<html>
+<head><meta name="pypi:repository-version" content="` + pypiSimpleVersion + `"><title>{{.Title}}</title></head>
+<body>
+<h1>{{.Title}}</h1>
+{{range .Links}}<a href="{{.URL}}"{{if .RequiresPython}} data-requires-python="{{.RequiresPython}}"{{end}}>{{.Name}}</a><br>
+{{end}}</body>
+</html>
+`
+)
+
+var pypiTemplate = template.Must(template.New("simple").Parse(pypiSimpleTemplate))
+
+type pypiLink struct {
+	Name           string
+	URL            string
+	RequiresPython string
+}
+
+// PypiHandler serves boxes of type pypi through the simple repository API (PEP 503 and PEP 691)
+// and accepts uploads through the legacy upload API used by twine
+type PypiHandler struct {
+	service     services.PypiService
+	fileService services.FileService
+}
+
+func NewPypiHandler(service services.PypiService, fileService services.FileService) *PypiHandler {
+	return &PypiHandler{service: service, fileService: fileService}
+}
+
+func (h *PypiHandler) Get(c *fiber.Ctx) error {
+	box := h.pypiBox(c)
+	if box == nil {
+		return c.Status(http.StatusNotFound).JSON(map[string]interface{}{"error": "PyPI box not found"})
+	}
+	requestPath, err := url.PathUnescape(c.Params("*"))
+	if err != nil || strings.Contains(requestPath, "..") {
+		return c.Status(http.StatusBadRequest).JSON(map[string]interface{}{"error": "Invalid path"})
+	}
+	segments := strings.Split(strings.Trim(requestPath, "/"), "/")
+
+	switch {
+	case len(segments) == 1 && segments[0] == "simple":
+		return h.projects(c, box)
+	case len(segments) == 2 && segments[0] == "simple":
+		project := helpers.NormalizePythonName(segments[1])
+		if project != segments[1] {
+			return c.Redirect(h.baseURL(c, box)+"/simple/"+project+"/", http.StatusMovedPermanently)
+		}
+		return h.files(c, box, project)
+	case len(segments) == 3 && segments[0] == "packages":
+		item, err := h.service.File(box, segments[1], segments[2])
+		if err != nil {
+			return pypiError(c, err)
+		}
+		return sendBlob(c, h.fileService, box, item)
+	}
+	return c.Status(http.StatusNotFound).JSON(map[string]interface{}{"error": "Not found"})
+}
+
+func (h *PypiHandler) projects(c *fiber.Ctx, box *models.Box) error {
+	projects, err := h.service.Projects(box)
+	if err != nil {
+		return pypiError(c, err)
+	}
+	if wantsSimpleJSON(c) {
+		entries := make([]map[string]string, 0, len(projects))
+		for _, project := range projects {
+			entries = append(entries, map[string]string{"name": project})
+		}
+		return c.JSON(map[string]interface{}{
+			"meta":     map[string]string{"api-version": pypiSimpleVersion},
+			"projects": entries,
+		}, pypiSimpleJSON)
+	}
+
+	links := make([]pypiLink, 0, len(projects))
+	for _, project := range projects {
+		links = append(links, pypiLink{Name: project, URL: project + "/"})
+	}
+	return renderSimple(c, "Simple index", links)
+}
+
+func (h *PypiHandler) files(c *fiber.Ctx, box *models.Box, project string) error {
+	files, err := h.service.Files(box, project)
+	if err != nil {
+		return pypiError(c, err)
+	}
+	packagesURL := h.baseURL(c, box) + "/packages/" + project + "/"
+
+	if wantsSimpleJSON(c) {
+		entries := make([]map[string]interface{}, 0, len(files))
+		versions := make([]string, 0)
+		seen := make(map[string]bool)
+		for _, file := range files {
+			entry := map[string]interface{}{
+				"filename":    file.Filename,
+				"url":         packagesURL + url.PathEscape(file.Filename),
+				"hashes":      map[string]string{"sha256": file.SHA256},
+				"size":        file.Size,
+				"upload-time": file.UploadTime.UTC().Format(time.RFC3339),
+			}
+			if file.RequiresPython != "" {
+				entry["requires-python"] = file.RequiresPython
+			}
+			entries = append(entries, entry)
+			if file.Version != "" && !seen[file.Version] {
+				seen[file.Version] = true
+				versions = append(versions, file.Version)
+			}
+		}
+		return c.JSON(map[string]interface{}{
+			"meta":     map[string]string{"api-version": pypiSimpleVersion},
+			"name":     project,
+			"files":    entries,
+			"versions": versions,
+		}, pypiSimpleJSON)
+	}
+
+	links := make([]pypiLink, 0, len(files))
+	for _, file := range files {
+		links = append(links, pypiLink{
+			Name:           file.Filename,
+			URL:            packagesURL + url.PathEscape(file.Filename) + "#sha256=" + file.SHA256,
+			RequiresPython: file.RequiresPython,
+		})
+	}
+	return renderSimple(c, "Links for "+project, links)
+}
+
+// Upload handles the legacy upload API, the distribution arrives in the "content" part of a
+// multipart form next to its metadata fields
+func (h *PypiHandler) Upload(c *fiber.Ctx) error {
+	box := h.pypiBox(c)
+	if box == nil {
+		return c.Status(http.StatusNotFound).JSON(map[string]interface{}{"error": "PyPI box not found"})
+	}
+	boundary := string(c.Request().Header.MultipartFormBoundary())
+	if boundary == "" {
+		return c.Status(http.StatusBadRequest).JSON(map[string]interface{}{"error": "Expected a multipart upload"})
+	}
+
+	reader := multipart.NewReader(requestBody(c), boundary)
+	fields := make(map[string]string)
+	var blob *services.StoredBlob
+	var filename string
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(map[string]interface{}{"error": "Invalid multipart body"})
+		}
+
+		if part.FormName() == "content" {
+			if blob == nil {
+				filename = part.FileName()
+				blob, err = h.fileService.StoreBlob(box, filename, part)
+				if err != nil {
+					return c.Status(http.StatusInternalServerError).JSON(map[string]interface{}{"error": err.Error()})
+				}
+			}
+		} else {
+			value, err := io.ReadAll(io.LimitReader(part, maxFormValueSize))
+			if err != nil {
+				return c.Status(http.StatusBadRequest).JSON(map[string]interface{}{"error": "Invalid multipart body"})
+			}
+			// Repeated fields such as classifiers are not needed, the first value is kept
+			if _, ok := fields[part.FormName()]; !ok {
+				fields[part.FormName()] = string(value)
+			}
+		}
+		_ = part.Close()
+	}
+
+	if action := fields[":action"]; action != "" && action != "file_upload" {
+		return c.Status(http.StatusBadRequest).JSON(map[string]interface{}{"error": "Unsupported action " + action})
+	}
+	if blob == nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]interface{}{"error": "Missing content"})
+	}
+	item, err := h.service.Upload(box, fields, filename, blob)
+	if err != nil {
+		return pypiError(c, err)
+	}
+	return c.Status(http.StatusCreated).JSON(item)
+}
+
+// pypiBox resolves the box of the request, nil unless it is a pypi box
+func (h *PypiHandler) pypiBox(c *fiber.Ctx) *models.Box {
+	box, err := h.fileService.FindBoxByPath(c.Params("box"))
+	if err != nil || box == nil || box.Type != models.BoxTypePypi {
+		return nil
+	}
+	return box
+}
+
+func (h *PypiHandler) baseURL(c *fiber.Ctx, box *models.Box) string {
+	return c.BaseURL() + "/pypi/" + box.Name
+}
+
+// wantsSimpleJSON negotiates between the JSON and HTML forms of the simple API, HTML is the default
+func wantsSimpleJSON(c *fiber.Ctx) bool {
+	return c.Accepts(pypiSimpleHTML, fiber.MIMETextHTML, pypiSimpleJSON) == pypiSimpleJSON
+}
+
+func renderSimple(c *fiber.Ctx, title string, links []pypiLink) error {
+	contentType := fiber.MIMETextHTMLCharsetUTF8
+	if c.Accepts(fiber.MIMETextHTML, pypiSimpleHTML) == pypiSimpleHTML {
+		contentType = pypiSimpleHTML
+	}
+	c.Set(fiber.HeaderContentType, contentType)
+	return pypiTemplate.Execute(c.Response().BodyWriter(), map[string]interface{}{
+		"Title": title,
+		"Links": links,
+	})
+}
+
+func pypiError(c *fiber.Ctx, err error) error {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrPackageNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidPackage), errors.Is(err, services.ErrChecksumMismatch):
+		status = http.StatusBadRequest
+	case errors.Is(err, services.ErrVersionExists):
+		status = http.StatusConflict
+	}
+	return c.Status(status).JSON(map[string]interface{}{"error": err.Error()})
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"Boxed/internal/models"
+	"Boxed/internal/services"
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func pypiWheel(t *testing.T, distInfo string, metadata string) []byte {
+	var buffer bytes.Buffer
+	archive := zip.NewWriter(&buffer)
+	file, err := archive.Create(distInfo + "/METADATA")
+	require.NoError(t, err)
+	_, err = file.Write([]byte(metadata))
+	require.NoError(t, err)
+	require.NoError(t, archive.Close())
+	return buffer.Bytes()
+}
+
+// pypiUpload builds the multipart form twine sends to the legacy upload API
+func pypiUpload(t *testing.T, filename string, content []byte, fields map[string]string) (*bytes.Buffer, http.Header) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for name, value := range fields {
+		require.NoError(t, writer.WriteField(name, value))
+	}
+	part, err := writer.CreateFormFile("content", filename)
+	require.NoError(t, err)
+	_, err = part.Write(content)
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	return &body, http.Header{"Content-Type": {writer.FormDataContentType()}}
+}
+
+func TestPypiHandler_UploadThenSimpleIndex(t *testing.T) {
+	ts := setupTestServer(t)
+	handler := NewPypiHandler(services.NewPypiService(ts.itemService, ts.fileService, ts.logService), ts.fileService)
+	ts.app.Get("/pypi/:box/*", handler.Get)
+	ts.app.Post("/pypi/:box/legacy", handler.Upload)
+	ts.createBox(t, "python", models.BoxTypePypi, nil)
+
+	filename := "demo_pkg-1.0-py3-none-any.whl"
+	wheel := pypiWheel(t, "demo_pkg-1.0.dist-info", "Metadata-Version: 2.1\nName: Demo.Pkg\nVersion: 1.0\nRequires-Python: >=3.8\n\n")
+	sum := sha256.Sum256(wheel)
+	digest := hex.EncodeToString(sum[:])
+	body, header := pypiUpload(t, filename, wheel, map[string]string{":action": "file_upload", "sha256_digest": digest})
+	resp, content := ts.request(t, http.MethodPost, "/pypi/python/legacy", body, header)
+	require.Equal(t, http.StatusCreated, resp.StatusCode, content)
+
+	// PEP 503: the index links every project by its normalized name
+	resp, content = ts.request(t, http.MethodGet, "/pypi/python/simple/", nil, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, resp.Header.Get("Content-Type"), "text/html")
+	assert.Contains(t, content, `<a href="demo-pkg/">demo-pkg</a>`)
+
+	// Other spellings of the name redirect to the normalized one
+	resp, _ = ts.request(t, http.MethodGet, "/pypi/python/simple/Demo.Pkg/", nil, nil)
+	assert.Equal(t, http.StatusMovedPermanently, resp.StatusCode)
+	assert.Equal(t, "http://example.com/pypi/python/simple/demo-pkg/", resp.Header.Get("Location"))
+
+	// The project page links the file with its hash and the Requires-Python of its metadata
+	resp, content = ts.request(t, http.MethodGet, "/pypi/python/simple/demo-pkg/", nil, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	fileURL := "http://example.com/pypi/python/packages/demo-pkg/" + filename
+	assert.Contains(t, content, `<a href="`+fileURL+`#sha256=`+digest+`" data-requires-python="&gt;=3.8">`+filename+`</a>`)
+
+	// PEP 691 serves the same page as JSON
+	resp, content = ts.request(t, http.MethodGet, "/pypi/python/simple/demo-pkg/", nil, http.Header{"Accept": {pypiSimpleJSON}})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var page struct {
+		Versions []string `json:"versions"`
+		Files    []struct {
+			Filename string            `json:"filename"`
+			URL      string            `json:"url"`
+			Hashes   map[string]string `json:"hashes"`
+		} `json:"files"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(content), &page))
+	assert.Equal(t, []string{"1.0"}, page.Versions)
+	require.Len(t, page.Files, 1)
+	assert.Equal(t, fileURL, page.Files[0].URL)
+	assert.Equal(t, digest, page.Files[0].Hashes["sha256"])
+
+	// The linked file is the uploaded one
+	resp, content = ts.request(t, http.MethodGet, "/pypi/python/packages/demo-pkg/"+filename, nil, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, string(wheel), content)
+
+	// Files are immutable
+	body, header = pypiUpload(t, filename, wheel, map[string]string{":action": "file_upload"})
+	resp, _ = ts.request(t, http.MethodPost, "/pypi/python/legacy", body, header)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	resp, _ = ts.request(t, http.MethodGet, "/pypi/python/simple/missing/", nil, nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
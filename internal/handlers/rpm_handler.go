@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"Boxed/internal/models"
+	"Boxed/internal/services"
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// RpmHandler serves boxes of type rpm as YUM/DNF repositories, the box URL is the baseurl of a .repo file
+type RpmHandler struct {
+	service     services.RpmService
+	fileService services.FileService
+}
+
+func NewRpmHandler(service services.RpmService, fileService services.FileService) *RpmHandler {
+	return &RpmHandler{service: service, fileService: fileService}
+}
+
+func (h *RpmHandler) Get(c *fiber.Ctx) error {
+	box := h.rpmBox(c)
+	if box == nil {
+		return c.Status(http.StatusNotFound).JSON(map[string]interface{}{"error": "Rpm box not found"})
+	}
+	filePath, ok := rpmPath(c)
+	if !ok {
+		return c.Status(http.StatusBadRequest).JSON(map[string]interface{}{"error": "Invalid path"})
+	}
+	item, err := h.service.File(box, filePath)
+	if err != nil {
+		return rpmError(c, err)
+	}
+	return sendBlob(c, h.fileService, box, item)
+}
+
+// Put uploads the package in the body to the path of the request
+func (h *RpmHandler) Put(c *fiber.Ctx) error {
+	box := h.rpmBox(c)
+	if box == nil {
+		return c.Status(http.StatusNotFound).JSON(map[string]interface{}{"error": "Rpm box not found"})
+	}
+	filePath, ok := rpmPath(c)
+	if !ok {
+		return c.Status(http.StatusBadRequest).JSON(map[string]interface{}{"error": "Invalid path"})
+	}
+	rpmPackage, err := h.service.Upload(box, filePath, requestBody(c))
+	if err != nil {
+		return rpmError(c, err)
+	}
+	return c.Status(http.StatusCreated).JSON(rpmPackage)
+}
+
+func (h *RpmHandler) Delete(c *fiber.Ctx) error {
+	box := h.rpmBox(c)
+	if box == nil {
+		return c.Status(http.StatusNotFound).JSON(map[string]interface{}{"error": "Rpm box not found"})
+	}
+	filePath, ok := rpmPath(c)
+	if !ok {
+		return c.Status(http.StatusBadRequest).JSON(map[string]interface{}{"error": "Invalid path"})
+	}
+	if err := h.service.Delete(box, filePath); err != nil {
+		return rpmError(c, err)
+	}
+	return c.JSON(map[string]interface{}{"deleted": true})
+}
+
+// rpmBox resolves the box of the request, nil unless it is an rpm box
+func (h *RpmHandler) rpmBox(c *fiber.Ctx) *models.Box {
+	box, err := h.fileService.FindBoxByPath(c.Params("box"))
+	if err != nil || box == nil || box.Type != models.BoxTypeRpm {
+		return nil
+	}
+	return box
+}
+
+func rpmPath(c *fiber.Ctx) (string, bool) {
+	filePath, err := url.PathUnescape(c.Params("*"))
+	filePath = strings.Trim(filePath, "/")
+	return filePath, err == nil && filePath != ""
+}
+
+func rpmError(c *fiber.Ctx, err error) error {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrPackageNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidPackage):
+		status = http.StatusBadRequest
+	case errors.Is(err, services.ErrVersionExists):
+		status = http.StatusConflict
+	}
+	return c.Status(status).JSON(map[string]interface{}{"error": err.Error()})
+}
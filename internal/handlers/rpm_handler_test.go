@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"Boxed/internal/helpers"
+	"Boxed/internal/models"
+	"Boxed/internal/services"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testRpmPackage builds an rpm with an empty signature and a main header holding the string tags
+func testRpmPackage(tags map[int]string) []byte {
+	headerStructure := func(tags map[int]string) []byte {
+		numbers := make([]int, 0, len(tags))
+		for tag := range tags {
+			numbers = append(numbers, tag)
+		}
+		sort.Ints(numbers)
+		var index, store bytes.Buffer
+		for _, tag := range numbers {
+			// 6 is the string type of the header
+			_ = binary.Write(&index, binary.BigEndian, []uint32{uint32(tag), 6, uint32(store.Len()), 1})
+			store.WriteString(tags[tag] + "\x00")
+		}
+		var header bytes.Buffer
+		header.Write([]byte{0x8e, 0xad, 0xe8, 0x01})
+		_ = binary.Write(&header, binary.BigEndian, []uint32{0, uint32(len(numbers)), uint32(store.Len())})
+		header.Write(index.Bytes())
+		header.Write(store.Bytes())
+		return header.Bytes()
+	}
+
+	var rpm bytes.Buffer
+	rpm.Write([]byte{0xed, 0xab, 0xee, 0xdb})
+	rpm.Write(make([]byte, 92))
+	// The empty signature header ends at a multiple of 8 bytes, no padding is needed
+	rpm.Write(headerStructure(nil))
+	rpm.Write(headerStructure(tags))
+	rpm.WriteString("payload")
+	return rpm.Bytes()
+}
+
+type testRepomd struct {
+	Data []struct {
+		Type     string `xml:"type,attr"`
+		Checksum string `xml:"checksum"`
+		Location struct {
+			Href string `xml:"href,attr"`
+		} `xml:"location"`
+	} `xml:"data"`
+}
+
+// rpmPrimary fetches repomd.xml and the primary metadata it points at, checking the checksum repomd.xml gives
+func rpmPrimary(t *testing.T, ts *testServer, repository string) string {
+	resp, content := ts.request(t, http.MethodGet, repository+"/repodata/repomd.xml", nil, nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var repomd testRepomd
+	require.NoError(t, xml.Unmarshal([]byte(content), &repomd))
+	for _, data := range repomd.Data {
+		if data.Type != "primary" {
+			continue
+		}
+		resp, compressed := ts.request(t, http.MethodGet, repository+"/"+data.Location.Href, nil, nil)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		sum := sha256.Sum256([]byte(compressed))
+		assert.Equal(t, hex.EncodeToString(sum[:]), data.Checksum)
+		reader, err := gzip.NewReader(bytes.NewReader([]byte(compressed)))
+		require.NoError(t, err)
+		primary, err := io.ReadAll(reader)
+		require.NoError(t, err)
+		return string(primary)
+	}
+	t.Fatal("repomd.xml lists no primary metadata")
+	return ""
+}
+
+func TestRpmHandler_UploadThenRepodata(t *testing.T) {
+	ts := setupTestServer(t)
+	handler := NewRpmHandler(services.NewRpmService(ts.itemService, ts.fileService, ts.logService), ts.fileService)
+	ts.app.Get("/rpm/:box/*", handler.Get)
+	ts.app.Put("/rpm/:box/*", handler.Put)
+	ts.app.Delete("/rpm/:box/*", handler.Delete)
+	ts.createBox(t, "el9", models.BoxTypeRpm, nil)
+
+	rpm := testRpmPackage(map[int]string{
+		helpers.RpmTagName:      "hello",
+		helpers.RpmTagVersion:   "1.0",
+		helpers.RpmTagRelease:   "1.el9",
+		helpers.RpmTagArch:      "x86_64",
+		helpers.RpmTagSummary:   "Says hello",
+		helpers.RpmTagSourceRpm: "hello-1.0-1.el9.src.rpm",
+	})
+	location := "Packages/hello-1.0-1.el9.x86_64.rpm"
+	resp, content := ts.request(t, http.MethodPut, "/rpm/el9/"+location, bytes.NewReader(rpm), nil)
+	require.Equal(t, http.StatusCreated, resp.StatusCode, content)
+
+	// repomd.xml points at primary.xml.gz, which lists the package where it can be fetched
+	primary := rpmPrimary(t, ts, "/rpm/el9")
+	assert.Contains(t, primary, `packages="1"`)
+	assert.Contains(t, primary, "<name>hello</name>")
+	assert.Contains(t, primary, "<summary>Says hello</summary>")
+	assert.Contains(t, primary, `<location href="`+location+`"`)
+	resp, content = ts.request(t, http.MethodGet, "/rpm/el9/"+location, nil, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, string(rpm), content)
+
+	// Packages are immutable, deleting one takes it out of the metadata
+	resp, _ = ts.request(t, http.MethodPut, "/rpm/el9/"+location, bytes.NewReader(rpm), nil)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	resp, _ = ts.request(t, http.MethodDelete, "/rpm/el9/"+location, nil, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	primary = rpmPrimary(t, ts, "/rpm/el9")
+	assert.Contains(t, primary, `packages="0"`)
+	assert.NotContains(t, primary, "<name>hello</name>")
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"Boxed/internal/config"
+	"Boxed/internal/models"
+	"Boxed/internal/repository"
+	"Boxed/internal/services"
+	"Boxed/internal/storage"
+	"Boxed/internal/testdb"
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// testServer wires the real services on a sqlite database and a local blob store in a temporary directory,
+// the tests register the routes of the handlers they go through on app
+type testServer struct {
+	app           *fiber.App
+	db            *gorm.DB
+	configuration *config.Configuration
+	logService    services.LogService
+	itemService   services.ItemService
+	boxService    services.BoxService
+	fileService   services.FileService
+}
+
+func setupTestServer(t *testing.T) *testServer {
+	db, err := gorm.Open(testdb.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	// Every connection to :memory: opens a database of its own
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	require.NoError(t, db.AutoMigrate(
+		&models.Box{}, &models.Item{}, &models.ItemVersion{}, &models.Job{}, &models.DataKey{}, &models.UploadSession{},
+	))
+
+	configuration := &config.Configuration{}
+	configuration.Storage.Path = t.TempDir()
+	configuration.Server.LogConfig.Level = "error"
+	ts := &testServer{app: fiber.New(), db: db, configuration: configuration}
+	ts.logService = services.NewLogService(configuration)
+	ts.itemService = services.NewItemService(repository.NewItemRepository(db), repository.NewItemVersionRepository(db))
+	ts.boxService = services.NewBoxService(repository.NewBoxRepository(db))
+	jobService := services.NewJobService(repository.NewJobRepository(db), ts.logService, configuration)
+	keyService, err := services.NewKeyService(repository.NewDataKeyRepository(db), jobService, ts.logService, configuration)
+	require.NoError(t, err)
+	blobStore := storage.NewLocalBlobStore(storage.StagingDir(configuration.Storage.Path, "blobs"))
+	ts.fileService = services.NewFileService(ts.itemService, ts.boxService, blobStore, keyService, ts.logService, configuration)
+	return ts
+}
+
+func (ts *testServer) createBox(t *testing.T, name string, boxType string, properties map[string]interface{}) *models.Box {
+	box, err := ts.boxService.CreateBox(name, properties, filepath.Join(ts.configuration.Storage.Path, name), boxType)
+	require.NoError(t, err)
+	return box
+}
+
+// fileHandler builds the FileHandler with the real archive, remote and virtual services and registers its routes.
+// Its routes catch every path, the routes of other handlers are registered before.
+func (ts *testServer) fileHandler() *FileHandler {
+	remoteService := services.NewRemoteService(ts.itemService, ts.fileService, ts.logService, ts.configuration)
+	handler := NewFileHandler(
+		ts.fileService,
+		services.NewArchiveService(ts.itemService, ts.fileService, ts.logService, ts.configuration),
+		remoteService,
+		services.NewVirtualService(ts.itemService, ts.fileService, remoteService, ts.logService),
+	)
+	ts.app.Post("/upload/:box/*", handler.UploadFile)
+	ts.app.Get("/download/:box/*", handler.DownloadFile)
+	ts.app.Get("/:box/*", handler.ListFileOrFolder)
+	ts.app.Delete("/:box/*", handler.DeleteFile)
+	return handler
+}
+
+// upload sends content as the file form field to the upload route of a box
+func (ts *testServer) upload(t *testing.T, boxName string, filePath string, content string) (*http.Response, string) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file", filePath[strings.LastIndex(filePath, "/")+1:])
+	require.NoError(t, err)
+	_, err = part.Write([]byte(content))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	return ts.request(t, http.MethodPost, "/upload/"+boxName+"/"+filePath, &body, http.Header{"Content-Type": {writer.FormDataContentType()}})
+}
+
+// request sends a request through the app and returns the response with its body read
+func (ts *testServer) request(t *testing.T, method string, target string, body io.Reader, header http.Header) (*http.Response, string) {
+	req := httptest.NewRequest(method, target, body)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	resp, err := ts.app.Test(req, -1)
+	require.NoError(t, err)
+	content, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	return resp, string(content)
+}
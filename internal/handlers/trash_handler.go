@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"Boxed/internal/services"
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"net/http"
+	"strconv"
+)
+
+// TrashHandler lists and restores the deleted items of a box
+type TrashHandler struct {
+	service     services.TrashService
+	fileService services.FileService
+}
+
+func NewTrashHandler(service services.TrashService, fileService services.FileService) *TrashHandler {
+	return &TrashHandler{service: service, fileService: fileService}
+}
+
+// GetTrash lists the deleted items of a box with who deleted them and when
+func (h *TrashHandler) GetTrash(c *fiber.Ctx) error {
+	box, err := h.fileService.FindBoxByPath(c.Params("box"))
+	if err != nil || box == nil {
+		return c.Status(http.StatusNotFound).JSON(map[string]interface{}{"error": "Box not found"})
+	}
+	trash, err := h.service.List(box)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]interface{}{"error": err.Error()})
+	}
+	return c.JSON(trash)
+}
+
+// RestoreItem takes a deleted item out of the trash, a folder comes back with everything below it
+func (h *TrashHandler) RestoreItem(c *fiber.Ctx) error {
+	box, err := h.fileService.FindBoxByPath(c.Params("box"))
+	if err != nil || box == nil {
+		return c.Status(http.StatusNotFound).JSON(map[string]interface{}{"error": "Box not found"})
+	}
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]interface{}{"error": "Invalid id"})
+	}
+	item, err := h.service.Restore(box, uint(id))
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, services.ErrTrashNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, services.ErrTrashConflict):
+			status = http.StatusConflict
+		}
+		return c.Status(status).JSON(map[string]interface{}{"error": err.Error()})
+	}
+	return c.JSON(item)
+}
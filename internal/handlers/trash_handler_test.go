@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"Boxed/internal/dto"
+	"Boxed/internal/models"
+	"Boxed/internal/services"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func (ts *testServer) trash(t *testing.T, boxName string) []dto.TrashItemDTO {
+	resp, content := ts.request(t, http.MethodGet, "/trash/"+boxName, nil, nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode, content)
+	var trash []dto.TrashItemDTO
+	require.NoError(t, json.Unmarshal([]byte(content), &trash))
+	return trash
+}
+
+func TestTrashHandler_DeleteThenRestore(t *testing.T) {
+	ts := setupTestServer(t)
+	handler := NewTrashHandler(services.NewTrashService(ts.itemService, ts.fileService), ts.fileService)
+	ts.app.Get("/trash/:box", handler.GetTrash)
+	ts.app.Post("/trash/:box/:id/restore", handler.RestoreItem)
+	ts.fileHandler()
+	ts.createBox(t, "files", models.BoxTypeGeneric, nil)
+	uploaded := make(map[string]dto.ItemGetDTO)
+	for _, filePath := range []string{"docs/a.txt", "docs/sub/b.txt", "other.txt"} {
+		resp, content := ts.upload(t, "files", filePath, "content of "+filePath)
+		require.Equal(t, http.StatusCreated, resp.StatusCode, content)
+		var item dto.ItemGetDTO
+		require.NoError(t, json.Unmarshal([]byte(content), &item))
+		uploaded[filePath] = item
+	}
+
+	// A folder is only deleted with force, it takes everything below it along
+	resp, _ := ts.request(t, http.MethodDelete, "/files/docs", nil, nil)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp, _ = ts.request(t, http.MethodDelete, "/files/other.txt", nil, nil)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	resp, _ = ts.request(t, http.MethodDelete, "/files/docs?force=true", nil, nil)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	resp, _ = ts.request(t, http.MethodGet, "/download/files/docs/sub/b.txt", nil, nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	resp, _ = ts.request(t, http.MethodGet, "/files/other.txt", nil, nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// The trash lists what was deleted, the latest deletion first, without the items deleted along
+	trash := ts.trash(t, "files")
+	require.Len(t, trash, 2)
+	assert.Equal(t, "docs", trash[0].Path)
+	assert.Equal(t, "folder", trash[0].Type)
+	assert.Equal(t, "other.txt", trash[1].Path)
+	assert.False(t, trash[1].DeletedAt.IsZero())
+
+	// An item deleted along with its folder comes back with the folder only
+	resp, _ = ts.request(t, http.MethodPost, fmt.Sprintf("/trash/files/%d/restore", uploaded["docs/a.txt"].ID), nil, nil)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	resp, content := ts.request(t, http.MethodPost, fmt.Sprintf("/trash/files/%d/restore", trash[0].ID), nil, nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode, content)
+	var restored dto.ItemGetDTO
+	require.NoError(t, json.Unmarshal([]byte(content), &restored))
+	assert.Equal(t, "docs", restored.Path)
+	resp, content = ts.request(t, http.MethodGet, "/download/files/docs/sub/b.txt", nil, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "content of docs/sub/b.txt", content)
+	resp, content = ts.request(t, http.MethodGet, "/download/files/docs/a.txt", nil, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "content of docs/a.txt", content)
+
+	// A path that is taken again cannot be restored
+	resp, content = ts.upload(t, "files", "other.txt", "new content")
+	require.Equal(t, http.StatusCreated, resp.StatusCode, content)
+	trash = ts.trash(t, "files")
+	require.Len(t, trash, 1)
+	resp, _ = ts.request(t, http.MethodPost, fmt.Sprintf("/trash/files/%d/restore", trash[0].ID), nil, nil)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	resp, _ = ts.request(t, http.MethodPost, "/trash/files/9999/restore", nil, nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	resp, _ = ts.request(t, http.MethodPost, "/trash/files/latest/restore", nil, nil)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
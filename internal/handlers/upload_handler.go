@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"Boxed/internal/models"
+	"Boxed/internal/services"
+	"errors"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,creation-defer-length,termination,expiration"
+	tusChunkType  = "application/offset+octet-stream"
+)
+
+// UploadHandler implements resumable uploads following the tus 1.0 protocol
+type UploadHandler struct {
+	service     services.UploadService
+	fileService services.FileService
+}
+
+func NewUploadHandler(service services.UploadService, fileService services.FileService) *UploadHandler {
+	return &UploadHandler{service: service, fileService: fileService}
+}
+
+func (h *UploadHandler) Options(c *fiber.Ctx) error {
+	c.Set("Tus-Resumable", tusVersion)
+	c.Set("Tus-Version", tusVersion)
+	c.Set("Tus-Extension", tusExtensions)
+	return c.SendStatus(http.StatusNoContent)
+}
+
+func (h *UploadHandler) CreateUpload(c *fiber.Ctx) error {
+	boxName := c.Params("box")
+	filePath := strings.TrimLeft(c.Params("*"), "/")
+
+	box, err := h.fileService.FindBoxByPath(boxName)
+	if err != nil || box == nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]interface{}{"error": "Box not found"})
+	}
+
+	length := int64(-1)
+	if c.Get("Upload-Defer-Length") != "1" {
+		lengthHeader := c.Get("Upload-Length", c.Query("length"))
+		length, err = strconv.ParseInt(lengthHeader, 10, 64)
+		if err != nil || length < 0 {
+			return c.Status(http.StatusBadRequest).JSON(map[string]interface{}{"error": "Upload-Length or Upload-Defer-Length is required"})
+		}
+	}
+
+	session, err := h.service.CreateSession(box, filePath, length, c.Query("flat") == "true", c.Query("properties"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]interface{}{"error": err.Error()})
+	}
+
+	c.Set("Tus-Resumable", tusVersion)
+	c.Location("/uploads/" + session.UUID)
+	setUploadHeaders(c, session)
+	return c.Status(http.StatusCreated).JSON(session)
+}
+
+func (h *UploadHandler) UploadStatus(c *fiber.Ctx) error {
+	session, err := h.service.GetSession(c.Params("id"))
+	if err != nil {
+		return uploadError(c, err)
+	}
+	c.Set("Tus-Resumable", tusVersion)
+	c.Set("Cache-Control", "no-store")
+	setUploadHeaders(c, session)
+	if c.Method() == fiber.MethodHead {
+		return c.SendStatus(http.StatusOK)
+	}
+	return c.JSON(session)
+}
+
+func (h *UploadHandler) UploadChunk(c *fiber.Ctx) error {
+	id := c.Params("id")
+	c.Set("Tus-Resumable", tusVersion)
+
+	if !strings.HasPrefix(c.Get(fiber.HeaderContentType), tusChunkType) {
+		return c.Status(http.StatusUnsupportedMediaType).JSON(map[string]interface{}{"error": "Content-Type must be " + tusChunkType})
+	}
+	offset, err := strconv.ParseInt(c.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		return c.Status(http.StatusBadRequest).JSON(map[string]interface{}{"error": "Upload-Offset header is required"})
+	}
+	if lengthHeader := c.Get("Upload-Length"); lengthHeader != "" {
+		length, err := strconv.ParseInt(lengthHeader, 10, 64)
+		if err != nil || length < 0 {
+			return c.Status(http.StatusBadRequest).JSON(map[string]interface{}{"error": "Invalid Upload-Length"})
+		}
+		if _, err := h.service.SetLength(id, length); err != nil {
+			return uploadError(c, err)
+		}
+	}
+
+	session, err := h.service.WriteChunk(id, offset, requestBody(c))
+	if err != nil {
+		if session != nil {
+			setUploadHeaders(c, session)
+		}
+		return uploadError(c, err)
+	}
+
+	// The upload is complete once all announced bytes arrived
+	if session.LengthKnown() && session.Offset == session.Length {
+		item, err := h.service.FinalizeSession(id)
+		if err != nil {
+			return uploadError(c, err)
+		}
+		recordUploader(c, h.fileService, item)
+		c.Set("Content-Location", fmt.Sprintf("/items/%d", item.ID))
+	}
+	setUploadHeaders(c, session)
+	return c.SendStatus(http.StatusNoContent)
+}
+
+func (h *UploadHandler) FinalizeUpload(c *fiber.Ctx) error {
+	item, err := h.service.FinalizeSession(c.Params("id"))
+	if err != nil {
+		return uploadError(c, err)
+	}
+	recordUploader(c, h.fileService, item)
+	return c.Status(http.StatusCreated).JSON(item)
+}
+
+func (h *UploadHandler) AbortUpload(c *fiber.Ctx) error {
+	c.Set("Tus-Resumable", tusVersion)
+	if err := h.service.AbortSession(c.Params("id")); err != nil {
+		return uploadError(c, err)
+	}
+	return c.SendStatus(http.StatusNoContent)
+}
+
+func setUploadHeaders(c *fiber.Ctx, session *models.UploadSession) {
+	c.Set("Upload-Offset", strconv.FormatInt(session.Offset, 10))
+	if session.LengthKnown() {
+		c.Set("Upload-Length", strconv.FormatInt(session.Length, 10))
+	} else {
+		c.Set("Upload-Defer-Length", "1")
+	}
+	c.Set("Upload-Expires", session.ExpiresAt.UTC().Format(http.TimeFormat))
+}
+
+func uploadError(c *fiber.Ctx, err error) error {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrUploadNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, services.ErrUploadOffsetMismatch), errors.Is(err, services.ErrUploadCompleted):
+		status = http.StatusConflict
+	case errors.Is(err, services.ErrUploadTooLarge):
+		status = http.StatusRequestEntityTooLarge
+	case errors.Is(err, services.ErrUploadIncomplete):
+		status = http.StatusBadRequest
+	}
+	return c.Status(status).JSON(map[string]interface{}{"error": err.Error()})
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"Boxed/internal/models"
+	"Boxed/internal/services"
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// VersionHandler lists, serves and restores the prior revisions of files
+type VersionHandler struct {
+	service     services.VersionService
+	fileService services.FileService
+}
+
+func NewVersionHandler(service services.VersionService, fileService services.FileService) *VersionHandler {
+	return &VersionHandler{service: service, fileService: fileService}
+}
+
+// GetVersions lists the revisions of a file, the current one first. With ?version=N it serves the
+// content of that revision instead.
+func (h *VersionHandler) GetVersions(c *fiber.Ctx) error {
+	box, filePath, err := h.versionTarget(c)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]interface{}{"error": err.Error()})
+	}
+	if c.Query("version") != "" {
+		version, err := strconv.Atoi(c.Query("version"))
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(map[string]interface{}{"error": "Invalid version"})
+		}
+		item, err := h.service.Version(box, filePath, version)
+		if err != nil {
+			return versionError(c, err)
+		}
+		return sendBlob(c, h.fileService, box, item)
+	}
+
+	current, versions, err := h.service.Versions(box, filePath)
+	if err != nil {
+		return versionError(c, err)
+	}
+	return c.JSON(map[string]interface{}{
+		"current":  current,
+		"versions": versions,
+	})
+}
+
+// RestoreVersion makes the revision given by ?version=N the current content of a file
+func (h *VersionHandler) RestoreVersion(c *fiber.Ctx) error {
+	box, filePath, err := h.versionTarget(c)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]interface{}{"error": err.Error()})
+	}
+	version, err := strconv.Atoi(c.Query("version"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]interface{}{"error": "Invalid version"})
+	}
+	item, err := h.service.Restore(box, filePath, version)
+	if err != nil {
+		return versionError(c, err)
+	}
+	recordUploader(c, h.fileService, item)
+	return c.JSON(item)
+}
+
+func (h *VersionHandler) versionTarget(c *fiber.Ctx) (*models.Box, string, error) {
+	box, err := h.fileService.FindBoxByPath(c.Params("box"))
+	if err != nil || box == nil {
+		return nil, "", errors.New("Box not found")
+	}
+	return box, strings.Trim(c.Params("*"), "/"), nil
+}
+
+func versionError(c *fiber.Ctx, err error) error {
+	status := http.StatusInternalServerError
+	if errors.Is(err, services.ErrVersionNotFound) {
+		status = http.StatusNotFound
+	}
+	return c.Status(status).JSON(map[string]interface{}{"error": err.Error()})
+}
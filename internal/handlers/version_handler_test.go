@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"Boxed/internal/dto"
+	"Boxed/internal/models"
+	"Boxed/internal/services"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testVersions struct {
+	Current  dto.ItemGetDTO       `json:"current"`
+	Versions []models.ItemVersion `json:"versions"`
+}
+
+func (ts *testServer) versions(t *testing.T, target string) testVersions {
+	resp, content := ts.request(t, http.MethodGet, target, nil, nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode, content)
+	var versions testVersions
+	require.NoError(t, json.Unmarshal([]byte(content), &versions))
+	return versions
+}
+
+func TestVersionHandler_RestoreVersion(t *testing.T) {
+	ts := setupTestServer(t)
+	handler := NewVersionHandler(services.NewVersionService(ts.itemService, ts.fileService, ts.logService), ts.fileService)
+	ts.app.Get("/versions/:box/*", handler.GetVersions)
+	ts.app.Post("/versions/:box/*", handler.RestoreVersion)
+	ts.fileHandler()
+	ts.createBox(t, "docs", models.BoxTypeGeneric, nil)
+	for _, content := range []string{"first", "second", "third"} {
+		resp, body := ts.upload(t, "docs", "notes/readme.txt", content)
+		require.Equal(t, http.StatusCreated, resp.StatusCode, body)
+	}
+
+	// Every upload over the file keeps the content it replaced as a revision, the newest first
+	versions := ts.versions(t, "/versions/docs/notes/readme.txt")
+	assert.Equal(t, 3, versions.Current.Version)
+	require.Len(t, versions.Versions, 2)
+	assert.Equal(t, 2, versions.Versions[0].Version)
+	assert.Equal(t, 1, versions.Versions[1].Version)
+	resp, content := ts.request(t, http.MethodGet, "/versions/docs/notes/readme.txt?version=1", nil, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "first", content)
+
+	// Restoring a revision makes its content current again and keeps the replaced one
+	resp, content = ts.request(t, http.MethodPost, "/versions/docs/notes/readme.txt?version=1", nil, nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode, content)
+	var restored dto.ItemGetDTO
+	require.NoError(t, json.Unmarshal([]byte(content), &restored))
+	assert.Equal(t, 4, restored.Version)
+	assert.Equal(t, "notes/readme.txt", restored.Path)
+	resp, content = ts.request(t, http.MethodGet, "/download/docs/notes/readme.txt", nil, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "first", content)
+	versions = ts.versions(t, "/versions/docs/notes/readme.txt")
+	assert.Equal(t, 4, versions.Current.Version)
+	require.Len(t, versions.Versions, 3)
+	assert.Equal(t, 3, versions.Versions[0].Version)
+	resp, content = ts.request(t, http.MethodGet, "/versions/docs/notes/readme.txt?version=3", nil, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "third", content)
+
+	resp, _ = ts.request(t, http.MethodPost, "/versions/docs/notes/readme.txt?version=9", nil, nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	resp, _ = ts.request(t, http.MethodPost, "/versions/docs/notes/readme.txt?version=latest", nil, nil)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp, _ = ts.request(t, http.MethodPost, "/versions/docs/notes/missing.txt?version=1", nil, nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
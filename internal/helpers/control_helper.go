@@ -0,0 +1,68 @@
+package helpers
+
+import (
+	"errors"
+	"strings"
+)
+
+// ControlField is one field of a Debian control paragraph. Values of multi-line fields keep their
+// continuation lines, each starting with a newline and a space.
+type ControlField struct {
+	Name  string
+	Value string
+}
+
+// ParseControlParagraph parses the first paragraph of a Debian control file, keeping the field order
+func ParseControlParagraph(content string) ([]ControlField, error) {
+	var fields []ControlField
+	for _, line := range strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n") {
+		if strings.TrimSpace(line) == "" {
+			if len(fields) > 0 {
+				break
+			}
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			if len(fields) == 0 {
+				return nil, errors.New("continuation line before the first field")
+			}
+			fields[len(fields)-1].Value += "\n " + strings.TrimSpace(line)
+			continue
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok || name == "" || strings.ContainsAny(name, " \t") {
+			return nil, errors.New("invalid control line: " + line)
+		}
+		fields = append(fields, ControlField{Name: name, Value: strings.TrimSpace(value)})
+	}
+	if len(fields) == 0 {
+		return nil, errors.New("empty control paragraph")
+	}
+	return fields, nil
+}
+
+// ControlValue returns the value of the named field, field names are case-insensitive
+func ControlValue(fields []ControlField, name string) string {
+	for _, field := range fields {
+		if strings.EqualFold(field.Name, name) {
+			return field.Value
+		}
+	}
+	return ""
+}
+
+// FormatControlParagraph writes fields back as a paragraph, every field on its own line
+func FormatControlParagraph(fields []ControlField) string {
+	var paragraph strings.Builder
+	for _, field := range fields {
+		paragraph.WriteString(field.Name + ":")
+		if field.Value != "" && !strings.HasPrefix(field.Value, "\n") {
+			paragraph.WriteString(" ")
+		}
+		paragraph.WriteString(field.Value + "\n")
+	}
+	return paragraph.String()
+}
@@ -0,0 +1,23 @@
+package helpers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseControlParagraph(t *testing.T) {
+	control := "Package: hello\nVersion: 2.10-3\n# comment\nDescription: example package\n greets the world\n .\n twice\n\nPackage: ignored\n"
+	fields, err := ParseControlParagraph(control)
+	assert.NoError(t, err)
+	assert.Len(t, fields, 3)
+	assert.Equal(t, "2.10-3", ControlValue(fields, "version"))
+	assert.Equal(t, "example package\n greets the world\n .\n twice", ControlValue(fields, "Description"))
+	assert.Equal(t, "", ControlValue(fields, "Depends"))
+	assert.Equal(t, "Package: hello\nVersion: 2.10-3\nDescription: example package\n greets the world\n .\n twice\n", FormatControlParagraph(fields))
+
+	for _, invalid := range []string{"", " leading continuation", "no separator", "bad name: x"} {
+		_, err := ParseControlParagraph(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
@@ -1,10 +1,13 @@
 package helpers
 
 import (
+	"crypto/md5"
+	"crypto/sha1"
 	"crypto/sha256"
 	"crypto/sha512"
 	"encoding/hex"
 	"fmt"
+	"hash"
 	"io"
 	"mime/multipart"
 	"os"
@@ -56,19 +59,26 @@ func SaveFileAndComputeChecksums(fileHeader *multipart.FileHeader, destinationPa
 		return "", "", err
 	}
 
+	sha256sum, sha512sum, _, err = CopyAndComputeChecksums(dst, src)
+	return sha256sum, sha512sum, err
+}
+
+// CopyAndComputeChecksums copies src to dst while calculating SHA256 and SHA512 hashes of the copied data
+func CopyAndComputeChecksums(dst io.Writer, src io.Reader) (sha256sum string, sha512sum string, written int64, err error) {
 	sha256Hasher := sha256.New()
 	sha512Hasher := sha512.New()
 
 	writer := io.MultiWriter(dst, sha256Hasher, sha512Hasher)
 
-	if _, err := io.Copy(writer, src); err != nil {
-		return "", "", err
+	written, err = io.Copy(writer, src)
+	if err != nil {
+		return "", "", written, err
 	}
 
 	sha256sum = hex.EncodeToString(sha256Hasher.Sum(nil))
 	sha512sum = hex.EncodeToString(sha512Hasher.Sum(nil))
 
-	return sha256sum, sha512sum, nil
+	return sha256sum, sha512sum, written, nil
 }
 
 // CopyFile copies a file from src to dst
@@ -118,22 +128,35 @@ func ComputeChecksums(filePath string) (sha256sum string, sha512sum string, err
 	}
 	defer file.Close()
 
-	sha256Hasher := sha256.New()
-	sha512Hasher := sha512.New()
-
-	// Create a multi-writer to write to both hashers simultaneously
-	multiWriter := io.MultiWriter(sha256Hasher, sha512Hasher)
-
-	if _, err := io.Copy(multiWriter, file); err != nil {
+	sha256sum, sha512sum, _, err = CopyAndComputeChecksums(io.Discard, file)
+	if err != nil {
 		return "", "", fmt.Errorf("could not compute checksums: %w", err)
 	}
 
-	sha256sum = hex.EncodeToString(sha256Hasher.Sum(nil))
-	sha512sum = hex.EncodeToString(sha512Hasher.Sum(nil))
-
 	return sha256sum, sha512sum, nil
 }
 
+// ChecksumOf hashes reader with one of md5, sha1, sha256 or sha512 and returns the hex digest
+func ChecksumOf(algorithm string, reader io.Reader) (string, error) {
+	var hasher hash.Hash
+	switch algorithm {
+	case "md5":
+		hasher = md5.New()
+	case "sha1":
+		hasher = sha1.New()
+	case "sha256":
+		hasher = sha256.New()
+	case "sha512":
+		hasher = sha512.New()
+	default:
+		return "", fmt.Errorf("unsupported checksum algorithm: %s", algorithm)
+	}
+	if _, err := io.Copy(hasher, reader); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
 func DeleteFile(path string, recurse bool) error {
 	if recurse {
 		err := os.RemoveAll(path)
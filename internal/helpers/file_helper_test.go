@@ -0,0 +1,33 @@
+package helpers
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCopyAndComputeChecksums(t *testing.T) {
+	var dst bytes.Buffer
+	sha256sum, sha512sum, written, err := CopyAndComputeChecksums(&dst, strings.NewReader("hello"))
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), written)
+	assert.Equal(t, "hello", dst.String())
+	assert.Equal(t, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", sha256sum)
+	assert.Equal(t, "9b71d224bd62f3785d96d46ad3ea3d73319bfbc2890caadae2dff72519673ca72323c3d99ba5c11d7c7acc6e14b8c5da0c4663475c2e5c3adef46f73bcdec043", sha512sum)
+}
+
+func TestChecksumOf(t *testing.T) {
+	sha1sum, err := ChecksumOf("sha1", strings.NewReader("hello"))
+	assert.NoError(t, err)
+	assert.Equal(t, "aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d", sha1sum)
+
+	md5sum, err := ChecksumOf("md5", strings.NewReader("hello"))
+	assert.NoError(t, err)
+	assert.Equal(t, "5d41402abc4b2a76b9719d911017c592", md5sum)
+
+	_, err = ChecksumOf("crc32", strings.NewReader("hello"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,80 @@
+package helpers
+
+import (
+	"encoding/json"
+	"path"
+	"strings"
+)
+
+// MatchGlob matches a slash separated path against a glob pattern. "**" matches any number of
+// path segments, the other wildcards follow path.Match. A pattern without a slash is matched
+// against the last segment only, so "*.jar" finds jars at any depth.
+func MatchGlob(pattern string, name string) bool {
+	pattern = strings.Trim(pattern, "/")
+	name = strings.Trim(name, "/")
+	if !strings.Contains(pattern, "/") && pattern != "**" {
+		matched, _ := path.Match(pattern, path.Base(name))
+		return matched
+	}
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+// MatchAnyGlob reports whether name matches at least one of the patterns
+func MatchAnyGlob(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if MatchGlob(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// SplitGlobs splits a comma separated list of patterns, dropping empty entries
+func SplitGlobs(value string) []string {
+	var patterns []string
+	for _, pattern := range strings.Split(value, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns
+}
+
+// ParseGlobList reads a pattern list of a JSON property, given either as a list of patterns or as a
+// comma separated string
+func ParseGlobList(value json.RawMessage) ([]string, error) {
+	if len(value) == 0 || string(value) == "null" {
+		return nil, nil
+	}
+	var list string
+	if err := json.Unmarshal(value, &list); err == nil {
+		return SplitGlobs(list), nil
+	}
+	var patterns []string
+	if err := json.Unmarshal(value, &patterns); err != nil {
+		return nil, err
+	}
+	return SplitGlobs(strings.Join(patterns, ",")), nil
+}
+
+func matchSegments(pattern []string, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			rest := pattern[1:]
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(rest, name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if matched, err := path.Match(pattern[0], name[0]); err != nil || !matched {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
@@ -0,0 +1,37 @@
+package helpers
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchGlob(t *testing.T) {
+	assert.True(t, MatchGlob("*.jar", "lib/deep/app.jar"))
+	assert.False(t, MatchGlob("*.jar", "lib/app.war"))
+	assert.True(t, MatchGlob("docs/**", "docs/api/index.html"))
+	assert.True(t, MatchGlob("**/test/*.txt", "a/b/test/x.txt"))
+	assert.True(t, MatchGlob("**/test/*.txt", "test/x.txt"))
+	assert.False(t, MatchGlob("docs/*", "docs/api/index.html"))
+	assert.True(t, MatchGlob("**", "anything/at/all"))
+}
+
+func TestSplitGlobs(t *testing.T) {
+	assert.Equal(t, []string{"*.jar", "docs/**"}, SplitGlobs(" *.jar, ,docs/** "))
+	assert.Nil(t, SplitGlobs(""))
+}
+
+func TestParseGlobList(t *testing.T) {
+	patterns, err := ParseGlobList(json.RawMessage(`"*.jar, docs/**"`))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"*.jar", "docs/**"}, patterns)
+	patterns, err = ParseGlobList(json.RawMessage(`["*.jar", " ", "docs/**"]`))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"*.jar", "docs/**"}, patterns)
+	patterns, err = ParseGlobList(json.RawMessage(`null`))
+	assert.NoError(t, err)
+	assert.Nil(t, patterns)
+	_, err = ParseGlobList(json.RawMessage(`{"include":"*.jar"}`))
+	assert.Error(t, err)
+}
@@ -0,0 +1,96 @@
+package helpers
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// maxRanges limits the ranges served for a single request, longer lists are ignored
+const maxRanges = 32
+
+var ErrUnsatisfiableRange = errors.New("requested range not satisfiable")
+
+// ByteRange is a section of a file requested through the Range header
+type ByteRange struct {
+	Start  int64
+	Length int64
+}
+
+// ContentRange formats the range as the value of a Content-Range header
+func (r ByteRange) ContentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.Start, r.Start+r.Length-1, size)
+}
+
+// ParseRange parses a Range header such as "bytes=0-99,200-,-50" for a file of the given size.
+// Malformed headers return no ranges so the whole file is served. ErrUnsatisfiableRange is
+// returned when none of the ranges overlaps the file.
+func ParseRange(header string, size int64) ([]ByteRange, error) {
+	spec, found := strings.CutPrefix(strings.TrimSpace(header), "bytes=")
+	if !found {
+		return nil, nil
+	}
+	specs := strings.Split(spec, ",")
+	if len(specs) > maxRanges {
+		return nil, nil
+	}
+
+	var ranges []ByteRange
+	for _, rangeSpec := range specs {
+		first, last, found := strings.Cut(strings.TrimSpace(rangeSpec), "-")
+		if !found {
+			return nil, nil
+		}
+		first, last = strings.TrimSpace(first), strings.TrimSpace(last)
+
+		if first == "" {
+			// Suffix range, the last n bytes of the file
+			suffix, err := strconv.ParseInt(last, 10, 64)
+			if err != nil || suffix < 0 {
+				return nil, nil
+			}
+			if suffix == 0 || size == 0 {
+				continue
+			}
+			suffix = min(suffix, size)
+			ranges = append(ranges, ByteRange{Start: size - suffix, Length: suffix})
+			continue
+		}
+
+		start, err := strconv.ParseInt(first, 10, 64)
+		if err != nil || start < 0 {
+			return nil, nil
+		}
+		end := size - 1
+		if last != "" {
+			end, err = strconv.ParseInt(last, 10, 64)
+			if err != nil || end < start {
+				return nil, nil
+			}
+			end = min(end, size-1)
+		}
+		if start >= size {
+			continue
+		}
+		ranges = append(ranges, ByteRange{Start: start, Length: end - start + 1})
+	}
+
+	if len(ranges) == 0 {
+		return nil, ErrUnsatisfiableRange
+	}
+	return ranges, nil
+}
+
+// MatchETag reports whether an If-None-Match or If-Match header lists etag. Weak validators
+// match their strong counterpart, "*" matches any entity tag.
+func MatchETag(header string, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,44 @@
+package helpers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRange(t *testing.T) {
+	ranges, err := ParseRange("bytes=0-9, 90-, -5", 100)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []ByteRange{{Start: 0, Length: 10}, {Start: 90, Length: 10}, {Start: 95, Length: 5}}, ranges)
+	assert.Equal(t, "bytes 90-99/100", ranges[1].ContentRange(100))
+}
+
+func TestParseRange_ClampsEnd(t *testing.T) {
+	ranges, err := ParseRange("bytes=50-500", 100)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []ByteRange{{Start: 50, Length: 50}}, ranges)
+}
+
+func TestParseRange_Unsatisfiable(t *testing.T) {
+	_, err := ParseRange("bytes=100-", 100)
+
+	assert.ErrorIs(t, err, ErrUnsatisfiableRange)
+}
+
+func TestParseRange_MalformedIsIgnored(t *testing.T) {
+	for _, header := range []string{"items=0-1", "bytes=5-1", "bytes=a-b", "bytes=10"} {
+		ranges, err := ParseRange(header, 100)
+
+		assert.NoError(t, err, header)
+		assert.Nil(t, ranges, header)
+	}
+}
+
+func TestMatchETag(t *testing.T) {
+	assert.True(t, MatchETag(`"a", "b"`, `"b"`))
+	assert.True(t, MatchETag(`W/"b"`, `"b"`))
+	assert.True(t, MatchETag(`*`, `"b"`))
+	assert.False(t, MatchETag(`"a"`, `"b"`))
+}
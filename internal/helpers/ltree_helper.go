@@ -2,80 +2,67 @@ package helpers
 
 import (
 	"Boxed/internal/models"
+	"fmt"
+	"strconv"
 	"strings"
 )
 
-// PathToLtree converts user path to ltree format
-// Example: "native-1234/file2.pkg" -> "native_1234.file2_pkg"
+// PathToLtree converts user path to ltree format, every name becomes a label of its own
+// Example: "native-1234/file2.pkg" -> "native_2d1234.file2_2epkg"
 func PathToLtree(path string) string {
 	// First split by slashes to get path parts
 	parts := strings.Split(path, "/")
 
 	// Process each part
 	for i, part := range parts {
-		// Only replace hyphens with underscores
-		parts[i] = strings.ReplaceAll(part, "-", "_")
+		parts[i] = EncodeLtreeLabel(part)
 	}
 
 	// Join with dots
 	return strings.Join(parts, ".")
 }
 
+// LtreeToUserPath converts the ltree path of an item back to the user path it was stored with
 func LtreeToUserPath(item *models.Item) string {
-	if item == nil {
+	if item == nil || item.Path == "" {
 		return ""
 	}
 
-	// Split the path into parts
-	parts := strings.Split(item.Path, ".")
-
-	if item.Type == "file" {
-		// Get the last parts that might make up the filename
-		lastParts := parts[len(parts)-2:] // Get last two parts
-		possibleFilename := strings.Join(lastParts, ".")
-
-		// If these parts match our filename, we should exclude them from path
-		if possibleFilename == item.Name {
-			// Use all parts except the last two
-			parentParts := parts[:len(parts)-2]
-
-			// Convert parent parts from underscore to hyphen
-			for i := range parentParts {
-				parentParts[i] = strings.ReplaceAll(parentParts[i], "_", "-")
-			}
-
-			// Join with the original filename
-			if len(parentParts) > 0 {
-				return strings.Join(parentParts, "/") + "/" + item.Name
-			}
-			return item.Name
-		}
-	}
-
-	// For folders or non-matching files, convert all parts
-	for i := range parts {
-		parts[i] = strings.ReplaceAll(parts[i], "_", "-")
+	labels := strings.Split(item.Path, ".")
+	for i := range labels {
+		labels[i] = DecodeLtreeLabel(labels[i])
 	}
-
-	return strings.Join(parts, "/")
+	return strings.Join(labels, "/")
 }
 
-// UserPathToLtree converts a user path to database format
-func UserPathToLtree(path string) string {
-	parts := strings.Split(path, "/")
-
-	// Convert all parts to underscore format
-	for i := range parts {
-		if i < len(parts)-1 { // Don't convert the last part if it's a filename
-			parts[i] = strings.ReplaceAll(parts[i], "-", "_")
+// EncodeLtreeLabel converts a name to an ltree label. Letters and digits are kept, every other byte,
+// dots and underscores included, becomes an underscore followed by its two hex digits, so "my-lib.tgz"
+// turns into "my_2dlib_2etgz". Distinct names get distinct labels and DecodeLtreeLabel gives the name back.
+func EncodeLtreeLabel(name string) string {
+	var label strings.Builder
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' {
+			label.WriteByte(c)
+			continue
 		}
+		_, _ = fmt.Fprintf(&label, "_%02x", c)
 	}
-
-	return strings.Join(parts, ".")
+	return label.String()
 }
 
-// SanitizeLtreeIdentifier converts a string to ltree-safe format
-func SanitizeLtreeIdentifier(input string) string {
-	// Replace hyphens with underscores
-	return strings.ReplaceAll(input, "-", "_")
+// DecodeLtreeLabel returns the name EncodeLtreeLabel converted to the label
+func DecodeLtreeLabel(label string) string {
+	var name strings.Builder
+	for i := 0; i < len(label); i++ {
+		if label[i] == '_' && i+2 < len(label) {
+			if c, err := strconv.ParseUint(label[i+1:i+3], 16, 8); err == nil {
+				name.WriteByte(byte(c))
+				i += 2
+				continue
+			}
+		}
+		name.WriteByte(label[i])
+	}
+	return name.String()
 }
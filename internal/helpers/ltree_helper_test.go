@@ -0,0 +1,38 @@
+package helpers
+
+import (
+	"Boxed/internal/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodeLtreeLabel(t *testing.T) {
+	assert.Equal(t, "native_2d1234", EncodeLtreeLabel("native-1234"))
+	assert.Equal(t, "_40scope", EncodeLtreeLabel("@scope"))
+	assert.Equal(t, "app_2d1_2e0_2bbeta_2etgz", EncodeLtreeLabel("app-1.0+beta.tgz"))
+	assert.Equal(t, "r_c3_a9sum_c3_a9", EncodeLtreeLabel("résumé"))
+
+	// Names that only differ in their punctuation keep apart
+	names := []string{"a-b", "a_b", "a+b", "a b", "a.b", "a_2db", "a__b"}
+	labels := make(map[string]string)
+	for _, name := range names {
+		label := EncodeLtreeLabel(name)
+		assert.NotContains(t, labels, label, name)
+		assert.Regexp(t, `^[A-Za-z0-9_]+$`, label)
+		assert.Equal(t, name, DecodeLtreeLabel(label))
+		labels[label] = name
+	}
+}
+
+func TestPathToLtree(t *testing.T) {
+	assert.Equal(t, "native_2d1234.file2_2epkg", PathToLtree("native-1234/file2.pkg"))
+	assert.Equal(t, "_40scope.pkg.pkg_2d1_2e0_2e0_2etgz", PathToLtree("@scope/pkg/pkg-1.0.0.tgz"))
+}
+
+func TestLtreeToUserPath(t *testing.T) {
+	assert.Equal(t, "native-1234/file2.pkg", LtreeToUserPath(&models.Item{Name: "file2.pkg", Type: "file", Path: "native_2d1234.file2_2epkg"}))
+	assert.Equal(t, "my_dir/a.b", LtreeToUserPath(&models.Item{Name: "a.b", Type: "folder", Path: "my_5fdir.a_2eb"}))
+	assert.Equal(t, "README", LtreeToUserPath(&models.Item{Name: "README", Type: "file", Path: "README"}))
+	assert.Equal(t, "@scope/pkg/pkg-1.0.0.tgz", LtreeToUserPath(&models.Item{Path: PathToLtree("@scope/pkg/pkg-1.0.0.tgz")}))
+}
@@ -0,0 +1,55 @@
+package helpers
+
+import (
+	"regexp"
+	"strings"
+)
+
+var pythonNameSeparators = regexp.MustCompile(`[-_.]+`)
+
+// NormalizePythonName normalizes a Python project name as PEP 503 describes: lower case
+// with every run of "-", "_" and "." replaced by a single "-"
+func NormalizePythonName(name string) string {
+	return pythonNameSeparators.ReplaceAllString(strings.ToLower(strings.TrimSpace(name)), "-")
+}
+
+// EscapeModulePath applies the case-encoding of the module proxy protocol: every upper case
+// letter becomes "!" followed by its lower case form, so "github.com/Azure" is "github.com/!azure"
+func EscapeModulePath(modulePath string) string {
+	var escaped strings.Builder
+	for _, r := range modulePath {
+		if 'A' <= r && r <= 'Z' {
+			escaped.WriteByte('!')
+			r += 'a' - 'A'
+		}
+		escaped.WriteRune(r)
+	}
+	return escaped.String()
+}
+
+// UnescapeModulePath reverses EscapeModulePath. Escaped paths never contain upper case letters,
+// so a path with one, a "!" not followed by a lower case letter, or a trailing "!" is rejected.
+func UnescapeModulePath(escaped string) (string, bool) {
+	var unescaped strings.Builder
+	bang := false
+	for _, r := range escaped {
+		switch {
+		case 'A' <= r && r <= 'Z':
+			return "", false
+		case bang:
+			if r < 'a' || r > 'z' {
+				return "", false
+			}
+			unescaped.WriteRune(r + 'A' - 'a')
+			bang = false
+		case r == '!':
+			bang = true
+		default:
+			unescaped.WriteRune(r)
+		}
+	}
+	if bang {
+		return "", false
+	}
+	return unescaped.String(), true
+}
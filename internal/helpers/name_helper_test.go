@@ -0,0 +1,31 @@
+package helpers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizePythonName(t *testing.T) {
+	assert.Equal(t, "friendly-bard", NormalizePythonName("Friendly-Bard"))
+	assert.Equal(t, "friendly-bard", NormalizePythonName("FRIENDLY_BARD"))
+	assert.Equal(t, "friendly-bard", NormalizePythonName("friendly.bard"))
+	assert.Equal(t, "friendly-bard", NormalizePythonName("Friendly-._.-Bard"))
+}
+
+func TestEscapeModulePath(t *testing.T) {
+	assert.Equal(t, "github.com/!azure/azure-sdk-for-go", EscapeModulePath("github.com/Azure/azure-sdk-for-go"))
+	assert.Equal(t, "github.com/!burnt!sushi/toml", EscapeModulePath("github.com/BurntSushi/toml"))
+	assert.Equal(t, "golang.org/x/mod", EscapeModulePath("golang.org/x/mod"))
+}
+
+func TestUnescapeModulePath(t *testing.T) {
+	modulePath, ok := UnescapeModulePath("github.com/!burnt!sushi/toml")
+	assert.True(t, ok)
+	assert.Equal(t, "github.com/BurntSushi/toml", modulePath)
+
+	for _, escaped := range []string{"github.com/Azure/x", "github.com/!/x", "github.com/!1/x", "github.com/x!"} {
+		_, ok := UnescapeModulePath(escaped)
+		assert.False(t, ok, escaped)
+	}
+}
@@ -0,0 +1,40 @@
+package helpers
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// ParseProperties converts a "key=value;key=value" string into a property map.
+// Repeated keys are collected into the same slice, invalid pairs are skipped.
+func ParseProperties(properties string) map[string][]string {
+	propertiesMap := make(map[string][]string)
+	if properties == "" {
+		return propertiesMap
+	}
+	keyValueProperties := strings.Split(properties, ";")
+	for i := range keyValueProperties {
+		keyAndValue := strings.SplitN(keyValueProperties[i], "=", 2)
+		if len(keyAndValue) != 2 {
+			continue // Skip invalid key-value pairs
+		}
+		key := strings.TrimSpace(keyAndValue[0])
+		value := strings.TrimSpace(keyAndValue[1])
+		propertiesMap[key] = append(propertiesMap[key], value)
+	}
+	return propertiesMap
+}
+
+// PropertiesToJSON parses a "key=value;key=value" string into its JSON representation
+func PropertiesToJSON(properties string) ([]byte, error) {
+	return json.Marshal(ParseProperties(properties))
+}
+
+// PropertiesFromJSON decodes properties stored by PropertiesToJSON, invalid JSON yields no properties
+func PropertiesFromJSON(properties []byte) map[string][]string {
+	propertiesMap := make(map[string][]string)
+	if len(properties) > 0 {
+		_ = json.Unmarshal(properties, &propertiesMap)
+	}
+	return propertiesMap
+}
@@ -0,0 +1,31 @@
+package helpers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseProperties(t *testing.T) {
+	properties := ParseProperties("env=prod; team = core;env=staging;invalid")
+
+	assert.Equal(t, []string{"prod", "staging"}, properties["env"])
+	assert.Equal(t, []string{"core"}, properties["team"])
+	assert.NotContains(t, properties, "invalid")
+}
+
+func TestPropertiesToJSON_Empty(t *testing.T) {
+	jsonProperties, err := PropertiesToJSON("")
+
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{}`, string(jsonProperties))
+}
+
+func TestPropertiesFromJSON(t *testing.T) {
+	properties := PropertiesFromJSON([]byte(`{"name":["@scope/pkg"],"dist_tags":["latest=1.0.0"]}`))
+
+	assert.Equal(t, []string{"@scope/pkg"}, properties["name"])
+	assert.Equal(t, []string{"latest=1.0.0"}, properties["dist_tags"])
+	assert.Empty(t, PropertiesFromJSON(nil))
+	assert.Empty(t, PropertiesFromJSON([]byte("not json")))
+}
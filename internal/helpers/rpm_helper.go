@@ -0,0 +1,257 @@
+package helpers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Tags of the main header of an rpm package
+const (
+	RpmTagName            = 1000
+	RpmTagVersion         = 1001
+	RpmTagRelease         = 1002
+	RpmTagEpoch           = 1003
+	RpmTagSummary         = 1004
+	RpmTagDescription     = 1005
+	RpmTagBuildTime       = 1006
+	RpmTagBuildHost       = 1007
+	RpmTagSize            = 1009
+	RpmTagVendor          = 1011
+	RpmTagLicense         = 1014
+	RpmTagPackager        = 1015
+	RpmTagGroup           = 1016
+	RpmTagURL             = 1020
+	RpmTagArch            = 1022
+	RpmTagOldFilenames    = 1027
+	RpmTagFileModes       = 1030
+	RpmTagFileFlags       = 1037
+	RpmTagSourceRpm       = 1044
+	RpmTagArchiveSize     = 1046
+	RpmTagProvideName     = 1047
+	RpmTagRequireFlags    = 1048
+	RpmTagRequireName     = 1049
+	RpmTagRequireVersion  = 1050
+	RpmTagConflictFlags   = 1053
+	RpmTagConflictName    = 1054
+	RpmTagConflictVersion = 1055
+	RpmTagChangelogTime   = 1080
+	RpmTagChangelogName   = 1081
+	RpmTagChangelogText   = 1082
+	RpmTagObsoleteName    = 1090
+	RpmTagProvideFlags    = 1112
+	RpmTagProvideVersion  = 1113
+	RpmTagObsoleteFlags   = 1114
+	RpmTagObsoleteVersion = 1115
+	RpmTagDirIndexes      = 1116
+	RpmTagBaseNames       = 1117
+	RpmTagDirNames        = 1118
+	RpmTagLongSize        = 5009
+)
+
+const (
+	rpmLeadSize      = 96
+	rpmMaxIndexCount = 0xffff
+	rpmMaxStoreSize  = 0x0fffffff
+)
+
+// Types of header entries
+const (
+	rpmTypeChar        = 1
+	rpmTypeInt8        = 2
+	rpmTypeInt16       = 3
+	rpmTypeInt32       = 4
+	rpmTypeInt64       = 5
+	rpmTypeString      = 6
+	rpmTypeBin         = 7
+	rpmTypeStringArray = 8
+	rpmTypeI18nString  = 9
+)
+
+var (
+	rpmLeadMagic   = []byte{0xed, 0xab, 0xee, 0xdb}
+	rpmHeaderMagic = []byte{0x8e, 0xad, 0xe8, 0x01}
+)
+
+type rpmHeaderEntry struct {
+	kind   uint32
+	offset uint32
+	count  uint32
+}
+
+// RpmHeader is the main header of an rpm package. Start and End are its byte range in the file,
+// repository metadata lists them so clients can fetch the header alone.
+type RpmHeader struct {
+	Start   int64
+	End     int64
+	entries map[int]rpmHeaderEntry
+	store   []byte
+}
+
+// ReadRpmHeader reads the lead, the signature header and the main header of an rpm package
+func ReadRpmHeader(reader io.Reader) (*RpmHeader, error) {
+	lead := make([]byte, rpmLeadSize)
+	if _, err := io.ReadFull(reader, lead); err != nil || !bytes.Equal(lead[:4], rpmLeadMagic) {
+		return nil, errors.New("not an rpm package")
+	}
+	signature, err := readRpmHeaderStructure(reader)
+	if err != nil {
+		return nil, fmt.Errorf("signature header: %w", err)
+	}
+	// The signature header is padded to a multiple of 8 bytes
+	offset := int64(rpmLeadSize) + signature.size()
+	padding := (8 - offset%8) % 8
+	if _, err := io.CopyN(io.Discard, reader, padding); err != nil {
+		return nil, err
+	}
+	header, err := readRpmHeaderStructure(reader)
+	if err != nil {
+		return nil, fmt.Errorf("header: %w", err)
+	}
+	header.Start = offset + padding
+	header.End = header.Start + header.size()
+	return header, nil
+}
+
+func readRpmHeaderStructure(reader io.Reader) (*RpmHeader, error) {
+	intro := make([]byte, 16)
+	if _, err := io.ReadFull(reader, intro); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(intro[:4], rpmHeaderMagic) {
+		return nil, errors.New("bad header magic")
+	}
+	count := binary.BigEndian.Uint32(intro[8:12])
+	storeSize := binary.BigEndian.Uint32(intro[12:16])
+	if count > rpmMaxIndexCount || storeSize > rpmMaxStoreSize {
+		return nil, errors.New("header too large")
+	}
+	index := make([]byte, count*16)
+	if _, err := io.ReadFull(reader, index); err != nil {
+		return nil, err
+	}
+	header := &RpmHeader{entries: make(map[int]rpmHeaderEntry, count), store: make([]byte, storeSize)}
+	if _, err := io.ReadFull(reader, header.store); err != nil {
+		return nil, err
+	}
+	for i := uint32(0); i < count; i++ {
+		entry := index[i*16 : i*16+16]
+		header.entries[int(binary.BigEndian.Uint32(entry[0:4]))] = rpmHeaderEntry{
+			kind:   binary.BigEndian.Uint32(entry[4:8]),
+			offset: binary.BigEndian.Uint32(entry[8:12]),
+			count:  binary.BigEndian.Uint32(entry[12:16]),
+		}
+	}
+	return header, nil
+}
+
+func (h *RpmHeader) size() int64 {
+	return 16 + int64(len(h.entries))*16 + int64(len(h.store))
+}
+
+// String returns the value of a string tag, the first translation of an i18n string
+func (h *RpmHeader) String(tag int) string {
+	if values := h.Strings(tag); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// Strings returns the values of a string array tag, empty when the tag is missing or malformed
+func (h *RpmHeader) Strings(tag int) []string {
+	entry, ok := h.entries[tag]
+	if !ok || entry.kind != rpmTypeString && entry.kind != rpmTypeStringArray && entry.kind != rpmTypeI18nString {
+		return nil
+	}
+	if entry.kind == rpmTypeString {
+		entry.count = 1
+	}
+	var values []string
+	offset := int(entry.offset)
+	for i := uint32(0); i < entry.count; i++ {
+		if offset > len(h.store) {
+			return nil
+		}
+		end := bytes.IndexByte(h.store[offset:], 0)
+		if end < 0 {
+			return nil
+		}
+		values = append(values, string(h.store[offset:offset+end]))
+		offset += end + 1
+	}
+	return values
+}
+
+// Int returns the first value of an integer tag
+func (h *RpmHeader) Int(tag int) (int64, bool) {
+	if values := h.Ints(tag); len(values) > 0 {
+		return values[0], true
+	}
+	return 0, false
+}
+
+// Ints returns the values of an integer tag, unsigned as rpm stores sizes, modes and flags
+func (h *RpmHeader) Ints(tag int) []int64 {
+	entry, ok := h.entries[tag]
+	if !ok {
+		return nil
+	}
+	var width int
+	switch entry.kind {
+	case rpmTypeChar, rpmTypeInt8:
+		width = 1
+	case rpmTypeInt16:
+		width = 2
+	case rpmTypeInt32:
+		width = 4
+	case rpmTypeInt64:
+		width = 8
+	default:
+		return nil
+	}
+	start, end := int64(entry.offset), int64(entry.offset)+int64(entry.count)*int64(width)
+	if end > int64(len(h.store)) {
+		return nil
+	}
+	values := make([]int64, 0, entry.count)
+	for offset := start; offset < end; offset += int64(width) {
+		value := h.store[offset : offset+int64(width)]
+		switch width {
+		case 1:
+			values = append(values, int64(value[0]))
+		case 2:
+			values = append(values, int64(binary.BigEndian.Uint16(value)))
+		case 4:
+			values = append(values, int64(binary.BigEndian.Uint32(value)))
+		case 8:
+			values = append(values, int64(binary.BigEndian.Uint64(value)))
+		}
+	}
+	return values
+}
+
+// Has reports whether the header carries the tag
+func (h *RpmHeader) Has(tag int) bool {
+	_, ok := h.entries[tag]
+	return ok
+}
+
+// Files returns the paths of the files in the package, joined from base and directory names
+func (h *RpmHeader) Files() []string {
+	baseNames := h.Strings(RpmTagBaseNames)
+	if len(baseNames) == 0 {
+		return h.Strings(RpmTagOldFilenames)
+	}
+	dirNames := h.Strings(RpmTagDirNames)
+	dirIndexes := h.Ints(RpmTagDirIndexes)
+	files := make([]string, 0, len(baseNames))
+	for i, baseName := range baseNames {
+		if i >= len(dirIndexes) || dirIndexes[i] >= int64(len(dirNames)) {
+			return nil
+		}
+		files = append(files, dirNames[dirIndexes[i]]+baseName)
+	}
+	return files
+}
@@ -0,0 +1,92 @@
+package helpers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testRpmTag struct {
+	tag   int
+	kind  uint32
+	value interface{}
+}
+
+func testRpmHeaderStructure(tags []testRpmTag) []byte {
+	var index, store bytes.Buffer
+	for _, tag := range tags {
+		var count int
+		switch value := tag.value.(type) {
+		case string:
+			binary.Write(&index, binary.BigEndian, []uint32{uint32(tag.tag), tag.kind, uint32(store.Len()), 1})
+			store.WriteString(value + "\x00")
+			continue
+		case []string:
+			count = len(value)
+			binary.Write(&index, binary.BigEndian, []uint32{uint32(tag.tag), tag.kind, uint32(store.Len()), uint32(count)})
+			for _, s := range value {
+				store.WriteString(s + "\x00")
+			}
+			continue
+		case []uint16:
+			for store.Len()%2 != 0 {
+				store.WriteByte(0)
+			}
+			count = len(value)
+		case []uint32:
+			for store.Len()%4 != 0 {
+				store.WriteByte(0)
+			}
+			count = len(value)
+		}
+		binary.Write(&index, binary.BigEndian, []uint32{uint32(tag.tag), tag.kind, uint32(store.Len()), uint32(count)})
+		binary.Write(&store, binary.BigEndian, tag.value)
+	}
+	var header bytes.Buffer
+	header.Write(rpmHeaderMagic)
+	binary.Write(&header, binary.BigEndian, []uint32{0, uint32(index.Len() / 16), uint32(store.Len())})
+	header.Write(index.Bytes())
+	header.Write(store.Bytes())
+	return header.Bytes()
+}
+
+func TestReadRpmHeader(t *testing.T) {
+	var rpm bytes.Buffer
+	rpm.Write(rpmLeadMagic)
+	rpm.Write(make([]byte, rpmLeadSize-4))
+	rpm.Write(testRpmHeaderStructure([]testRpmTag{{1000, rpmTypeInt32, []uint32{5}}, {1002, rpmTypeBin, []uint32{1}}, {1004, rpmTypeString, "md5"}}))
+	for rpm.Len()%8 != 0 {
+		rpm.WriteByte(0)
+	}
+	start := rpm.Len()
+	rpm.Write(testRpmHeaderStructure([]testRpmTag{
+		{RpmTagName, rpmTypeString, "hello"},
+		{RpmTagSummary, rpmTypeI18nString, []string{"Says hello"}},
+		{RpmTagFileModes, rpmTypeInt16, []uint16{0o100755, 0o40755}},
+		{RpmTagEpoch, rpmTypeInt32, []uint32{2}},
+		{RpmTagBaseNames, rpmTypeStringArray, []string{"hello", "doc"}},
+		{RpmTagDirIndexes, rpmTypeInt32, []uint32{0, 1}},
+		{RpmTagDirNames, rpmTypeStringArray, []string{"/usr/bin/", "/usr/share/"}},
+	}))
+	end := rpm.Len()
+	rpm.WriteString("payload")
+
+	header, err := ReadRpmHeader(&rpm)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(start), header.Start)
+	assert.Equal(t, int64(end), header.End)
+	assert.Equal(t, "hello", header.String(RpmTagName))
+	assert.Equal(t, "Says hello", header.String(RpmTagSummary))
+	assert.Equal(t, []int64{0o100755, 0o40755}, header.Ints(RpmTagFileModes))
+	epoch, ok := header.Int(RpmTagEpoch)
+	assert.True(t, ok)
+	assert.Equal(t, int64(2), epoch)
+	assert.Equal(t, []string{"/usr/bin/hello", "/usr/share/doc"}, header.Files())
+	assert.False(t, header.Has(RpmTagRelease))
+	assert.Nil(t, header.Strings(RpmTagEpoch))
+
+	_, err = ReadRpmHeader(bytes.NewReader([]byte("not an rpm")))
+	assert.Error(t, err)
+}
@@ -0,0 +1,50 @@
+package helpers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// UpstreamValidators are the validators of a cached copy, an upstream that still has the same
+// content answers a request carrying them with 304 Not Modified
+type UpstreamValidators struct {
+	ETag         string
+	LastModified string
+}
+
+// UpstreamURL joins the base URL of an upstream repository and a path inside of it. Every segment
+// of the path is escaped, empty segments and dot segments are rejected.
+func UpstreamURL(baseURL string, filePath string) (string, error) {
+	base, err := url.Parse(strings.TrimSpace(baseURL))
+	if err != nil || base.Scheme != "http" && base.Scheme != "https" || base.Host == "" {
+		return "", fmt.Errorf("invalid upstream URL %q", baseURL)
+	}
+	segments := strings.Split(strings.Trim(filePath, "/"), "/")
+	for i, segment := range segments {
+		if segment == "" || segment == "." || segment == ".." {
+			return "", fmt.Errorf("invalid path %q", filePath)
+		}
+		segments[i] = url.PathEscape(segment)
+	}
+	base.RawQuery, base.Fragment = "", ""
+	return strings.TrimRight(base.String(), "/") + "/" + strings.Join(segments, "/"), nil
+}
+
+// FetchUpstream sends a GET request for rawURL, made conditional by the validators that are set.
+// The caller closes the body of the response.
+func FetchUpstream(client *http.Client, rawURL string, validators UpstreamValidators) (*http.Response, error) {
+	request, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("User-Agent", "Boxed")
+	if validators.ETag != "" {
+		request.Header.Set("If-None-Match", validators.ETag)
+	}
+	if validators.LastModified != "" {
+		request.Header.Set("If-Modified-Since", validators.LastModified)
+	}
+	return client.Do(request)
+}
@@ -0,0 +1,55 @@
+package helpers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpstreamURL(t *testing.T) {
+	upstreamURL, err := UpstreamURL("https://repo.example.com/maven2/", "/org/example/lib 1.0.jar")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://repo.example.com/maven2/org/example/lib%201.0.jar", upstreamURL)
+
+	upstreamURL, err = UpstreamURL("http://repo.example.com?token=x", "a/b")
+	assert.NoError(t, err)
+	assert.Equal(t, "http://repo.example.com/a/b", upstreamURL)
+}
+
+func TestUpstreamURL_Invalid(t *testing.T) {
+	for _, baseURL := range []string{"", "ftp://repo.example.com", "repo.example.com/path", "https://"} {
+		_, err := UpstreamURL(baseURL, "a")
+		assert.Error(t, err, baseURL)
+	}
+	for _, filePath := range []string{"", "a//b", "a/../b", "./a"} {
+		_, err := UpstreamURL("https://repo.example.com", filePath)
+		assert.Error(t, err, filePath)
+	}
+}
+
+func TestFetchUpstream(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		_, _ = io.WriteString(w, "content of "+r.URL.Path)
+	}))
+	defer upstream.Close()
+
+	response, err := FetchUpstream(upstream.Client(), upstream.URL+"/a/b.txt", UpstreamValidators{})
+	assert.NoError(t, err)
+	body, _ := io.ReadAll(response.Body)
+	_ = response.Body.Close()
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, "content of /a/b.txt", string(body))
+
+	response, err = FetchUpstream(upstream.Client(), upstream.URL+"/a/b.txt", UpstreamValidators{ETag: response.Header.Get("ETag")})
+	assert.NoError(t, err)
+	_ = response.Body.Close()
+	assert.Equal(t, http.StatusNotModified, response.StatusCode)
+}
@@ -0,0 +1,257 @@
+package helpers
+
+import (
+	"math/big"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// mavenQualifiers ranks the well known qualifiers, a release without qualifier ranks as ""
+var mavenQualifiers = map[string]int{
+	"alpha":     1,
+	"a":         1,
+	"beta":      2,
+	"b":         2,
+	"milestone": 3,
+	"m":         3,
+	"rc":        4,
+	"cr":        4,
+	"snapshot":  5,
+	"":          6,
+	"ga":        6,
+	"final":     6,
+	"release":   6,
+	"sp":        7,
+}
+
+type versionToken struct {
+	number    *big.Int
+	qualifier string
+}
+
+// CompareMavenVersions orders versions the way Maven does for the common cases:
+// numeric parts compare as numbers, "1.0" equals "1", and qualifiers rank
+// alpha < beta < milestone < rc < snapshot < release < sp < anything else.
+// It returns -1, 0 or 1.
+func CompareMavenVersions(a string, b string) int {
+	tokensA, tokensB := tokenizeVersion(a), tokenizeVersion(b)
+	for i := 0; i < max(len(tokensA), len(tokensB)); i++ {
+		var tokenA, tokenB *versionToken
+		if i < len(tokensA) {
+			tokenA = &tokensA[i]
+		}
+		if i < len(tokensB) {
+			tokenB = &tokensB[i]
+		}
+		if result := compareVersionTokens(tokenA, tokenB); result != 0 {
+			return result
+		}
+	}
+	return 0
+}
+
+func tokenizeVersion(version string) []versionToken {
+	var tokens []versionToken
+	var current strings.Builder
+	currentIsDigit := false
+	flush := func() {
+		if current.Len() == 0 {
+			return
+		}
+		value := current.String()
+		current.Reset()
+		if currentIsDigit {
+			number, _ := new(big.Int).SetString(value, 10)
+			tokens = append(tokens, versionToken{number: number})
+			return
+		}
+		tokens = append(tokens, versionToken{qualifier: strings.ToLower(value)})
+	}
+	for _, r := range version {
+		if r == '.' || r == '-' || r == '_' {
+			flush()
+			continue
+		}
+		isDigit := unicode.IsDigit(r)
+		if current.Len() > 0 && isDigit != currentIsDigit {
+			flush()
+		}
+		currentIsDigit = isDigit
+		current.WriteRune(r)
+	}
+	flush()
+	return tokens
+}
+
+// compareVersionTokens compares two tokens, a missing token acts as 0 or as a release qualifier
+func compareVersionTokens(a *versionToken, b *versionToken) int {
+	if a == nil && b == nil {
+		return 0
+	}
+	if a == nil {
+		return -compareVersionTokens(b, nil)
+	}
+	if b == nil {
+		if a.number != nil {
+			return a.number.Sign()
+		}
+		return compareQualifiers(a.qualifier, "")
+	}
+	switch {
+	case a.number != nil && b.number != nil:
+		return a.number.Cmp(b.number)
+	case a.number != nil:
+		return 1
+	case b.number != nil:
+		return -1
+	}
+	return compareQualifiers(a.qualifier, b.qualifier)
+}
+
+func compareQualifiers(a string, b string) int {
+	rankA, knownA := mavenQualifiers[a]
+	rankB, knownB := mavenQualifiers[b]
+	if !knownA {
+		rankA = len(mavenQualifiers)
+	}
+	if !knownB {
+		rankB = len(mavenQualifiers)
+	}
+	switch {
+	case rankA != rankB:
+		if rankA < rankB {
+			return -1
+		}
+		return 1
+	case !knownA && !knownB:
+		return strings.Compare(a, b)
+	}
+	return 0
+}
+
+// CompareSemver orders semantic versions: the numeric core first, then a version without
+// pre-release above one with it, then the pre-release identifiers. Build metadata is ignored.
+// It returns -1, 0 or 1.
+func CompareSemver(a string, b string) int {
+	coreA, preA := splitSemver(a)
+	coreB, preB := splitSemver(b)
+	for i := 0; i < max(len(coreA), len(coreB)); i++ {
+		if result := compareNumericIdentifiers(semverPart(coreA, i), semverPart(coreB, i)); result != 0 {
+			return result
+		}
+	}
+	switch {
+	case preA == "" && preB == "":
+		return 0
+	case preA == "":
+		return 1
+	case preB == "":
+		return -1
+	}
+
+	identifiersA, identifiersB := strings.Split(preA, "."), strings.Split(preB, ".")
+	for i := 0; i < min(len(identifiersA), len(identifiersB)); i++ {
+		numericA, numericB := isNumeric(identifiersA[i]), isNumeric(identifiersB[i])
+		var result int
+		switch {
+		case numericA && numericB:
+			result = compareNumericIdentifiers(identifiersA[i], identifiersB[i])
+		case numericA:
+			result = -1
+		case numericB:
+			result = 1
+		default:
+			result = strings.Compare(identifiersA[i], identifiersB[i])
+		}
+		if result != 0 {
+			return result
+		}
+	}
+	switch {
+	case len(identifiersA) < len(identifiersB):
+		return -1
+	case len(identifiersA) > len(identifiersB):
+		return 1
+	}
+	return 0
+}
+
+// IsPrerelease reports whether a semantic version carries a pre-release part
+func IsPrerelease(version string) bool {
+	_, prerelease := splitSemver(version)
+	return prerelease != ""
+}
+
+// NormalizeNugetVersion brings a NuGet version into the normalized form the v3 protocol uses in
+// package paths: no leading zeros, at least three numeric parts, a fourth part only when it is not
+// zero and no build metadata. "1.01" is "1.1.0", "1.0.0.0-Beta+sha" is "1.0.0-Beta".
+func NormalizeNugetVersion(version string) (string, bool) {
+	version, _, _ = strings.Cut(strings.TrimSpace(version), "+")
+	core, prerelease, hasPrerelease := strings.Cut(version, "-")
+	parts := strings.Split(core, ".")
+	if len(parts) > 4 {
+		return "", false
+	}
+	numbers := make([]string, 0, 4)
+	for _, part := range parts {
+		if !isNumeric(part) {
+			return "", false
+		}
+		number, _ := new(big.Int).SetString(part, 10)
+		numbers = append(numbers, number.String())
+	}
+	for len(numbers) < 3 {
+		numbers = append(numbers, "0")
+	}
+	if len(numbers) == 4 && numbers[3] == "0" {
+		numbers = numbers[:3]
+	}
+	normalized := strings.Join(numbers, ".")
+	if !hasPrerelease {
+		return normalized, true
+	}
+	for _, identifier := range strings.Split(prerelease, ".") {
+		if identifier == "" || strings.IndexFunc(identifier, func(r rune) bool {
+			return r != '-' && (r >= utf8.RuneSelf || !unicode.IsLetter(r) && !unicode.IsDigit(r))
+		}) >= 0 {
+			return "", false
+		}
+	}
+	return normalized + "-" + prerelease, true
+}
+
+func splitSemver(version string) ([]string, string) {
+	version = strings.TrimPrefix(strings.TrimSpace(version), "v")
+	version, _, _ = strings.Cut(version, "+")
+	core, prerelease, _ := strings.Cut(version, "-")
+	return strings.Split(core, "."), prerelease
+}
+
+func semverPart(parts []string, i int) string {
+	if i < len(parts) {
+		return parts[i]
+	}
+	return "0"
+}
+
+func compareNumericIdentifiers(a string, b string) int {
+	numberA, okA := new(big.Int).SetString(a, 10)
+	numberB, okB := new(big.Int).SetString(b, 10)
+	if !okA || !okB {
+		return strings.Compare(a, b)
+	}
+	return numberA.Cmp(numberB)
+}
+
+func isNumeric(value string) bool {
+	if value == "" {
+		return false
+	}
+	for _, r := range value {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,53 @@
+package helpers
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompareMavenVersions(t *testing.T) {
+	assert.Equal(t, 0, CompareMavenVersions("1.0", "1"))
+	assert.Equal(t, 0, CompareMavenVersions("1.0", "1.0-final"))
+	assert.Equal(t, -1, CompareMavenVersions("1.0-SNAPSHOT", "1.0"))
+	assert.Equal(t, -1, CompareMavenVersions("1.0-rc1", "1.0"))
+	assert.Equal(t, 1, CompareMavenVersions("1.10", "1.9"))
+	assert.Equal(t, 1, CompareMavenVersions("1.0.1", "1.0-sp"))
+}
+
+func TestCompareMavenVersions_Sort(t *testing.T) {
+	versions := []string{"2.0", "1.0", "1.0-beta-2", "1.0-alpha", "1.0-SNAPSHOT", "1.0-rc1", "1.0-beta-10"}
+	sort.Slice(versions, func(i, j int) bool { return CompareMavenVersions(versions[i], versions[j]) < 0 })
+
+	assert.Equal(t, []string{"1.0-alpha", "1.0-beta-2", "1.0-beta-10", "1.0-rc1", "1.0-SNAPSHOT", "1.0", "2.0"}, versions)
+}
+
+func TestCompareSemver(t *testing.T) {
+	versions := []string{"1.0.0", "1.0.0-rc.1", "1.0.0-alpha.beta", "1.0.0-alpha", "0.9.12", "1.0.0-beta.11", "1.0.0-alpha.1", "1.0.0-beta.2", "1.0.0-beta", "1.10.0", "1.2.0"}
+	sort.Slice(versions, func(i, j int) bool { return CompareSemver(versions[i], versions[j]) < 0 })
+
+	assert.Equal(t, []string{"0.9.12", "1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-alpha.beta", "1.0.0-beta", "1.0.0-beta.2", "1.0.0-beta.11", "1.0.0-rc.1", "1.0.0", "1.2.0", "1.10.0"}, versions)
+	assert.Equal(t, 0, CompareSemver("v1.0.0+build.5", "1.0.0"))
+	assert.True(t, IsPrerelease("2.0.0-rc.1"))
+	assert.False(t, IsPrerelease("2.0.0+build"))
+}
+
+func TestNormalizeNugetVersion(t *testing.T) {
+	for version, expected := range map[string]string{
+		"1.0":              "1.0.0",
+		"1.01.002":         "1.1.2",
+		"1.0.0.0":          "1.0.0",
+		"1.2.3.4":          "1.2.3.4",
+		"1.0.0-Beta.1+abc": "1.0.0-Beta.1",
+		"2":                "2.0.0",
+	} {
+		normalized, ok := NormalizeNugetVersion(version)
+		assert.True(t, ok, version)
+		assert.Equal(t, expected, normalized, version)
+	}
+	for _, version := range []string{"", "1.2.3.4.5", "1.x", "1.0-", "1.0-beta..1", "1.0-beta_1", "-1.0"} {
+		_, ok := NormalizeNugetVersion(version)
+		assert.False(t, ok, version)
+	}
+}
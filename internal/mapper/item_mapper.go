@@ -28,18 +28,22 @@ func ToItemGetDTO(item *models.Item) (*dto.ItemGetDTO, error) {
 	userPath := helpers.LtreeToUserPath(item)
 
 	itemDTO := &dto.ItemGetDTO{
-		ID:         item.ID,
-		ParentID:   item.ParentID,
-		BoxID:      item.BoxID,
-		Name:       item.Name,
-		Path:       userPath,
-		Type:       item.Type,
-		Size:       item.Size,
-		SHA256:     item.SHA256,
-		SHA512:     item.SHA512,
-		Properties: props,
-		Children:   childrenDTOs,
-		Extension:  item.Extension,
+		ID:          item.ID,
+		ParentID:    item.ParentID,
+		BoxID:       item.BoxID,
+		Name:        item.Name,
+		Path:        userPath,
+		Type:        item.Type,
+		Size:        item.Size,
+		StoredSize:  item.StoredSize,
+		SHA256:      item.SHA256,
+		SHA512:      item.SHA512,
+		Properties:  props,
+		Children:    childrenDTOs,
+		Extension:   item.Extension,
+		Version:     item.Version,
+		Uploader:    item.Uploader,
+		Quarantined: item.Quarantined,
 	}
 	return itemDTO, nil
 }
@@ -69,9 +73,12 @@ func ToItemModel(d dto.ItemGetDTO) (*models.Item, error) {
 		Path:       helpers.PathToLtree(d.Path),
 		Type:       d.Type,
 		Size:       d.Size,
+		StoredSize: d.StoredSize,
 		Properties: props,
 		Children:   childrenItems,
 		Extension:  d.Extension,
+		Version:    d.Version,
+		Uploader:   d.Uploader,
 	}, nil
 }
 
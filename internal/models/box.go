@@ -12,3 +12,42 @@ type Box struct {
 	Path       string          `gorm:"type:varchar(255);not null;unique" json:"path"`
 	Type       string          `gorm:"varchar(255)" json:"type"`
 }
+
+// Box types, a typed box additionally speaks the protocol of its package format
+const (
+	BoxTypeGeneric = "generic"
+	BoxTypeMaven   = "maven"
+	BoxTypeNpm     = "npm"
+	BoxTypePypi    = "pypi"
+	BoxTypeGoproxy = "goproxy"
+	BoxTypeOci     = "oci"
+	BoxTypeHelm    = "helm"
+	BoxTypeDebian  = "debian"
+	BoxTypeRpm     = "rpm"
+	BoxTypeNuget   = "nuget"
+	BoxTypeCargo   = "cargo"
+	BoxTypeRemote  = "remote"
+	BoxTypeVirtual = "virtual"
+)
+
+var boxTypes = map[string]bool{
+	"":             true,
+	BoxTypeGeneric: true,
+	BoxTypeMaven:   true,
+	BoxTypeNpm:     true,
+	BoxTypePypi:    true,
+	BoxTypeGoproxy: true,
+	BoxTypeOci:     true,
+	BoxTypeHelm:    true,
+	BoxTypeDebian:  true,
+	BoxTypeRpm:     true,
+	BoxTypeNuget:   true,
+	BoxTypeCargo:   true,
+	BoxTypeRemote:  true,
+	BoxTypeVirtual: true,
+}
+
+// IsValidBoxType reports whether boxType is known, an empty type is a generic box
+func IsValidBoxType(boxType string) bool {
+	return boxTypes[boxType]
+}
@@ -0,0 +1,10 @@
+package models
+
+// DataKey is the key the content of an encrypted box is encrypted with. It is only stored wrapped by the
+// master key named by MasterKeyID, rotating the master key re-wraps it without touching the content.
+type DataKey struct {
+	BaseModel
+	BoxID       uint   `gorm:"index;not null" json:"box_id"`
+	MasterKeyID string `gorm:"type:varchar(255);not null;index" json:"master_key_id"`
+	WrappedKey  []byte `gorm:"not null" json:"-"`
+}
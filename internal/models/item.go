@@ -12,12 +12,20 @@ type Item struct {
 	Path       string          `gorm:"type:ltree;not null" json:"path"`
 	Type       string          `gorm:"type:varchar(50);not null" json:"type"`
 	Size       int64           `gorm:"default:0" json:"size"`
+	StoredSize int64           `gorm:"default:0" json:"stored_size,omitempty"`
 	SHA256     string          `gorm:"type:varchar(64)" json:"sha256,omitempty"`
 	SHA512     string          `gorm:"type:varchar(128)" json:"sha512,omitempty"`
 	Properties json.RawMessage `gorm:"type:jsonb" json:"properties,omitempty"`
 	Children   []Item          `gorm:"-" json:"children,omitempty"`
 	Extension  string          `gorm:"type:varchar(20)" json:"extension,omitempty"`
-	// For future reference
-	//Version    int             `gorm:"default:1" json:"version"`
-	//Versions   []Item          `gorm:"foreignKey:ParentID" json:"versions,omitempty"`
+	// Version counts the revisions of a file, the prior ones are kept as ItemVersion
+	Version  int    `gorm:"default:1" json:"version"`
+	Uploader string `gorm:"type:varchar(255)" json:"uploader,omitempty"`
+	// DeletedBy and TrashedWith describe an item in the trash, TrashedWith is the item whose deletion
+	// took this one along
+	DeletedBy   string `gorm:"type:varchar(255)" json:"deleted_by,omitempty"`
+	TrashedWith *uint  `gorm:"index" json:"trashed_with,omitempty"`
+	// Quarantined marks an item whose content failed the integrity scrub, it cannot be downloaded
+	// until the content is stored again
+	Quarantined bool `gorm:"default:false" json:"quarantined,omitempty"`
 }
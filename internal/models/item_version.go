@@ -0,0 +1,22 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// ItemVersion is a prior revision of a file item, kept when the file is overwritten. The content stays
+// in the hash storage of the box as long as a revision references it.
+type ItemVersion struct {
+	BaseModel
+	ItemID     uint            `gorm:"index;not null" json:"item_id"`
+	BoxID      uint            `gorm:"index;not null" json:"box_id"`
+	Version    int             `gorm:"not null" json:"version"`
+	Size       int64           `gorm:"default:0" json:"size"`
+	StoredSize int64           `gorm:"default:0" json:"stored_size,omitempty"`
+	SHA256     string          `gorm:"type:varchar(64);index" json:"sha256"`
+	SHA512     string          `gorm:"type:varchar(128)" json:"sha512"`
+	Properties json.RawMessage `gorm:"type:jsonb" json:"properties,omitempty"`
+	Uploader   string          `gorm:"type:varchar(255)" json:"uploader,omitempty"`
+	UploadedAt time.Time       `json:"uploaded_at"`
+}
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	JobStatusPending   = "pending"
+	JobStatusRunning   = "running"
+	JobStatusSucceeded = "succeeded"
+	JobStatusFailed    = "failed"
+	JobStatusCancelled = "cancelled"
+)
+
+type Job struct {
+	BaseModel
+	Type           string          `gorm:"type:varchar(50);not null;index" json:"type"`
+	Status         string          `gorm:"type:varchar(20);not null;index" json:"status"`
+	Payload        json.RawMessage `gorm:"type:jsonb" json:"payload,omitempty"`
+	Result         json.RawMessage `gorm:"type:jsonb" json:"result,omitempty"`
+	BytesProcessed int64           `gorm:"default:0" json:"bytes_processed"`
+	ItemsProcessed int64           `gorm:"default:0" json:"items_processed"`
+	ItemsTotal     int64           `gorm:"default:0" json:"items_total"`
+	Error          string          `gorm:"type:text" json:"error,omitempty"`
+	Errors         json.RawMessage `gorm:"type:jsonb" json:"errors,omitempty"`
+	StartedAt      *time.Time      `json:"started_at,omitempty"`
+	FinishedAt     *time.Time      `json:"finished_at,omitempty"`
+}
+
+// IsFinished reports whether the job reached a terminal status
+func (j *Job) IsFinished() bool {
+	return j.Status == JobStatusSucceeded || j.Status == JobStatusFailed || j.Status == JobStatusCancelled
+}
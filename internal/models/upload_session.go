@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+type UploadSession struct {
+	BaseModel
+	UUID       string    `gorm:"type:varchar(36);not null;uniqueIndex" json:"uuid"`
+	BoxID      uint      `gorm:"index" json:"box_id"`
+	Path       string    `gorm:"type:text;not null" json:"path"`
+	Length     int64     `gorm:"default:-1" json:"length"`
+	Offset     int64     `gorm:"default:0" json:"offset"`
+	Flat       bool      `json:"flat"`
+	Properties string    `gorm:"type:text" json:"properties,omitempty"`
+	ItemID     *uint     `json:"item_id,omitempty"`
+	ExpiresAt  time.Time `gorm:"index" json:"expires_at"`
+}
+
+// LengthKnown reports whether the client announced the final size of the upload
+func (u *UploadSession) LengthKnown() bool {
+	return u.Length >= 0
+}
+
+// IsComplete reports whether the upload has been assembled into an item
+func (u *UploadSession) IsComplete() bool {
+	return u.ItemID != nil
+}
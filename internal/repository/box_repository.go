@@ -10,6 +10,17 @@ type BoxRepository interface {
 	GenericRepository[models.Box]
 	FindByName(path string) (*models.Box, error)
 	FindDeleted(id int) ([]*models.Box, error)
+	Usage(boxID uint) (*BoxUsage, error)
+}
+
+// BoxUsage is the storage taken by a box. LogicalSize adds up the sizes of the current files,
+// PhysicalSize is what the hash storage holds for the box, with every content counted once as it is
+// stored. Prior revisions and files in the trash take physical space as well.
+type BoxUsage struct {
+	BoxID        uint  `json:"box_id"`
+	Files        int64 `json:"files"`
+	LogicalSize  int64 `json:"logical_size"`
+	PhysicalSize int64 `json:"physical_size"`
 }
 
 type BoxRepositoryImpl[T models.Box] struct {
@@ -45,3 +56,27 @@ func (r *BoxRepositoryImpl[T]) FindDeleted(id int) ([]*models.Box, error) {
 	}
 	return boxes, nil
 }
+
+func (r *BoxRepositoryImpl[T]) Usage(boxID uint) (*BoxUsage, error) {
+	var usage BoxUsage
+	err := r.db.Model(&models.Item{}).
+		Select("COUNT(*) AS files, COALESCE(SUM(size), 0) AS logical_size").
+		Where("box_id = ? AND type = ?", boxID, "file").
+		Scan(&usage).Error
+	if err != nil {
+		return nil, err
+	}
+	usage.BoxID = boxID
+	// Content stored before the stored size was recorded was stored as it is
+	err = r.db.Raw(`SELECT COALESCE(SUM(stored), 0) FROM (
+			SELECT MAX(CASE WHEN stored_size > 0 THEN stored_size ELSE size END) AS stored FROM (
+				SELECT sha256, size, stored_size FROM items WHERE box_id = ? AND type = 'file'
+				UNION ALL
+				SELECT sha256, size, stored_size FROM item_versions WHERE box_id = ? AND deleted_at IS NULL
+			) AS content WHERE sha256 <> '' GROUP BY sha256
+		) AS blobs`, boxID, boxID).Scan(&usage.PhysicalSize).Error
+	if err != nil {
+		return nil, err
+	}
+	return &usage, nil
+}
@@ -93,3 +93,30 @@ func TestBoxRepository_Delete(t *testing.T) {
 	assert.Equal(t, gorm.ErrRecordNotFound, err)
 	assert.NotEqual(t, box.ID, deletedBox.ID)
 }
+
+func TestBoxRepository_Usage(t *testing.T) {
+	db := setupTestDBWithBox()
+	assert.NoError(t, db.AutoMigrate(&models.Item{}, &models.ItemVersion{}))
+	boxRepo := NewBoxRepository(db)
+	itemRepo := NewItemRepository(db)
+
+	box := &models.Box{Name: "Usage Box", Path: "/usage/box"}
+	assert.NoError(t, boxRepo.Create(box))
+	assert.NoError(t, itemRepo.Create(&models.Item{Name: "docs", Path: "docs", Type: "folder", BoxID: box.ID}))
+	assert.NoError(t, itemRepo.Create(&models.Item{Name: "a.txt", Path: "a.txt", Type: "file", BoxID: box.ID, SHA256: "aa", Size: 1000, StoredSize: 300}))
+	assert.NoError(t, itemRepo.Create(&models.Item{Name: "b.txt", Path: "b.txt", Type: "file", BoxID: box.ID, SHA256: "aa", Size: 1000, StoredSize: 300}))
+	// Stored before the stored size was recorded
+	assert.NoError(t, itemRepo.Create(&models.Item{Name: "c.zip", Path: "c_zip", Type: "file", BoxID: box.ID, SHA256: "cc", Size: 500}))
+	trashed := &models.Item{Name: "d.txt", Path: "d_txt", Type: "file", BoxID: box.ID, SHA256: "dd", Size: 400, StoredSize: 100}
+	assert.NoError(t, itemRepo.Create(trashed))
+	assert.NoError(t, itemRepo.Trash(trashed, ""))
+	assert.NoError(t, db.Create(&models.ItemVersion{ItemID: 2, BoxID: box.ID, Version: 1, SHA256: "ee", Size: 800, StoredSize: 200}).Error)
+	assert.NoError(t, itemRepo.Create(&models.Item{Name: "e.txt", Path: "e_txt", Type: "file", BoxID: box.ID + 1, SHA256: "ff", Size: 900}))
+
+	usage, err := boxRepo.Usage(box.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, box.ID, usage.BoxID)
+	assert.Equal(t, int64(3), usage.Files)
+	assert.Equal(t, int64(2500), usage.LogicalSize)
+	assert.Equal(t, int64(300+500+100+200), usage.PhysicalSize)
+}
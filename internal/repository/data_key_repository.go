@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"Boxed/internal/models"
+	"errors"
+	"gorm.io/gorm"
+)
+
+type DataKeyRepository interface {
+	GenericRepository[models.DataKey]
+	FindLatestByBoxID(boxID uint) (*models.DataKey, error)
+	FindNotWrappedWith(masterKeyID string) ([]models.DataKey, error)
+	CountByMasterKey() (map[string]int64, error)
+}
+
+type DataKeyRepositoryImpl[T models.DataKey] struct {
+	GenericRepository[models.DataKey]
+	db *gorm.DB
+}
+
+func NewDataKeyRepository(db *gorm.DB) DataKeyRepository {
+	return &DataKeyRepositoryImpl[models.DataKey]{
+		GenericRepository: NewGenericRepository[models.DataKey](db),
+		db:                db,
+	}
+}
+
+// FindLatestByBoxID returns the data key new content of the box is encrypted with, nil when the box has none
+func (r *DataKeyRepositoryImpl[T]) FindLatestByBoxID(boxID uint) (*models.DataKey, error) {
+	var dataKey models.DataKey
+	err := r.db.Where("box_id = ?", boxID).Order("id DESC").First(&dataKey).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &dataKey, nil
+}
+
+// FindNotWrappedWith returns the data keys wrapped by any other master key than masterKeyID
+func (r *DataKeyRepositoryImpl[T]) FindNotWrappedWith(masterKeyID string) ([]models.DataKey, error) {
+	var dataKeys []models.DataKey
+	if err := r.db.Where("master_key_id <> ?", masterKeyID).Order("id").Find(&dataKeys).Error; err != nil {
+		return nil, err
+	}
+	return dataKeys, nil
+}
+
+// CountByMasterKey counts the data keys wrapped by each master key
+func (r *DataKeyRepositoryImpl[T]) CountByMasterKey() (map[string]int64, error) {
+	var rows []struct {
+		MasterKeyID string
+		Count       int64
+	}
+	err := r.db.Model(&models.DataKey{}).
+		Select("master_key_id, COUNT(*) AS count").
+		Group("master_key_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		counts[row.MasterKeyID] = row.Count
+	}
+	return counts, nil
+}
@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"Boxed/internal/models"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"testing"
+)
+
+func setupTestDBWithDataKeys() *gorm.DB {
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	err := db.AutoMigrate(&models.DataKey{})
+	if err != nil {
+		panic(err)
+	}
+	return db
+}
+
+func TestDataKeyRepository_FindLatestByBoxID(t *testing.T) {
+	db := setupTestDBWithDataKeys()
+	dataKeyRepo := NewDataKeyRepository(db)
+
+	dataKey, err := dataKeyRepo.FindLatestByBoxID(1)
+	assert.NoError(t, err)
+	assert.Nil(t, dataKey)
+
+	assert.NoError(t, dataKeyRepo.Create(&models.DataKey{BoxID: 1, MasterKeyID: "old", WrappedKey: []byte("a")}))
+	assert.NoError(t, dataKeyRepo.Create(&models.DataKey{BoxID: 1, MasterKeyID: "new", WrappedKey: []byte("b")}))
+	assert.NoError(t, dataKeyRepo.Create(&models.DataKey{BoxID: 2, MasterKeyID: "new", WrappedKey: []byte("c")}))
+
+	dataKey, err = dataKeyRepo.FindLatestByBoxID(1)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("b"), dataKey.WrappedKey)
+}
+
+func TestDataKeyRepository_FindNotWrappedWith(t *testing.T) {
+	db := setupTestDBWithDataKeys()
+	dataKeyRepo := NewDataKeyRepository(db)
+	assert.NoError(t, dataKeyRepo.Create(&models.DataKey{BoxID: 1, MasterKeyID: "old", WrappedKey: []byte("a")}))
+	assert.NoError(t, dataKeyRepo.Create(&models.DataKey{BoxID: 2, MasterKeyID: "new", WrappedKey: []byte("b")}))
+	assert.NoError(t, dataKeyRepo.Create(&models.DataKey{BoxID: 3, MasterKeyID: "older", WrappedKey: []byte("c")}))
+
+	dataKeys, err := dataKeyRepo.FindNotWrappedWith("new")
+	assert.NoError(t, err)
+	assert.Len(t, dataKeys, 2)
+	assert.Equal(t, "old", dataKeys[0].MasterKeyID)
+
+	counts, err := dataKeyRepo.CountByMasterKey()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int64{"old": 1, "new": 1, "older": 1}, counts)
+}
@@ -3,19 +3,37 @@ package repository
 import (
 	"Boxed/internal/helpers"
 	"Boxed/internal/models"
+	"encoding/json"
 	"errors"
 	"gorm.io/gorm"
 	"math"
+	"strings"
+	"time"
 )
 
 type ItemRepository interface {
 	GenericRepository[models.Item]
 	FindFolderByNameAndParent(name string, parentID *uint, boxID uint) (*models.Item, error)
+	FindByNameAndParent(name string, parentID *uint, boxID uint) (*models.Item, error)
 	FindByPathAndBoxId(path string, boxID uint) (*models.Item, error)
 	FindItemsByParentID(parentID *uint, boxID uint) ([]models.Item, error)
 	FindDeleted() ([]models.Item, error)
+	FindDeletedBefore(before time.Time) ([]models.Item, error)
+	FindDeletedByID(id uint) (*models.Item, error)
+	FindTrash(boxID uint) ([]models.Item, error)
+	Trash(item *models.Item, deletedBy string) error
+	Restore(item *models.Item) ([]models.Item, error)
+	Purge(item *models.Item) error
+	CountBySHA256(boxID uint, sha256sum string) (int64, error)
+	FindBySHA256(boxID uint, sha256sum string) ([]models.Item, error)
+	FindSHA256s(boxID uint) ([]string, error)
+	SetQuarantined(boxID uint, sha256sum string, quarantined bool) error
 	HardDelete(item *models.Item) error
 	GetAllDescendants(parentID uint, maxLevel int) ([]models.Item, error)
+	UpdatePath(boxID uint, oldPath, newPath string, newBoxID uint) error
+	UpdateProperties(id uint, properties json.RawMessage) error
+	UpdateUploader(id uint, uploader string) error
+	MoveSubtree(item *models.Item, newParentID *uint, newBoxID uint, newName string) error
 	ItemsSearch(
 		whereClause string,
 		args []interface{},
@@ -56,6 +74,26 @@ func (r *ItemRepositoryImpl[T]) FindFolderByNameAndParent(name string, parentID
 	return &folder, nil
 }
 
+// FindByNameAndParent returns the item of any type with exactly the given name in the folder
+func (r *ItemRepositoryImpl[T]) FindByNameAndParent(name string, parentID *uint, boxID uint) (*models.Item, error) {
+	var item models.Item
+	query := r.db.Where("name = ? AND box_id = ?", name, boxID)
+	if parentID == nil {
+		query = query.Where("parent_id IS NULL")
+	} else {
+		query = query.Where("parent_id = ?", *parentID)
+	}
+
+	err := query.Order("id").First(&item).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &item, nil
+}
+
 func (r *ItemRepositoryImpl[T]) FindByPathAndBoxId(path string, boxID uint) (*models.Item, error) {
 	var item models.Item
 	ltreePath := helpers.PathToLtree(path)
@@ -88,18 +126,18 @@ func (r *ItemRepositoryImpl[T]) Create(item *models.Item) error {
 }
 
 func (r *ItemRepositoryImpl[T]) Update(item *models.Item) error {
-	// Convert to ltree format for storage
-	storagePath := helpers.UserPathToLtree(item.Path)
-	itemToUpdate := *item
-	itemToUpdate.Path = storagePath
+	// The stored path is left alone, items are loaded with it in either form and only MoveSubtree changes it
+	return r.db.Omit("path").Save(item).Error
+}
 
-	err := r.db.Save(&itemToUpdate).Error
-	if err != nil {
-		return err
-	}
+// UpdateProperties replaces the properties of an item without touching its path
+func (r *ItemRepositoryImpl[T]) UpdateProperties(id uint, properties json.RawMessage) error {
+	return r.db.Model(&models.Item{}).Where("id = ?", id).Update("properties", properties).Error
+}
 
-	// Keep the original item's path in user-friendly format
-	return nil
+// UpdateUploader records who uploaded the current content of an item
+func (r *ItemRepositoryImpl[T]) UpdateUploader(id uint, uploader string) error {
+	return r.db.Model(&models.Item{}).Where("id = ?", id).UpdateColumn("uploader", uploader).Error
 }
 
 func (r *ItemRepositoryImpl[T]) FindItemsByParentID(parentID *uint, boxID uint) ([]models.Item, error) {
@@ -134,6 +172,156 @@ func (r *ItemRepositoryImpl[T]) FindDeleted() ([]models.Item, error) {
 	return items, nil
 }
 
+// FindDeletedBefore returns the items that were deleted before the given time
+func (r *ItemRepositoryImpl[T]) FindDeletedBefore(before time.Time) ([]models.Item, error) {
+	var items []models.Item
+	if err := r.db.Unscoped().Where("deleted_at IS NOT NULL AND deleted_at < ?", before).Find(&items).Error; err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (r *ItemRepositoryImpl[T]) FindDeletedByID(id uint) (*models.Item, error) {
+	var item models.Item
+	err := r.db.Unscoped().Where("id = ? AND deleted_at IS NOT NULL", id).First(&item).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &item, nil
+}
+
+// FindTrash returns the items deleted in a box, the newest deletion first. Items that were deleted
+// along with a folder are left out, they come back with the folder.
+func (r *ItemRepositoryImpl[T]) FindTrash(boxID uint) ([]models.Item, error) {
+	var items []models.Item
+	err := r.db.Unscoped().
+		Where("box_id = ? AND deleted_at IS NOT NULL AND trashed_with IS NULL", boxID).
+		Order("deleted_at DESC").
+		Find(&items).Error
+	if err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// Trash soft deletes an item and, for a folder, every item below it that is not in the trash yet.
+// The items below remember the item they were trashed with.
+func (r *ItemRepositoryImpl[T]) Trash(item *models.Item, deletedBy string) error {
+	now := time.Now()
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.Item{}).Where("id = ?", item.ID).Updates(map[string]interface{}{
+			"deleted_at":   now,
+			"deleted_by":   deletedBy,
+			"trashed_with": nil,
+		}).Error
+		if err != nil {
+			return err
+		}
+		parentIDs := []uint{item.ID}
+		for len(parentIDs) > 0 {
+			var children []models.Item
+			if err := tx.Where("parent_id IN ? AND box_id = ?", parentIDs, item.BoxID).Find(&children).Error; err != nil {
+				return err
+			}
+			parentIDs = nil
+			childIDs := make([]uint, 0, len(children))
+			for _, child := range children {
+				childIDs = append(childIDs, child.ID)
+				if child.Type == "folder" {
+					parentIDs = append(parentIDs, child.ID)
+				}
+			}
+			if len(childIDs) == 0 {
+				break
+			}
+			err := tx.Model(&models.Item{}).Where("id IN ?", childIDs).Updates(map[string]interface{}{
+				"deleted_at":   now,
+				"deleted_by":   deletedBy,
+				"trashed_with": item.ID,
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Restore brings a trashed item back together with the items that were trashed along with it and
+// returns them
+func (r *ItemRepositoryImpl[T]) Restore(item *models.Item) ([]models.Item, error) {
+	var restored []models.Item
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Unscoped().
+			Where("(id = ? OR trashed_with = ?) AND deleted_at IS NOT NULL", item.ID, item.ID).
+			Find(&restored).Error
+		if err != nil {
+			return err
+		}
+		return tx.Unscoped().Model(&models.Item{}).
+			Where("(id = ? OR trashed_with = ?) AND deleted_at IS NOT NULL", item.ID, item.ID).
+			Updates(map[string]interface{}{
+				"deleted_at":   nil,
+				"deleted_by":   "",
+				"trashed_with": nil,
+			}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i := range restored {
+		restored[i].DeletedAt = gorm.DeletedAt{}
+		restored[i].DeletedBy = ""
+		restored[i].TrashedWith = nil
+	}
+	return restored, nil
+}
+
+// Purge removes a single item for good. Unlike HardDelete it leaves the items below a folder alone,
+// so it does not take along items created at the same path after the folder went to the trash.
+func (r *ItemRepositoryImpl[T]) Purge(item *models.Item) error {
+	return r.db.Unscoped().Delete(&models.Item{}, item.ID).Error
+}
+
+// CountBySHA256 counts the items in the box that reference the content, those in the trash included
+func (r *ItemRepositoryImpl[T]) CountBySHA256(boxID uint, sha256sum string) (int64, error) {
+	var count int64
+	err := r.db.Unscoped().Model(&models.Item{}).Where("box_id = ? AND sha256 = ?", boxID, sha256sum).Count(&count).Error
+	return count, err
+}
+
+// FindBySHA256 returns the items in the box that reference the content, those in the trash included
+func (r *ItemRepositoryImpl[T]) FindBySHA256(boxID uint, sha256sum string) ([]models.Item, error) {
+	var items []models.Item
+	if err := r.db.Unscoped().Where("box_id = ? AND sha256 = ?", boxID, sha256sum).Order("id").Find(&items).Error; err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// FindSHA256s returns the distinct content referenced by the files of the box, those in the trash included
+func (r *ItemRepositoryImpl[T]) FindSHA256s(boxID uint) ([]string, error) {
+	var sums []string
+	err := r.db.Unscoped().Model(&models.Item{}).
+		Where("box_id = ? AND type = ? AND sha256 <> ''", boxID, "file").
+		Distinct().
+		Pluck("sha256", &sums).Error
+	if err != nil {
+		return nil, err
+	}
+	return sums, nil
+}
+
+// SetQuarantined flags or clears the items in the box that reference the content, those in the trash included
+func (r *ItemRepositoryImpl[T]) SetQuarantined(boxID uint, sha256sum string, quarantined bool) error {
+	return r.db.Unscoped().Model(&models.Item{}).
+		Where("box_id = ? AND sha256 = ? AND quarantined <> ?", boxID, sha256sum, quarantined).
+		Update("quarantined", quarantined).Error
+}
+
 func (r *ItemRepositoryImpl[T]) HardDelete(item *models.Item) error {
 	return r.db.Transaction(func(tx *gorm.DB) error {
 		if item.Type == "folder" {
@@ -158,17 +346,8 @@ func (r *ItemRepositoryImpl[T]) deleteItemAndDescendants(tx *gorm.DB, parentID u
 	if err := tx.Unscoped().First(&parentItem, parentID).Error; err != nil {
 		return err
 	}
-	query := "DELETE FROM items where path <@ ?"
-	result := tx.Exec(query, parentItem.Path)
-	if result.Error != nil {
-		return result.Error
-	}
-
-	if result.RowsAffected == 0 {
-		// TODO Logging
-	}
-
-	return nil
+	// Paths are only unique within a box, another box may have items at the same paths
+	return tx.Unscoped().Where("box_id = ? AND path <@ ?", parentItem.BoxID, parentItem.Path).Delete(&models.Item{}).Error
 }
 
 func (r *ItemRepositoryImpl[T]) GetAllDescendants(parentID uint, maxLevel int) ([]models.Item, error) {
@@ -184,7 +363,7 @@ func (r *ItemRepositoryImpl[T]) GetAllDescendants(parentID uint, maxLevel int) (
 	}
 
 	var items []models.Item
-	query := r.db.Where("path <@ ?", parentItem.Path)
+	query := r.db.Where("box_id = ? AND path <@ ?", parentItem.BoxID, parentItem.Path)
 	if maxLevel > 0 {
 		query = query.Where("nlevel(path) <= ?", maxLevel)
 	}
@@ -213,9 +392,57 @@ func (r *ItemRepositoryImpl[T]) ItemsSearch(
 	return items, nil
 }
 
-func (r *ItemRepositoryImpl[T]) UpdatePath(oldPath, newPath string) error {
-	return r.db.Exec(`
+// UpdatePath rewrites the ltree path of oldPath and all of its descendants to live under newPath
+// and moves the whole subtree to newBoxID
+func (r *ItemRepositoryImpl[T]) UpdatePath(boxID uint, oldPath, newPath string, newBoxID uint) error {
+	return r.updatePath(r.db, boxID, oldPath, newPath, newBoxID)
+}
+
+func (r *ItemRepositoryImpl[T]) updatePath(tx *gorm.DB, boxID uint, oldPath, newPath string, newBoxID uint) error {
+	return tx.Exec(`
 		UPDATE items
-		SET path = regexp_replace(path::text, ?, ?, 'g')::ltree
-		WHERE path <@ ?`, oldPath, newPath, oldPath).Error
+		SET path = CASE
+				WHEN path = ?::ltree THEN ?::ltree
+				ELSE ?::ltree || subpath(path, nlevel(?::ltree))
+			END,
+			box_id = ?
+		WHERE box_id = ? AND path <@ ?::ltree`,
+		oldPath, newPath, newPath, oldPath, newBoxID, boxID, oldPath).Error
+}
+
+// MoveSubtree re-parents and/or renames an item, rewriting the paths of its whole subtree
+func (r *ItemRepositoryImpl[T]) MoveSubtree(item *models.Item, newParentID *uint, newBoxID uint, newName string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var current models.Item
+		if err := tx.First(&current, item.ID).Error; err != nil {
+			return err
+		}
+		newPath := helpers.EncodeLtreeLabel(newName)
+		if newParentID != nil {
+			var parent models.Item
+			if err := tx.First(&parent, *newParentID).Error; err != nil {
+				return err
+			}
+			if parent.BoxID == current.BoxID && isLtreeDescendant(parent.Path, current.Path) {
+				return errors.New("cannot move an item into its own subtree")
+			}
+			newPath = parent.Path + "." + newPath
+		}
+		if err := r.updatePath(tx, current.BoxID, current.Path, newPath, newBoxID); err != nil {
+			return err
+		}
+		updates := map[string]interface{}{
+			"parent_id": newParentID,
+			"name":      newName,
+		}
+		if current.Type == "file" {
+			updates["extension"] = helpers.GetFileType(newName)
+		}
+		return tx.Model(&models.Item{}).Where("id = ?", current.ID).Updates(updates).Error
+	})
+}
+
+// isLtreeDescendant reports whether path equals ancestor or lies beneath it
+func isLtreeDescendant(path, ancestor string) bool {
+	return path == ancestor || strings.HasPrefix(path, ancestor+".")
 }
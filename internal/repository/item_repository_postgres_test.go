@@ -0,0 +1,53 @@
+//go:build integration
+
+package repository
+
+import (
+	"Boxed/internal/models"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"os"
+	"testing"
+	"time"
+)
+
+// The other tests run the ltree queries on sqlite, translated by testdb. These run them on Postgres:
+//
+//	BOXED_TEST_DATABASE_DSN="host=localhost port=5555 user=boxed password=... dbname=boxed" \
+//	  go test -tags integration ./internal/repository
+func setupPostgresWithItems(t *testing.T) *gorm.DB {
+	dsn := os.Getenv("BOXED_TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("BOXED_TEST_DATABASE_DSN is not set")
+	}
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	// The search path is set per connection, so there is only one
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	// Every test gets a schema of its own, dropped afterwards
+	schema := fmt.Sprintf("boxed_test_%d", time.Now().UnixNano())
+	require.NoError(t, db.Exec("CREATE EXTENSION IF NOT EXISTS ltree").Error)
+	require.NoError(t, db.Exec("CREATE SCHEMA "+schema).Error)
+	t.Cleanup(func() { db.Exec("DROP SCHEMA " + schema + " CASCADE") })
+	require.NoError(t, db.Exec("SET search_path TO "+schema+", public").Error)
+	require.NoError(t, db.AutoMigrate(&models.Box{}, &models.Item{}))
+	return db
+}
+
+func TestItemRepositoryPostgres_HardDeleteStaysInBox(t *testing.T) {
+	testHardDeleteStaysInBox(t, setupPostgresWithItems(t))
+}
+
+func TestItemRepositoryPostgres_MoveSubtree(t *testing.T) {
+	testMoveSubtree(t, setupPostgresWithItems(t))
+}
+
+func TestItemRepositoryPostgres_UpdatePath(t *testing.T) {
+	testUpdatePath(t, setupPostgresWithItems(t))
+}
@@ -2,14 +2,18 @@ package repository
 
 import (
 	"Boxed/internal/models"
+	"Boxed/internal/testdb"
+	"encoding/json"
+	"fmt"
 	"github.com/stretchr/testify/assert"
-	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
+	"strings"
 	"testing"
+	"time"
 )
 
 func setupTestDBWithItems() *gorm.DB {
-	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	db, _ := gorm.Open(testdb.Open(":memory:"), &gorm.Config{})
 	err := db.AutoMigrate(&models.Box{}, &models.Item{})
 	if err != nil {
 		panic(err)
@@ -92,3 +96,315 @@ func TestItemRepository_Delete(t *testing.T) {
 	assert.Equal(t, gorm.ErrRecordNotFound, err)
 	assert.NotEqual(t, item.ID, deletedItem.ID)
 }
+
+func TestItemRepository_UpdateProperties(t *testing.T) {
+	db := setupTestDBWithItems()
+	itemRepo := NewItemRepository(db)
+
+	item := &models.Item{Name: "pkg", Path: "scope.pkg", Type: "folder"}
+	assert.NoError(t, db.Create(item).Error)
+
+	err := itemRepo.UpdateProperties(item.ID, json.RawMessage(`{"name":["@scope/pkg"]}`))
+	assert.NoError(t, err)
+
+	var updatedItem models.Item
+	assert.NoError(t, db.First(&updatedItem, item.ID).Error)
+	assert.JSONEq(t, `{"name":["@scope/pkg"]}`, string(updatedItem.Properties))
+	assert.Equal(t, "scope.pkg", updatedItem.Path)
+}
+
+func TestItemRepository_UpdateKeepsPath(t *testing.T) {
+	db := setupTestDBWithItems()
+	itemRepo := NewItemRepository(db)
+
+	var parentID *uint
+	for _, folderPath := range []string{"index", "index/my", "index/my/-l"} {
+		folder := &models.Item{Name: folderPath[strings.LastIndex(folderPath, "/")+1:], Path: folderPath, Type: "folder", BoxID: 1, ParentID: parentID}
+		assert.NoError(t, itemRepo.Create(folder))
+		parentID = &folder.ID
+	}
+	item := &models.Item{Name: "my-lib", Path: "index/my/-l/my-lib", Type: "file", BoxID: 1, ParentID: parentID}
+	assert.NoError(t, itemRepo.Create(item))
+
+	found, err := itemRepo.FindByPathAndBoxId("index/my/-l/my-lib", 1)
+	assert.NoError(t, err)
+	found.Size = 42
+	assert.NoError(t, itemRepo.Update(found))
+
+	found, err = itemRepo.FindByPathAndBoxId("index/my/-l/my-lib", 1)
+	assert.NoError(t, err)
+	assert.NotNil(t, found)
+	assert.Equal(t, int64(42), found.Size)
+}
+
+func TestItemRepository_TrashAndRestore(t *testing.T) {
+	db := setupTestDBWithItems()
+	itemRepo := NewItemRepository(db)
+
+	folder := &models.Item{Name: "docs", Path: "docs", Type: "folder", BoxID: 1}
+	assert.NoError(t, itemRepo.Create(folder))
+	sub := &models.Item{Name: "api", Path: "docs/api", Type: "folder", BoxID: 1, ParentID: &folder.ID}
+	assert.NoError(t, itemRepo.Create(sub))
+	file := &models.Item{Name: "index.md", Path: "docs/api/index.md", Type: "file", BoxID: 1, ParentID: &sub.ID}
+	assert.NoError(t, itemRepo.Create(file))
+	other := &models.Item{Name: "readme.md", Path: "readme.md", Type: "file", BoxID: 1}
+	assert.NoError(t, itemRepo.Create(other))
+
+	assert.NoError(t, itemRepo.Trash(other, "10.0.0.1"))
+	assert.NoError(t, itemRepo.Trash(folder, "10.0.0.2"))
+
+	// Only the items deleted on their own are listed, the newest deletion first
+	trash, err := itemRepo.FindTrash(1)
+	assert.NoError(t, err)
+	assert.Len(t, trash, 2)
+	assert.Equal(t, folder.ID, trash[0].ID)
+	assert.Equal(t, "10.0.0.2", trash[0].DeletedBy)
+
+	trashedFile, err := itemRepo.FindDeletedByID(file.ID)
+	assert.NoError(t, err)
+	assert.NotNil(t, trashedFile)
+	assert.Equal(t, folder.ID, *trashedFile.TrashedWith)
+
+	restored, err := itemRepo.Restore(folder)
+	assert.NoError(t, err)
+	assert.Len(t, restored, 3)
+	found, err := itemRepo.FindByID(file.ID)
+	assert.NoError(t, err)
+	assert.Nil(t, found.TrashedWith)
+
+	trash, err = itemRepo.FindTrash(1)
+	assert.NoError(t, err)
+	assert.Len(t, trash, 1)
+	assert.Equal(t, other.ID, trash[0].ID)
+}
+
+func TestItemRepository_Purge(t *testing.T) {
+	db := setupTestDBWithItems()
+	itemRepo := NewItemRepository(db)
+
+	folder := &models.Item{Name: "docs", Path: "docs", Type: "folder", BoxID: 1}
+	assert.NoError(t, itemRepo.Create(folder))
+	file := &models.Item{Name: "index.md", Path: "docs/index.md", Type: "file", BoxID: 1, ParentID: &folder.ID}
+	assert.NoError(t, itemRepo.Create(file))
+	assert.NoError(t, itemRepo.Trash(folder, ""))
+
+	deleted, err := itemRepo.FindDeletedBefore(time.Now().Add(-time.Hour))
+	assert.NoError(t, err)
+	assert.Empty(t, deleted)
+	deleted, err = itemRepo.FindDeletedBefore(time.Now().Add(time.Second))
+	assert.NoError(t, err)
+	assert.Len(t, deleted, 2)
+
+	// Purging the folder leaves the items below it to be purged on their own
+	assert.NoError(t, itemRepo.Purge(folder))
+	missing, err := itemRepo.FindDeletedByID(folder.ID)
+	assert.NoError(t, err)
+	assert.Nil(t, missing)
+	trashedFile, err := itemRepo.FindDeletedByID(file.ID)
+	assert.NoError(t, err)
+	assert.NotNil(t, trashedFile)
+}
+
+func TestItemRepository_CountBySHA256(t *testing.T) {
+	db := setupTestDBWithItems()
+	itemRepo := NewItemRepository(db)
+
+	live := &models.Item{Name: "a.txt", Path: "a.txt", Type: "file", BoxID: 1, SHA256: "aa"}
+	assert.NoError(t, itemRepo.Create(live))
+	trashed := &models.Item{Name: "b.txt", Path: "b.txt", Type: "file", BoxID: 1, SHA256: "aa"}
+	assert.NoError(t, itemRepo.Create(trashed))
+	assert.NoError(t, itemRepo.Create(&models.Item{Name: "c.txt", Path: "c.txt", Type: "file", BoxID: 2, SHA256: "aa"}))
+	assert.NoError(t, itemRepo.Trash(trashed, ""))
+
+	// An item in the trash may come back, its content is still referenced
+	count, err := itemRepo.CountBySHA256(1, "aa")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+
+	assert.NoError(t, itemRepo.Purge(trashed))
+	count, err = itemRepo.CountBySHA256(1, "aa")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestItemRepository_Quarantine(t *testing.T) {
+	db := setupTestDBWithItems()
+	itemRepo := NewItemRepository(db)
+
+	live := &models.Item{Name: "a.txt", Path: "a.txt", Type: "file", BoxID: 1, SHA256: "aa"}
+	assert.NoError(t, itemRepo.Create(live))
+	trashed := &models.Item{Name: "b.txt", Path: "b.txt", Type: "file", BoxID: 1, SHA256: "aa"}
+	assert.NoError(t, itemRepo.Create(trashed))
+	assert.NoError(t, itemRepo.Trash(trashed, ""))
+	other := &models.Item{Name: "c.txt", Path: "c.txt", Type: "file", BoxID: 1, SHA256: "bb"}
+	assert.NoError(t, itemRepo.Create(other))
+	assert.NoError(t, itemRepo.Create(&models.Item{Name: "d.txt", Path: "d.txt", Type: "file", BoxID: 2, SHA256: "aa"}))
+	assert.NoError(t, itemRepo.Create(&models.Item{Name: "dir", Path: "dir", Type: "folder", BoxID: 1}))
+
+	items, err := itemRepo.FindBySHA256(1, "aa")
+	assert.NoError(t, err)
+	assert.Len(t, items, 2)
+
+	sums, err := itemRepo.FindSHA256s(1)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"aa", "bb"}, sums)
+
+	// Items in the trash are flagged too, they may come back
+	assert.NoError(t, itemRepo.SetQuarantined(1, "aa", true))
+	items, _ = itemRepo.FindBySHA256(1, "aa")
+	for _, item := range items {
+		assert.True(t, item.Quarantined)
+	}
+	unaffected, _ := itemRepo.FindBySHA256(2, "aa")
+	assert.False(t, unaffected[0].Quarantined)
+	unaffected, _ = itemRepo.FindBySHA256(1, "bb")
+	assert.False(t, unaffected[0].Quarantined)
+
+	assert.NoError(t, itemRepo.SetQuarantined(1, "aa", false))
+	items, _ = itemRepo.FindBySHA256(1, "aa")
+	for _, item := range items {
+		assert.False(t, item.Quarantined)
+	}
+}
+
+func TestItemRepository_HardDeleteStaysInBox(t *testing.T) {
+	testHardDeleteStaysInBox(t, setupTestDBWithItems())
+}
+
+func testHardDeleteStaysInBox(t *testing.T, db *gorm.DB) {
+	itemRepo := NewItemRepository(db)
+
+	// Both boxes have the same folder, deleting it in one of them leaves the other alone
+	var folders []*models.Item
+	for _, boxID := range []uint{1, 2} {
+		folder := &models.Item{Name: "docs", Path: "docs", Type: "folder", BoxID: boxID}
+		assert.NoError(t, itemRepo.Create(folder))
+		assert.NoError(t, itemRepo.Create(&models.Item{Name: "index.md", Path: "docs/index.md", Type: "file", BoxID: boxID, ParentID: &folder.ID}))
+		folders = append(folders, folder)
+	}
+	// A label starting like the folder is not below it
+	assert.NoError(t, itemRepo.Create(&models.Item{Name: "docs2", Path: "docs2", Type: "folder", BoxID: 1}))
+
+	descendants, err := itemRepo.GetAllDescendants(folders[0].ID, -1)
+	assert.NoError(t, err)
+	assert.Len(t, descendants, 2)
+	for _, item := range descendants {
+		assert.Equal(t, uint(1), item.BoxID)
+	}
+
+	assert.NoError(t, itemRepo.HardDelete(folders[0]))
+	var remaining []models.Item
+	assert.NoError(t, db.Unscoped().Order("id").Find(&remaining).Error)
+	assert.Len(t, remaining, 3)
+	assert.Equal(t, "docs2", remaining[2].Path)
+	descendants, err = itemRepo.GetAllDescendants(folders[1].ID, -1)
+	assert.NoError(t, err)
+	assert.Len(t, descendants, 2)
+}
+
+func TestItemRepository_MoveSubtree(t *testing.T) {
+	testMoveSubtree(t, setupTestDBWithItems())
+}
+
+func testMoveSubtree(t *testing.T, db *gorm.DB) {
+	itemRepo := NewItemRepository(db)
+
+	folder := &models.Item{Name: "my_docs", Path: "my_docs", Type: "folder", BoxID: 1}
+	assert.NoError(t, itemRepo.Create(folder))
+	file := &models.Item{Name: "index.md", Path: "my_docs/index.md", Type: "file", BoxID: 1, ParentID: &folder.ID}
+	assert.NoError(t, itemRepo.Create(file))
+	// The underscore is not a wildcard, this folder is not below the moved one
+	lookalike := &models.Item{Name: "myXdocs", Path: "myXdocs/x", Type: "folder", BoxID: 1}
+	assert.NoError(t, itemRepo.Create(lookalike))
+	target := &models.Item{Name: "archive", Path: "archive", Type: "folder", BoxID: 2}
+	assert.NoError(t, itemRepo.Create(target))
+
+	assert.NoError(t, itemRepo.MoveSubtree(folder, &target.ID, 2, "old_docs"))
+	moved, err := itemRepo.FindByPathAndBoxId("archive/old_docs/index.md", 2)
+	assert.NoError(t, err)
+	assert.NotNil(t, moved)
+	assert.Equal(t, file.ID, moved.ID)
+	unmoved, err := itemRepo.FindByID(lookalike.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "myXdocs.x", unmoved.Path)
+	assert.Equal(t, uint(1), unmoved.BoxID)
+
+	assert.Error(t, itemRepo.MoveSubtree(target, &folder.ID, 2, "archive"))
+}
+
+func TestItemRepository_UpdatePath(t *testing.T) {
+	testUpdatePath(t, setupTestDBWithItems())
+}
+
+func testUpdatePath(t *testing.T, db *gorm.DB) {
+	itemRepo := NewItemRepository(db)
+
+	for _, path := range []string{"docs", "docs.api", "docs.api.v1", "docs2"} {
+		folder := &models.Item{Name: path[strings.LastIndex(path, ".")+1:], Path: path, Type: "folder", BoxID: 1}
+		assert.NoError(t, db.Create(folder).Error)
+	}
+
+	assert.NoError(t, itemRepo.UpdatePath(1, "docs", "archive.old", 2))
+	var items []models.Item
+	assert.NoError(t, db.Order("id").Find(&items).Error)
+	var paths []string
+	for _, item := range items {
+		paths = append(paths, fmt.Sprintf("%d:%s", item.BoxID, item.Path))
+	}
+	assert.Equal(t, []string{"2:archive.old", "2:archive.old.api", "2:archive.old.api.v1", "1:docs2"}, paths)
+
+	// The level counts from the root, not from the item
+	descendants, err := itemRepo.GetAllDescendants(items[0].ID, 3)
+	assert.NoError(t, err)
+	assert.Len(t, descendants, 2)
+}
+
+func TestItemRepository_FindByPathTellsNamesApart(t *testing.T) {
+	db := setupTestDBWithItems()
+	itemRepo := NewItemRepository(db)
+
+	// "@scope" and "_scope" only differ in punctuation, so do the files below them
+	files := make(map[string]uint)
+	for _, scope := range []string{"@scope", "_scope"} {
+		folder := &models.Item{Name: scope, Path: scope, Type: "folder", BoxID: 1}
+		assert.NoError(t, itemRepo.Create(folder))
+		for _, name := range []string{"pkg-1.0.0+build.tgz", "pkg-1.0.0-build.tgz"} {
+			file := &models.Item{Name: name, Path: scope + "/" + name, Type: "file", BoxID: 1, ParentID: &folder.ID}
+			assert.NoError(t, itemRepo.Create(file))
+			files[scope+"/"+name] = file.ID
+		}
+	}
+	for path, id := range files {
+		found, err := itemRepo.FindByPathAndBoxId(path, 1)
+		assert.NoError(t, err)
+		if assert.NotNil(t, found, path) {
+			assert.Equal(t, id, found.ID, path)
+		}
+	}
+
+	missing, err := itemRepo.FindByPathAndBoxId("@scope/pkg-1.0.0_build.tgz", 1)
+	assert.NoError(t, err)
+	assert.Nil(t, missing)
+	missing, err = itemRepo.FindByPathAndBoxId("+scope/pkg-1.0.0-build.tgz", 1)
+	assert.NoError(t, err)
+	assert.Nil(t, missing)
+}
+
+func TestItemRepository_FindByShownPath(t *testing.T) {
+	db := setupTestDBWithItems()
+	itemRepo := NewItemRepository(db)
+
+	folder := &models.Item{Name: "my_dir", Path: "my_dir", Type: "folder", BoxID: 1}
+	assert.NoError(t, itemRepo.Create(folder))
+	file := &models.Item{Name: "notes.txt", Path: "my_dir/notes.txt", Type: "file", BoxID: 1, ParentID: &folder.ID}
+	assert.NoError(t, itemRepo.Create(file))
+
+	// The item is shown with the path it was stored with and found by it, a lookalike finds nothing
+	assert.Equal(t, "my_dir/notes.txt", file.Path)
+	found, err := itemRepo.FindByPathAndBoxId(file.Path, 1)
+	assert.NoError(t, err)
+	assert.NotNil(t, found)
+	found, err = itemRepo.FindByPathAndBoxId("my-dir/notes.txt", 1)
+	assert.NoError(t, err)
+	assert.Nil(t, found)
+}
@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"Boxed/internal/models"
+	"errors"
+	"gorm.io/gorm"
+)
+
+type ItemVersionRepository interface {
+	GenericRepository[models.ItemVersion]
+	FindByItemID(itemID uint) ([]models.ItemVersion, error)
+	FindByItemIDAndVersion(itemID uint, version int) (*models.ItemVersion, error)
+	FindItemIDsWithMoreVersions(boxID uint, keep int) ([]uint, error)
+	CountBySHA256(boxID uint, sha256sum string) (int64, error)
+	FindBySHA256(boxID uint, sha256sum string) ([]models.ItemVersion, error)
+	FindSHA256s(boxID uint) ([]string, error)
+	HardDelete(version *models.ItemVersion) error
+}
+
+type ItemVersionRepositoryImpl[T models.ItemVersion] struct {
+	GenericRepository[models.ItemVersion]
+	db *gorm.DB
+}
+
+func NewItemVersionRepository(db *gorm.DB) ItemVersionRepository {
+	return &ItemVersionRepositoryImpl[models.ItemVersion]{
+		GenericRepository: NewGenericRepository[models.ItemVersion](db),
+		db:                db,
+	}
+}
+
+// FindByItemID returns the prior revisions of an item, the newest first
+func (r *ItemVersionRepositoryImpl[T]) FindByItemID(itemID uint) ([]models.ItemVersion, error) {
+	var versions []models.ItemVersion
+	if err := r.db.Where("item_id = ?", itemID).Order("version DESC").Find(&versions).Error; err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+func (r *ItemVersionRepositoryImpl[T]) FindByItemIDAndVersion(itemID uint, version int) (*models.ItemVersion, error) {
+	var itemVersion models.ItemVersion
+	err := r.db.Where("item_id = ? AND version = ?", itemID, version).First(&itemVersion).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &itemVersion, nil
+}
+
+// FindItemIDsWithMoreVersions returns the items of the box that have more than keep prior revisions
+func (r *ItemVersionRepositoryImpl[T]) FindItemIDsWithMoreVersions(boxID uint, keep int) ([]uint, error) {
+	var itemIDs []uint
+	err := r.db.Model(&models.ItemVersion{}).
+		Where("box_id = ?", boxID).
+		Group("item_id").
+		Having("COUNT(*) > ?", keep).
+		Pluck("item_id", &itemIDs).Error
+	if err != nil {
+		return nil, err
+	}
+	return itemIDs, nil
+}
+
+// CountBySHA256 counts the revisions in the box that reference the content
+func (r *ItemVersionRepositoryImpl[T]) CountBySHA256(boxID uint, sha256sum string) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.ItemVersion{}).Where("box_id = ? AND sha256 = ?", boxID, sha256sum).Count(&count).Error
+	return count, err
+}
+
+// FindBySHA256 returns the revisions in the box that reference the content
+func (r *ItemVersionRepositoryImpl[T]) FindBySHA256(boxID uint, sha256sum string) ([]models.ItemVersion, error) {
+	var versions []models.ItemVersion
+	if err := r.db.Where("box_id = ? AND sha256 = ?", boxID, sha256sum).Order("id").Find(&versions).Error; err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+// FindSHA256s returns the distinct content referenced by the revisions in the box
+func (r *ItemVersionRepositoryImpl[T]) FindSHA256s(boxID uint) ([]string, error) {
+	var sums []string
+	err := r.db.Model(&models.ItemVersion{}).
+		Where("box_id = ? AND sha256 <> ''", boxID).
+		Distinct().
+		Pluck("sha256", &sums).Error
+	if err != nil {
+		return nil, err
+	}
+	return sums, nil
+}
+
+func (r *ItemVersionRepositoryImpl[T]) HardDelete(version *models.ItemVersion) error {
+	return r.db.Unscoped().Delete(version).Error
+}
@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"Boxed/internal/models"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"testing"
+)
+
+func setupTestDBWithItemVersions() *gorm.DB {
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	err := db.AutoMigrate(&models.ItemVersion{})
+	if err != nil {
+		panic(err)
+	}
+	return db
+}
+
+func TestItemVersionRepository_FindByItemID(t *testing.T) {
+	db := setupTestDBWithItemVersions()
+	versionRepo := NewItemVersionRepository(db)
+	for version := 1; version <= 3; version++ {
+		assert.NoError(t, versionRepo.Create(&models.ItemVersion{ItemID: 7, BoxID: 1, Version: version, SHA256: "aa"}))
+	}
+	assert.NoError(t, versionRepo.Create(&models.ItemVersion{ItemID: 8, BoxID: 1, Version: 1, SHA256: "bb"}))
+
+	versions, err := versionRepo.FindByItemID(7)
+	assert.NoError(t, err)
+	assert.Len(t, versions, 3)
+	assert.Equal(t, 3, versions[0].Version)
+	assert.Equal(t, 1, versions[2].Version)
+
+	version, err := versionRepo.FindByItemIDAndVersion(7, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, version.Version)
+
+	missing, err := versionRepo.FindByItemIDAndVersion(7, 4)
+	assert.NoError(t, err)
+	assert.Nil(t, missing)
+}
+
+func TestItemVersionRepository_Retention(t *testing.T) {
+	db := setupTestDBWithItemVersions()
+	versionRepo := NewItemVersionRepository(db)
+	for version := 1; version <= 3; version++ {
+		assert.NoError(t, versionRepo.Create(&models.ItemVersion{ItemID: 7, BoxID: 1, Version: version, SHA256: "aa"}))
+	}
+	assert.NoError(t, versionRepo.Create(&models.ItemVersion{ItemID: 8, BoxID: 1, Version: 1, SHA256: "bb"}))
+	assert.NoError(t, versionRepo.Create(&models.ItemVersion{ItemID: 9, BoxID: 2, Version: 1, SHA256: "aa"}))
+
+	itemIDs, err := versionRepo.FindItemIDsWithMoreVersions(1, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []uint{7}, itemIDs)
+
+	count, err := versionRepo.CountBySHA256(1, "aa")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), count)
+
+	versions, _ := versionRepo.FindByItemID(7)
+	assert.NoError(t, versionRepo.HardDelete(&versions[2]))
+	count, _ = versionRepo.CountBySHA256(1, "aa")
+	assert.Equal(t, int64(2), count)
+}
+
+func TestItemVersionRepository_FindBySHA256(t *testing.T) {
+	db := setupTestDBWithItemVersions()
+	versionRepo := NewItemVersionRepository(db)
+	assert.NoError(t, versionRepo.Create(&models.ItemVersion{ItemID: 7, BoxID: 1, Version: 1, SHA256: "aa"}))
+	assert.NoError(t, versionRepo.Create(&models.ItemVersion{ItemID: 7, BoxID: 1, Version: 2, SHA256: "aa"}))
+	assert.NoError(t, versionRepo.Create(&models.ItemVersion{ItemID: 8, BoxID: 1, Version: 1, SHA256: "bb"}))
+	assert.NoError(t, versionRepo.Create(&models.ItemVersion{ItemID: 9, BoxID: 2, Version: 1, SHA256: "cc"}))
+
+	versions, err := versionRepo.FindBySHA256(1, "aa")
+	assert.NoError(t, err)
+	assert.Len(t, versions, 2)
+
+	sums, err := versionRepo.FindSHA256s(1)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"aa", "bb"}, sums)
+}
@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"Boxed/internal/models"
+	"gorm.io/gorm"
+)
+
+type JobRepository interface {
+	GenericRepository[models.Job]
+	FindByStatus(statuses ...string) ([]models.Job, error)
+	FindRecent(status string, limit int, offset int) ([]models.Job, error)
+	UpdateProgress(id uint, bytesProcessed int64, itemsProcessed int64, itemsTotal int64) error
+}
+
+type JobRepositoryImpl[T models.Job] struct {
+	GenericRepository[models.Job]
+	db *gorm.DB
+}
+
+func NewJobRepository(db *gorm.DB) JobRepository {
+	return &JobRepositoryImpl[models.Job]{
+		GenericRepository: NewGenericRepository[models.Job](db),
+		db:                db,
+	}
+}
+
+func (r *JobRepositoryImpl[T]) FindByStatus(statuses ...string) ([]models.Job, error) {
+	var jobs []models.Job
+	if err := r.db.Where("status IN ?", statuses).Order("id").Find(&jobs).Error; err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+func (r *JobRepositoryImpl[T]) FindRecent(status string, limit int, offset int) ([]models.Job, error) {
+	var jobs []models.Job
+	query := r.db.Order("id DESC").Limit(limit).Offset(offset)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if err := query.Find(&jobs).Error; err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// UpdateProgress only touches the progress counters so it can run concurrently with status changes
+func (r *JobRepositoryImpl[T]) UpdateProgress(id uint, bytesProcessed int64, itemsProcessed int64, itemsTotal int64) error {
+	return r.db.Model(&models.Job{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"bytes_processed": bytesProcessed,
+		"items_processed": itemsProcessed,
+		"items_total":     itemsTotal,
+	}).Error
+}
@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"Boxed/internal/models"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"testing"
+)
+
+func setupTestDBWithJobs() *gorm.DB {
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	err := db.AutoMigrate(&models.Job{})
+	if err != nil {
+		panic(err)
+	}
+	return db
+}
+
+func TestJobRepository_FindByStatus(t *testing.T) {
+	db := setupTestDBWithJobs()
+	jobRepo := NewJobRepository(db)
+
+	assert.NoError(t, jobRepo.Create(&models.Job{Type: "copy", Status: models.JobStatusRunning}))
+	assert.NoError(t, jobRepo.Create(&models.Job{Type: "clean", Status: models.JobStatusPending}))
+	assert.NoError(t, jobRepo.Create(&models.Job{Type: "move", Status: models.JobStatusSucceeded}))
+
+	jobs, err := jobRepo.FindByStatus(models.JobStatusPending, models.JobStatusRunning)
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 2)
+	assert.Equal(t, "copy", jobs[0].Type)
+	assert.Equal(t, "clean", jobs[1].Type)
+}
+
+func TestJobRepository_FindRecent(t *testing.T) {
+	db := setupTestDBWithJobs()
+	jobRepo := NewJobRepository(db)
+
+	for _, status := range []string{models.JobStatusFailed, models.JobStatusSucceeded, models.JobStatusFailed} {
+		assert.NoError(t, jobRepo.Create(&models.Job{Type: "clean", Status: status}))
+	}
+
+	jobs, err := jobRepo.FindRecent("", 2, 0)
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 2)
+	assert.Greater(t, jobs[0].ID, jobs[1].ID)
+
+	failed, err := jobRepo.FindRecent(models.JobStatusFailed, 10, 0)
+	assert.NoError(t, err)
+	assert.Len(t, failed, 2)
+}
+
+func TestJobRepository_UpdateProgress(t *testing.T) {
+	db := setupTestDBWithJobs()
+	jobRepo := NewJobRepository(db)
+	job := &models.Job{Type: "copy", Status: models.JobStatusRunning}
+	assert.NoError(t, jobRepo.Create(job))
+
+	assert.NoError(t, jobRepo.UpdateProgress(job.ID, 2048, 3, 10))
+
+	stored, err := jobRepo.FindByID(job.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2048), stored.BytesProcessed)
+	assert.Equal(t, int64(3), stored.ItemsProcessed)
+	assert.Equal(t, int64(10), stored.ItemsTotal)
+	assert.Equal(t, models.JobStatusRunning, stored.Status)
+}
@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"Boxed/internal/models"
+	"errors"
+	"gorm.io/gorm"
+	"time"
+)
+
+type UploadSessionRepository interface {
+	GenericRepository[models.UploadSession]
+	FindByUUID(uuid string) (*models.UploadSession, error)
+	FindExpired(now time.Time) ([]models.UploadSession, error)
+	HardDelete(session *models.UploadSession) error
+}
+
+type UploadSessionRepositoryImpl[T models.UploadSession] struct {
+	GenericRepository[models.UploadSession]
+	db *gorm.DB
+}
+
+func NewUploadSessionRepository(db *gorm.DB) UploadSessionRepository {
+	return &UploadSessionRepositoryImpl[models.UploadSession]{
+		GenericRepository: NewGenericRepository[models.UploadSession](db),
+		db:                db,
+	}
+}
+
+func (r *UploadSessionRepositoryImpl[T]) FindByUUID(uuid string) (*models.UploadSession, error) {
+	var session models.UploadSession
+	err := r.db.Where("uuid = ?", uuid).First(&session).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (r *UploadSessionRepositoryImpl[T]) FindExpired(now time.Time) ([]models.UploadSession, error) {
+	var sessions []models.UploadSession
+	if err := r.db.Where("expires_at < ?", now).Find(&sessions).Error; err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+func (r *UploadSessionRepositoryImpl[T]) HardDelete(session *models.UploadSession) error {
+	return r.db.Unscoped().Delete(session).Error
+}
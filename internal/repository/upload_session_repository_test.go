@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"Boxed/internal/models"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"testing"
+	"time"
+)
+
+func setupTestDBWithUploadSessions() *gorm.DB {
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	err := db.AutoMigrate(&models.UploadSession{})
+	if err != nil {
+		panic(err)
+	}
+	return db
+}
+
+func TestUploadSessionRepository_FindByUUID(t *testing.T) {
+	db := setupTestDBWithUploadSessions()
+	sessionRepo := NewUploadSessionRepository(db)
+	session := &models.UploadSession{UUID: "0b5e2a5c-8f0e-4c38-9d4e-3c8b1f7e1a11", Path: "builds/app.tar", Length: 1024, ExpiresAt: time.Now().Add(time.Hour)}
+	assert.NoError(t, sessionRepo.Create(session))
+
+	found, err := sessionRepo.FindByUUID(session.UUID)
+	assert.NoError(t, err)
+	assert.Equal(t, session.ID, found.ID)
+	assert.Equal(t, int64(1024), found.Length)
+
+	missing, err := sessionRepo.FindByUUID("7d8a2f55-5a0b-4a6e-8f0c-2b9c1a4f9e22")
+	assert.NoError(t, err)
+	assert.Nil(t, missing)
+}
+
+func TestUploadSessionRepository_FindExpiredAndHardDelete(t *testing.T) {
+	db := setupTestDBWithUploadSessions()
+	sessionRepo := NewUploadSessionRepository(db)
+	expired := &models.UploadSession{UUID: "expired", Path: "a.bin", ExpiresAt: time.Now().Add(-time.Minute)}
+	active := &models.UploadSession{UUID: "active", Path: "b.bin", ExpiresAt: time.Now().Add(time.Hour)}
+	assert.NoError(t, sessionRepo.Create(expired))
+	assert.NoError(t, sessionRepo.Create(active))
+
+	sessions, err := sessionRepo.FindExpired(time.Now())
+	assert.NoError(t, err)
+	assert.Len(t, sessions, 1)
+	assert.Equal(t, "expired", sessions[0].UUID)
+
+	assert.NoError(t, sessionRepo.HardDelete(&sessions[0]))
+	var count int64
+	db.Unscoped().Model(&models.UploadSession{}).Count(&count)
+	assert.Equal(t, int64(1), count)
+}
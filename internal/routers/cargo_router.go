@@ -0,0 +1,19 @@
+package routers
+
+import (
+	"Boxed/cmd"
+	"github.com/gofiber/fiber/v2"
+)
+
+func SetupCargoRouter(
+	app *fiber.App,
+	server *cmd.Server,
+) {
+	cargoHandler := server.CargoHandler
+	app.Get("/cargo/:box/index/config.json", cargoHandler.GetConfig)
+	app.Get("/cargo/:box/index/*", cargoHandler.GetIndexFile)
+	app.Put("/cargo/:box/api/v1/crates/new", cargoHandler.Publish)
+	app.Delete("/cargo/:box/api/v1/crates/:crate/:version/yank", cargoHandler.Yank)
+	app.Put("/cargo/:box/api/v1/crates/:crate/:version/unyank", cargoHandler.Unyank)
+	app.Get("/cargo/:box/api/v1/crates/:crate/:version/download", cargoHandler.Download)
+}
@@ -0,0 +1,17 @@
+package routers
+
+import (
+	"Boxed/cmd"
+	"github.com/gofiber/fiber/v2"
+)
+
+func SetupDebianRouter(
+	app *fiber.App,
+	server *cmd.Server,
+) {
+	debianHandler := server.DebianHandler
+	app.Post("/debian/:box/api/dists/:distribution/:component", debianHandler.Upload)
+	app.Delete("/debian/:box/api/dists/:distribution/:component/:package/:version/:architecture", debianHandler.Remove)
+	app.Get("/debian/:box/key.asc", debianHandler.GetKey)
+	app.Get("/debian/:box/*", debianHandler.Get)
+}
@@ -0,0 +1,15 @@
+package routers
+
+import (
+	"Boxed/cmd"
+	"github.com/gofiber/fiber/v2"
+)
+
+func SetupGoproxyRouter(
+	app *fiber.App,
+	server *cmd.Server,
+) {
+	goproxyHandler := server.GoproxyHandler
+	app.Get("/goproxy/:box/*", goproxyHandler.Get)
+	app.Put("/goproxy/:box/*", goproxyHandler.Put)
+}
@@ -0,0 +1,17 @@
+package routers
+
+import (
+	"Boxed/cmd"
+	"github.com/gofiber/fiber/v2"
+)
+
+func SetupHelmRouter(
+	app *fiber.App,
+	server *cmd.Server,
+) {
+	helmHandler := server.HelmHandler
+	app.Get("/helm/:box/index.yaml", helmHandler.GetIndex)
+	app.Get("/helm/:box/charts/:file", helmHandler.GetChart)
+	app.Post("/helm/:box/api/charts", helmHandler.Upload)
+	app.Delete("/helm/:box/api/charts/:name/:version", helmHandler.Delete)
+}
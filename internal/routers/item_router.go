@@ -10,8 +10,6 @@ func SetupItemRouter(app *fiber.App, server *cmd.Server) {
 	app.Get("/items", itemHandler.ListItems)
 	app.Get("/items/deleted", itemHandler.ListDeletedItems)
 	app.Get("/items/search", itemHandler.ItemsSearch)
-
-	// TODO: Not implemented yet, implement ASAP
-	//app.Post("/items/copy", itemHandler.ItemCopy)
-	//app.Post("/items/move", itemHandler.ItemMove)
+	app.Post("/items/copy", itemHandler.ItemCopy)
+	app.Post("/items/move", itemHandler.ItemMove)
 }
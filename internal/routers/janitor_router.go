@@ -8,12 +8,22 @@ import (
 func SetupJanitorRouter(app *fiber.App, server *cmd.Server) {
 	janitor := server.JanitorService
 	app.Post("/janitor/clean", func(ctx *fiber.Ctx) error {
-		err := janitor.ForceStartCleanCycle()
+		job, err := janitor.ForceStartCleanCycle()
 		if err != nil {
 			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"error": err.Error(),
 			})
 		}
-		return ctx.Status(fiber.StatusOK).JSON(fiber.Map{})
+		return ctx.Status(fiber.StatusAccepted).JSON(job)
+	})
+	scrubber := server.ScrubService
+	app.Post("/janitor/scrub", func(ctx *fiber.Ctx) error {
+		job, err := scrubber.ForceScrub()
+		if err != nil {
+			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		return ctx.Status(fiber.StatusAccepted).JSON(job)
 	})
 }
@@ -0,0 +1,13 @@
+package routers
+
+import (
+	"Boxed/cmd"
+	"github.com/gofiber/fiber/v2"
+)
+
+func SetupJobRouter(app *fiber.App, server *cmd.Server) {
+	jobHandler := server.JobHandler
+	app.Get("/jobs", jobHandler.ListJobs)
+	app.Get("/jobs/:id", jobHandler.GetJob)
+	app.Post("/jobs/:id/cancel", jobHandler.CancelJob)
+}
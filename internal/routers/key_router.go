@@ -0,0 +1,15 @@
+package routers
+
+import (
+	"Boxed/cmd"
+	"github.com/gofiber/fiber/v2"
+)
+
+func SetupKeyRouter(
+	app *fiber.App,
+	server *cmd.Server,
+) {
+	keyHandler := server.KeyHandler
+	app.Get("/keys", keyHandler.GetKeys)
+	app.Post("/keys/rotate", keyHandler.RotateKeys)
+}
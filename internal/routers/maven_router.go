@@ -0,0 +1,15 @@
+package routers
+
+import (
+	"Boxed/cmd"
+	"github.com/gofiber/fiber/v2"
+)
+
+func SetupMavenRouter(
+	app *fiber.App,
+	server *cmd.Server,
+) {
+	mavenHandler := server.MavenHandler
+	app.Get("/maven/:box/*", mavenHandler.Get)
+	app.Put("/maven/:box/*", mavenHandler.Put)
+}
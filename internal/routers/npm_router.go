@@ -0,0 +1,16 @@
+package routers
+
+import (
+	"Boxed/cmd"
+	"github.com/gofiber/fiber/v2"
+)
+
+func SetupNpmRouter(
+	app *fiber.App,
+	server *cmd.Server,
+) {
+	npmHandler := server.NpmHandler
+	app.Get("/npm/:box/*", npmHandler.Get)
+	app.Put("/npm/:box/*", npmHandler.Put)
+	app.Delete("/npm/:box/*", npmHandler.Delete)
+}
@@ -0,0 +1,20 @@
+package routers
+
+import (
+	"Boxed/cmd"
+	"github.com/gofiber/fiber/v2"
+)
+
+func SetupNugetRouter(
+	app *fiber.App,
+	server *cmd.Server,
+) {
+	nugetHandler := server.NugetHandler
+	app.Get("/nuget/:box/index.json", nugetHandler.GetServiceIndex)
+	app.Put("/nuget/:box/api/v2/package", nugetHandler.Push)
+	app.Delete("/nuget/:box/api/v2/package/:id/:version", nugetHandler.Delete)
+	app.Get("/nuget/:box/v3-flatcontainer/:id/index.json", nugetHandler.GetVersions)
+	app.Get("/nuget/:box/v3-flatcontainer/:id/:version/:file", nugetHandler.GetFile)
+	app.Get("/nuget/:box/registration/:id/index.json", nugetHandler.GetRegistration)
+	app.Get("/nuget/:box/registration/:id/:leaf", nugetHandler.GetRegistrationLeaf)
+}
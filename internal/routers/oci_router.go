@@ -0,0 +1,18 @@
+package routers
+
+import (
+	"Boxed/cmd"
+	"github.com/gofiber/fiber/v2"
+)
+
+func SetupOciRouter(
+	app *fiber.App,
+	server *cmd.Server,
+) {
+	ociHandler := server.OciHandler
+	app.Get("/v2/*", ociHandler.Get)
+	app.Post("/v2/*", ociHandler.Post)
+	app.Patch("/v2/*", ociHandler.Patch)
+	app.Put("/v2/*", ociHandler.Put)
+	app.Delete("/v2/*", ociHandler.Delete)
+}
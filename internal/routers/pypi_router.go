@@ -0,0 +1,16 @@
+package routers
+
+import (
+	"Boxed/cmd"
+	"github.com/gofiber/fiber/v2"
+)
+
+func SetupPypiRouter(
+	app *fiber.App,
+	server *cmd.Server,
+) {
+	pypiHandler := server.PypiHandler
+	app.Get("/pypi/:box/*", pypiHandler.Get)
+	app.Post("/pypi/:box", pypiHandler.Upload)
+	app.Post("/pypi/:box/legacy", pypiHandler.Upload)
+}
@@ -11,6 +11,21 @@ func SetupRoutes(
 ) {
 	SetupItemRouter(app, server)
 	SetupBoxRouter(app, server)
+	SetupJobRouter(app, server)
+	SetupUploadSessionRouter(app, server)
+	SetupMavenRouter(app, server)
+	SetupNpmRouter(app, server)
+	SetupPypiRouter(app, server)
+	SetupGoproxyRouter(app, server)
+	SetupOciRouter(app, server)
+	SetupHelmRouter(app, server)
+	SetupDebianRouter(app, server)
+	SetupRpmRouter(app, server)
+	SetupNugetRouter(app, server)
+	SetupCargoRouter(app, server)
+	SetupVersionRouter(app, server)
+	SetupTrashRouter(app, server)
+	SetupKeyRouter(app, server)
 	SetupUploadRouter(app, server)
 	SetupJanitorRouter(app, server)
 }
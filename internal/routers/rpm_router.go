@@ -0,0 +1,16 @@
+package routers
+
+import (
+	"Boxed/cmd"
+	"github.com/gofiber/fiber/v2"
+)
+
+func SetupRpmRouter(
+	app *fiber.App,
+	server *cmd.Server,
+) {
+	rpmHandler := server.RpmHandler
+	app.Get("/rpm/:box/*", rpmHandler.Get)
+	app.Put("/rpm/:box/*", rpmHandler.Put)
+	app.Delete("/rpm/:box/*", rpmHandler.Delete)
+}
@@ -0,0 +1,15 @@
+package routers
+
+import (
+	"Boxed/cmd"
+	"github.com/gofiber/fiber/v2"
+)
+
+func SetupTrashRouter(
+	app *fiber.App,
+	server *cmd.Server,
+) {
+	trashHandler := server.TrashHandler
+	app.Get("/trash/:box", trashHandler.GetTrash)
+	app.Post("/trash/:box/:id/restore", trashHandler.RestoreItem)
+}
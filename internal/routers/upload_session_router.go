@@ -0,0 +1,16 @@
+package routers
+
+import (
+	"Boxed/cmd"
+	"github.com/gofiber/fiber/v2"
+)
+
+func SetupUploadSessionRouter(app *fiber.App, server *cmd.Server) {
+	uploadHandler := server.UploadHandler
+	app.Options("/uploads", uploadHandler.Options)
+	app.Post("/uploads/:id<guid>/finalize", uploadHandler.FinalizeUpload)
+	app.Post("/uploads/:box/*", uploadHandler.CreateUpload)
+	app.Get("/uploads/:id<guid>", uploadHandler.UploadStatus)
+	app.Patch("/uploads/:id<guid>", uploadHandler.UploadChunk)
+	app.Delete("/uploads/:id<guid>", uploadHandler.AbortUpload)
+}
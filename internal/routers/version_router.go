@@ -0,0 +1,15 @@
+package routers
+
+import (
+	"Boxed/cmd"
+	"github.com/gofiber/fiber/v2"
+)
+
+func SetupVersionRouter(
+	app *fiber.App,
+	server *cmd.Server,
+) {
+	versionHandler := server.VersionHandler
+	app.Get("/versions/:box/*", versionHandler.GetVersions)
+	app.Post("/versions/:box/*", versionHandler.RestoreVersion)
+}
@@ -0,0 +1,501 @@
+package services
+
+import (
+	"Boxed/internal/config"
+	"Boxed/internal/helpers"
+	"Boxed/internal/models"
+	"Boxed/internal/storage"
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	ArchiveFormatZip   = "zip"
+	ArchiveFormatTar   = "tar"
+	ArchiveFormatTarGz = "tar.gz"
+)
+
+var (
+	ErrUnsupportedArchive  = errors.New("unsupported archive format")
+	ErrArchiveRejected     = errors.New("archive rejected")
+	defaultExplodeEntries  = 10000
+	defaultExplodeMaxSize  = int64(10 * 1024)
+	defaultExplodeMaxRatio = int64(100)
+)
+
+// ArchiveOptions selects the files of a folder that go into an archive.
+// Depth limits how many levels below the folder are included, 0 means unlimited.
+type ArchiveOptions struct {
+	Include []string
+	Exclude []string
+	Depth   int
+}
+
+// ArchiveEntry is a file of the archive together with its path relative to the archived folder
+type ArchiveEntry struct {
+	Path string
+	Item models.Item
+}
+
+// ExplodeSummary lists the items an exploded archive created or updated, by path
+type ExplodeSummary struct {
+	Created []string `json:"created"`
+	Updated []string `json:"updated"`
+	Skipped []string `json:"skipped,omitempty"`
+	Bytes   int64    `json:"bytes"`
+}
+
+type ArchiveService interface {
+	ListFolderEntries(box *models.Box, folder *models.Item, options ArchiveOptions) ([]ArchiveEntry, error)
+	WriteArchive(writer io.Writer, box *models.Box, format string, entries []ArchiveEntry) error
+	StageArchive(reader io.Reader) (string, error)
+	ExplodeArchive(box *models.Box, targetPath string, archivePath string, properties string) (*ExplodeSummary, error)
+}
+
+type ArchiveServiceImpl struct {
+	itemService   ItemService
+	fileService   FileService
+	logService    LogService
+	configuration config.Configuration
+}
+
+func NewArchiveService(
+	itemService ItemService,
+	fileService FileService,
+	logService LogService,
+	configuration *config.Configuration,
+) ArchiveService {
+	return &ArchiveServiceImpl{
+		itemService:   itemService,
+		fileService:   fileService,
+		logService:    logService,
+		configuration: *configuration,
+	}
+}
+
+// NormalizeArchiveFormat maps the accepted spellings of a format to its canonical name
+func NormalizeArchiveFormat(format string) (string, error) {
+	switch strings.ToLower(strings.TrimPrefix(format, ".")) {
+	case "", "zip":
+		return ArchiveFormatZip, nil
+	case "tar.gz", "tgz":
+		return ArchiveFormatTarGz, nil
+	}
+	return "", fmt.Errorf("%w: %s", ErrUnsupportedArchive, format)
+}
+
+// ListFolderEntries collects the files below folder that pass the filters, sorted by path
+func (s *ArchiveServiceImpl) ListFolderEntries(box *models.Box, folder *models.Item, options ArchiveOptions) ([]ArchiveEntry, error) {
+	descendants, err := s.itemService.GetAllDescendants(folder.ID, -1)
+	if err != nil {
+		return nil, err
+	}
+
+	// Entry paths are rebuilt from the names of the items below the folder
+	byID := make(map[uint]*models.Item, len(descendants))
+	for i := range descendants {
+		if descendants[i].BoxID == box.ID {
+			byID[descendants[i].ID] = &descendants[i]
+		}
+	}
+
+	var entries []ArchiveEntry
+	for _, item := range byID {
+		if item.Type != "file" {
+			continue
+		}
+		entryPath, ok := relativeItemPath(item, folder.ID, byID)
+		if !ok {
+			continue
+		}
+		if options.Depth > 0 && strings.Count(entryPath, "/")+1 > options.Depth {
+			continue
+		}
+		if len(options.Include) > 0 && !helpers.MatchAnyGlob(options.Include, entryPath) {
+			continue
+		}
+		if helpers.MatchAnyGlob(options.Exclude, entryPath) {
+			continue
+		}
+		entries = append(entries, ArchiveEntry{Path: entryPath, Item: *item})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	return entries, nil
+}
+
+// relativeItemPath walks up the parents of item until it reaches the folder with rootID
+func relativeItemPath(item *models.Item, rootID uint, byID map[uint]*models.Item) (string, bool) {
+	parts := []string{item.Name}
+	for current := item; ; {
+		if current.ParentID == nil {
+			return "", false
+		}
+		if *current.ParentID == rootID {
+			break
+		}
+		parent, ok := byID[*current.ParentID]
+		if !ok {
+			return "", false
+		}
+		parts = append(parts, parent.Name)
+		current = parent
+	}
+	for i, j := 0, len(parts)-1; i < j; i, j = i+1, j-1 {
+		parts[i], parts[j] = parts[j], parts[i]
+	}
+	return path.Join(parts...), true
+}
+
+// WriteArchive streams the entries into writer, reading each file from the hash storage
+func (s *ArchiveServiceImpl) WriteArchive(writer io.Writer, box *models.Box, format string, entries []ArchiveEntry) error {
+	archiveLog := s.logService.Log.WithFields(logrus.Fields{
+		"box":     box.Name,
+		"format":  format,
+		"entries": len(entries),
+	})
+
+	var err error
+	switch format {
+	case ArchiveFormatZip:
+		err = s.writeZip(writer, box, entries)
+	case ArchiveFormatTarGz:
+		err = s.writeTarGz(writer, box, entries)
+	default:
+		err = fmt.Errorf("%w: %s", ErrUnsupportedArchive, format)
+	}
+	if err != nil {
+		archiveLog.WithError(err).Error("Failed to write archive")
+		return err
+	}
+	archiveLog.Debug("Archive written")
+	return nil
+}
+
+func (s *ArchiveServiceImpl) writeZip(writer io.Writer, box *models.Box, entries []ArchiveEntry) error {
+	zipWriter := zip.NewWriter(writer)
+	for _, entry := range entries {
+		entryWriter, err := zipWriter.CreateHeader(&zip.FileHeader{
+			Name:     entry.Path,
+			Method:   zip.Deflate,
+			Modified: entry.Item.UpdatedAt,
+		})
+		if err != nil {
+			return err
+		}
+		if err := s.copyBlob(entryWriter, box, &entry.Item); err != nil {
+			return err
+		}
+	}
+	return zipWriter.Close()
+}
+
+func (s *ArchiveServiceImpl) writeTarGz(writer io.Writer, box *models.Box, entries []ArchiveEntry) error {
+	gzipWriter := gzip.NewWriter(writer)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for _, entry := range entries {
+		err := tarWriter.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     entry.Path,
+			Mode:     0644,
+			Size:     entry.Item.Size,
+			ModTime:  entry.Item.UpdatedAt,
+		})
+		if err != nil {
+			return err
+		}
+		if err := s.copyBlob(tarWriter, box, &entry.Item); err != nil {
+			return err
+		}
+	}
+	if err := tarWriter.Close(); err != nil {
+		return err
+	}
+	return gzipWriter.Close()
+}
+
+func (s *ArchiveServiceImpl) copyBlob(writer io.Writer, box *models.Box, item *models.Item) error {
+	blob, err := s.fileService.OpenBlob(box, item.SHA256)
+	if err != nil {
+		return fmt.Errorf("content of %s not found: %w", item.Name, err)
+	}
+	defer blob.Close()
+	// The tar header announced item.Size, never write more than that
+	if _, err := io.Copy(writer, io.LimitReader(blob, item.Size)); err != nil {
+		return fmt.Errorf("failed to archive %s: %w", item.Name, err)
+	}
+	return nil
+}
+
+// StageArchive writes an uploaded archive to the staging directory, zip archives need random access
+// and the properties of a streamed upload may only arrive after the file. The caller removes the file.
+func (s *ArchiveServiceImpl) StageArchive(reader io.Reader) (string, error) {
+	stagingDir := storage.StagingDir(s.fileService.GetStoragePath(), "archives")
+	if err := os.MkdirAll(stagingDir, 0750); err != nil {
+		return "", fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	stagingFile, err := os.CreateTemp(stagingDir, "archive-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create staging file: %w", err)
+	}
+	_, err = io.Copy(stagingFile, reader)
+	if closeErr := stagingFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(stagingFile.Name())
+		return "", fmt.Errorf("failed to stage archive: %w", err)
+	}
+	return stagingFile.Name(), nil
+}
+
+// ExplodeArchive extracts a zip, tar or tar.gz archive below targetPath. Every file goes through the
+// hash storage and receives properties. Entries escaping the target folder and archives exceeding
+// the configured limits are rejected with ErrArchiveRejected. Extraction is not rolled back: the entries
+// extracted before that are kept and listed by the summary returned with the error, the entry that
+// exceeded a limit is not stored.
+func (s *ArchiveServiceImpl) ExplodeArchive(box *models.Box, targetPath string, archivePath string, properties string) (*ExplodeSummary, error) {
+	archive, err := os.Open(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer archive.Close()
+	archiveInfo, err := archive.Stat()
+	if err != nil {
+		return nil, err
+	}
+	format, err := detectArchiveFormat(archive)
+	if err != nil {
+		return nil, err
+	}
+
+	explodeConfig := s.configuration.Server.UploadConfig.Explode
+	maxEntries := explodeConfig.MaxEntries
+	if maxEntries <= 0 {
+		maxEntries = defaultExplodeEntries
+	}
+	maxSize := explodeConfig.MaxSize
+	if maxSize <= 0 {
+		maxSize = defaultExplodeMaxSize
+	}
+	maxRatio := explodeConfig.MaxRatio
+	if maxRatio <= 0 {
+		maxRatio = defaultExplodeMaxRatio
+	}
+	// The entry headers can lie about their sizes, so the bytes actually extracted are counted
+	exploder := &archiveExploder{
+		service:    s,
+		box:        box,
+		targetPath: strings.Trim(targetPath, "/"),
+		properties: properties,
+		maxEntries: maxEntries,
+		budget:     min(maxSize*1024*1024, max(archiveInfo.Size(), 1)*maxRatio),
+		summary:    &ExplodeSummary{Created: []string{}, Updated: []string{}},
+	}
+
+	switch format {
+	case ArchiveFormatZip:
+		err = exploder.explodeZip(archive, archiveInfo.Size())
+	case ArchiveFormatTarGz:
+		var gzipReader *gzip.Reader
+		if gzipReader, err = gzip.NewReader(archive); err == nil {
+			err = exploder.explodeTar(gzipReader)
+		}
+	case ArchiveFormatTar:
+		err = exploder.explodeTar(archive)
+	}
+
+	explodeLog := s.logService.Log.WithFields(logrus.Fields{
+		"box":     box.Name,
+		"path":    targetPath,
+		"format":  format,
+		"created": len(exploder.summary.Created),
+		"updated": len(exploder.summary.Updated),
+	})
+	if err != nil {
+		explodeLog.WithError(err).Warn("Failed to explode archive")
+		return exploder.summary, err
+	}
+	explodeLog.Info("Archive exploded")
+	return exploder.summary, nil
+}
+
+// detectArchiveFormat sniffs the format from the magic bytes and rewinds the archive
+func detectArchiveFormat(archive io.ReadSeeker) (string, error) {
+	header, err := bufio.NewReaderSize(archive, 512).Peek(262)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	if _, err := archive.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	switch {
+	case bytes.HasPrefix(header, []byte("PK\x03\x04")), bytes.HasPrefix(header, []byte("PK\x05\x06")):
+		return ArchiveFormatZip, nil
+	case bytes.HasPrefix(header, []byte{0x1f, 0x8b}):
+		return ArchiveFormatTarGz, nil
+	case len(header) >= 262 && string(header[257:262]) == "ustar":
+		return ArchiveFormatTar, nil
+	}
+	return "", ErrUnsupportedArchive
+}
+
+// archiveExploder holds the state of a single ExplodeArchive call
+type archiveExploder struct {
+	service    *ArchiveServiceImpl
+	box        *models.Box
+	targetPath string
+	properties string
+	maxEntries int
+	entries    int
+	budget     int64
+	summary    *ExplodeSummary
+}
+
+func (e *archiveExploder) explodeZip(archive io.ReaderAt, size int64) error {
+	zipReader, err := zip.NewReader(archive, size)
+	if err != nil {
+		return err
+	}
+	for _, file := range zipReader.File {
+		mode := file.Mode()
+		switch {
+		case mode.IsDir():
+			if err := e.folder(file.Name); err != nil {
+				return err
+			}
+		case mode.IsRegular():
+			entry, err := file.Open()
+			if err != nil {
+				return err
+			}
+			err = e.file(file.Name, entry)
+			_ = entry.Close()
+			if err != nil {
+				return err
+			}
+		default:
+			e.summary.Skipped = append(e.summary.Skipped, file.Name)
+		}
+	}
+	return nil
+}
+
+func (e *archiveExploder) explodeTar(archive io.Reader) error {
+	tarReader := tar.NewReader(archive)
+	for {
+		header, err := tarReader.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = e.folder(header.Name)
+		case tar.TypeReg:
+			err = e.file(header.Name, tarReader)
+		case tar.TypeXGlobalHeader:
+		default:
+			// Links and devices have no place in a box
+			e.summary.Skipped = append(e.summary.Skipped, header.Name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (e *archiveExploder) folder(name string) error {
+	folderPath, err := e.entryPath(name)
+	if err != nil || folderPath == e.targetPath {
+		return err
+	}
+	_, err = e.service.fileService.CreateFileStructure(e.box, folderPath, nil, false, "")
+	return err
+}
+
+func (e *archiveExploder) file(name string, reader io.Reader) error {
+	filePath, err := e.entryPath(name)
+	if err != nil {
+		return err
+	}
+	if filePath == e.targetPath {
+		return fmt.Errorf("%w: invalid entry %q", ErrArchiveRejected, name)
+	}
+
+	// The entry fails while it is stored once it exceeds the remaining budget, so nothing past it is kept
+	budget := &budgetReader{reader: reader, remaining: e.budget}
+	blob, err := e.service.fileService.StoreBlob(e.box, filePath, budget)
+	if err != nil {
+		return err
+	}
+	e.budget = budget.remaining
+
+	existing, err := e.service.itemService.FindByPathAndBoxId(filePath, e.box.ID)
+	if err != nil {
+		return err
+	}
+	if _, err := e.service.fileService.CreateFileFromBlob(e.box, filePath, blob, false, e.properties); err != nil {
+		return fmt.Errorf("failed to extract %s: %w", name, err)
+	}
+	if existing != nil {
+		e.summary.Updated = append(e.summary.Updated, filePath)
+	} else {
+		e.summary.Created = append(e.summary.Created, filePath)
+	}
+	e.summary.Bytes += blob.Size
+	return nil
+}
+
+// entryPath validates an entry name and returns its path inside the box
+func (e *archiveExploder) entryPath(name string) (string, error) {
+	e.entries++
+	if e.entries > e.maxEntries {
+		return "", fmt.Errorf("%w: more than %d entries", ErrArchiveRejected, e.maxEntries)
+	}
+	name = strings.TrimSuffix(strings.ReplaceAll(name, "\\", "/"), "/")
+	if name == "" || name == "." {
+		return e.targetPath, nil
+	}
+	if path.IsAbs(name) || !filepath.IsLocal(name) {
+		return "", fmt.Errorf("%w: entry %q escapes the target folder", ErrArchiveRejected, name)
+	}
+	cleaned := path.Clean(name)
+	if e.targetPath == "" {
+		return cleaned, nil
+	}
+	return e.targetPath + "/" + cleaned, nil
+}
+
+// budgetReader fails with ErrArchiveRejected as soon as more than remaining bytes are read through it
+type budgetReader struct {
+	reader    io.Reader
+	remaining int64
+}
+
+func (r *budgetReader) Read(p []byte) (int, error) {
+	// Read one byte more than the remaining budget to notice readers exceeding it
+	if int64(len(p)) > r.remaining+1 {
+		p = p[:r.remaining+1]
+	}
+	n, err := r.reader.Read(p)
+	if int64(n) > r.remaining {
+		r.remaining = 0
+		return 0, fmt.Errorf("%w: extracted size exceeds the limit", ErrArchiveRejected)
+	}
+	r.remaining -= int64(n)
+	return n, err
+}
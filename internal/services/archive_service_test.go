@@ -0,0 +1,144 @@
+package services
+
+import (
+	"Boxed/internal/config"
+	"Boxed/internal/models"
+	"Boxed/internal/storage"
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func setupTestArchive(t *testing.T, configuration *config.Configuration) (*testServices, ArchiveService) {
+	ts := setupTestServicesWithConfig(t, configuration)
+	return ts, NewArchiveService(ts.itemService, ts.fileService, ts.logService, ts.configuration)
+}
+
+// stageTarGz builds a tar.gz archive of the files and stages it like an upload
+func stageTarGz(t *testing.T, archiveService ArchiveService, files map[string]string) string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buffer bytes.Buffer
+	gzipWriter := gzip.NewWriter(&buffer)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for _, name := range names {
+		require.NoError(t, tarWriter.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(files[name])), Typeflag: tar.TypeReg}))
+		_, err := io.WriteString(tarWriter, files[name])
+		require.NoError(t, err)
+	}
+	require.NoError(t, tarWriter.Close())
+	require.NoError(t, gzipWriter.Close())
+
+	archivePath, err := archiveService.StageArchive(&buffer)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = os.Remove(archivePath) })
+	return archivePath
+}
+
+func (ts *testServices) blobCount(t *testing.T, box *models.Box) int {
+	count := 0
+	require.NoError(t, ts.blobStore.List(box, func(storage.BlobInfo) error {
+		count++
+		return nil
+	}))
+	return count
+}
+
+func TestArchiveService_FolderArchive(t *testing.T) {
+	ts, archiveService := setupTestArchive(t, &config.Configuration{})
+	box := ts.createBox(t, "files", nil)
+	ts.storeFile(t, box, "docs/readme.md", "readme")
+	ts.storeFile(t, box, "docs/api/index.md", "index")
+	ts.storeFile(t, box, "docs/api/deep/notes.txt", "notes")
+	ts.storeFile(t, box, "other/skipped.md", "skipped")
+	folder := ts.findItem(t, box, "docs")
+
+	entries, err := archiveService.ListFolderEntries(box, folder, ArchiveOptions{})
+	require.NoError(t, err)
+	var paths []string
+	for _, entry := range entries {
+		paths = append(paths, entry.Path)
+	}
+	assert.Equal(t, []string{"api/deep/notes.txt", "api/index.md", "readme.md"}, paths)
+
+	entries, err = archiveService.ListFolderEntries(box, folder, ArchiveOptions{Include: []string{"**/*.md"}, Depth: 2})
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "api/index.md", entries[0].Path)
+
+	var archive bytes.Buffer
+	require.NoError(t, archiveService.WriteArchive(&archive, box, ArchiveFormatZip, entries))
+	zipReader, err := zip.NewReader(bytes.NewReader(archive.Bytes()), int64(archive.Len()))
+	require.NoError(t, err)
+	require.Len(t, zipReader.File, 2)
+	entry, err := zipReader.File[0].Open()
+	require.NoError(t, err)
+	content, err := io.ReadAll(entry)
+	assert.NoError(t, entry.Close())
+	assert.NoError(t, err)
+	assert.Equal(t, "index", string(content))
+
+	assert.ErrorIs(t, archiveService.WriteArchive(io.Discard, box, "rar", entries), ErrUnsupportedArchive)
+}
+
+func TestArchiveService_ExplodeArchive(t *testing.T) {
+	ts, archiveService := setupTestArchive(t, &config.Configuration{})
+	box := ts.createBox(t, "files", nil)
+	ts.storeFile(t, box, "target/existing.txt", "old")
+
+	archivePath := stageTarGz(t, archiveService, map[string]string{
+		"existing.txt":   "new",
+		"nested/new.txt": "created",
+	})
+	summary, err := archiveService.ExplodeArchive(box, "/target/", archivePath, "origin=archive")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"target/nested/new.txt"}, summary.Created)
+	assert.Equal(t, []string{"target/existing.txt"}, summary.Updated)
+	assert.Equal(t, int64(len("new")+len("created")), summary.Bytes)
+	assert.Equal(t, "created", ts.fileContent(t, box, "target/nested/new.txt"))
+	assert.Equal(t, "new", ts.fileContent(t, box, "target/existing.txt"))
+	assert.Contains(t, string(ts.findItem(t, box, "target/nested/new.txt").Properties), "archive")
+
+	archivePath = stageTarGz(t, archiveService, map[string]string{"../escaped.txt": "escaped"})
+	_, err = archiveService.ExplodeArchive(box, "target", archivePath, "")
+	assert.ErrorIs(t, err, ErrArchiveRejected)
+	assert.Nil(t, ts.findItem(t, box, "escaped.txt"))
+}
+
+func TestArchiveService_ExplodeBudget(t *testing.T) {
+	configuration := &config.Configuration{}
+	configuration.Server.UploadConfig.Explode.MaxRatio = 2
+	ts, archiveService := setupTestArchive(t, configuration)
+	box := ts.createBox(t, "files", nil)
+
+	// The zeros compress far better than the ratio allows
+	archivePath := stageTarGz(t, archiveService, map[string]string{
+		"a-small.txt": "small",
+		"b-bomb.bin":  strings.Repeat("\x00", 1<<20),
+	})
+	summary, err := archiveService.ExplodeArchive(box, "", archivePath, "")
+	assert.ErrorIs(t, err, ErrArchiveRejected)
+	// What was extracted before the limit was hit is kept, nothing of the entry exceeding it is stored
+	assert.Equal(t, []string{"a-small.txt"}, summary.Created)
+	assert.NotNil(t, ts.findItem(t, box, "a-small.txt"))
+	assert.Nil(t, ts.findItem(t, box, "b-bomb.bin"))
+	assert.Equal(t, 1, ts.blobCount(t, box))
+
+	configuration.Server.UploadConfig.Explode.MaxEntries = 1
+	archiveService = NewArchiveService(ts.itemService, ts.fileService, ts.logService, configuration)
+	archivePath = stageTarGz(t, archiveService, map[string]string{"one.txt": "1", "two.txt": "2"})
+	_, err = archiveService.ExplodeArchive(box, "", archivePath, "")
+	assert.ErrorIs(t, err, ErrArchiveRejected)
+}
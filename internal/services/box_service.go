@@ -3,17 +3,38 @@ package services
 import (
 	"Boxed/internal/models"
 	"Boxed/internal/repository"
+	"Boxed/internal/storage"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
 )
 
+// ErrReservedBoxPath rejects box paths inside the directory Boxed stages its files in, and box names
+// the API routes take for themselves
+var ErrReservedBoxPath = errors.New("box path is reserved")
+
+// reservedBoxNames are the first segments of the routes besides /:box/*. A box named like one of them
+// could not be browsed, its requests would reach the route instead, so no box may take these names:
+// boxes, items, jobs, uploads, upload, download, versions, trash, keys, janitor and the protocol routes
+// maven, npm, pypi, goproxy, v2, helm, debian, rpm, nuget and cargo.
+var reservedBoxNames = map[string]bool{
+	"boxes": true, "items": true, "jobs": true, "uploads": true, "upload": true, "download": true,
+	"versions": true, "trash": true, "keys": true, "janitor": true,
+	"maven": true, "npm": true, "pypi": true, "goproxy": true, "v2": true, "helm": true, "debian": true,
+	"rpm": true, "nuget": true, "cargo": true,
+}
+
 type BoxService interface {
-	CreateBox(name string, properties map[string]interface{}, path string) (*models.Box, error)
+	CreateBox(name string, properties map[string]interface{}, path string, boxType string) (*models.Box, error)
 	GetBoxByID(id uint) (*models.Box, error)
 	UpdateBox(id uint, name string, properties map[string]interface{}) (*models.Box, error)
 	DeleteBox(id uint) error
 	GetBoxes() ([]models.Box, error)
 	GetBoxByPath(path string) (*models.Box, error)
 	GetDeletedBoxes() ([]models.Box, error)
+	// GetBoxUsage reports the logical size of the files of the box and the space they take in storage
+	GetBoxUsage(id uint) (*repository.BoxUsage, error)
 }
 
 func NewBoxService(boxRepo repository.BoxRepository) BoxService {
@@ -24,9 +45,21 @@ type boxServiceImpl struct {
 	boxRepo repository.BoxRepository
 }
 
-func (s *boxServiceImpl) CreateBox(name string, properties map[string]interface{}, path string) (*models.Box, error) {
+func (s *boxServiceImpl) CreateBox(name string, properties map[string]interface{}, path string, boxType string) (*models.Box, error) {
+	if !models.IsValidBoxType(boxType) {
+		return nil, fmt.Errorf("unknown box type: %s", boxType)
+	}
+	if boxType == "" {
+		boxType = models.BoxTypeGeneric
+	}
+	if storage.IsReservedPath(path) {
+		return nil, fmt.Errorf("%w: %s", ErrReservedBoxPath, path)
+	}
+	if reservedBoxNames[name] {
+		return nil, fmt.Errorf("%w: %s", ErrReservedBoxPath, name)
+	}
 	propertiesJSON, _ := json.Marshal(properties)
-	box := &models.Box{Name: name, Properties: propertiesJSON, Path: path}
+	box := &models.Box{Name: name, Properties: propertiesJSON, Path: path, Type: boxType}
 	if err := s.boxRepo.Create(box); err != nil {
 		return nil, err
 	}
@@ -40,6 +73,9 @@ func (s *boxServiceImpl) GetBoxByPath(path string) (*models.Box, error) {
 	return s.boxRepo.FindByName(path)
 }
 func (s *boxServiceImpl) UpdateBox(id uint, name string, properties map[string]interface{}) (*models.Box, error) {
+	if reservedBoxNames[name] {
+		return nil, fmt.Errorf("%w: %s", ErrReservedBoxPath, name)
+	}
 	box, err := s.boxRepo.FindByID(id)
 	if err != nil {
 		return nil, err
@@ -70,3 +106,13 @@ func (s *boxServiceImpl) GetBoxes() ([]models.Box, error) {
 func (s *boxServiceImpl) GetDeletedBoxes() ([]models.Box, error) {
 	return s.GetDeletedBoxes()
 }
+
+func (s *boxServiceImpl) GetBoxUsage(id uint) (*repository.BoxUsage, error) {
+	if _, err := s.boxRepo.FindByID(id); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %d", ErrBoxNotFound, id)
+		}
+		return nil, err
+	}
+	return s.boxRepo.Usage(id)
+}
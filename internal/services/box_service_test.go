@@ -2,6 +2,7 @@ package services
 
 import (
 	"Boxed/internal/models"
+	"Boxed/internal/repository"
 	"encoding/json"
 	"testing"
 
@@ -41,6 +42,29 @@ func (m *MockBoxRepository) FindAll() ([]models.Box, error) {
 	return args.Get(0).([]models.Box), args.Error(1)
 }
 
+func (m *MockBoxRepository) FindByName(path string) (*models.Box, error) {
+	args := m.Called(path)
+	box, ok := args.Get(0).(*models.Box)
+	if !ok {
+		return nil, args.Error(1)
+	}
+	return box, args.Error(1)
+}
+
+func (m *MockBoxRepository) FindDeleted(id int) ([]*models.Box, error) {
+	args := m.Called(id)
+	return args.Get(0).([]*models.Box), args.Error(1)
+}
+
+func (m *MockBoxRepository) Usage(boxID uint) (*repository.BoxUsage, error) {
+	args := m.Called(boxID)
+	usage, ok := args.Get(0).(*repository.BoxUsage)
+	if !ok {
+		return nil, args.Error(1)
+	}
+	return usage, args.Error(1)
+}
+
 func TestBoxService_GetBoxes(t *testing.T) {
 	mockRepo := new(MockBoxRepository)
 	service := NewBoxService(mockRepo)
@@ -68,11 +92,11 @@ func TestBoxService_CreateBox(t *testing.T) {
 
 	properties := map[string]interface{}{"key": "value"}
 	propertiesJSON, _ := json.Marshal(properties)
-	box := &models.Box{Name: "Test Box", Path: "/path/to/box", Properties: propertiesJSON}
+	box := &models.Box{Name: "Test Box", Path: "/path/to/box", Properties: propertiesJSON, Type: models.BoxTypeGeneric}
 
 	mockRepo.On("Create", box).Return(nil)
 
-	createdBox, err := service.CreateBox("Test Box", "/path/to/box", properties)
+	createdBox, err := service.CreateBox("Test Box", properties, "/path/to/box", "")
 
 	assert.NoError(t, err)
 	assert.Equal(t, "Test Box", createdBox.Name)
@@ -80,6 +104,32 @@ func TestBoxService_CreateBox(t *testing.T) {
 	mockRepo.AssertExpectations(t)
 }
 
+func TestBoxService_CreateBoxInReservedPath(t *testing.T) {
+	mockRepo := new(MockBoxRepository)
+	service := NewBoxService(mockRepo)
+
+	for _, path := range []string{"/data/.boxed", "/data/.boxed/uploads", "data/./.boxed/../.boxed/blobs"} {
+		_, err := service.CreateBox("Test Box", nil, path, "")
+		assert.ErrorIs(t, err, ErrReservedBoxPath, path)
+	}
+	mockRepo.AssertNotCalled(t, "Create", mock.Anything)
+}
+
+func TestBoxService_ReservedBoxNames(t *testing.T) {
+	mockRepo := new(MockBoxRepository)
+	service := NewBoxService(mockRepo)
+
+	// The routes of these names would shadow the box
+	for _, name := range []string{"maven", "npm", "pypi", "goproxy", "v2", "helm", "debian", "rpm", "nuget", "cargo", "jobs"} {
+		_, err := service.CreateBox(name, nil, "/data/"+name, "")
+		assert.ErrorIs(t, err, ErrReservedBoxPath, name)
+		_, err = service.UpdateBox(1, name, nil)
+		assert.ErrorIs(t, err, ErrReservedBoxPath, name)
+	}
+	mockRepo.AssertNotCalled(t, "Create", mock.Anything)
+	mockRepo.AssertNotCalled(t, "FindByID", mock.Anything)
+}
+
 func TestBoxService_GetBoxByID(t *testing.T) {
 	mockRepo := new(MockBoxRepository)
 	service := NewBoxService(mockRepo)
@@ -106,11 +156,11 @@ func TestBoxService_UpdateBox(t *testing.T) {
 	mockRepo.On("FindByID", uint(1)).Return(box, nil)
 	mockRepo.On("Update", box).Return(nil)
 
-	updatedBox, err := service.UpdateBox(1, "Updated Box", "/updated/path", updatedProperties)
+	updatedBox, err := service.UpdateBox(1, "Updated Box", updatedProperties)
 
 	assert.NoError(t, err)
 	assert.Equal(t, "Updated Box", updatedBox.Name)
-	assert.Equal(t, "/updated/path", updatedBox.Path)
+	assert.Equal(t, "/original/path", updatedBox.Path)
 	assert.EqualValues(t, updatedPropertiesJSON, updatedBox.Properties)
 	mockRepo.AssertExpectations(t)
 }
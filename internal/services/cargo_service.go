@@ -0,0 +1,445 @@
+package services
+
+import (
+	"Boxed/internal/helpers"
+	"Boxed/internal/models"
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	CargoIndexDir         = "index"
+	cargoCratesDir        = "crates"
+	cargoMaxMetadataBytes = 1 << 20
+	cargoMaxCrateBytes    = 1 << 30
+)
+
+var (
+	cargoNamePattern = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_-]{0,63}$`)
+	cargoSemver      = regexp.MustCompile(`^(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)(-[0-9A-Za-z-.]+)?(\+[0-9A-Za-z-.]+)?$`)
+)
+
+// CargoIndexEntry is one line of an index file, it describes a single version of a crate
+type CargoIndexEntry struct {
+	Name        string                 `json:"name"`
+	Vers        string                 `json:"vers"`
+	Deps        []CargoIndexDependency `json:"deps"`
+	Cksum       string                 `json:"cksum"`
+	Features    map[string][]string    `json:"features"`
+	Features2   map[string][]string    `json:"features2,omitempty"`
+	Yanked      bool                   `json:"yanked"`
+	Links       *string                `json:"links"`
+	V           int                    `json:"v,omitempty"`
+	RustVersion string                 `json:"rust_version,omitempty"`
+}
+
+type CargoIndexDependency struct {
+	Name            string   `json:"name"`
+	Req             string   `json:"req"`
+	Features        []string `json:"features"`
+	Optional        bool     `json:"optional"`
+	DefaultFeatures bool     `json:"default_features"`
+	Target          *string  `json:"target"`
+	Kind            string   `json:"kind"`
+	Registry        *string  `json:"registry,omitempty"`
+	Package         string   `json:"package,omitempty"`
+}
+
+// cargoPublishMetadata is the JSON part of a publish request
+type cargoPublishMetadata struct {
+	Name string `json:"name"`
+	Vers string `json:"vers"`
+	Deps []struct {
+		Name               string   `json:"name"`
+		VersionReq         string   `json:"version_req"`
+		Features           []string `json:"features"`
+		Optional           bool     `json:"optional"`
+		DefaultFeatures    bool     `json:"default_features"`
+		Target             *string  `json:"target"`
+		Kind               string   `json:"kind"`
+		Registry           *string  `json:"registry"`
+		ExplicitNameInToml *string  `json:"explicit_name_in_toml"`
+	} `json:"deps"`
+	Features      map[string][]string `json:"features"`
+	Authors       []string            `json:"authors"`
+	Description   string              `json:"description"`
+	Documentation string              `json:"documentation"`
+	Homepage      string              `json:"homepage"`
+	Keywords      []string            `json:"keywords"`
+	Categories    []string            `json:"categories"`
+	License       string              `json:"license"`
+	Repository    string              `json:"repository"`
+	Links         *string             `json:"links"`
+	RustVersion   string              `json:"rust_version"`
+}
+
+// CargoService keeps boxes of type cargo as registries for the sparse index protocol. The .crate
+// files are stored in crates/<name>/ with their index entry and the publish metadata as properties,
+// the index files under index/ are regenerated from those properties after every publish and yank.
+type CargoService interface {
+	Publish(box *models.Box, body io.Reader) (*CargoIndexEntry, error)
+	SetYanked(box *models.Box, name string, version string, yanked bool) error
+	Crate(box *models.Box, name string, version string) (*models.Item, error)
+	IndexFile(box *models.Box, indexPath string) (*models.Item, error)
+}
+
+type CargoServiceImpl struct {
+	itemService ItemService
+	fileService FileService
+	logService  LogService
+	indexLock   sync.Mutex
+}
+
+func NewCargoService(
+	itemService ItemService,
+	fileService FileService,
+	logService LogService,
+) CargoService {
+	return &CargoServiceImpl{
+		itemService: itemService,
+		fileService: fileService,
+		logService:  logService,
+	}
+}
+
+// Publish stores a crate from the body of a publish request: the length of the JSON metadata as a
+// 32 bit little endian integer, the metadata, then the length of the .crate file and the file itself.
+// A crate version can only be published once, yanked versions included.
+func (s *CargoServiceImpl) Publish(box *models.Box, body io.Reader) (*CargoIndexEntry, error) {
+	var metadataLength uint32
+	if err := binary.Read(body, binary.LittleEndian, &metadataLength); err != nil || metadataLength > cargoMaxMetadataBytes {
+		return nil, fmt.Errorf("%w: invalid metadata length", ErrInvalidPackage)
+	}
+	var metadata cargoPublishMetadata
+	if err := json.NewDecoder(io.LimitReader(body, int64(metadataLength))).Decode(&metadata); err != nil {
+		return nil, fmt.Errorf("%w: metadata: %v", ErrInvalidPackage, err)
+	}
+	if !cargoNamePattern.MatchString(metadata.Name) {
+		return nil, fmt.Errorf("%w: invalid crate name %q", ErrInvalidPackage, metadata.Name)
+	}
+	if !cargoSemver.MatchString(metadata.Vers) {
+		return nil, fmt.Errorf("%w: version %q is not a semantic version", ErrInvalidPackage, metadata.Vers)
+	}
+	var crateLength uint32
+	if err := binary.Read(body, binary.LittleEndian, &crateLength); err != nil || crateLength > cargoMaxCrateBytes {
+		return nil, fmt.Errorf("%w: invalid crate length", ErrInvalidPackage)
+	}
+
+	s.indexLock.Lock()
+	defer s.indexLock.Unlock()
+
+	name := strings.ToLower(metadata.Name)
+	versions, err := s.versions(box, name)
+	if err != nil {
+		return nil, err
+	}
+	for _, version := range versions {
+		if version.entry.Name != metadata.Name {
+			return nil, fmt.Errorf("%w: crate name %q conflicts with %q", ErrInvalidPackage, metadata.Name, version.entry.Name)
+		}
+		// Versions differing only in build metadata cannot be told apart by cargo
+		if helpers.CompareSemver(version.entry.Vers, metadata.Vers) == 0 {
+			return nil, fmt.Errorf("%w: %s %s", ErrVersionExists, metadata.Name, version.entry.Vers)
+		}
+	}
+
+	blob, err := s.fileService.StoreBlob(box, ".crate", io.LimitReader(body, int64(crateLength)))
+	if err != nil {
+		return nil, err
+	}
+	if blob.Size != int64(crateLength) {
+		return nil, fmt.Errorf("%w: crate is shorter than its length", ErrInvalidPackage)
+	}
+	crate, err := s.fileService.OpenBlob(box, blob.SHA256)
+	if err != nil {
+		return nil, err
+	}
+	err = checkCrateArchive(crate, metadata.Name+"-"+metadata.Vers+"/")
+	_ = crate.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	entry := cargoIndexEntry(&metadata, blob.SHA256)
+	item, err := s.fileService.CreateFileFromBlob(box, cargoCratePath(name, metadata.Vers), blob, false, "")
+	if err != nil {
+		return nil, err
+	}
+	propertiesJSON, err := cargoProperties(&metadata, entry)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.itemService.UpdateProperties(item.ID, propertiesJSON); err != nil {
+		return nil, err
+	}
+	if err := s.regenerateIndexFile(box, name); err != nil {
+		return nil, err
+	}
+
+	s.logService.Log.WithFields(logrus.Fields{
+		"box":     box.Name,
+		"crate":   metadata.Name,
+		"version": metadata.Vers,
+	}).Info("Cargo crate published")
+	return entry, nil
+}
+
+// SetYanked marks a crate version as yanked or takes the mark back, the index file follows
+func (s *CargoServiceImpl) SetYanked(box *models.Box, name string, version string, yanked bool) error {
+	s.indexLock.Lock()
+	defer s.indexLock.Unlock()
+
+	item, err := s.Crate(box, name, version)
+	if err != nil {
+		return err
+	}
+	properties := helpers.PropertiesFromJSON(item.Properties)
+	properties["yanked"] = []string{fmt.Sprint(yanked)}
+	propertiesJSON, err := json.Marshal(properties)
+	if err != nil {
+		return err
+	}
+	if err := s.itemService.UpdateProperties(item.ID, propertiesJSON); err != nil {
+		return err
+	}
+	if err := s.regenerateIndexFile(box, strings.ToLower(name)); err != nil {
+		return err
+	}
+
+	s.logService.Log.WithFields(logrus.Fields{
+		"box":     box.Name,
+		"crate":   name,
+		"version": version,
+		"yanked":  yanked,
+	}).Info("Cargo crate yank changed")
+	return nil
+}
+
+func (s *CargoServiceImpl) Crate(box *models.Box, name string, version string) (*models.Item, error) {
+	name = strings.ToLower(name)
+	item, err := s.itemService.FindByPathAndBoxId(cargoCratePath(name, version), box.ID)
+	if err != nil {
+		return nil, err
+	}
+	if item == nil || item.Type != "file" || item.Name != name+"-"+version+".crate" {
+		return nil, fmt.Errorf("%w: %s %s", ErrPackageNotFound, name, version)
+	}
+	return item, nil
+}
+
+// IndexFile returns the index file at a path relative to the index root, e.g. "se/rd/serde"
+func (s *CargoServiceImpl) IndexFile(box *models.Box, indexPath string) (*models.Item, error) {
+	name := indexPath[strings.LastIndex(indexPath, "/")+1:]
+	if !cargoNamePattern.MatchString(name) || indexPath != CargoIndexPath(strings.ToLower(name)) {
+		return nil, fmt.Errorf("%w: %s", ErrPackageNotFound, indexPath)
+	}
+	item, err := s.itemService.FindByPathAndBoxId(CargoIndexDir+"/"+indexPath, box.ID)
+	if err != nil {
+		return nil, err
+	}
+	// The index file is named after the crate it lists
+	if item == nil || item.Type != "file" || item.Name != name {
+		return nil, fmt.Errorf("%w: %s", ErrPackageNotFound, name)
+	}
+	return item, nil
+}
+
+type cargoVersion struct {
+	item  models.Item
+	entry CargoIndexEntry
+}
+
+// versions reads the index entries of the stored versions of a crate, ordered by version
+func (s *CargoServiceImpl) versions(box *models.Box, name string) ([]cargoVersion, error) {
+	folder, err := s.itemService.FindByPathAndBoxId(cargoCratesDir+"/"+name, box.ID)
+	if err != nil || folder == nil {
+		return nil, err
+	}
+	items, err := s.itemService.FindItemsByParentID(&folder.ID, box.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []cargoVersion
+	for _, item := range items {
+		properties := helpers.PropertiesFromJSON(item.Properties)
+		if item.Type != "file" || len(properties["index"]) == 0 {
+			continue
+		}
+		version := cargoVersion{item: item}
+		if err := json.Unmarshal([]byte(properties["index"][0]), &version.entry); err != nil {
+			continue
+		}
+		version.entry.Yanked = len(properties["yanked"]) > 0 && properties["yanked"][0] == "true"
+		versions = append(versions, version)
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return helpers.CompareSemver(versions[i].entry.Vers, versions[j].entry.Vers) < 0
+	})
+	return versions, nil
+}
+
+// regenerateIndexFile writes the index file of a crate, one JSON line per version
+func (s *CargoServiceImpl) regenerateIndexFile(box *models.Box, name string) error {
+	versions, err := s.versions(box, name)
+	if err != nil {
+		return err
+	}
+	var index bytes.Buffer
+	for _, version := range versions {
+		line, err := json.Marshal(version.entry)
+		if err != nil {
+			return err
+		}
+		index.Write(line)
+		index.WriteByte('\n')
+	}
+	_, err = s.fileService.CreateFileFromReader(box, CargoIndexDir+"/"+CargoIndexPath(name), &index, false, "")
+	return err
+}
+
+// CargoIndexPath is the path of the index file of a lower case crate name: names of one to three
+// characters live in 1/, 2/ and 3/<first character>/, longer ones under their first two pairs of characters
+func CargoIndexPath(name string) string {
+	switch len(name) {
+	case 1:
+		return "1/" + name
+	case 2:
+		return "2/" + name
+	case 3:
+		return "3/" + name[:1] + "/" + name
+	}
+	return name[:2] + "/" + name[2:4] + "/" + name
+}
+
+func cargoCratePath(name string, version string) string {
+	return cargoCratesDir + "/" + name + "/" + name + "-" + version + ".crate"
+}
+
+// cargoIndexEntry converts publish metadata into an index entry. Dependencies renamed in Cargo.toml
+// are listed under their new name with the original one as package, features using the "dep:" or
+// "?/" syntax go into features2, which needs version 2 of the entry format.
+func cargoIndexEntry(metadata *cargoPublishMetadata, cksum string) *CargoIndexEntry {
+	entry := &CargoIndexEntry{
+		Name:        metadata.Name,
+		Vers:        metadata.Vers,
+		Deps:        []CargoIndexDependency{},
+		Cksum:       cksum,
+		Features:    map[string][]string{},
+		Links:       metadata.Links,
+		RustVersion: metadata.RustVersion,
+	}
+	for _, dependency := range metadata.Deps {
+		indexDependency := CargoIndexDependency{
+			Name:            dependency.Name,
+			Req:             dependency.VersionReq,
+			Features:        dependency.Features,
+			Optional:        dependency.Optional,
+			DefaultFeatures: dependency.DefaultFeatures,
+			Target:          dependency.Target,
+			Kind:            dependency.Kind,
+			Registry:        dependency.Registry,
+		}
+		if indexDependency.Features == nil {
+			indexDependency.Features = []string{}
+		}
+		if indexDependency.Kind == "" {
+			indexDependency.Kind = "normal"
+		}
+		if dependency.ExplicitNameInToml != nil && *dependency.ExplicitNameInToml != dependency.Name {
+			indexDependency.Name = *dependency.ExplicitNameInToml
+			indexDependency.Package = dependency.Name
+		}
+		entry.Deps = append(entry.Deps, indexDependency)
+	}
+	for feature, values := range metadata.Features {
+		if values == nil {
+			values = []string{}
+		}
+		newSyntax := false
+		for _, value := range values {
+			newSyntax = newSyntax || strings.HasPrefix(value, "dep:") || strings.Contains(value, "?/")
+		}
+		if !newSyntax {
+			entry.Features[feature] = values
+			continue
+		}
+		if entry.Features2 == nil {
+			entry.Features2 = map[string][]string{}
+			entry.V = 2
+		}
+		entry.Features2[feature] = values
+	}
+	return entry
+}
+
+func cargoProperties(metadata *cargoPublishMetadata, entry *CargoIndexEntry) ([]byte, error) {
+	index, err := json.Marshal(entry)
+	if err != nil {
+		return nil, err
+	}
+	properties := map[string][]string{
+		"name":    {metadata.Name},
+		"version": {metadata.Vers},
+		"cksum":   {entry.Cksum},
+		"yanked":  {"false"},
+		"index":   {string(index)},
+	}
+	for key, value := range map[string]string{
+		"description":   metadata.Description,
+		"documentation": metadata.Documentation,
+		"homepage":      metadata.Homepage,
+		"license":       metadata.License,
+		"repository":    metadata.Repository,
+		"rust_version":  metadata.RustVersion,
+	} {
+		if value != "" {
+			properties[key] = []string{value}
+		}
+	}
+	for key, values := range map[string][]string{
+		"authors":    metadata.Authors,
+		"keywords":   metadata.Keywords,
+		"categories": metadata.Categories,
+	} {
+		if len(values) > 0 {
+			properties[key] = values
+		}
+	}
+	for _, dependency := range entry.Deps {
+		properties["dependencies"] = append(properties["dependencies"], dependency.Name+" "+dependency.Req)
+	}
+	return json.Marshal(properties)
+}
+
+// checkCrateArchive makes sure a .crate is a gzipped tarball with its files in <name>-<version>/
+func checkCrateArchive(crate io.Reader, prefix string) error {
+	gzipReader, err := gzip.NewReader(crate)
+	if err != nil {
+		return fmt.Errorf("%w: crate is not a gzipped tarball", ErrInvalidPackage)
+	}
+	defer gzipReader.Close()
+
+	header, err := tar.NewReader(gzipReader).Next()
+	if errors.Is(err, io.EOF) {
+		return fmt.Errorf("%w: crate is empty", ErrInvalidPackage)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidPackage, err)
+	}
+	if !strings.HasPrefix(header.Name, prefix) {
+		return fmt.Errorf("%w: crate files are not in %s", ErrInvalidPackage, prefix)
+	}
+	return nil
+}
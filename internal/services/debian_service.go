@@ -0,0 +1,800 @@
+package services
+
+import (
+	"Boxed/internal/config"
+	"Boxed/internal/helpers"
+	"Boxed/internal/models"
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/klauspost/compress/zstd"
+	"github.com/sirupsen/logrus"
+	"github.com/ulikunitz/xz"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/clearsign"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	debianPoolDir    = "pool"
+	debianDistsDir   = "dists"
+	debianArchAll    = "all"
+	debianMaxControl = 1 << 20
+)
+
+var (
+	ErrNoSigningKey      = errors.New("no signing key configured")
+	debianPackagePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9+.-]+$`)
+	debianVersionPattern = regexp.MustCompile(`^([0-9]+:)?[0-9][A-Za-z0-9.+~-]*$`)
+	debianNamePattern    = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9.+-]*$`)
+	// debianIndexFields are computed from the stored file and replace whatever the control file says
+	debianIndexFields = []string{"Filename", "Size", "MD5sum", "SHA1", "SHA256", "SHA512"}
+)
+
+// DebianPackage identifies a package of a distribution
+type DebianPackage struct {
+	Package      string `json:"package"`
+	Version      string `json:"version"`
+	Architecture string `json:"architecture"`
+	Distribution string `json:"distribution"`
+	Component    string `json:"component"`
+	Filename     string `json:"filename"`
+}
+
+// DebianService keeps boxes of type debian as APT repositories. Packages are stored once in pool/,
+// backed by the hash storage, with the fields of their control file as properties. The distributions
+// a package belongs to are a property as well, the files in dists/ are regenerated from them whenever a
+// package is stored or deleted, through this service or the generic file API. Packages stored in pool/
+// through the file API are part of the distributions their distributions property names.
+type DebianService interface {
+	Upload(box *models.Box, distribution string, component string, body io.Reader) (*DebianPackage, error)
+	Remove(box *models.Box, distribution string, component string, name string, version string, architecture string) error
+	File(box *models.Box, filePath string) (*models.Item, error)
+	PublicKey() ([]byte, error)
+	RegenerateDistribution(box *models.Box, distribution string) error
+}
+
+type DebianServiceImpl struct {
+	itemService   ItemService
+	fileService   FileService
+	logService    LogService
+	signingKey    *openpgp.Entity
+	signingKeyErr error
+	lock          sync.Mutex
+}
+
+func NewDebianService(
+	itemService ItemService,
+	fileService FileService,
+	logService LogService,
+	configuration *config.Configuration,
+) DebianService {
+	signingKey, err := loadDebianSigningKey(configuration.Server.DebianConfig)
+	if err != nil {
+		logService.Log.WithError(err).Error("Failed to load the debian signing key")
+	}
+	service := &DebianServiceImpl{
+		itemService:   itemService,
+		fileService:   fileService,
+		logService:    logService,
+		signingKey:    signingKey,
+		signingKeyErr: err,
+	}
+	fileService.AddFileListener(service)
+	return service
+}
+
+// debianPoolEntry is a package in the pool together with its properties
+type debianPoolEntry struct {
+	item       models.Item
+	properties map[string][]string
+}
+
+func (e debianPoolEntry) value(key string) string {
+	if values := e.properties[key]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// Upload adds a .deb to a component of a distribution. A package already in the pool can be added to
+// further distributions, but a different build with the same name, version and architecture is rejected.
+func (s *DebianServiceImpl) Upload(box *models.Box, distribution string, component string, body io.Reader) (*DebianPackage, error) {
+	if !debianNamePattern.MatchString(distribution) || !debianNamePattern.MatchString(component) {
+		return nil, fmt.Errorf("%w: invalid distribution %q or component %q", ErrInvalidPackage, distribution, component)
+	}
+	blob, err := s.fileService.StoreBlob(box, ".deb", body)
+	if err != nil {
+		return nil, err
+	}
+	deb, err := s.fileService.OpenBlob(box, blob.SHA256)
+	if err != nil {
+		return nil, err
+	}
+	control, md5sum, sha1sum, err := readDebianPackage(deb)
+	_ = deb.Close()
+	if err != nil {
+		return nil, err
+	}
+	name := helpers.ControlValue(control, "Package")
+	version := helpers.ControlValue(control, "Version")
+	architecture := helpers.ControlValue(control, "Architecture")
+	source, _, _ := strings.Cut(helpers.ControlValue(control, "Source"), " ")
+	if source == "" {
+		source = name
+	}
+	if !debianPackagePattern.MatchString(name) || !debianPackagePattern.MatchString(source) {
+		return nil, fmt.Errorf("%w: invalid package name %q", ErrInvalidPackage, name)
+	}
+	if !debianVersionPattern.MatchString(version) {
+		return nil, fmt.Errorf("%w: invalid version %q", ErrInvalidPackage, version)
+	}
+	if !debianNamePattern.MatchString(architecture) {
+		return nil, fmt.Errorf("%w: invalid architecture %q", ErrInvalidPackage, architecture)
+	}
+
+	poolPath := debianPoolPath(component, source, name, version, architecture)
+	existing, err := s.poolItem(box, poolPath, blob.SHA256)
+	if err != nil {
+		return nil, err
+	}
+	if existing == nil {
+		// Not under the lock, the file listener takes it to index the package
+		if _, err := s.fileService.CreateFileFromBlob(box, poolPath, blob, false, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	// Another upload may have stored a different build in the meantime
+	existing, err = s.poolItem(box, poolPath, blob.SHA256)
+	if err != nil {
+		return nil, err
+	}
+	if existing == nil {
+		return nil, fmt.Errorf("%w: %s is not in the pool", ErrPackageNotFound, poolPath)
+	}
+	properties := helpers.PropertiesFromJSON(existing.Properties)
+	if slices.Contains(properties["distributions"], distribution) {
+		return nil, fmt.Errorf("%w: %s %s %s is already in %s", ErrVersionExists, name, version, architecture, distribution)
+	}
+	distributions := append(properties["distributions"], distribution)
+	sort.Strings(distributions)
+	for key, values := range debianProperties(control, poolPath, component, md5sum, sha1sum) {
+		properties[key] = values
+	}
+	properties["distributions"] = distributions
+	propertiesJSON, err := json.Marshal(properties)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.itemService.UpdateProperties(existing.ID, propertiesJSON); err != nil {
+		return nil, err
+	}
+	if err := s.regenerateDistribution(box, distribution); err != nil {
+		return nil, err
+	}
+
+	s.logService.Log.WithFields(logrus.Fields{
+		"box":          box.Name,
+		"package":      name,
+		"version":      version,
+		"distribution": distribution,
+	}).Info("Debian package uploaded")
+	return &DebianPackage{
+		Package:      name,
+		Version:      version,
+		Architecture: architecture,
+		Distribution: distribution,
+		Component:    component,
+		Filename:     poolPath,
+	}, nil
+}
+
+// poolItem returns the package stored at poolPath, an error when it is a different build than digest
+func (s *DebianServiceImpl) poolItem(box *models.Box, poolPath string, digest string) (*models.Item, error) {
+	item, err := s.itemService.FindByPathAndBoxId(poolPath, box.ID)
+	if err != nil || item == nil {
+		return nil, err
+	}
+	if item.SHA256 != digest {
+		return nil, fmt.Errorf("%w: a different build of %s is in the pool", ErrVersionExists, path.Base(poolPath))
+	}
+	return item, nil
+}
+
+// Remove takes a package out of a distribution, it is deleted from the pool when no distribution is left
+func (s *DebianServiceImpl) Remove(box *models.Box, distribution string, component string, name string, version string, architecture string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	entries, err := s.poolEntries(box)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.value("package") != name || entry.value("version") != version ||
+			entry.value("architecture") != architecture || entry.value("component") != component {
+			continue
+		}
+		distributions := entry.properties["distributions"]
+		if !slices.Contains(distributions, distribution) {
+			continue
+		}
+
+		remaining := slices.DeleteFunc(slices.Clone(distributions), func(d string) bool { return d == distribution })
+		if len(remaining) == 0 {
+			err = s.itemService.DeleteItem(entry.item.ID, false)
+		} else {
+			entry.properties["distributions"] = remaining
+			var propertiesJSON []byte
+			if propertiesJSON, err = json.Marshal(entry.properties); err == nil {
+				err = s.itemService.UpdateProperties(entry.item.ID, propertiesJSON)
+			}
+		}
+		if err != nil {
+			return err
+		}
+		return s.regenerateDistribution(box, distribution)
+	}
+	return fmt.Errorf("%w: %s %s %s in %s/%s", ErrPackageNotFound, name, version, architecture, distribution, component)
+}
+
+// File returns a file of the repository, a pool package or an index below dists/
+func (s *DebianServiceImpl) File(box *models.Box, filePath string) (*models.Item, error) {
+	item, err := s.itemService.FindByPathAndBoxId(filePath, box.ID)
+	if err != nil {
+		return nil, err
+	}
+	if item == nil || item.Type != "file" {
+		return nil, fmt.Errorf("%w: %s", ErrPackageNotFound, filePath)
+	}
+	return item, nil
+}
+
+// PublicKey returns the armored public key clients verify the Release files with
+func (s *DebianServiceImpl) PublicKey() ([]byte, error) {
+	if s.signingKey == nil {
+		return nil, ErrNoSigningKey
+	}
+	var key bytes.Buffer
+	writer, err := armor.Encode(&key, openpgp.PublicKeyType, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.signingKey.Serialize(writer); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return key.Bytes(), nil
+}
+
+func (s *DebianServiceImpl) RegenerateDistribution(box *models.Box, distribution string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.regenerateDistribution(box, distribution)
+}
+
+// FileStored indexes packages stored in pool/ of debian boxes. A stored file takes the properties it was
+// stored with, so a replaced package may have left distributions and every distribution is regenerated.
+func (s *DebianServiceImpl) FileStored(box *models.Box, filePath string, item models.Item) {
+	component, ok := debianPoolComponent(box, filePath, item)
+	if !ok {
+		return
+	}
+	debianLog := s.logService.Log.WithFields(logrus.Fields{
+		"box":  box.Name,
+		"path": filePath,
+	})
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if err := s.indexPackage(box, filePath, component, item); err != nil {
+		debianLog.WithError(err).Warn("Failed to index debian package")
+	}
+	// A package that cannot be read is left out, even when it replaced one that was indexed
+	distributions := s.childFolders(box, debianDistsDir)
+	for _, distribution := range helpers.PropertiesFromJSON(item.Properties)["distributions"] {
+		if debianNamePattern.MatchString(distribution) && !slices.Contains(distributions, distribution) {
+			distributions = append(distributions, distribution)
+		}
+	}
+	for _, distribution := range distributions {
+		if err := s.regenerateDistribution(box, distribution); err != nil {
+			debianLog.WithError(err).WithField("distribution", distribution).Error("Failed to regenerate distribution")
+		}
+	}
+	debianLog.Info("Debian package indexed")
+}
+
+// FileDeleted regenerates every distribution when packages, or folders that may hold some, are deleted
+// from the pool of debian boxes
+func (s *DebianServiceImpl) FileDeleted(box *models.Box, item models.Item) {
+	if box.Type != models.BoxTypeDebian || item.Type != "folder" && !strings.HasSuffix(item.Name, ".deb") {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, distribution := range s.childFolders(box, debianDistsDir) {
+		if err := s.regenerateDistribution(box, distribution); err != nil {
+			s.logService.Log.WithFields(logrus.Fields{
+				"box":          box.Name,
+				"item":         item.Name,
+				"distribution": distribution,
+			}).WithError(err).Error("Failed to regenerate distribution")
+		}
+	}
+}
+
+// indexPackage reads the control file of a stored package into its properties, next to the properties it
+// already has. The distributions the package is part of are kept.
+func (s *DebianServiceImpl) indexPackage(box *models.Box, filePath string, component string, item models.Item) error {
+	deb, err := s.fileService.OpenBlob(box, item.SHA256)
+	if err != nil {
+		return err
+	}
+	control, md5sum, sha1sum, err := readDebianPackage(deb)
+	_ = deb.Close()
+	if err != nil {
+		return err
+	}
+	properties := helpers.PropertiesFromJSON(item.Properties)
+	for key, values := range debianProperties(control, filePath, component, md5sum, sha1sum) {
+		properties[key] = values
+	}
+	propertiesJSON, err := json.Marshal(properties)
+	if err != nil {
+		return err
+	}
+	return s.itemService.UpdateProperties(item.ID, propertiesJSON)
+}
+
+// debianPoolComponent returns the component of a package stored in pool/<component>/ of a debian box
+func debianPoolComponent(box *models.Box, filePath string, item models.Item) (string, bool) {
+	if box.Type != models.BoxTypeDebian || !strings.HasSuffix(item.Name, ".deb") {
+		return "", false
+	}
+	parts := strings.Split(filePath, "/")
+	if len(parts) < 3 || parts[0] != debianPoolDir || !debianNamePattern.MatchString(parts[1]) {
+		return "", false
+	}
+	return parts[1], true
+}
+
+// regenerateDistribution writes the Packages indices of every component and architecture of the
+// distribution and the Release file listing them, signed when a key is configured. Indices that no
+// longer have packages are removed, a distribution without packages is removed entirely.
+func (s *DebianServiceImpl) regenerateDistribution(box *models.Box, distribution string) error {
+	if s.signingKeyErr != nil {
+		return s.signingKeyErr
+	}
+	entries, err := s.poolEntries(box)
+	if err != nil {
+		return err
+	}
+
+	components := make(map[string][]debianPoolEntry)
+	architectures := map[string]bool{debianArchAll: true}
+	for _, entry := range entries {
+		if slices.Contains(entry.properties["distributions"], distribution) {
+			components[entry.value("component")] = append(components[entry.value("component")], entry)
+			architectures[entry.value("architecture")] = true
+		}
+	}
+	distDir := debianDistsDir + "/" + distribution
+	if len(components) == 0 {
+		return s.removeIndexItem(box, distDir)
+	}
+
+	componentNames := sortedKeys(components)
+	architectureNames := sortedKeys(architectures)
+	release := &debianRelease{}
+	for _, component := range componentNames {
+		packages := components[component]
+		sort.Slice(packages, func(i, j int) bool {
+			if packages[i].value("package") != packages[j].value("package") {
+				return packages[i].value("package") < packages[j].value("package")
+			}
+			return packages[i].value("version") < packages[j].value("version")
+		})
+		for _, architecture := range architectureNames {
+			// Like the Debian archive, packages for all architectures are part of every Packages index
+			var index bytes.Buffer
+			for _, entry := range packages {
+				if packageArchitecture := entry.value("architecture"); packageArchitecture == architecture || packageArchitecture == debianArchAll {
+					if index.Len() > 0 {
+						index.WriteString("\n")
+					}
+					index.WriteString(debianIndexParagraph(entry))
+				}
+			}
+			var compressed bytes.Buffer
+			gzipWriter := gzip.NewWriter(&compressed)
+			if _, err := gzipWriter.Write(index.Bytes()); err != nil {
+				return err
+			}
+			if err := gzipWriter.Close(); err != nil {
+				return err
+			}
+
+			indexDir := component + "/binary-" + architecture
+			for _, file := range []struct {
+				name    string
+				content []byte
+			}{{"Packages", index.Bytes()}, {"Packages.gz", compressed.Bytes()}} {
+				if err := s.writeIndexFile(box, distDir+"/"+indexDir+"/"+file.name, file.content); err != nil {
+					return err
+				}
+				release.add(indexDir+"/"+file.name, file.content)
+			}
+		}
+	}
+	if err := s.removeStaleIndices(box, distDir, componentNames, architectureNames); err != nil {
+		return err
+	}
+
+	content := release.content(box, distribution, componentNames, architectureNames)
+	if err := s.writeIndexFile(box, distDir+"/Release", content); err != nil {
+		return err
+	}
+	return s.signRelease(box, distDir, content)
+}
+
+// signRelease writes the Release file signed inline as InRelease and detached as Release.gpg
+func (s *DebianServiceImpl) signRelease(box *models.Box, distDir string, release []byte) error {
+	if s.signingKey == nil {
+		// Signatures of an earlier key no longer match the Release file
+		for _, filename := range []string{"InRelease", "Release.gpg"} {
+			if err := s.removeIndexItem(box, distDir+"/"+filename); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var inRelease bytes.Buffer
+	writer, err := clearsign.Encode(&inRelease, s.signingKey.PrivateKey, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(release); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	var detached bytes.Buffer
+	if err := openpgp.ArmoredDetachSign(&detached, s.signingKey, bytes.NewReader(release), nil); err != nil {
+		return err
+	}
+	detached.WriteString("\n")
+
+	if err := s.writeIndexFile(box, distDir+"/InRelease", inRelease.Bytes()); err != nil {
+		return err
+	}
+	return s.writeIndexFile(box, distDir+"/Release.gpg", detached.Bytes())
+}
+
+// removeStaleIndices removes the component and binary-<arch> folders of the distribution nothing was written to
+func (s *DebianServiceImpl) removeStaleIndices(box *models.Box, distDir string, components []string, architectures []string) error {
+	for _, component := range s.childFolders(box, distDir) {
+		if !slices.Contains(components, component) {
+			if err := s.removeIndexItem(box, distDir+"/"+component); err != nil {
+				return err
+			}
+			continue
+		}
+		for _, folder := range s.childFolders(box, distDir+"/"+component) {
+			architecture, ok := strings.CutPrefix(folder, "binary-")
+			if !ok || !slices.Contains(architectures, architecture) {
+				if err := s.removeIndexItem(box, distDir+"/"+component+"/"+folder); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (s *DebianServiceImpl) childFolders(box *models.Box, folderPath string) []string {
+	folder, err := s.itemService.FindByPathAndBoxId(folderPath, box.ID)
+	if err != nil || folder == nil {
+		return nil
+	}
+	children, err := s.itemService.FindItemsByParentID(&folder.ID, box.ID)
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, child := range children {
+		if child.Type == "folder" {
+			names = append(names, child.Name)
+		}
+	}
+	return names
+}
+
+func (s *DebianServiceImpl) removeIndexItem(box *models.Box, itemPath string) error {
+	item, err := s.itemService.FindByPathAndBoxId(itemPath, box.ID)
+	if err != nil || item == nil {
+		return err
+	}
+	return s.itemService.DeleteItem(item.ID, true)
+}
+
+func (s *DebianServiceImpl) writeIndexFile(box *models.Box, filePath string, content []byte) error {
+	_, err := s.fileService.CreateFileFromReader(box, filePath, bytes.NewReader(content), false, "")
+	return err
+}
+
+// poolEntries returns every package in the pool of the box
+func (s *DebianServiceImpl) poolEntries(box *models.Box) ([]debianPoolEntry, error) {
+	pool, err := s.itemService.FindByPathAndBoxId(debianPoolDir, box.ID)
+	if err != nil || pool == nil {
+		return nil, err
+	}
+	items, err := s.itemService.GetAllDescendants(pool.ID, -1)
+	if err != nil {
+		return nil, err
+	}
+	var entries []debianPoolEntry
+	for _, item := range items {
+		properties := helpers.PropertiesFromJSON(item.Properties)
+		if item.Type == "file" && len(properties["control"]) > 0 {
+			entries = append(entries, debianPoolEntry{item: item, properties: properties})
+		}
+	}
+	return entries, nil
+}
+
+// debianRelease collects the checksums of the indices listed in a Release file
+type debianRelease struct {
+	md5    strings.Builder
+	sha256 strings.Builder
+}
+
+func (r *debianRelease) add(filename string, content []byte) {
+	md5sum := md5.Sum(content)
+	sha256sum := sha256.Sum256(content)
+	fmt.Fprintf(&r.md5, " %s %16d %s\n", hex.EncodeToString(md5sum[:]), len(content), filename)
+	fmt.Fprintf(&r.sha256, " %s %16d %s\n", hex.EncodeToString(sha256sum[:]), len(content), filename)
+}
+
+func (r *debianRelease) content(box *models.Box, distribution string, components []string, architectures []string) []byte {
+	fields := []helpers.ControlField{
+		{Name: "Origin", Value: box.Name},
+		{Name: "Label", Value: box.Name},
+		{Name: "Suite", Value: distribution},
+		{Name: "Codename", Value: distribution},
+		{Name: "Date", Value: time.Now().UTC().Format(time.RFC1123)},
+		{Name: "Architectures", Value: strings.Join(architectures, " ")},
+		{Name: "Components", Value: strings.Join(components, " ")},
+		{Name: "No-Support-for-Architecture-all", Value: "Packages"},
+		{Name: "MD5Sum", Value: "\n" + strings.TrimSuffix(r.md5.String(), "\n")},
+		{Name: "SHA256", Value: "\n" + strings.TrimSuffix(r.sha256.String(), "\n")},
+	}
+	return []byte(helpers.FormatControlParagraph(fields))
+}
+
+// debianIndexParagraph is the stanza of a package in a Packages index
+func debianIndexParagraph(entry debianPoolEntry) string {
+	control, err := helpers.ParseControlParagraph(entry.value("control"))
+	if err != nil {
+		control = nil
+	}
+	control = slices.DeleteFunc(control, func(field helpers.ControlField) bool {
+		return slices.ContainsFunc(debianIndexFields, func(name string) bool { return strings.EqualFold(name, field.Name) })
+	})
+	control = append(control,
+		helpers.ControlField{Name: "Filename", Value: entry.value("filename")},
+		helpers.ControlField{Name: "Size", Value: strconv.FormatInt(entry.item.Size, 10)},
+		helpers.ControlField{Name: "MD5sum", Value: entry.value("md5")},
+		helpers.ControlField{Name: "SHA1", Value: entry.value("sha1")},
+		helpers.ControlField{Name: "SHA256", Value: entry.item.SHA256},
+	)
+	return helpers.FormatControlParagraph(control)
+}
+
+func debianProperties(control []helpers.ControlField, poolPath string, component string, md5sum string, sha1sum string) map[string][]string {
+	properties := map[string][]string{
+		"package":      {helpers.ControlValue(control, "Package")},
+		"version":      {helpers.ControlValue(control, "Version")},
+		"architecture": {helpers.ControlValue(control, "Architecture")},
+		"component":    {component},
+		"filename":     {poolPath},
+		"md5":          {md5sum},
+		"sha1":         {sha1sum},
+		"control":      {helpers.FormatControlParagraph(control)},
+	}
+	for key, field := range map[string]string{
+		"source":         "Source",
+		"section":        "Section",
+		"priority":       "Priority",
+		"maintainer":     "Maintainer",
+		"installed_size": "Installed-Size",
+	} {
+		if value := helpers.ControlValue(control, field); value != "" {
+			properties[key] = []string{value}
+		}
+	}
+	if description := helpers.ControlValue(control, "Description"); description != "" {
+		summary, _, _ := strings.Cut(description, "\n")
+		properties["description"] = []string{summary}
+	}
+	for _, dependency := range strings.Split(helpers.ControlValue(control, "Depends"), ",") {
+		if dependency = strings.TrimSpace(dependency); dependency != "" {
+			properties["depends"] = append(properties["depends"], dependency)
+		}
+	}
+	return properties
+}
+
+// debianPoolPath follows the pool layout of the Debian archive: pool/<component>/<prefix>/<source>/<file>,
+// the prefix is the first letter of the source package, or its first four letters for lib* packages
+func debianPoolPath(component string, source string, name string, version string, architecture string) string {
+	prefix := source[:1]
+	if strings.HasPrefix(source, "lib") && len(source) > 3 {
+		prefix = source[:4]
+	}
+	if _, upstream, hasEpoch := strings.Cut(version, ":"); hasEpoch {
+		version = upstream
+	}
+	return debianPoolDir + "/" + component + "/" + prefix + "/" + source + "/" + name + "_" + version + "_" + architecture + ".deb"
+}
+
+func sortedKeys[V any](values map[string]V) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// readDebianPackage returns the control file of a .deb with the MD5 and SHA1 sums of the package
+func readDebianPackage(file io.ReadSeeker) ([]helpers.ControlField, string, string, error) {
+	md5Hash, sha1Hash := md5.New(), sha1.New()
+	if _, err := io.Copy(io.MultiWriter(md5Hash, sha1Hash), file); err != nil {
+		return nil, "", "", err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, "", "", err
+	}
+	control, err := readDebianControl(file)
+	if err != nil {
+		return nil, "", "", err
+	}
+	return control, hex.EncodeToString(md5Hash.Sum(nil)), hex.EncodeToString(sha1Hash.Sum(nil)), nil
+}
+
+// readDebianControl walks the ar archive of a .deb to its control.tar member
+func readDebianControl(reader io.Reader) ([]helpers.ControlField, error) {
+	magic := make([]byte, 8)
+	if _, err := io.ReadFull(reader, magic); err != nil || string(magic) != "!<arch>\n" {
+		return nil, fmt.Errorf("%w: not a debian package", ErrInvalidPackage)
+	}
+	header := make([]byte, 60)
+	for {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, fmt.Errorf("%w: control archive not found", ErrInvalidPackage)
+			}
+			return nil, fmt.Errorf("%w: %v", ErrInvalidPackage, err)
+		}
+		name := strings.TrimSuffix(strings.TrimSpace(string(header[:16])), "/")
+		size, err := strconv.ParseInt(strings.TrimSpace(string(header[48:58])), 10, 64)
+		if err != nil || size < 0 || string(header[58:60]) != "`\n" {
+			return nil, fmt.Errorf("%w: invalid ar header", ErrInvalidPackage)
+		}
+		if strings.HasPrefix(name, "control.tar") {
+			return readControlTar(name, io.LimitReader(reader, size))
+		}
+		// Members are aligned to an even offset
+		if _, err := io.CopyN(io.Discard, reader, size+size%2); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidPackage, err)
+		}
+	}
+}
+
+func readControlTar(name string, reader io.Reader) ([]helpers.ControlField, error) {
+	var archive io.Reader
+	switch path.Ext(name) {
+	case ".tar":
+		archive = reader
+	case ".gz":
+		gzipReader, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidPackage, err)
+		}
+		defer gzipReader.Close()
+		archive = gzipReader
+	case ".xz":
+		xzReader, err := xz.NewReader(reader)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidPackage, err)
+		}
+		archive = xzReader
+	case ".zst":
+		zstdReader, err := zstd.NewReader(reader)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidPackage, err)
+		}
+		defer zstdReader.Close()
+		archive = zstdReader
+	default:
+		return nil, fmt.Errorf("%w: unsupported control archive %s", ErrInvalidPackage, name)
+	}
+
+	tarReader := tar.NewReader(archive)
+	for {
+		header, err := tarReader.Next()
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%w: control file not found", ErrInvalidPackage)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidPackage, err)
+		}
+		if header.Typeflag != tar.TypeReg || path.Clean(header.Name) != "control" {
+			continue
+		}
+		content, err := io.ReadAll(io.LimitReader(tarReader, debianMaxControl))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidPackage, err)
+		}
+		control, err := helpers.ParseControlParagraph(string(content))
+		if err != nil {
+			return nil, fmt.Errorf("%w: control file: %v", ErrInvalidPackage, err)
+		}
+		return control, nil
+	}
+}
+
+// loadDebianSigningKey reads the first private key of the configured armored key ring, nil when
+// signing is not configured
+func loadDebianSigningKey(debianConfig config.DebianConfig) (*openpgp.Entity, error) {
+	if debianConfig.SigningKey == "" {
+		return nil, nil
+	}
+	file, err := os.Open(debianConfig.SigningKey)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	entities, err := openpgp.ReadArmoredKeyRing(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", debianConfig.SigningKey, err)
+	}
+	for _, entity := range entities {
+		if entity.PrivateKey == nil {
+			continue
+		}
+		if entity.PrivateKey.Encrypted {
+			if err := entity.PrivateKey.Decrypt([]byte(debianConfig.Passphrase)); err != nil {
+				return nil, fmt.Errorf("failed to decrypt %s: %w", debianConfig.SigningKey, err)
+			}
+		}
+		return entity, nil
+	}
+	return nil, fmt.Errorf("%s holds no private key", debianConfig.SigningKey)
+}
@@ -0,0 +1,83 @@
+package services
+
+import (
+	"Boxed/internal/models"
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"testing"
+)
+
+// debianPackageArchive builds a .deb holding nothing but its control file
+func debianPackageArchive(t *testing.T, name string, version string) []byte {
+	control := []byte(fmt.Sprintf("Package: %s\nVersion: %s\nArchitecture: amd64\nMaintainer: Test <test@example.com>\nDescription: test package\n", name, version))
+	var controlTar bytes.Buffer
+	gzipWriter := gzip.NewWriter(&controlTar)
+	tarWriter := tar.NewWriter(gzipWriter)
+	require.NoError(t, tarWriter.WriteHeader(&tar.Header{Name: "./control", Mode: 0644, Size: int64(len(control)), Typeflag: tar.TypeReg}))
+	_, err := tarWriter.Write(control)
+	require.NoError(t, err)
+	require.NoError(t, tarWriter.Close())
+	require.NoError(t, gzipWriter.Close())
+
+	var deb bytes.Buffer
+	deb.WriteString("!<arch>\n")
+	for _, member := range []struct {
+		name    string
+		content []byte
+	}{{"debian-binary", []byte("2.0\n")}, {"control.tar.gz", controlTar.Bytes()}} {
+		fmt.Fprintf(&deb, "%-16s%-12d%-6d%-6d%-8s%-10d`\n", member.name, 0, 0, 0, "100644", len(member.content))
+		deb.Write(member.content)
+		if len(member.content)%2 == 1 {
+			deb.WriteString("\n")
+		}
+	}
+	return deb.Bytes()
+}
+
+func TestDebianService_DistributionFollowsFileAPI(t *testing.T) {
+	ts := setupTestServices(t)
+	box, err := ts.boxService.CreateBox("apt", nil, filepath.Join(ts.configuration.Storage.Path, "apt"), models.BoxTypeDebian)
+	require.NoError(t, err)
+	debian := NewDebianService(ts.itemService, ts.fileService, ts.logService, ts.configuration)
+
+	first, err := debian.Upload(box, "stable", "main", bytes.NewReader(debianPackageArchive(t, "hello", "1.0")))
+	require.NoError(t, err)
+	second, err := debian.Upload(box, "stable", "main", bytes.NewReader(debianPackageArchive(t, "world", "1.0")))
+	require.NoError(t, err)
+	packages := ts.fileContent(t, box, "dists/stable/main/binary-amd64/Packages")
+	assert.Contains(t, packages, "Package: hello")
+	assert.Contains(t, packages, "Package: world")
+
+	// Adding the same build to another distribution is fine, the same one twice or another build is not
+	_, err = debian.Upload(box, "testing", "main", bytes.NewReader(debianPackageArchive(t, "hello", "1.0")))
+	assert.NoError(t, err)
+	_, err = debian.Upload(box, "testing", "main", bytes.NewReader(debianPackageArchive(t, "hello", "1.0")))
+	assert.ErrorIs(t, err, ErrVersionExists)
+	_, err = debian.Upload(box, "stable", "main", bytes.NewReader(append(debianPackageArchive(t, "hello", "1.0"), 0)))
+	assert.ErrorIs(t, err, ErrVersionExists)
+
+	// Packages deleted through the generic file API leave every distribution
+	item, err := ts.fileService.GetFileItem(box, first.Filename)
+	require.NoError(t, err)
+	require.NoError(t, ts.fileService.TrashItem(item, box, false, ""))
+	assert.NotContains(t, ts.fileContent(t, box, "dists/stable/main/binary-amd64/Packages"), "Package: hello")
+	testingDist, err := ts.itemService.FindByPathAndBoxId("dists/testing", box.ID)
+	assert.NoError(t, err)
+	assert.Nil(t, testingDist)
+
+	// Packages replaced through it take the distributions they are stored with
+	ts.storeFile(t, box, second.Filename, string(debianPackageArchive(t, "world", "1.0"))+"\n")
+	stable, err := ts.itemService.FindByPathAndBoxId("dists/stable", box.ID)
+	assert.NoError(t, err)
+	assert.Nil(t, stable)
+	replaced, err := ts.fileService.CreateFileFromReader(box, second.Filename,
+		bytes.NewReader(debianPackageArchive(t, "world", "1.0")), false, "distributions=stable")
+	require.NoError(t, err)
+	assert.Contains(t, ts.fileContent(t, box, "dists/stable/main/binary-amd64/Packages"), "SHA256: "+replaced.SHA256)
+	assert.Contains(t, ts.fileContent(t, box, "dists/stable/Release"), "main/binary-amd64/Packages")
+}
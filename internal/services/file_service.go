@@ -4,15 +4,16 @@ import (
 	"Boxed/internal/config"
 	"Boxed/internal/dto"
 	"Boxed/internal/helpers"
-	"Boxed/internal/mapper"
 	"Boxed/internal/models"
+	"Boxed/internal/storage"
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"github.com/sirupsen/logrus"
+	"io"
 	"mime/multipart"
 	"os"
 	"path/filepath"
-	"strconv"
 	"strings"
 )
 
@@ -22,26 +23,61 @@ type FileService interface {
 	ListFileOrFolder(boxName string, itemPath string) (*models.Item, error)
 	GetFileItem(box *models.Box, filePath string) (*models.Item, error)
 	GetStoragePath() string
+	OpenBlob(box *models.Box, sha256sum string) (storage.Blob, error)
 	DeleteItemOnDisk(item models.Item, box *models.Box) error
+	TrashItem(item *models.Item, box *models.Box, force bool, deletedBy string) error
+	RestoreItem(item *models.Item, box *models.Box) error
 	UpdateItem(item *models.Item) (*dto.ItemGetDTO, error)
+	CreateFileFromPath(box *models.Box, filePath string, localPath string, flat bool, properties string) (*dto.ItemGetDTO, error)
+	EnsureBlob(source *models.Box, destination *models.Box, sha256sum string) error
+	StoreBlob(box *models.Box, name string, reader io.Reader) (*StoredBlob, error)
+	CreateFileFromBlob(box *models.Box, filePath string, blob *StoredBlob, flat bool, properties string) (*dto.ItemGetDTO, error)
+	CreateFileFromReader(box *models.Box, filePath string, reader io.Reader, flat bool, properties string) (*dto.ItemGetDTO, error)
+	CreateFileFromVersion(box *models.Box, filePath string, version *models.ItemVersion) (*dto.ItemGetDTO, error)
+	ReleaseBlob(box *models.Box, sha256sum string) error
+	RecordUploader(itemID uint, uploader string) error
+	AddFileListener(listener FileListener)
+}
+
+// FileListener is told about files stored or deleted through the FileService, typed boxes use it to keep
+// their repository metadata current. filePath is where the file was stored, relative to the box.
+type FileListener interface {
+	FileStored(box *models.Box, filePath string, item models.Item)
+	FileDeleted(box *models.Box, item models.Item)
+}
+
+// StoredBlob describes content that was written to the hash storage. Size and the checksums are those
+// of the content, StoredSize is what it takes in the hash storage.
+type StoredBlob struct {
+	SHA256     string
+	SHA512     string
+	Size       int64
+	StoredSize int64
 }
 
 type FileServiceImpl struct {
 	itemService   ItemService
 	boxService    BoxService
 	logService    LogService
+	blobStore     storage.BlobStore
+	keyService    KeyService
 	configuration config.Configuration
+	listeners     []FileListener
 }
 
 func NewFileService(
 	itemService ItemService,
 	boxService BoxService,
+	blobStore storage.BlobStore,
+	keyService KeyService,
 	logService LogService,
 	configuration *config.Configuration,
 ) FileService {
 	return &FileServiceImpl{
 		itemService:   itemService,
 		boxService:    boxService,
+		blobStore:     blobStore,
+		keyService:    keyService,
 		logService:    logService,
 		configuration: *configuration,
 	}
@@ -54,42 +90,16 @@ func (s *FileServiceImpl) CreateFileStructure(
 	flat bool,
 	properties string,
 ) (*dto.ItemGetDTO, error) {
-	pathParts := strings.Split(filePath, "/")
-
-	// Parse properties
-	propertiesMap := make(map[string][]string)
-	if properties != "" {
-		keyValueProperties := strings.Split(properties, ";")
-		for i := range keyValueProperties {
-			keyAndValue := strings.SplitN(keyValueProperties[i], "=", 2)
-			if len(keyAndValue) != 2 {
-				continue // Skip invalid key-value pairs
-			}
-			key := strings.TrimSpace(keyAndValue[0])
-			value := strings.TrimSpace(keyAndValue[1])
-			propertiesMap[key] = append(propertiesMap[key], value)
-		}
-	}
-
-	jsonProperties, err := json.Marshal(propertiesMap)
+	jsonProperties, err := helpers.PropertiesToJSON(properties)
 	if err != nil {
 		return nil, err
 	}
 
-	var parentItem *models.Item
-
-	if !flat {
-		for _, part := range pathParts[:len(pathParts)-1] {
-			folderItem, err := s.createOrGetFolder(part, parentItem, box)
-			if err != nil {
-				return nil, err
-			}
-			parentItem = folderItem
-		}
+	parentItem, name, err := s.resolveParent(box, filePath, flat)
+	if err != nil {
+		return nil, err
 	}
 
-	name := pathParts[len(pathParts)-1]
-
 	if fileHeader == nil {
 		// No file provided; create a folder
 		item, err := s.createOrGetFolder(name, parentItem, box)
@@ -99,13 +109,249 @@ func (s *FileServiceImpl) CreateFileStructure(
 		return s.itemService.GetItemByID(item.ID)
 	} else {
 		// File provided; create a file using hash-based storage
-		fileType := helpers.GetFileType(name)
-		item, err := s.createHashBasedFile(name, fileType, parentItem, box, fileHeader, jsonProperties)
+		item, err := s.createHashBasedFile(name, parentItem, box, fileHeader, jsonProperties)
 		if err != nil {
 			return nil, err
 		}
-		return s.itemService.GetItemByID(item.ID)
+		return s.fileStored(box, filePath, flat, item)
+	}
+}
+
+// CreateFileFromPath stores an already assembled local file. The file is moved into the hash storage,
+// or removed once it was compressed into it, so the caller must not use localPath afterwards.
+func (s *FileServiceImpl) CreateFileFromPath(
+	box *models.Box,
+	filePath string,
+	localPath string,
+	flat bool,
+	properties string,
+) (*dto.ItemGetDTO, error) {
+	jsonProperties, err := helpers.PropertiesToJSON(properties)
+	if err != nil {
+		return nil, err
+	}
+
+	parentItem, name, err := s.resolveParent(box, filePath, flat)
+	if err != nil {
+		return nil, err
+	}
+
+	blob, err := s.importBlob(box, name, localPath)
+	if err != nil {
+		return nil, err
+	}
+
+	item, err := s.saveFileItem(name, parentItem, box, blob, jsonProperties)
+	if err != nil {
+		return nil, err
+	}
+	return s.fileStored(box, filePath, flat, item)
+}
+
+// CreateFileFromReader streams reader into the hash storage and creates or updates the item at filePath
+func (s *FileServiceImpl) CreateFileFromReader(
+	box *models.Box,
+	filePath string,
+	reader io.Reader,
+	flat bool,
+	properties string,
+) (*dto.ItemGetDTO, error) {
+	blob, err := s.StoreBlob(box, filePath, reader)
+	if err != nil {
+		return nil, err
 	}
+	return s.CreateFileFromBlob(box, filePath, blob, flat, properties)
+}
+
+// CreateFileFromBlob creates or updates the item at filePath for a blob stored with StoreBlob
+func (s *FileServiceImpl) CreateFileFromBlob(
+	box *models.Box,
+	filePath string,
+	blob *StoredBlob,
+	flat bool,
+	properties string,
+) (*dto.ItemGetDTO, error) {
+	jsonProperties, err := helpers.PropertiesToJSON(properties)
+	if err != nil {
+		return nil, err
+	}
+
+	parentItem, name, err := s.resolveParent(box, filePath, flat)
+	if err != nil {
+		return nil, err
+	}
+
+	item, err := s.saveFileItem(name, parentItem, box, blob, jsonProperties)
+	if err != nil {
+		return nil, err
+	}
+	return s.fileStored(box, filePath, flat, item)
+}
+
+// CreateFileFromVersion makes the content and properties of a prior revision the current ones of the item
+// at filePath. The content it replaces is kept as a revision like on any other overwrite.
+func (s *FileServiceImpl) CreateFileFromVersion(box *models.Box, filePath string, version *models.ItemVersion) (*dto.ItemGetDTO, error) {
+	parentItem, name, err := s.resolveParent(box, filePath, false)
+	if err != nil {
+		return nil, err
+	}
+
+	blob := &StoredBlob{SHA256: version.SHA256, SHA512: version.SHA512, Size: version.Size, StoredSize: version.StoredSize}
+	item, err := s.saveFileItem(name, parentItem, box, blob, version.Properties)
+	if err != nil {
+		return nil, err
+	}
+	return s.fileStored(box, filePath, false, item)
+}
+
+// RecordUploader notes who uploaded the current content of an item, it is kept with the revision
+// once the content is overwritten
+func (s *FileServiceImpl) RecordUploader(itemID uint, uploader string) error {
+	return s.itemService.UpdateUploader(itemID, uploader)
+}
+
+// AddFileListener registers a listener for the files stored and deleted from now on. Listeners are
+// registered while the services are wired, before any request is served.
+func (s *FileServiceImpl) AddFileListener(listener FileListener) {
+	s.listeners = append(s.listeners, listener)
+}
+
+// fileStored tells the listeners about a stored file and returns it as they left it
+func (s *FileServiceImpl) fileStored(box *models.Box, filePath string, flat bool, item *models.Item) (*dto.ItemGetDTO, error) {
+	if flat {
+		filePath = item.Name
+	}
+	for _, listener := range s.listeners {
+		listener.FileStored(box, strings.Trim(filePath, "/"), *item)
+	}
+	return s.itemService.GetItemByID(item.ID)
+}
+
+// StoreBlob hashes reader while writing it to the blob store, which keeps it under the hash once
+// everything was read. Content that is already stored is dropped. The content is compressed as the
+// box asks for files named like name, only the extension of name is looked at, and then encrypted
+// when the box is encrypted.
+func (s *FileServiceImpl) StoreBlob(box *models.Box, name string, reader io.Reader) (*StoredBlob, error) {
+	compression, err := compressionFor(box, name)
+	if err != nil {
+		return nil, err
+	}
+	var keyID uint64
+	var key []byte
+	if s.keyService.Encrypted(box) {
+		if keyID, key, err = s.keyService.DataKey(box); err != nil {
+			return nil, err
+		}
+	}
+	writer, err := s.blobStore.Writer(box)
+	if err != nil {
+		return nil, err
+	}
+	// Compressing happens before encrypting, encrypted content does not compress
+	var target io.Writer = writer
+	var encrypter io.WriteCloser
+	if key != nil {
+		if encrypter, err = storage.NewEncrypter(writer, key, keyID); err != nil {
+			_ = writer.Abort()
+			return nil, err
+		}
+		target = encrypter
+	}
+	encoder, err := storage.NewEncoder(target, compression)
+	if err != nil {
+		_ = writer.Abort()
+		return nil, err
+	}
+	sha256sum, sha512sum, size, err := helpers.CopyAndComputeChecksums(encoder, reader)
+	if err == nil {
+		err = encoder.Close()
+	}
+	if err == nil && encrypter != nil {
+		err = encrypter.Close()
+	}
+	if err != nil {
+		_ = writer.Abort()
+		return nil, fmt.Errorf("failed to store file: %w", err)
+	}
+	if err := writer.Commit(sha256sum); err != nil {
+		return nil, fmt.Errorf("failed to move file to hash storage: %w", err)
+	}
+	// Content the scrubber quarantined is stored again, the items referencing it can be downloaded again
+	if err := s.itemService.SetQuarantined(box.ID, sha256sum, false); err != nil {
+		return nil, err
+	}
+	return s.storedBlob(box, sha256sum, sha512sum, size)
+}
+
+// importBlob moves a local file into the blob store. A file that has to be compressed or encrypted, or
+// framed so it is not mistaken for such content, is written through StoreBlob instead.
+func (s *FileServiceImpl) importBlob(box *models.Box, name string, localPath string) (*StoredBlob, error) {
+	compression, err := compressionFor(box, name)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(localPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open assembled file: %w", err)
+	}
+	head := make([]byte, storage.FrameMagicSize)
+	n, _ := io.ReadFull(file, head)
+	if compression != storage.CompressionNone || s.keyService.Encrypted(box) ||
+		storage.IsFramed(head[:n]) || storage.IsEncrypted(head[:n]) {
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			_ = file.Close()
+			return nil, err
+		}
+		blob, err := s.StoreBlob(box, name, file)
+		_ = file.Close()
+		if err != nil {
+			return nil, err
+		}
+		return blob, os.Remove(localPath)
+	}
+	_ = file.Close()
+
+	fileInfo, err := os.Stat(localPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat assembled file: %w", err)
+	}
+	sha256sum, sha512sum, err := helpers.ComputeChecksums(localPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute checksums: %w", err)
+	}
+	if err := s.blobStore.Import(box, sha256sum, localPath); err != nil {
+		return nil, fmt.Errorf("failed to move file to hash storage: %w", err)
+	}
+	return s.storedBlob(box, sha256sum, sha512sum, fileInfo.Size())
+}
+
+// storedBlob describes content that was just stored. The stored size is that of the blob in the store,
+// which may have been written differently when the content was stored before.
+func (s *FileServiceImpl) storedBlob(box *models.Box, sha256sum string, sha512sum string, size int64) (*StoredBlob, error) {
+	info, err := s.blobStore.Stat(box, sha256sum)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat stored file: %w", err)
+	}
+	return &StoredBlob{SHA256: sha256sum, SHA512: sha512sum, Size: size, StoredSize: info.Size}, nil
+}
+
+// resolveParent creates the folders leading up to the last element of filePath (unless flat is set)
+// and returns the parent folder together with the name of the last element
+func (s *FileServiceImpl) resolveParent(box *models.Box, filePath string, flat bool) (*models.Item, string, error) {
+	pathParts := strings.Split(filePath, "/")
+	var parentItem *models.Item
+
+	if !flat {
+		for _, part := range pathParts[:len(pathParts)-1] {
+			folderItem, err := s.createOrGetFolder(part, parentItem, box)
+			if err != nil {
+				return nil, "", err
+			}
+			parentItem = folderItem
+		}
+	}
+
+	return parentItem, pathParts[len(pathParts)-1], nil
 }
 
 func (s *FileServiceImpl) createOrGetFolder(name string, parentItem *models.Item, box *models.Box) (*models.Item, error) {
@@ -140,97 +386,68 @@ func (s *FileServiceImpl) createOrGetFolder(name string, parentItem *models.Item
 
 // createHashBasedFile stores a file using its hash and creates a database entry
 func (s *FileServiceImpl) createHashBasedFile(
-	name, fileType string,
+	name string,
 	parentItem *models.Item,
 	box *models.Box,
 	fileHeader *multipart.FileHeader,
 	properties []byte,
 ) (*models.Item, error) {
-	var parentID *uint
-	var itemPath string
-
-	// Determine the item's path in the database
-	if parentItem != nil {
-		parentID = &parentItem.ID
-		itemPath = filepath.Join(parentItem.Path, name)
-	} else {
-		itemPath = name
-	}
-
-	tempFile, err := os.CreateTemp("", "upload-*")
-	if err != nil {
-		return nil, fmt.Errorf("failed to create temp file: %w", err)
-	}
-	tempFilePath := tempFile.Name()
-	var deferErr error
-	defer func(name string) {
-		err := os.Remove(name)
-		if err != nil {
-			deferErr = err
-		}
-	}(tempFilePath)
-	if deferErr != nil {
-		return nil, deferErr
-	}
-	defer func(tempFile *os.File) {
-		err := tempFile.Close()
-		if err != nil {
-			deferErr = err
-		}
-	}(tempFile)
-	if deferErr != nil {
-		return nil, deferErr
-	}
 	src, err := fileHeader.Open()
 	if err != nil {
 		return nil, fmt.Errorf("failed to open uploaded file: %w", err)
 	}
-	defer func(src multipart.File) {
-		err := src.Close()
-		if err != nil {
-			deferErr = err
-		}
-	}(src)
-	if deferErr != nil {
-		return nil, deferErr
-	}
-	sha256sum, sha512sum, err := helpers.SaveFileAndComputeChecksums(fileHeader, tempFilePath)
+	defer src.Close()
+
+	blob, err := s.StoreBlob(box, name, src)
 	if err != nil {
-		return nil, fmt.Errorf("failed to compute checksums: %w", err)
+		return nil, err
 	}
 
-	// Hash-based path: prepare the storage directory using the first few characters of the hash
-	firstHashPrefix := sha256sum[:2]
-	secondHashPrefix := sha256sum[2:4]
-	hashDir := filepath.Join(box.Path, secondHashPrefix, firstHashPrefix)
-
-	if err := os.MkdirAll(hashDir, 0750); err != nil {
-		return nil, fmt.Errorf("failed to create hash directory: %w", err)
-	}
+	return s.saveFileItem(name, parentItem, box, blob, properties)
+}
 
-	// Final storage path will be [box_name]/[first_hash_prefix]/[second_hash_prefix]/[full_hash]
-	finalStoragePath := filepath.Join(hashDir, sha256sum)
+// saveFileItem creates the database entry of a stored file, or updates it when the path is already taken
+func (s *FileServiceImpl) saveFileItem(
+	name string,
+	parentItem *models.Item,
+	box *models.Box,
+	blob *StoredBlob,
+	properties []byte,
+) (*models.Item, error) {
+	var parentID *uint
+	var itemPath string
 
-	// Check if the file already exists on box level
-	if _, err := os.Stat(finalStoragePath); os.IsNotExist(err) {
-		// File doesn't exist yet, copy it from the temp location
-		if err := helpers.CopyFile(tempFilePath, finalStoragePath); err != nil {
-			return nil, fmt.Errorf("failed to move file to hash storage: %w", err)
-		}
+	// Determine the item's path in the database
+	if parentItem != nil {
+		parentID = &parentItem.ID
+		itemPath = filepath.Join(parentItem.Path, name)
+	} else {
+		itemPath = name
 	}
 
-	// Check if an item with the same path already exists in the database
-	existingItem, err := s.itemService.FindByPathAndBoxId(itemPath, box.ID)
+	// Check if the folder already has an item with the name
+	existingItem, err := s.itemService.FindByNameAndParent(name, parentID, box.ID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to check for existing item: %w", err)
 	}
 
 	if existingItem != nil {
+		// Keep the prior revision, unless the same content is uploaded with the same properties again
+		if existingItem.SHA256 != blob.SHA256 || !bytes.Equal(existingItem.Properties, properties) {
+			if err := s.itemService.RecordVersion(existingItem); err != nil {
+				return nil, fmt.Errorf("failed to keep the prior version: %w", err)
+			}
+			existingItem.Version++
+			existingItem.Uploader = ""
+		}
+
 		// Update the existing item with new hash and properties
-		existingItem.Size = fileHeader.Size
-		existingItem.SHA256 = sha256sum
-		existingItem.SHA512 = sha512sum
+		existingItem.Size = blob.Size
+		existingItem.StoredSize = blob.StoredSize
+		existingItem.SHA256 = blob.SHA256
+		existingItem.SHA512 = blob.SHA512
 		existingItem.Properties = properties
+		existingItem.Quarantined = false
 
 		if err := s.itemService.UpdateItem(existingItem); err != nil {
 			return nil, fmt.Errorf("failed to update existing item: %w", err)
@@ -241,13 +458,14 @@ func (s *FileServiceImpl) createHashBasedFile(
 		newFile := &models.Item{
 			Name:       name,
 			Type:       "file",
-			Extension:  fileType,
+			Extension:  helpers.GetFileType(name),
 			BoxID:      box.ID,
 			ParentID:   parentID,
 			Path:       itemPath,
-			Size:       fileHeader.Size,
-			SHA256:     sha256sum,
-			SHA512:     sha512sum,
+			Size:       blob.Size,
+			StoredSize: blob.StoredSize,
+			SHA256:     blob.SHA256,
+			SHA512:     blob.SHA512,
 			Properties: properties,
 		}
 
@@ -259,6 +477,34 @@ func (s *FileServiceImpl) createHashBasedFile(
 	}
 }
 
+// EnsureBlob makes sure the blob referenced by sha256sum is present in the destination box,
+// copying it from the source box when the boxes use different storage. The content is stored anew
+// for an encrypted destination, so it is encrypted with the data key of that box.
+func (s *FileServiceImpl) EnsureBlob(source *models.Box, destination *models.Box, sha256sum string) error {
+	if sha256sum == "" || source.ID == destination.ID {
+		return nil
+	}
+	if !s.keyService.Encrypted(destination) {
+		return s.blobStore.Copy(source, destination, sha256sum)
+	}
+	if _, err := s.blobStore.Stat(destination, sha256sum); err == nil {
+		return nil
+	}
+	blob, err := s.OpenBlob(source, sha256sum)
+	if err != nil {
+		return err
+	}
+	defer blob.Close()
+	stored, err := s.StoreBlob(destination, "", blob)
+	if err != nil {
+		return err
+	}
+	if stored.SHA256 != sha256sum {
+		return fmt.Errorf("content of %s changed while it was copied", sha256sum)
+	}
+	return nil
+}
+
 func (s *FileServiceImpl) FindBoxByPath(boxPath string) (*models.Box, error) {
 	return s.boxService.GetBoxByPath(boxPath)
 }
@@ -281,6 +527,7 @@ func (s *FileServiceImpl) ListFileOrFolder(boxName string, itemPath string) (*mo
 			Path:  "",
 		}
 	} else {
+		// The path of the item found is already converted to the user format
 		item, err = s.itemService.FindByPathAndBoxId(itemPath, box.ID)
 		if err != nil {
 			return nil, err
@@ -297,9 +544,6 @@ func (s *FileServiceImpl) ListFileOrFolder(boxName string, itemPath string) (*mo
 		}
 		item.Children = children
 	}
-
-	// Converting path to readable format
-	item.Path = helpers.LtreeToUserPath(item)
 	return item, nil
 }
 
@@ -318,9 +562,25 @@ func (s *FileServiceImpl) GetStoragePath() string {
 	return s.configuration.Storage.Path
 }
 
-func (s *FileServiceImpl) getHashBasedFilePath(item *models.Item) string {
-	hashPrefix := item.SHA256[:2]
-	return filepath.Join(s.configuration.Storage.Path, hashPrefix, item.SHA256)
+// OpenBlob opens the content with the given hash stored for the box, encrypted and compressed content
+// is decrypted and decompressed while it is read. Content whose data key cannot be unwrapped fails with
+// ErrKeyUnavailable.
+func (s *FileServiceImpl) OpenBlob(box *models.Box, sha256sum string) (storage.Blob, error) {
+	blob, err := s.blobStore.Get(box, sha256sum)
+	if err != nil {
+		return nil, err
+	}
+	decrypted, err := storage.Decrypt(blob, s.keyService.Key)
+	if err != nil {
+		_ = blob.Close()
+		return nil, err
+	}
+	decoded, err := storage.Decode(decrypted)
+	if err != nil {
+		_ = blob.Close()
+		return nil, err
+	}
+	return decoded, nil
 }
 
 func (s *FileServiceImpl) DeleteItemOnDisk(item models.Item, box *models.Box) error {
@@ -331,61 +591,113 @@ func (s *FileServiceImpl) DeleteItemOnDisk(item models.Item, box *models.Box) er
 	})
 
 	itemLog.Debug("Deleting item(s) from the database")
-	err := s.itemService.HardDelete(&item)
+	var err error
+	if item.DeletedAt.Valid && item.Type == "folder" {
+		// The items trashed with the folder are purged on their own, a folder created at the same path
+		// since then keeps its content
+		err = s.itemService.PurgeItem(&item)
+	} else {
+		err = s.itemService.HardDelete(&item)
+	}
 	if err != nil {
 		itemLog.WithError(err).Error("Failed to delete item(s) from the database")
 		return err
 	}
+	// The item is gone from here on, even when its blob cannot be removed
+	defer func() {
+		for _, listener := range s.listeners {
+			listener.FileDeleted(box, item)
+		}
+	}()
 
 	if item.Type == "folder" {
 		itemLog.Info("Folder deleted from database")
 		return nil
 	}
 
-	// For files, we should check if any other items reference the same hash
-	// before deleting the file from storage
-	itemsWithSameHash, err := s.itemService.ItemsSearch(
-		"sha256 eq \""+item.SHA256+"\" and box_id eq \""+strconv.Itoa(int(box.ID))+"\"",
-		"id",
-		1,
-		0,
-	)
+	// The prior revisions go with the item
+	versions, err := s.itemService.FindVersions(item.ID)
 	if err != nil {
-		itemLog.WithError(err).Error("Failed to check for other items with same hash")
+		itemLog.WithError(err).Error("Failed to find the versions of the item")
 		return err
 	}
-
-	// If no other items reference this hash, delete the file
-	if len(itemsWithSameHash) == 0 {
-		hashFilePath := s.getHashBasedFilePath(&item)
-		itemLog.Debug("Deleting file from hash storage: " + hashFilePath)
-
-		if err := os.Remove(hashFilePath); err != nil && !os.IsNotExist(err) {
-			itemLog.WithError(err).Error("Failed to delete file from hash storage")
+	for i := range versions {
+		if err := s.itemService.DeleteVersion(&versions[i]); err != nil {
+			itemLog.WithError(err).Error("Failed to delete a version of the item")
 			return err
 		}
-
-		// Check if the hash directory is empty and remove it if so
-		hashDir := filepath.Dir(hashFilePath)
-		entries, err := os.ReadDir(hashDir)
-		if err != nil {
-			itemLog.WithError(err).Error("Failed to read hash directory")
+		if err := s.ReleaseBlob(box, versions[i].SHA256); err != nil {
+			itemLog.WithError(err).Error("Failed to release the content of a version")
 			return err
 		}
-
-		if len(entries) == 0 {
-			if err := os.Remove(hashDir); err != nil {
-				itemLog.WithError(err).Error("Failed to remove empty hash directory")
-			}
-		}
-	} else {
-		itemLog.Info("File still referenced by other items, not deleting from storage")
 	}
 
+	if err := s.ReleaseBlob(box, item.SHA256); err != nil {
+		itemLog.WithError(err).Error("Failed to release the content of the item")
+		return err
+	}
 	itemLog.Info("Successfully deleted item from database and storage if needed")
 	return nil
 }
 
+// TrashItem moves an item, a folder with everything below it, to the trash. The content stays until
+// the Janitor purges the trash.
+func (s *FileServiceImpl) TrashItem(item *models.Item, box *models.Box, force bool, deletedBy string) error {
+	if err := s.itemService.DeleteItemBy(item.ID, force, deletedBy); err != nil {
+		return err
+	}
+	s.logService.Log.WithFields(logrus.Fields{
+		"box":       box.Name,
+		"path":      item.Path,
+		"deletedBy": deletedBy,
+	}).Info("Item moved to the trash")
+	for _, listener := range s.listeners {
+		listener.FileDeleted(box, *item)
+	}
+	return nil
+}
+
+// RestoreItem takes an item and the items trashed along with it out of the trash
+func (s *FileServiceImpl) RestoreItem(item *models.Item, box *models.Box) error {
+	restored, err := s.itemService.RestoreItem(item)
+	if err != nil {
+		return err
+	}
+	s.logService.Log.WithFields(logrus.Fields{
+		"box":   box.Name,
+		"item":  item.Name,
+		"count": len(restored),
+	}).Info("Item restored from the trash")
+	for i := range restored {
+		if restored[i].Type != "file" {
+			continue
+		}
+		for _, listener := range s.listeners {
+			listener.FileStored(box, helpers.LtreeToUserPath(&restored[i]), restored[i])
+		}
+	}
+	return nil
+}
+
+// ReleaseBlob deletes the content from the hash storage of the box, unless an item or a prior revision
+// still references it
+func (s *FileServiceImpl) ReleaseBlob(box *models.Box, sha256sum string) error {
+	if sha256sum == "" {
+		return nil
+	}
+	references, err := s.itemService.CountBlobReferences(box.ID, sha256sum)
+	if err != nil {
+		return fmt.Errorf("failed to check for references to the content: %w", err)
+	}
+	if references > 0 {
+		s.logService.Log.WithField("sha256", sha256sum).Debug("Content still referenced, not deleting it from storage")
+		return nil
+	}
+
+	s.logService.Log.WithField("sha256", sha256sum).Debug("Deleting content from hash storage")
+	return s.blobStore.Delete(box, sha256sum)
+}
+
 func (s *FileServiceImpl) UpdateItem(item *models.Item) (*dto.ItemGetDTO, error) {
 	itemLog := s.logService.Log.WithFields(logrus.Fields{
 		"name": item.Name,
@@ -408,11 +720,44 @@ func (s *FileServiceImpl) UpdateItem(item *models.Item) (*dto.ItemGetDTO, error)
 		itemLog.Debug("Item not found in database")
 		return nil, fmt.Errorf("item not found")
 	}
-	itemLog.Debug("Converting item to dto")
-	itemDTO, err := mapper.ToItemGetDTO(item)
-	if err != nil {
-		itemLog.WithError(err).Error("Failed to convert item to dto")
-		return nil, err
+	return itemInDB, nil
+}
+
+// uncompressedTypes are the file types that are compressed already, compressing them again gains little
+var uncompressedTypes = []string{
+	"7z", "apk", "br", "bz2", "crate", "deb", "docx", "ear", "gem", "gif", "gz", "jar", "jpeg", "jpg",
+	"lz", "lz4", "lzma", "mkv", "mov", "mp3", "mp4", "nupkg", "ogg", "png", "pptx", "rar", "rpm", "tbz2",
+	"tgz", "txz", "war", "webm", "webp", "whl", "woff", "woff2", "xlsx", "xz", "zip", "zst",
+}
+
+// compressionFor reads how the box compresses a file named name at rest. The "compression" property
+// of the box names the compression, "compression_exclude" lists the file types to store as they are,
+// as a list or a comma separated string. Without it the types in uncompressedTypes are left out.
+func compressionFor(box *models.Box, name string) (storage.Compression, error) {
+	var properties struct {
+		Compression string          `json:"compression"`
+		Exclude     json.RawMessage `json:"compression_exclude"`
+	}
+	if len(box.Properties) > 0 {
+		if err := json.Unmarshal(box.Properties, &properties); err != nil {
+			return storage.CompressionNone, nil
+		}
+	}
+	compression, err := storage.ParseCompression(properties.Compression)
+	if err != nil || compression == storage.CompressionNone {
+		return storage.CompressionNone, err
+	}
+	exclude := uncompressedTypes
+	if len(properties.Exclude) > 0 && string(properties.Exclude) != "null" {
+		if exclude, err = helpers.ParseGlobList(properties.Exclude); err != nil {
+			return storage.CompressionNone, fmt.Errorf("invalid compression_exclude: %w", err)
+		}
+	}
+	fileType := helpers.GetFileType(name)
+	for _, excluded := range exclude {
+		if strings.EqualFold(strings.TrimPrefix(excluded, "."), fileType) {
+			return storage.CompressionNone, nil
+		}
 	}
-	return itemDTO, nil
+	return compression, nil
 }
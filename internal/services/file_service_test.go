@@ -0,0 +1,162 @@
+package services
+
+import (
+	"Boxed/internal/config"
+	"Boxed/internal/dto"
+	"Boxed/internal/models"
+	"Boxed/internal/repository"
+	"Boxed/internal/storage"
+	"Boxed/internal/testdb"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testServices wires the services on a sqlite database and a local blob store in a temporary directory
+type testServices struct {
+	db            *gorm.DB
+	configuration *config.Configuration
+	logService    LogService
+	itemService   ItemService
+	boxService    BoxService
+	jobService    JobService
+	keyService    KeyService
+	blobStore     storage.BlobStore
+	fileService   FileService
+}
+
+func setupTestServices(t *testing.T) *testServices {
+	return setupTestServicesWithConfig(t, &config.Configuration{})
+}
+
+func setupTestServicesWithConfig(t *testing.T, configuration *config.Configuration) *testServices {
+	db, err := gorm.Open(testdb.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	// Every connection to :memory: opens a database of its own
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	require.NoError(t, db.AutoMigrate(
+		&models.Box{}, &models.Item{}, &models.ItemVersion{}, &models.Job{}, &models.DataKey{}, &models.UploadSession{},
+	))
+
+	configuration.Storage.Path = t.TempDir()
+	configuration.Server.LogConfig.Level = "error"
+	ts := &testServices{db: db, configuration: configuration}
+	ts.logService = NewLogService(configuration)
+	ts.itemService = NewItemService(repository.NewItemRepository(db), repository.NewItemVersionRepository(db))
+	ts.boxService = NewBoxService(repository.NewBoxRepository(db))
+	ts.jobService = NewJobService(repository.NewJobRepository(db), ts.logService, configuration)
+	ts.keyService, err = NewKeyService(repository.NewDataKeyRepository(db), ts.jobService, ts.logService, configuration)
+	require.NoError(t, err)
+	ts.blobStore = storage.NewLocalBlobStore(storage.StagingDir(configuration.Storage.Path, "blobs"))
+	ts.fileService = NewFileService(ts.itemService, ts.boxService, ts.blobStore, ts.keyService, ts.logService, configuration)
+	return ts
+}
+
+func (ts *testServices) createBox(t *testing.T, name string, properties map[string]interface{}) *models.Box {
+	box, err := ts.boxService.CreateBox(name, properties, filepath.Join(ts.configuration.Storage.Path, name), "")
+	require.NoError(t, err)
+	return box
+}
+
+func (ts *testServices) storeFile(t *testing.T, box *models.Box, filePath string, content string) *dto.ItemGetDTO {
+	item, err := ts.fileService.CreateFileFromReader(box, filePath, strings.NewReader(content), false, "")
+	require.NoError(t, err)
+	return item
+}
+
+func (ts *testServices) item(t *testing.T, id uint) models.Item {
+	var item models.Item
+	require.NoError(t, ts.db.Unscoped().First(&item, id).Error)
+	return item
+}
+
+func (ts *testServices) blobExists(t *testing.T, box *models.Box, digest string) bool {
+	_, err := ts.blobStore.Stat(box, digest)
+	if errors.Is(err, storage.ErrBlobNotFound) {
+		return false
+	}
+	require.NoError(t, err)
+	return true
+}
+
+func (ts *testServices) fileContent(t *testing.T, box *models.Box, filePath string) string {
+	item, err := ts.fileService.GetFileItem(box, filePath)
+	require.NoError(t, err)
+	blob, err := ts.fileService.OpenBlob(box, item.SHA256)
+	require.NoError(t, err)
+	content, err := io.ReadAll(blob)
+	assert.NoError(t, blob.Close())
+	require.NoError(t, err)
+	return string(content)
+}
+
+func TestFileService_DeleteItemOnDisk(t *testing.T) {
+	ts := setupTestServices(t)
+	box := ts.createBox(t, "files", nil)
+
+	unique := ts.storeFile(t, box, "folder/unique.txt", "unique content")
+	duplicate := ts.storeFile(t, box, "folder/duplicate.txt", "shared content")
+	ts.storeFile(t, box, "other/duplicate.txt", "shared content")
+
+	// Content no other item references is deleted with the item
+	assert.NoError(t, ts.fileService.DeleteItemOnDisk(ts.item(t, unique.ID), box))
+	assert.False(t, ts.blobExists(t, box, unique.SHA256))
+	var count int64
+	ts.db.Unscoped().Model(&models.Item{}).Where("id = ?", unique.ID).Count(&count)
+	assert.Zero(t, count)
+
+	// Content another item references stays
+	assert.NoError(t, ts.fileService.DeleteItemOnDisk(ts.item(t, duplicate.ID), box))
+	assert.True(t, ts.blobExists(t, box, duplicate.SHA256))
+}
+
+func TestFileService_DeleteItemOnDiskReleasesVersions(t *testing.T) {
+	ts := setupTestServices(t)
+	box := ts.createBox(t, "files", nil)
+
+	first := ts.storeFile(t, box, "report.txt", "first revision")
+	second := ts.storeFile(t, box, "report.txt", "second revision")
+	require.Equal(t, first.ID, second.ID)
+	versions, err := ts.itemService.FindVersions(first.ID)
+	require.NoError(t, err)
+	require.Len(t, versions, 1)
+
+	assert.NoError(t, ts.fileService.DeleteItemOnDisk(ts.item(t, second.ID), box))
+	assert.False(t, ts.blobExists(t, box, first.SHA256))
+	assert.False(t, ts.blobExists(t, box, second.SHA256))
+	versions, err = ts.itemService.FindVersions(first.ID)
+	assert.NoError(t, err)
+	assert.Empty(t, versions)
+}
+
+func TestFileService_NamesThatDifferInPunctuation(t *testing.T) {
+	ts := setupTestServices(t)
+	box := ts.createBox(t, "files", nil)
+
+	names := []string{"a+b.txt", "a-b.txt", "a b.txt", "résumé.txt", "r_sum_.txt"}
+	ids := make(map[uint]bool)
+	for _, name := range names {
+		ids[ts.storeFile(t, box, "@docs/"+name, name).ID] = true
+	}
+	ts.storeFile(t, box, "_docs/a+b.txt", "other folder")
+	assert.Len(t, ids, len(names), "every name gets an item of its own")
+
+	for _, name := range names {
+		item, err := ts.fileService.GetFileItem(box, "@docs/"+name)
+		require.NoError(t, err)
+		assert.Equal(t, name, item.Name)
+		blob, err := ts.fileService.OpenBlob(box, item.SHA256)
+		require.NoError(t, err)
+		content, err := io.ReadAll(blob)
+		assert.NoError(t, blob.Close())
+		assert.NoError(t, err)
+		assert.Equal(t, name, string(content))
+	}
+}
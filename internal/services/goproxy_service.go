@@ -0,0 +1,315 @@
+package services
+
+import (
+	"Boxed/internal/helpers"
+	"Boxed/internal/models"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// goVersionFolder holds the files of every version below the module folder, like @v in the module cache
+	goVersionFolder = "@v"
+	// goMaxModuleZip and goMaxGoMod follow the limits the go command enforces
+	goMaxModuleZip = 500 << 20
+	goMaxGoMod     = 16 << 20
+)
+
+var (
+	goVersionPattern     = regexp.MustCompile(`^v(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)(-[0-9A-Za-z-]+(\.[0-9A-Za-z-]+)*)?(\+incompatible)?$`)
+	goModuleElement      = regexp.MustCompile(`^[A-Za-z0-9_~-][A-Za-z0-9._~-]*$`)
+	goMajorVersionSuffix = regexp.MustCompile(`/v([2-9]|[1-9]\d+)$`)
+)
+
+// GoproxyInfo is the answer of the .info and @latest endpoints
+type GoproxyInfo struct {
+	Version string
+	Time    time.Time
+}
+
+// GoproxyService implements the GOPROXY protocol on boxes of type goproxy. A version of a module is
+// stored as <module>/@v/<version>.zip with its go.mod next to it as <version>.mod. Module paths are
+// stored unescaped, ltree labels are case-sensitive so mixed-case paths keep their own items.
+type GoproxyService interface {
+	Versions(box *models.Box, modulePath string) ([]string, error)
+	Info(box *models.Box, modulePath string, version string) (*GoproxyInfo, error)
+	Latest(box *models.Box, modulePath string) (*GoproxyInfo, error)
+	File(box *models.Box, modulePath string, version string, extension string) (*models.Item, error)
+	Upload(box *models.Box, modulePath string, version string, body io.Reader) (*GoproxyInfo, error)
+}
+
+type GoproxyServiceImpl struct {
+	itemService ItemService
+	fileService FileService
+	logService  LogService
+}
+
+func NewGoproxyService(
+	itemService ItemService,
+	fileService FileService,
+	logService LogService,
+) GoproxyService {
+	return &GoproxyServiceImpl{
+		itemService: itemService,
+		fileService: fileService,
+		logService:  logService,
+	}
+}
+
+func (s *GoproxyServiceImpl) Versions(box *models.Box, modulePath string) ([]string, error) {
+	folder, err := s.itemService.FindByPathAndBoxId(modulePath+"/"+goVersionFolder, box.ID)
+	if err != nil {
+		return nil, err
+	}
+	if folder == nil || folder.Type != "folder" {
+		return nil, fmt.Errorf("%w: %s", ErrPackageNotFound, modulePath)
+	}
+	items, err := s.itemService.FindItemsByParentID(&folder.ID, box.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []string
+	for _, item := range items {
+		if version, ok := strings.CutSuffix(item.Name, ".zip"); ok && item.Type == "file" {
+			versions = append(versions, version)
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool { return helpers.CompareSemver(versions[i], versions[j]) < 0 })
+	return versions, nil
+}
+
+func (s *GoproxyServiceImpl) Info(box *models.Box, modulePath string, version string) (*GoproxyInfo, error) {
+	item, err := s.File(box, modulePath, version, ".zip")
+	if err != nil {
+		return nil, err
+	}
+	return &GoproxyInfo{Version: version, Time: item.CreatedAt.UTC()}, nil
+}
+
+// Latest returns the highest release version, or the highest pre-release when there is no release
+func (s *GoproxyServiceImpl) Latest(box *models.Box, modulePath string) (*GoproxyInfo, error) {
+	versions, err := s.Versions(box, modulePath)
+	if err != nil {
+		return nil, err
+	}
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("%w: %s has no versions", ErrPackageNotFound, modulePath)
+	}
+	latest := versions[len(versions)-1]
+	for i := len(versions) - 1; i >= 0; i-- {
+		if !helpers.IsPrerelease(versions[i]) {
+			latest = versions[i]
+			break
+		}
+	}
+	return s.Info(box, modulePath, latest)
+}
+
+func (s *GoproxyServiceImpl) File(box *models.Box, modulePath string, version string, extension string) (*models.Item, error) {
+	item, err := s.itemService.FindByPathAndBoxId(goVersionPath(modulePath, version, extension), box.ID)
+	if err != nil {
+		return nil, err
+	}
+	if item == nil || item.Type != "file" {
+		return nil, fmt.Errorf("%w: %s@%s", ErrPackageNotFound, modulePath, version)
+	}
+	return item, nil
+}
+
+// Upload stores a module zip as the go command builds it: every file below <module>@<version>/ and the
+// go.mod, when present, declaring the module path. Versions are immutable once uploaded.
+func (s *GoproxyServiceImpl) Upload(box *models.Box, modulePath string, version string, body io.Reader) (*GoproxyInfo, error) {
+	if err := checkModuleVersion(modulePath, version); err != nil {
+		return nil, err
+	}
+	existing, err := s.itemService.FindByPathAndBoxId(goVersionPath(modulePath, version, ".zip"), box.ID)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, fmt.Errorf("%w: %s@%s", ErrVersionExists, modulePath, version)
+	}
+
+	blob, err := s.fileService.StoreBlob(box, ".zip", io.LimitReader(body, goMaxModuleZip+1))
+	if err != nil {
+		return nil, err
+	}
+	if blob.Size > goMaxModuleZip {
+		return nil, fmt.Errorf("%w: module zip exceeds %d bytes", ErrInvalidPackage, goMaxModuleZip)
+	}
+	moduleZip, err := s.fileService.OpenBlob(box, blob.SHA256)
+	if err != nil {
+		return nil, err
+	}
+	goMod, err := checkModuleZip(moduleZip, moduleZip.Size(), modulePath, version)
+	_ = moduleZip.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	properties, err := json.Marshal(map[string][]string{
+		"module":  {modulePath},
+		"version": {version},
+	})
+	if err != nil {
+		return nil, err
+	}
+	modItem, err := s.fileService.CreateFileFromReader(box, goVersionPath(modulePath, version, ".mod"), bytes.NewReader(goMod), false, "")
+	if err != nil {
+		return nil, err
+	}
+	if err := s.itemService.UpdateProperties(modItem.ID, properties); err != nil {
+		return nil, err
+	}
+	zipItem, err := s.fileService.CreateFileFromBlob(box, goVersionPath(modulePath, version, ".zip"), blob, false, "")
+	if err != nil {
+		return nil, err
+	}
+	if err := s.itemService.UpdateProperties(zipItem.ID, properties); err != nil {
+		return nil, err
+	}
+
+	s.logService.Log.WithFields(logrus.Fields{
+		"box":     box.Name,
+		"module":  modulePath,
+		"version": version,
+	}).Info("Go module uploaded")
+	return s.Info(box, modulePath, version)
+}
+
+func goVersionPath(modulePath string, version string, extension string) string {
+	return modulePath + "/" + goVersionFolder + "/" + version + extension
+}
+
+// checkModuleVersion validates the module path and the version, including the major version suffix
+// a module path needs from v2 on
+func checkModuleVersion(modulePath string, version string) error {
+	elements := strings.Split(modulePath, "/")
+	if !strings.Contains(elements[0], ".") {
+		return fmt.Errorf("%w: module path %q needs a domain as first element", ErrInvalidPackage, modulePath)
+	}
+	for _, element := range elements {
+		if !goModuleElement.MatchString(element) || strings.HasSuffix(element, ".") {
+			return fmt.Errorf("%w: invalid module path %q", ErrInvalidPackage, modulePath)
+		}
+		if element == goVersionFolder {
+			return fmt.Errorf("%w: module path element %q collides with the version folder", ErrInvalidPackage, element)
+		}
+	}
+	if !goVersionPattern.MatchString(version) {
+		return fmt.Errorf("%w: %q is not a canonical semantic version", ErrInvalidPackage, version)
+	}
+	if strings.HasPrefix(modulePath, "gopkg.in/") {
+		return nil
+	}
+
+	major, _, _ := strings.Cut(version, ".")
+	incompatible := strings.HasSuffix(version, "+incompatible")
+	if suffix := goMajorVersionSuffix.FindString(modulePath); suffix != "" {
+		if major != suffix[1:] || incompatible {
+			return fmt.Errorf("%w: version %s does not match the major version of %s", ErrInvalidPackage, version, modulePath)
+		}
+		return nil
+	}
+	if major != "v0" && major != "v1" && !incompatible {
+		return fmt.Errorf("%w: version %s needs the module path suffix /%s", ErrInvalidPackage, version, major)
+	}
+	return nil
+}
+
+// checkModuleZip validates the layout of a module zip and returns its go.mod. Modules without
+// go.mod get the minimal one the go command synthesizes.
+func checkModuleZip(moduleZip io.ReaderAt, size int64, modulePath string, version string) ([]byte, error) {
+	archive, err := zip.NewReader(moduleZip, size)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPackage, err)
+	}
+
+	prefix := modulePath + "@" + version + "/"
+	seen := make(map[string]bool)
+	var goMod []byte
+	for _, file := range archive.File {
+		name, ok := strings.CutPrefix(file.Name, prefix)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s is outside of %s", ErrInvalidPackage, file.Name, prefix)
+		}
+		if strings.HasSuffix(name, "/") {
+			continue
+		}
+		if name == "" || path.Clean(name) != name || strings.HasPrefix(name, "../") || path.IsAbs(name) {
+			return nil, fmt.Errorf("%w: invalid file name %s", ErrInvalidPackage, file.Name)
+		}
+		folded := strings.ToLower(name)
+		if seen[folded] {
+			return nil, fmt.Errorf("%w: %s appears more than once", ErrInvalidPackage, file.Name)
+		}
+		seen[folded] = true
+
+		if path.Base(name) != "go.mod" {
+			continue
+		}
+		if name != "go.mod" {
+			return nil, fmt.Errorf("%w: %s belongs to a nested module", ErrInvalidPackage, file.Name)
+		}
+		if goMod, err = readZipFile(file, goMaxGoMod); err != nil {
+			return nil, err
+		}
+	}
+
+	if goMod == nil {
+		return []byte("module " + modulePath + "\n"), nil
+	}
+	if strings.HasSuffix(version, "+incompatible") {
+		return nil, fmt.Errorf("%w: +incompatible versions cannot have a go.mod", ErrInvalidPackage)
+	}
+	if declared := goModModulePath(goMod); declared != modulePath {
+		return nil, fmt.Errorf("%w: go.mod declares module %q instead of %q", ErrInvalidPackage, declared, modulePath)
+	}
+	return goMod, nil
+}
+
+func readZipFile(file *zip.File, limit int64) ([]byte, error) {
+	reader, err := file.Open()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPackage, err)
+	}
+	defer reader.Close()
+	content, err := io.ReadAll(io.LimitReader(reader, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPackage, err)
+	}
+	if int64(len(content)) > limit {
+		return nil, fmt.Errorf("%w: %s exceeds %d bytes", ErrInvalidPackage, file.Name, limit)
+	}
+	return content, nil
+}
+
+// goModModulePath returns the path of the module directive, empty when there is none
+func goModModulePath(goMod []byte) string {
+	scanner := bufio.NewScanner(bytes.NewReader(goMod))
+	scanner.Buffer(nil, goMaxGoMod)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "//")
+		fields := strings.Fields(line)
+		if len(fields) != 2 || fields[0] != "module" {
+			continue
+		}
+		if unquoted, err := strconv.Unquote(fields[1]); err == nil {
+			return unquoted
+		}
+		return fields[1]
+	}
+	return ""
+}
@@ -0,0 +1,348 @@
+package services
+
+import (
+	"Boxed/internal/helpers"
+	"Boxed/internal/models"
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	HelmIndexFile   = "index.yaml"
+	helmChartsDir   = "charts"
+	helmMaxChartYml = 1 << 20
+)
+
+var (
+	ErrChartNotFound = errors.New("chart not found")
+	helmNamePattern  = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+	helmSemver       = regexp.MustCompile(`^v?(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)(-[0-9A-Za-z-.]+)?(\+[0-9A-Za-z-.]+)?$`)
+)
+
+// HelmChart is the part of Chart.yaml the repository validates and indexes
+type HelmChart struct {
+	APIVersion   string           `yaml:"apiVersion" json:"apiVersion"`
+	Name         string           `yaml:"name" json:"name"`
+	Version      string           `yaml:"version" json:"version"`
+	AppVersion   string           `yaml:"appVersion,omitempty" json:"appVersion,omitempty"`
+	Description  string           `yaml:"description,omitempty" json:"description,omitempty"`
+	Type         string           `yaml:"type,omitempty" json:"type,omitempty"`
+	Keywords     []string         `yaml:"keywords,omitempty" json:"keywords,omitempty"`
+	Dependencies []HelmDependency `yaml:"dependencies,omitempty" json:"dependencies,omitempty"`
+}
+
+type HelmDependency struct {
+	Name       string `yaml:"name" json:"name"`
+	Version    string `yaml:"version,omitempty" json:"version,omitempty"`
+	Repository string `yaml:"repository,omitempty" json:"repository,omitempty"`
+}
+
+// HelmService keeps boxes of type helm as chart repositories. Charts are stored in charts/ with the
+// fields of their Chart.yaml as properties, index.yaml at the root of the box is regenerated whenever a
+// chart is stored or deleted, through this service or the generic file API.
+type HelmService interface {
+	Upload(box *models.Box, body io.Reader) (*HelmChart, error)
+	Delete(box *models.Box, name string, version string) error
+	Chart(box *models.Box, filename string) (*models.Item, error)
+	Index(box *models.Box) (*models.Item, error)
+	RegenerateIndex(box *models.Box) (*models.Item, error)
+}
+
+type HelmServiceImpl struct {
+	itemService ItemService
+	fileService FileService
+	logService  LogService
+	indexLock   sync.Mutex
+}
+
+func NewHelmService(
+	itemService ItemService,
+	fileService FileService,
+	logService LogService,
+) HelmService {
+	service := &HelmServiceImpl{
+		itemService: itemService,
+		fileService: fileService,
+		logService:  logService,
+	}
+	fileService.AddFileListener(service)
+	return service
+}
+
+// Upload stores a packaged chart, the file listener indexes it. A chart version can only be uploaded once.
+func (s *HelmServiceImpl) Upload(box *models.Box, body io.Reader) (*HelmChart, error) {
+	blob, err := s.fileService.StoreBlob(box, ".tgz", body)
+	if err != nil {
+		return nil, err
+	}
+	chartFile, err := s.fileService.OpenBlob(box, blob.SHA256)
+	if err != nil {
+		return nil, err
+	}
+	chart, _, err := readHelmChart(chartFile)
+	_ = chartFile.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	chartPath := helmChartsDir + "/" + helmChartFile(chart.Name, chart.Version)
+	existing, err := s.itemService.FindByPathAndBoxId(chartPath, box.ID)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, fmt.Errorf("%w: %s %s", ErrVersionExists, chart.Name, chart.Version)
+	}
+
+	if _, err := s.fileService.CreateFileFromBlob(box, chartPath, blob, false, ""); err != nil {
+		return nil, err
+	}
+	s.logService.Log.WithFields(logrus.Fields{
+		"box":     box.Name,
+		"chart":   chart.Name,
+		"version": chart.Version,
+	}).Info("Helm chart uploaded")
+	return chart, nil
+}
+
+func (s *HelmServiceImpl) Delete(box *models.Box, name string, version string) error {
+	item, err := s.Chart(box, helmChartFile(name, version))
+	if err != nil {
+		return err
+	}
+	// The file listener regenerates the index
+	return s.fileService.TrashItem(item, box, false, "")
+}
+
+func (s *HelmServiceImpl) Chart(box *models.Box, filename string) (*models.Item, error) {
+	item, err := s.itemService.FindByPathAndBoxId(helmChartsDir+"/"+filename, box.ID)
+	if err != nil {
+		return nil, err
+	}
+	if item == nil || item.Type != "file" {
+		return nil, fmt.Errorf("%w: %s", ErrChartNotFound, filename)
+	}
+	return item, nil
+}
+
+// Index returns the stored index.yaml, a box without one gets it generated first
+func (s *HelmServiceImpl) Index(box *models.Box) (*models.Item, error) {
+	item, err := s.itemService.FindByPathAndBoxId(HelmIndexFile, box.ID)
+	if err != nil {
+		return nil, err
+	}
+	if item != nil {
+		return item, nil
+	}
+	return s.RegenerateIndex(box)
+}
+
+// RegenerateIndex writes index.yaml from the properties of the charts in the box
+func (s *HelmServiceImpl) RegenerateIndex(box *models.Box) (*models.Item, error) {
+	s.indexLock.Lock()
+	defer s.indexLock.Unlock()
+
+	var items []models.Item
+	folder, err := s.itemService.FindByPathAndBoxId(helmChartsDir, box.ID)
+	if err != nil {
+		return nil, err
+	}
+	if folder != nil {
+		if items, err = s.itemService.FindItemsByParentID(&folder.ID, box.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	entries := make(map[string][]map[string]interface{})
+	for _, item := range items {
+		metadata := helpers.PropertiesFromJSON(item.Properties)["metadata"]
+		if item.Type != "file" || len(metadata) == 0 {
+			continue
+		}
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(metadata[0]), &entry); err != nil {
+			continue
+		}
+		entry["urls"] = []string{helmChartsDir + "/" + item.Name}
+		entry["digest"] = item.SHA256
+		entry["created"] = item.CreatedAt.UTC().Format(time.RFC3339Nano)
+		name, _ := entry["name"].(string)
+		entries[name] = append(entries[name], entry)
+	}
+	for _, versions := range entries {
+		sort.Slice(versions, func(i, j int) bool {
+			versionI, _ := versions[i]["version"].(string)
+			versionJ, _ := versions[j]["version"].(string)
+			return helpers.CompareSemver(versionI, versionJ) > 0
+		})
+	}
+
+	index, err := yaml.Marshal(map[string]interface{}{
+		"apiVersion": "v1",
+		"entries":    entries,
+		"generated":  time.Now().UTC().Format(time.RFC3339Nano),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.fileService.CreateFileFromReader(box, HelmIndexFile, bytes.NewReader(index), false, ""); err != nil {
+		return nil, err
+	}
+	return s.itemService.FindByPathAndBoxId(HelmIndexFile, box.ID)
+}
+
+// FileStored indexes charts stored in charts/ of helm boxes
+func (s *HelmServiceImpl) FileStored(box *models.Box, filePath string, item models.Item) {
+	if box.Type != models.BoxTypeHelm || !strings.HasPrefix(filePath, helmChartsDir+"/") || !strings.HasSuffix(item.Name, ".tgz") {
+		return
+	}
+	helmLog := s.logService.Log.WithFields(logrus.Fields{
+		"box":  box.Name,
+		"path": filePath,
+	})
+	if err := s.indexChart(box, item); err != nil {
+		helmLog.WithError(err).Warn("Failed to index helm chart")
+	}
+	// A chart that cannot be read is left out, even when it replaced one that was indexed
+	if _, err := s.RegenerateIndex(box); err != nil {
+		helmLog.WithError(err).Error("Failed to regenerate index.yaml")
+		return
+	}
+	helmLog.Info("Helm chart indexed")
+}
+
+// FileDeleted regenerates index.yaml when charts, or folders that may hold some, are deleted from helm boxes
+func (s *HelmServiceImpl) FileDeleted(box *models.Box, item models.Item) {
+	if box.Type != models.BoxTypeHelm || item.Type != "folder" && !strings.HasSuffix(item.Name, ".tgz") {
+		return
+	}
+	if _, err := s.RegenerateIndex(box); err != nil {
+		s.logService.Log.WithFields(logrus.Fields{
+			"box":  box.Name,
+			"item": item.Name,
+		}).WithError(err).Error("Failed to regenerate index.yaml")
+	}
+}
+
+// indexChart reads the Chart.yaml of a stored chart into its properties, next to the properties it already has
+func (s *HelmServiceImpl) indexChart(box *models.Box, item models.Item) error {
+	chartFile, err := s.fileService.OpenBlob(box, item.SHA256)
+	if err != nil {
+		return err
+	}
+	chart, metadata, err := readHelmChart(chartFile)
+	_ = chartFile.Close()
+	if err != nil {
+		return err
+	}
+
+	properties := helpers.PropertiesFromJSON(item.Properties)
+	for key, values := range helmProperties(chart, metadata) {
+		properties[key] = values
+	}
+	propertiesJSON, err := json.Marshal(properties)
+	if err != nil {
+		return err
+	}
+	return s.itemService.UpdateProperties(item.ID, propertiesJSON)
+}
+
+// helmProperties returns the fields of Chart.yaml a chart is indexed and searched by
+func helmProperties(chart *HelmChart, metadata []byte) map[string][]string {
+	properties := map[string][]string{
+		"name":        {chart.Name},
+		"version":     {chart.Version},
+		"api_version": {chart.APIVersion},
+		"metadata":    {string(metadata)},
+	}
+	if chart.AppVersion != "" {
+		properties["app_version"] = []string{chart.AppVersion}
+	}
+	if chart.Description != "" {
+		properties["description"] = []string{chart.Description}
+	}
+	if len(chart.Keywords) > 0 {
+		properties["keywords"] = chart.Keywords
+	}
+	for _, dependency := range chart.Dependencies {
+		properties["dependencies"] = append(properties["dependencies"], dependency.Name+"="+dependency.Version)
+	}
+	return properties
+}
+
+func helmChartFile(name string, version string) string {
+	return name + "-" + version + ".tgz"
+}
+
+// readHelmChart reads <chart>/Chart.yaml from a packaged chart and returns it with its fields as JSON
+func readHelmChart(file io.Reader) (*HelmChart, []byte, error) {
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: chart is not a gzipped tarball", ErrInvalidPackage)
+	}
+	defer gzipReader.Close()
+
+	reader := tar.NewReader(gzipReader)
+	for {
+		header, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return nil, nil, fmt.Errorf("%w: Chart.yaml not found", ErrInvalidPackage)
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", ErrInvalidPackage, err)
+		}
+		name := strings.TrimPrefix(header.Name, "./")
+		if header.Typeflag != tar.TypeReg || strings.Count(name, "/") != 1 || path.Base(name) != "Chart.yaml" {
+			continue
+		}
+		content, err := io.ReadAll(io.LimitReader(reader, helmMaxChartYml))
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", ErrInvalidPackage, err)
+		}
+		return parseHelmChart(content)
+	}
+}
+
+func parseHelmChart(content []byte) (*HelmChart, []byte, error) {
+	var chart HelmChart
+	var fields map[string]interface{}
+	if err := yaml.Unmarshal(content, &chart); err != nil {
+		return nil, nil, fmt.Errorf("%w: Chart.yaml: %v", ErrInvalidPackage, err)
+	}
+	if err := yaml.Unmarshal(content, &fields); err != nil {
+		return nil, nil, fmt.Errorf("%w: Chart.yaml: %v", ErrInvalidPackage, err)
+	}
+	if chart.APIVersion != "v1" && chart.APIVersion != "v2" {
+		return nil, nil, fmt.Errorf("%w: unsupported apiVersion %q", ErrInvalidPackage, chart.APIVersion)
+	}
+	if !helmNamePattern.MatchString(chart.Name) {
+		return nil, nil, fmt.Errorf("%w: invalid chart name %q", ErrInvalidPackage, chart.Name)
+	}
+	if !helmSemver.MatchString(chart.Version) {
+		return nil, nil, fmt.Errorf("%w: version %q is not a semantic version", ErrInvalidPackage, chart.Version)
+	}
+	// Unquoted versions such as appVersion: 1.10 decode as numbers into the map, the struct keeps their text
+	for key, value := range map[string]string{"name": chart.Name, "version": chart.Version, "appVersion": chart.AppVersion} {
+		if value != "" {
+			fields[key] = value
+		}
+	}
+	metadata, err := json.Marshal(fields)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: Chart.yaml: %v", ErrInvalidPackage, err)
+	}
+	return &chart, metadata, nil
+}
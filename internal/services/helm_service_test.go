@@ -0,0 +1,88 @@
+package services
+
+import (
+	"Boxed/internal/models"
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+	"io"
+	"path/filepath"
+	"testing"
+)
+
+func helmChartArchive(t *testing.T, name string, version string) []byte {
+	chartYaml := []byte("apiVersion: v2\nname: " + name + "\nversion: " + version + "\ndescription: test chart\n")
+	var buffer bytes.Buffer
+	gzipWriter := gzip.NewWriter(&buffer)
+	tarWriter := tar.NewWriter(gzipWriter)
+	require.NoError(t, tarWriter.WriteHeader(&tar.Header{
+		Name:     name + "/Chart.yaml",
+		Mode:     0644,
+		Size:     int64(len(chartYaml)),
+		Typeflag: tar.TypeReg,
+	}))
+	_, err := tarWriter.Write(chartYaml)
+	require.NoError(t, err)
+	require.NoError(t, tarWriter.Close())
+	require.NoError(t, gzipWriter.Close())
+	return buffer.Bytes()
+}
+
+// helmIndexVersions returns the chart versions index.yaml of the box lists by chart name
+func (ts *testServices) helmIndexVersions(t *testing.T, box *models.Box) map[string][]string {
+	item, err := ts.fileService.GetFileItem(box, HelmIndexFile)
+	require.NoError(t, err)
+	blob, err := ts.fileService.OpenBlob(box, item.SHA256)
+	require.NoError(t, err)
+	content, err := io.ReadAll(blob)
+	assert.NoError(t, blob.Close())
+	require.NoError(t, err)
+
+	var index struct {
+		Entries map[string][]struct {
+			Version string `yaml:"version"`
+		} `yaml:"entries"`
+	}
+	require.NoError(t, yaml.Unmarshal(content, &index))
+	versions := make(map[string][]string)
+	for name, entries := range index.Entries {
+		for _, entry := range entries {
+			versions[name] = append(versions[name], entry.Version)
+		}
+	}
+	return versions
+}
+
+func TestHelmService_IndexFollowsFileAPI(t *testing.T) {
+	ts := setupTestServices(t)
+	box, err := ts.boxService.CreateBox("charts", nil, filepath.Join(ts.configuration.Storage.Path, "charts"), models.BoxTypeHelm)
+	require.NoError(t, err)
+	helm := NewHelmService(ts.itemService, ts.fileService, ts.logService)
+
+	_, err = helm.Upload(box, bytes.NewReader(helmChartArchive(t, "mychart", "1.0.0")))
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]string{"mychart": {"1.0.0"}}, ts.helmIndexVersions(t, box))
+
+	// Charts stored through the generic file API are indexed too
+	ts.storeFile(t, box, "charts/mychart-1.1.0.tgz", string(helmChartArchive(t, "mychart", "1.1.0")))
+	assert.Equal(t, map[string][]string{"mychart": {"1.1.0", "1.0.0"}}, ts.helmIndexVersions(t, box))
+	chart, err := helm.Chart(box, "mychart-1.1.0.tgz")
+	require.NoError(t, err)
+	assert.Contains(t, string(chart.Properties), "test chart")
+
+	// Files outside charts/ are not
+	ts.storeFile(t, box, "other/mychart-2.0.0.tgz", string(helmChartArchive(t, "mychart", "2.0.0")))
+	assert.Equal(t, map[string][]string{"mychart": {"1.1.0", "1.0.0"}}, ts.helmIndexVersions(t, box))
+
+	// Nor are deleted charts
+	item, err := ts.fileService.GetFileItem(box, "charts/mychart-1.0.0.tgz")
+	require.NoError(t, err)
+	require.NoError(t, ts.fileService.TrashItem(item, box, false, ""))
+	assert.Equal(t, map[string][]string{"mychart": {"1.1.0"}}, ts.helmIndexVersions(t, box))
+
+	require.NoError(t, helm.Delete(box, "mychart", "1.1.0"))
+	assert.Empty(t, ts.helmIndexVersions(t, box))
+}
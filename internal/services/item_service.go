@@ -6,36 +6,62 @@ import (
 	"Boxed/internal/mapper"
 	"Boxed/internal/models"
 	"Boxed/internal/repository"
+	"encoding/json"
 	"errors"
-	"fmt"
+	"time"
 )
 
 type ItemService interface {
 	GetItemByID(id uint) (*dto.ItemGetDTO, error)
 	DeleteItem(id uint, force bool) error
+	// DeleteItemBy moves an item, a folder with everything below it, to the trash and records who deleted it
+	DeleteItemBy(id uint, force bool, deletedBy string) error
 	GetItems() ([]dto.ItemGetDTO, error)
 	FindDeleted() ([]models.Item, error)
+	FindDeletedBefore(before time.Time) ([]models.Item, error)
+	FindDeletedByID(id uint) (*models.Item, error)
+	FindTrash(boxID uint) ([]models.Item, error)
+	RestoreItem(item *models.Item) ([]models.Item, error)
+	PurgeItem(item *models.Item) error
 	FindByPathAndBoxId(path string, boxID uint) (*models.Item, error)
 	FindItemsByParentID(parentID *uint, boxID uint) ([]models.Item, error)
 	FindFolderByNameAndParent(name string, parentID *uint, boxID uint) (*models.Item, error)
+	FindByNameAndParent(name string, parentID *uint, boxID uint) (*models.Item, error)
 	GetAllDescendants(parentID uint, maxLevel int) ([]models.Item, error)
 	HardDelete(item *models.Item) error
 	Create(item *models.Item) error
 	UpdateItem(item *models.Item) error
+	UpdateProperties(id uint, properties json.RawMessage) error
+	UpdateUploader(id uint, uploader string) error
+	MoveItem(item *models.Item, newParentID *uint, newBoxID uint, newName string) error
 	ItemsSearch(
 		filter string,
 		order string,
 		limit int,
 		offset int,
 	) ([]models.Item, error)
+	RecordVersion(item *models.Item) error
+	FindVersions(itemID uint) ([]models.ItemVersion, error)
+	FindVersion(itemID uint, version int) (*models.ItemVersion, error)
+	FindItemIDsWithMoreVersions(boxID uint, keep int) ([]uint, error)
+	DeleteVersion(version *models.ItemVersion) error
+	CountBlobReferences(boxID uint, sha256sum string) (int64, error)
+	// FindBlobReferences returns the items, those in the trash included, and the prior revisions in the
+	// box that reference the content
+	FindBlobReferences(boxID uint, sha256sum string) ([]models.Item, []models.ItemVersion, error)
+	// FindReferencedBlobs returns the distinct content referenced by the items and revisions of the box
+	FindReferencedBlobs(boxID uint) ([]string, error)
+	// SetQuarantined flags or clears the items in the box whose content failed the integrity scrub
+	SetQuarantined(boxID uint, sha256sum string, quarantined bool) error
 }
 
 type itemServiceImpl struct {
-	itemRepo repository.ItemRepository
+	itemRepo    repository.ItemRepository
+	versionRepo repository.ItemVersionRepository
 }
 
-func NewItemService(itemRepository repository.ItemRepository) ItemService {
-	return &itemServiceImpl{itemRepo: itemRepository}
+func NewItemService(itemRepository repository.ItemRepository, itemVersionRepository repository.ItemVersionRepository) ItemService {
+	return &itemServiceImpl{itemRepo: itemRepository, versionRepo: itemVersionRepository}
 }
 
 func (s *itemServiceImpl) Create(item *models.Item) error {
@@ -48,14 +74,14 @@ func (s *itemServiceImpl) Create(item *models.Item) error {
 		if parentItem == nil {
 			return errors.New("parent item not found")
 		}
-		parentPath = parentItem.Path
+		parentPath = helpers.LtreeToUserPath(parentItem)
 	}
 
-	// Bygg sökvägen korrekt
+	// The repository turns the user path into ltree labels
 	if parentPath != "" {
-		item.Path = fmt.Sprintf("%s.%s", parentPath, helpers.SanitizeLtreeIdentifier(item.Name))
+		item.Path = parentPath + "/" + item.Name
 	} else {
-		item.Path = helpers.SanitizeLtreeIdentifier(item.Name)
+		item.Path = item.Name
 	}
 
 	return s.itemRepo.Create(item)
@@ -77,7 +103,15 @@ func (s *itemServiceImpl) UpdateItem(item *models.Item) error {
 	return s.itemRepo.Update(item)
 }
 
+func (s *itemServiceImpl) MoveItem(item *models.Item, newParentID *uint, newBoxID uint, newName string) error {
+	return s.itemRepo.MoveSubtree(item, newParentID, newBoxID, newName)
+}
+
 func (s *itemServiceImpl) DeleteItem(id uint, force bool) error {
+	return s.DeleteItemBy(id, force, "")
+}
+
+func (s *itemServiceImpl) DeleteItemBy(id uint, force bool, deletedBy string) error {
 	item, err := s.itemRepo.FindByID(id)
 	if err != nil {
 		return err
@@ -88,7 +122,7 @@ func (s *itemServiceImpl) DeleteItem(id uint, force bool) error {
 	if item.Type == "folder" && !force {
 		return errors.New("to delete folder the 'force' option is required")
 	}
-	return s.itemRepo.Delete(id)
+	return s.itemRepo.Trash(item, deletedBy)
 }
 
 func (s *itemServiceImpl) GetItems() ([]dto.ItemGetDTO, error) {
@@ -107,6 +141,26 @@ func (s *itemServiceImpl) FindDeleted() ([]models.Item, error) {
 	return s.itemRepo.FindDeleted()
 }
 
+func (s *itemServiceImpl) FindDeletedBefore(before time.Time) ([]models.Item, error) {
+	return s.itemRepo.FindDeletedBefore(before)
+}
+
+func (s *itemServiceImpl) FindDeletedByID(id uint) (*models.Item, error) {
+	return s.itemRepo.FindDeletedByID(id)
+}
+
+func (s *itemServiceImpl) FindTrash(boxID uint) ([]models.Item, error) {
+	return s.itemRepo.FindTrash(boxID)
+}
+
+func (s *itemServiceImpl) RestoreItem(item *models.Item) ([]models.Item, error) {
+	return s.itemRepo.Restore(item)
+}
+
+func (s *itemServiceImpl) PurgeItem(item *models.Item) error {
+	return s.itemRepo.Purge(item)
+}
+
 func (s *itemServiceImpl) FindByPathAndBoxId(path string, boxID uint) (*models.Item, error) {
 	return s.itemRepo.FindByPathAndBoxId(path, boxID)
 }
@@ -115,6 +169,14 @@ func (s *itemServiceImpl) FindItemsByParentID(parentID *uint, boxID uint) ([]mod
 	return s.itemRepo.FindItemsByParentID(parentID, boxID)
 }
 
+func (s *itemServiceImpl) UpdateProperties(id uint, properties json.RawMessage) error {
+	return s.itemRepo.UpdateProperties(id, properties)
+}
+
+func (s *itemServiceImpl) UpdateUploader(id uint, uploader string) error {
+	return s.itemRepo.UpdateUploader(id, uploader)
+}
+
 func (s *itemServiceImpl) HardDelete(item *models.Item) error {
 	return s.itemRepo.HardDelete(item)
 }
@@ -124,6 +186,10 @@ func (s *itemServiceImpl) FindFolderByNameAndParent(name string, parentID *uint,
 
 }
 
+func (s *itemServiceImpl) FindByNameAndParent(name string, parentID *uint, boxID uint) (*models.Item, error) {
+	return s.itemRepo.FindByNameAndParent(name, parentID, boxID)
+}
+
 func (s *itemServiceImpl) GetAllDescendants(parentID uint, maxLevel int) ([]models.Item, error) {
 	return s.itemRepo.GetAllDescendants(parentID, maxLevel)
 }
@@ -143,3 +209,87 @@ func (s *itemServiceImpl) ItemsSearch(
 	}
 	return s.itemRepo.ItemsSearch(whereClause, args, order, limit, offset)
 }
+
+// RecordVersion keeps the current content of a file item as a prior revision, before it is overwritten
+func (s *itemServiceImpl) RecordVersion(item *models.Item) error {
+	return s.versionRepo.Create(&models.ItemVersion{
+		ItemID:     item.ID,
+		BoxID:      item.BoxID,
+		Version:    item.Version,
+		Size:       item.Size,
+		StoredSize: item.StoredSize,
+		SHA256:     item.SHA256,
+		SHA512:     item.SHA512,
+		Properties: item.Properties,
+		Uploader:   item.Uploader,
+		UploadedAt: item.UpdatedAt,
+	})
+}
+
+func (s *itemServiceImpl) FindVersions(itemID uint) ([]models.ItemVersion, error) {
+	return s.versionRepo.FindByItemID(itemID)
+}
+
+func (s *itemServiceImpl) FindVersion(itemID uint, version int) (*models.ItemVersion, error) {
+	return s.versionRepo.FindByItemIDAndVersion(itemID, version)
+}
+
+func (s *itemServiceImpl) FindItemIDsWithMoreVersions(boxID uint, keep int) ([]uint, error) {
+	return s.versionRepo.FindItemIDsWithMoreVersions(boxID, keep)
+}
+
+func (s *itemServiceImpl) DeleteVersion(version *models.ItemVersion) error {
+	return s.versionRepo.HardDelete(version)
+}
+
+// CountBlobReferences counts the items and prior revisions in the box that still reference the content
+func (s *itemServiceImpl) CountBlobReferences(boxID uint, sha256sum string) (int64, error) {
+	// Items in the trash still need their content, they may be restored
+	items, err := s.itemRepo.CountBySHA256(boxID, sha256sum)
+	if err != nil {
+		return 0, err
+	}
+	versions, err := s.versionRepo.CountBySHA256(boxID, sha256sum)
+	if err != nil {
+		return 0, err
+	}
+	return items + versions, nil
+}
+
+func (s *itemServiceImpl) FindBlobReferences(boxID uint, sha256sum string) ([]models.Item, []models.ItemVersion, error) {
+	items, err := s.itemRepo.FindBySHA256(boxID, sha256sum)
+	if err != nil {
+		return nil, nil, err
+	}
+	versions, err := s.versionRepo.FindBySHA256(boxID, sha256sum)
+	if err != nil {
+		return nil, nil, err
+	}
+	return items, versions, nil
+}
+
+func (s *itemServiceImpl) FindReferencedBlobs(boxID uint) ([]string, error) {
+	sums, err := s.itemRepo.FindSHA256s(boxID)
+	if err != nil {
+		return nil, err
+	}
+	versionSums, err := s.versionRepo.FindSHA256s(boxID)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool, len(sums))
+	for _, sum := range sums {
+		seen[sum] = true
+	}
+	for _, sum := range versionSums {
+		if !seen[sum] {
+			seen[sum] = true
+			sums = append(sums, sum)
+		}
+	}
+	return sums, nil
+}
+
+func (s *itemServiceImpl) SetQuarantined(boxID uint, sha256sum string, quarantined bool) error {
+	return s.itemRepo.SetQuarantined(boxID, sha256sum, quarantined)
+}
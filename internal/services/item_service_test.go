@@ -2,6 +2,7 @@ package services
 
 import (
 	"Boxed/internal/models"
+	"Boxed/internal/repository"
 	"encoding/json"
 	"testing"
 
@@ -9,8 +10,10 @@ import (
 	"github.com/stretchr/testify/mock"
 )
 
+// MockItemRepository implements the methods the tests use, the embedded interface panics on any other
 type MockItemRepository struct {
 	mock.Mock
+	repository.ItemRepository
 }
 
 func (m *MockItemRepository) Create(item *models.Item) error {
@@ -20,7 +23,11 @@ func (m *MockItemRepository) Create(item *models.Item) error {
 
 func (m *MockItemRepository) FindByID(id uint) (*models.Item, error) {
 	args := m.Called(id)
-	return args.Get(0).(*models.Item), args.Error(1)
+	item, ok := args.Get(0).(*models.Item)
+	if !ok {
+		return nil, args.Error(1)
+	}
+	return item, args.Error(1)
 }
 
 func (m *MockItemRepository) Update(item *models.Item) error {
@@ -33,9 +40,9 @@ func (m *MockItemRepository) Delete(id uint) error {
 	return args.Error(0)
 }
 
-func (m *MockItemRepository) FindAllByBoxID(boxID uint) ([]models.Item, error) {
-	args := m.Called(boxID)
-	return args.Get(0).([]models.Item), args.Error(1)
+func (m *MockItemRepository) Trash(item *models.Item, deletedBy string) error {
+	args := m.Called(item, deletedBy)
+	return args.Error(0)
 }
 
 func (m *MockItemRepository) FindAll() ([]models.Item, error) {
@@ -45,7 +52,7 @@ func (m *MockItemRepository) FindAll() ([]models.Item, error) {
 
 func TestItemService_GetItems(t *testing.T) {
 	mockRepo := new(MockItemRepository)
-	service := NewItemService(mockRepo)
+	service := NewItemService(mockRepo, nil)
 
 	items := []models.Item{
 		{BaseModel: models.BaseModel{ID: 1}, Name: "Item 1", Path: "/path/item1"},
@@ -63,27 +70,26 @@ func TestItemService_GetItems(t *testing.T) {
 	mockRepo.AssertExpectations(t)
 }
 
-func TestItemService_CreateItem(t *testing.T) {
+func TestItemService_Create(t *testing.T) {
 	mockRepo := new(MockItemRepository)
-	service := NewItemService(mockRepo)
+	service := NewItemService(mockRepo, nil)
 
-	properties := map[string]interface{}{"key": "value"}
-	propertiesJSON, _ := json.Marshal(properties)
-	item := &models.Item{Name: "Test Item", Path: "/path/to/item", Type: "file", BoxID: 1, Properties: propertiesJSON}
+	properties, _ := json.Marshal(map[string]interface{}{"key": "value"})
+	item := &models.Item{Name: "Test Item", Type: "file", BoxID: 1, Properties: properties}
 
 	mockRepo.On("Create", item).Return(nil)
 
-	createdItem, err := service.CreateItem("Test Item", "/path/to/item", "file", 0, 1, properties)
+	err := service.Create(item)
 
 	assert.NoError(t, err)
-	assert.Equal(t, "Test Item", createdItem.Name)
-	assert.Equal(t, "file", createdItem.Type)
+	// The repository turns the user path into labels
+	assert.Equal(t, "Test Item", item.Path)
 	mockRepo.AssertExpectations(t)
 }
 
 func TestItemService_GetItemByID(t *testing.T) {
 	mockRepo := new(MockItemRepository)
-	service := NewItemService(mockRepo)
+	service := NewItemService(mockRepo, nil)
 
 	item := &models.Item{BaseModel: models.BaseModel{ID: 1}, Name: "Test Item", Path: "/path/to/item"}
 	mockRepo.On("FindByID", uint(1)).Return(item, nil)
@@ -98,31 +104,42 @@ func TestItemService_GetItemByID(t *testing.T) {
 
 func TestItemService_UpdateItem(t *testing.T) {
 	mockRepo := new(MockItemRepository)
-	service := NewItemService(mockRepo)
-
-	item := &models.Item{BaseModel: models.BaseModel{ID: 1}, Name: "Original Item", Path: "/original/path"}
-	updatedProperties := map[string]interface{}{"newKey": "newValue"}
-	updatedPropertiesJSON, _ := json.Marshal(updatedProperties)
+	service := NewItemService(mockRepo, nil)
 
-	mockRepo.On("FindByID", uint(1)).Return(item, nil)
+	item := &models.Item{BaseModel: models.BaseModel{ID: 1}, Name: "Original Item", Path: "original"}
 	mockRepo.On("Update", item).Return(nil)
 
-	updatedItem, err := service.UpdateItem(1, "Updated Item", "/updated/path", updatedProperties)
+	err := service.UpdateItem(item)
 
 	assert.NoError(t, err)
-	assert.Equal(t, "Updated Item", updatedItem.Name)
-	assert.EqualValues(t, updatedPropertiesJSON, updatedItem.Properties)
 	mockRepo.AssertExpectations(t)
 }
 
 func TestItemService_DeleteItem(t *testing.T) {
 	mockRepo := new(MockItemRepository)
-	service := NewItemService(mockRepo)
+	service := NewItemService(mockRepo, nil)
 
-	mockRepo.On("Delete", uint(1)).Return(nil)
+	item := &models.Item{BaseModel: models.BaseModel{ID: 1}, Name: "a.txt", Type: "file"}
+	mockRepo.On("FindByID", uint(1)).Return(item, nil)
+	mockRepo.On("Trash", item, "").Return(nil)
 
-	err := service.DeleteItem(1)
+	err := service.DeleteItem(1, false)
 
 	assert.NoError(t, err)
 	mockRepo.AssertExpectations(t)
 }
+
+func TestItemService_DeleteFolderNeedsForce(t *testing.T) {
+	mockRepo := new(MockItemRepository)
+	service := NewItemService(mockRepo, nil)
+
+	folder := &models.Item{BaseModel: models.BaseModel{ID: 2}, Name: "dir", Type: "folder"}
+	mockRepo.On("FindByID", uint(2)).Return(folder, nil)
+
+	assert.Error(t, service.DeleteItem(2, false))
+	mockRepo.AssertNotCalled(t, "Trash", folder, "")
+
+	mockRepo.On("Trash", folder, "alice").Return(nil)
+	assert.NoError(t, service.DeleteItemBy(2, true, "alice"))
+	mockRepo.AssertExpectations(t)
+}
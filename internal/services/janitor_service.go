@@ -2,46 +2,83 @@ package services
 
 import (
 	"Boxed/internal/config"
+	"Boxed/internal/models"
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/robfig/cron/v3"
 	"github.com/sirupsen/logrus"
 	"sync"
+	"time"
 )
 
+const (
+	cleanJobType          = "clean"
+	defaultTrashRetention = 7 * 24 * time.Hour
+)
+
+// cleanJobPayload is the persisted payload of clean jobs
+type cleanJobPayload struct {
+	Forced bool `json:"forced"`
+}
+
 type Janitor struct {
-	itemService   ItemService
-	boxService    BoxService
-	fileService   FileService
-	configuration *config.Configuration
-	logService    LogService
-	cleaning      bool
-	mutex         sync.Mutex
-	stopChan      chan struct{}
-	cron          *cron.Cron
+	itemService    ItemService
+	boxService     BoxService
+	fileService    FileService
+	uploadService  UploadService
+	jobService     JobService
+	versionService VersionService
+	configuration  *config.Configuration
+	logService     LogService
+	cleaning       bool
+	mutex          sync.Mutex
+	stopChan       chan struct{}
+	cron           *cron.Cron
 }
 
 func NewJanitorService(
 	itemService ItemService,
 	boxService BoxService,
 	fileService FileService,
+	uploadService UploadService,
+	jobService JobService,
+	versionService VersionService,
 	logService LogService,
 	configuration *config.Configuration,
 
 ) *Janitor {
-	return &Janitor{
-		itemService:   itemService,
-		fileService:   fileService,
-		boxService:    boxService,
-		logService:    logService,
-		cleaning:      false,
-		mutex:         sync.Mutex{},
-		configuration: configuration,
-		cron:          cron.New(),
+	j := &Janitor{
+		itemService:    itemService,
+		fileService:    fileService,
+		uploadService:  uploadService,
+		boxService:     boxService,
+		jobService:     jobService,
+		versionService: versionService,
+		logService:     logService,
+		cleaning:       false,
+		mutex:          sync.Mutex{},
+		configuration:  configuration,
+		cron:           cron.New(),
+	}
+	// Cleaning only removes what is still marked as deleted, so an interrupted run can simply start over
+	jobService.RegisterHandler(cleanJobType, j.runCleanJob, true)
+	return j
+}
+
+func (j *Janitor) ForceStartCleanCycle() (*models.Job, error) {
+	if j.IsCleaning() {
+		return nil, errors.New("cleaning is in progress")
 	}
+	return j.jobService.Enqueue(cleanJobType, cleanJobPayload{Forced: true})
 }
 
-func (j *Janitor) ForceStartCleanCycle() error {
+func (j *Janitor) runCleanJob(ctx context.Context, job *models.Job, progress *JobProgress) error {
+	var payload cleanJobPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return err
+	}
 	j.mutex.Lock()
 	if j.cleaning {
 		j.mutex.Unlock()
@@ -50,16 +87,12 @@ func (j *Janitor) ForceStartCleanCycle() error {
 	j.cleaning = true
 	j.mutex.Unlock()
 
-	// Run the cleaning process
-	go func() {
-		defer func() {
-			j.mutex.Lock()
-			j.cleaning = false
-			j.mutex.Unlock()
-		}()
-		j.startClean(true)
+	defer func() {
+		j.mutex.Lock()
+		j.cleaning = false
+		j.mutex.Unlock()
 	}()
-
+	j.startClean(ctx, progress, payload.Forced)
 	return nil
 }
 
@@ -74,20 +107,22 @@ func (j *Janitor) StartCleanCycle() {
 
 	cronSchedule := j.configuration.Server.CleanConfig.Schedule
 	_, err := j.cron.AddFunc(cronSchedule, func() {
-		j.mutex.Lock()
-		if j.cleaning {
-			j.mutex.Unlock()
+		if j.IsCleaning() {
 			return
 		}
-		j.cleaning = true
-		j.mutex.Unlock()
-
-		defer func() {
-			j.mutex.Lock()
-			j.cleaning = false
-			j.mutex.Unlock()
-		}()
-		j.startClean(false)
+		j.cleanExpiredUploads()
+		j.pruneVersions()
+		// Only record a job when there is something to clean, the schedule usually runs every minute
+		items, err := j.itemService.FindDeletedBefore(j.trashCutoff())
+		if err != nil || len(items) == 0 {
+			return
+		}
+		if _, err := j.jobService.Enqueue(cleanJobType, cleanJobPayload{Forced: false}); err != nil {
+			j.logService.Log.WithFields(logrus.Fields{
+				"job":   "clean",
+				"error": err.Error(),
+			}).Error("Failed to enqueue cleaning job")
+		}
 	})
 
 	if err != nil {
@@ -122,9 +157,12 @@ func (j *Janitor) IsCleaning() bool {
 	return j.cleaning
 }
 
-func (j *Janitor) startClean(forced bool) {
+func (j *Janitor) startClean(ctx context.Context, progress *JobProgress, forced bool) {
+	j.cleanExpiredUploads()
+	pruned := j.pruneVersions()
 	j.logService.Log.Debug("getting deleted items")
-	items, err := j.itemService.FindDeleted()
+	// Deleted items stay in the trash, where they can be restored, for the retention period
+	items, err := j.itemService.FindDeletedBefore(j.trashCutoff())
 	j.logService.Log.Debug(fmt.Sprintf("found %d items", len(items)))
 	if err != nil {
 		j.logService.Log.WithFields(logrus.Fields{
@@ -149,15 +187,19 @@ func (j *Janitor) startClean(forced bool) {
 		}
 		j.logService.Log.WithFields(logFields).Info(fmt.Sprintf("Found %d items to delete", len(items)))
 	}
+	progress.AddTotal(int64(len(items)))
 	var deletedCount int
 	for i := range items {
+		if ctx.Err() != nil {
+			break
+		}
 		j.logService.Log.WithFields(logrus.Fields{
 			"job":    "clean",
 			"status": "deleting",
 			"item":   items[i].Name,
 			"path":   items[i].Path,
 		})
-		box, err := j.boxService.GetBoxByID(items[i].ID)
+		box, err := j.boxService.GetBoxByID(items[i].BoxID)
 		if err != nil {
 			j.logService.Log.WithFields(logrus.Fields{
 				"job":    "clean",
@@ -165,8 +207,10 @@ func (j *Janitor) startClean(forced bool) {
 				"error":  err.Error(),
 				"item":   items[i].Name,
 				"path":   items[i].Path,
-				"boxId":  items[i].ID,
+				"boxId":  items[i].BoxID,
 			}).Error("Failed to get box")
+			progress.AddError(err)
+			continue
 		}
 		err = j.fileService.DeleteItemOnDisk(items[i], box)
 		if err != nil {
@@ -175,7 +219,11 @@ func (j *Janitor) startClean(forced bool) {
 				"status": "error",
 				"error":  err.Error(),
 			}).Error("Failed to delete item")
+			progress.AddError(err)
+			continue
 		}
+		progress.AddItems(1)
+		progress.AddBytes(items[i].Size)
 		deletedCount++
 	}
 	if deletedCount > 0 {
@@ -185,7 +233,71 @@ func (j *Janitor) startClean(forced bool) {
 			"count":  deletedCount,
 		}).Info("cleaning job finished")
 	}
-	j.cleaning = false
+	progress.SetResult(map[string]int{"deleted": deletedCount, "versions_pruned": pruned})
+}
+
+// trashCutoff returns the time before which deleted items are purged from the trash
+func (j *Janitor) trashCutoff() time.Time {
+	retention, err := time.ParseDuration(j.configuration.Server.CleanConfig.TrashRetention)
+	if err != nil || retention < 0 {
+		retention = defaultTrashRetention
+	}
+	return time.Now().Add(-retention)
+}
+
+// cleanExpiredUploads removes abandoned resumable upload sessions and their staging files
+func (j *Janitor) cleanExpiredUploads() {
+	removed, err := j.uploadService.CleanupExpired()
+	if err != nil {
+		j.logService.Log.WithFields(logrus.Fields{
+			"job":    "clean",
+			"status": "error",
+			"error":  err.Error(),
+		}).Error("Failed to clean expired upload sessions")
+		return
+	}
+	if removed > 0 {
+		j.logService.Log.WithFields(logrus.Fields{
+			"job":   "clean",
+			"count": removed,
+		}).Info("Removed expired upload sessions")
+	}
+}
+
+// pruneVersions drops the prior revisions of files beyond the "keep_versions" of their box
+func (j *Janitor) pruneVersions() int {
+	boxes, err := j.boxService.GetBoxes()
+	if err != nil {
+		j.logService.Log.WithFields(logrus.Fields{
+			"job":    "clean",
+			"status": "error",
+			"error":  err.Error(),
+		}).Error("Failed to find the boxes to prune versions in")
+		return 0
+	}
+	var pruned int
+	for i := range boxes {
+		removed, freed, err := j.versionService.Prune(&boxes[i])
+		pruned += removed
+		if err != nil {
+			j.logService.Log.WithFields(logrus.Fields{
+				"job":    "clean",
+				"status": "error",
+				"box":    boxes[i].Name,
+				"error":  err.Error(),
+			}).Error("Failed to prune versions")
+			continue
+		}
+		if removed > 0 {
+			j.logService.Log.WithFields(logrus.Fields{
+				"job":   "clean",
+				"box":   boxes[i].Name,
+				"count": removed,
+				"bytes": freed,
+			}).Info("Pruned old versions")
+		}
+	}
+	return pruned
 }
 
 func (j *Janitor) getDeletedBoxes() {
@@ -0,0 +1,380 @@
+package services
+
+import (
+	"Boxed/internal/config"
+	"Boxed/internal/models"
+	"Boxed/internal/repository"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	errJobInterrupted  = "interrupted by server restart"
+	jobProgressFlush   = 2 * time.Second
+	defaultJobWorkers  = 4
+	maxJobErrorsStored = 100
+)
+
+var (
+	ErrJobNotFound    = errors.New("job not found")
+	ErrJobFinished    = errors.New("job already finished")
+	ErrUnknownJobType = errors.New("unknown job type")
+)
+
+// JobFunc executes a job. It should stop when ctx is cancelled and report progress through progress.
+type JobFunc func(ctx context.Context, job *models.Job, progress *JobProgress) error
+
+type JobService interface {
+	RegisterHandler(jobType string, handler JobFunc, resumable bool)
+	Enqueue(jobType string, payload interface{}) (*models.Job, error)
+	GetJob(id uint) (*models.Job, error)
+	ListJobs(status string, limit int, offset int) ([]models.Job, error)
+	CancelJob(id uint) (*models.Job, error)
+	ResumeInterrupted() error
+}
+
+type registeredJob struct {
+	run       JobFunc
+	resumable bool
+}
+
+type jobServiceImpl struct {
+	jobRepo    repository.JobRepository
+	logService LogService
+	handlers   map[string]registeredJob
+	running    map[uint]context.CancelFunc
+	mutex      sync.Mutex
+	slots      chan struct{}
+}
+
+func NewJobService(
+	jobRepo repository.JobRepository,
+	logService LogService,
+	configuration *config.Configuration,
+) JobService {
+	workers := configuration.Server.JobConfig.Workers
+	if workers <= 0 {
+		workers = defaultJobWorkers
+	}
+	return &jobServiceImpl{
+		jobRepo:    jobRepo,
+		logService: logService,
+		handlers:   make(map[string]registeredJob),
+		running:    make(map[uint]context.CancelFunc),
+		slots:      make(chan struct{}, workers),
+	}
+}
+
+func (s *jobServiceImpl) RegisterHandler(jobType string, handler JobFunc, resumable bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.handlers[jobType] = registeredJob{run: handler, resumable: resumable}
+}
+
+func (s *jobServiceImpl) Enqueue(jobType string, payload interface{}) (*models.Job, error) {
+	s.mutex.Lock()
+	handler, ok := s.handlers[jobType]
+	s.mutex.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownJobType, jobType)
+	}
+
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	job := &models.Job{
+		Type:    jobType,
+		Status:  models.JobStatusPending,
+		Payload: payloadJSON,
+	}
+	if err := s.jobRepo.Create(job); err != nil {
+		return nil, err
+	}
+	// The runner works on its own copy, the caller keeps a snapshot of the pending job
+	running := *job
+	s.start(&running, handler)
+	return job, nil
+}
+
+func (s *jobServiceImpl) GetJob(id uint) (*models.Job, error) {
+	job, err := s.jobRepo.FindByID(id)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %d", ErrJobNotFound, id)
+	}
+	return job, nil
+}
+
+func (s *jobServiceImpl) ListJobs(status string, limit int, offset int) ([]models.Job, error) {
+	return s.jobRepo.FindRecent(status, limit, offset)
+}
+
+func (s *jobServiceImpl) CancelJob(id uint) (*models.Job, error) {
+	job, err := s.GetJob(id)
+	if err != nil {
+		return nil, err
+	}
+	if job.IsFinished() {
+		return job, ErrJobFinished
+	}
+
+	s.mutex.Lock()
+	cancel, running := s.running[id]
+	s.mutex.Unlock()
+	if running {
+		// The runner records the cancelled status once the job function returns
+		cancel()
+		return job, nil
+	}
+
+	now := time.Now()
+	job.Status = models.JobStatusCancelled
+	job.FinishedAt = &now
+	if err := s.jobRepo.Update(job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// ResumeInterrupted picks up jobs that were pending or running when the process stopped.
+// Resumable jobs are started again, the others are marked as failed.
+func (s *jobServiceImpl) ResumeInterrupted() error {
+	jobs, err := s.jobRepo.FindByStatus(models.JobStatusPending, models.JobStatusRunning)
+	if err != nil {
+		return err
+	}
+	for i := range jobs {
+		job := jobs[i]
+		s.mutex.Lock()
+		handler, ok := s.handlers[job.Type]
+		s.mutex.Unlock()
+
+		jobLog := s.logService.Log.WithFields(logrus.Fields{
+			"job":    job.Type,
+			"jobId":  job.ID,
+			"status": job.Status,
+		})
+		if ok && (job.Status == models.JobStatusPending || handler.resumable) {
+			jobLog.Info("Resuming interrupted job")
+			job.Status = models.JobStatusPending
+			if err := s.jobRepo.Update(&job); err != nil {
+				return err
+			}
+			running := job
+			s.start(&running, handler)
+			continue
+		}
+
+		jobLog.Warn("Marking interrupted job as failed")
+		now := time.Now()
+		job.Status = models.JobStatusFailed
+		job.Error = errJobInterrupted
+		job.FinishedAt = &now
+		if err := s.jobRepo.Update(&job); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *jobServiceImpl) start(job *models.Job, handler registeredJob) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.mutex.Lock()
+	s.running[job.ID] = cancel
+	s.mutex.Unlock()
+
+	go func() {
+		defer func() {
+			s.mutex.Lock()
+			delete(s.running, job.ID)
+			s.mutex.Unlock()
+			cancel()
+		}()
+
+		progress := &JobProgress{}
+		select {
+		case s.slots <- struct{}{}:
+		case <-ctx.Done():
+			s.finish(job, progress, ctx.Err())
+			return
+		}
+		defer func() { <-s.slots }()
+
+		now := time.Now()
+		job.Status = models.JobStatusRunning
+		job.StartedAt = &now
+		if err := s.jobRepo.Update(job); err != nil {
+			s.logService.Log.WithFields(logrus.Fields{
+				"job":   job.Type,
+				"jobId": job.ID,
+			}).WithError(err).Error("Failed to mark job as running")
+		}
+
+		stop := make(chan struct{})
+		done := make(chan struct{})
+		go s.reportProgress(job.ID, progress, stop, done)
+
+		err := runJob(ctx, handler.run, job, progress)
+		close(stop)
+		<-done
+		if err == nil && ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		s.finish(job, progress, err)
+	}()
+}
+
+// runJob executes the job function and turns a panic into a job failure
+func runJob(ctx context.Context, run JobFunc, job *models.Job, progress *JobProgress) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+	return run(ctx, job, progress)
+}
+
+func (s *jobServiceImpl) reportProgress(id uint, progress *JobProgress, stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(jobProgressFlush)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			bytesProcessed, itemsProcessed, itemsTotal := progress.Counters()
+			if err := s.jobRepo.UpdateProgress(id, bytesProcessed, itemsProcessed, itemsTotal); err != nil {
+				s.logService.Log.WithFields(logrus.Fields{"jobId": id}).WithError(err).Warn("Failed to store job progress")
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (s *jobServiceImpl) finish(job *models.Job, progress *JobProgress, err error) {
+	now := time.Now()
+	job.FinishedAt = &now
+	job.BytesProcessed, job.ItemsProcessed, job.ItemsTotal = progress.Counters()
+	job.Errors, job.Result = progress.encode()
+
+	jobLog := s.logService.Log.WithFields(logrus.Fields{
+		"job":   job.Type,
+		"jobId": job.ID,
+	})
+	switch {
+	case err == nil:
+		job.Status = models.JobStatusSucceeded
+		job.Error = ""
+		jobLog.Info("Job finished")
+	case errors.Is(err, context.Canceled):
+		job.Status = models.JobStatusCancelled
+		jobLog.Info("Job cancelled")
+	default:
+		job.Status = models.JobStatusFailed
+		job.Error = err.Error()
+		jobLog.WithError(err).Error("Job failed")
+	}
+	if err := s.jobRepo.Update(job); err != nil {
+		jobLog.WithError(err).Error("Failed to store job result")
+	}
+}
+
+// JobProgress collects the progress of a running job. A nil *JobProgress ignores all updates,
+// which lets the same code run inside and outside of a job.
+type JobProgress struct {
+	mutex          sync.Mutex
+	bytesProcessed int64
+	itemsProcessed int64
+	itemsTotal     int64
+	errors         []string
+	result         interface{}
+}
+
+func (p *JobProgress) AddBytes(n int64) {
+	if p == nil {
+		return
+	}
+	p.mutex.Lock()
+	p.bytesProcessed += n
+	p.mutex.Unlock()
+}
+
+func (p *JobProgress) AddItems(n int64) {
+	if p == nil {
+		return
+	}
+	p.mutex.Lock()
+	p.itemsProcessed += n
+	p.mutex.Unlock()
+}
+
+func (p *JobProgress) AddTotal(n int64) {
+	if p == nil {
+		return
+	}
+	p.mutex.Lock()
+	p.itemsTotal += n
+	p.mutex.Unlock()
+}
+
+// AddError records a non-fatal error, the job keeps running
+func (p *JobProgress) AddError(err error) {
+	if p == nil || err == nil {
+		return
+	}
+	p.mutex.Lock()
+	if len(p.errors) < maxJobErrorsStored {
+		p.errors = append(p.errors, err.Error())
+	}
+	p.mutex.Unlock()
+}
+
+// SetResult stores a JSON serializable summary of the job
+func (p *JobProgress) SetResult(result interface{}) {
+	if p == nil {
+		return
+	}
+	p.mutex.Lock()
+	p.result = result
+	p.mutex.Unlock()
+}
+
+func (p *JobProgress) Counters() (bytesProcessed int64, itemsProcessed int64, itemsTotal int64) {
+	if p == nil {
+		return 0, 0, 0
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.bytesProcessed, p.itemsProcessed, p.itemsTotal
+}
+
+func (p *JobProgress) encode() (json.RawMessage, json.RawMessage) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	var errorsJSON, resultJSON json.RawMessage
+	if len(p.errors) > 0 {
+		errorsJSON, _ = json.Marshal(p.errors)
+	}
+	if p.result != nil {
+		resultJSON, _ = json.Marshal(p.result)
+	}
+	return errorsJSON, resultJSON
+}
+
+// ProgressWriter counts the bytes written through it into the job progress
+type ProgressWriter struct {
+	Writer   io.Writer
+	Progress *JobProgress
+}
+
+func (pw *ProgressWriter) Write(p []byte) (int, error) {
+	n, err := pw.Writer.Write(p)
+	pw.Progress.AddBytes(int64(n))
+	return n, err
+}
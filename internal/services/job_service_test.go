@@ -0,0 +1,154 @@
+package services
+
+import (
+	"Boxed/internal/config"
+	"Boxed/internal/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestJobService_Run(t *testing.T) {
+	ts := setupTestServices(t)
+	ts.jobService.RegisterHandler("count", func(ctx context.Context, job *models.Job, progress *JobProgress) error {
+		progress.AddTotal(3)
+		progress.AddItems(3)
+		progress.AddBytes(42)
+		progress.AddError(errors.New("one item was skipped"))
+		progress.SetResult(map[string]int{"counted": 3})
+		return nil
+	}, false)
+	ts.jobService.RegisterHandler("fail", func(ctx context.Context, job *models.Job, progress *JobProgress) error {
+		return errors.New("nothing to do")
+	}, false)
+	ts.jobService.RegisterHandler("panic", func(ctx context.Context, job *models.Job, progress *JobProgress) error {
+		panic("boom")
+	}, false)
+
+	job, err := ts.jobService.Enqueue("count", map[string]string{"box": "files"})
+	require.NoError(t, err)
+	job = ts.waitForJob(t, job.ID)
+	assert.Equal(t, models.JobStatusSucceeded, job.Status)
+	assert.JSONEq(t, `{"box":"files"}`, string(job.Payload))
+	assert.Equal(t, int64(3), job.ItemsProcessed)
+	assert.Equal(t, int64(3), job.ItemsTotal)
+	assert.Equal(t, int64(42), job.BytesProcessed)
+	assert.JSONEq(t, `["one item was skipped"]`, string(job.Errors))
+	assert.JSONEq(t, `{"counted":3}`, string(job.Result))
+	assert.NotNil(t, job.StartedAt)
+	assert.NotNil(t, job.FinishedAt)
+
+	job, err = ts.jobService.Enqueue("fail", nil)
+	require.NoError(t, err)
+	job = ts.waitForJob(t, job.ID)
+	assert.Equal(t, models.JobStatusFailed, job.Status)
+	assert.Equal(t, "nothing to do", job.Error)
+
+	job, err = ts.jobService.Enqueue("panic", nil)
+	require.NoError(t, err)
+	job = ts.waitForJob(t, job.ID)
+	assert.Equal(t, models.JobStatusFailed, job.Status)
+	assert.Contains(t, job.Error, "boom")
+
+	_, err = ts.jobService.Enqueue("unknown", nil)
+	assert.ErrorIs(t, err, ErrUnknownJobType)
+	_, err = ts.jobService.GetJob(9999)
+	assert.ErrorIs(t, err, ErrJobNotFound)
+}
+
+func TestJobService_EnqueueSnapshot(t *testing.T) {
+	ts := setupTestServices(t)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	ts.jobService.RegisterHandler("slow", func(ctx context.Context, job *models.Job, progress *JobProgress) error {
+		close(started)
+		progress.AddItems(1)
+		progress.SetResult("done")
+		<-release
+		return nil
+	}, false)
+
+	job, err := ts.jobService.Enqueue("slow", nil)
+	require.NoError(t, err)
+	<-started
+	// The handler encodes the returned job while the runner updates its own copy, go test -race catches a shared one
+	encoded, err := json.Marshal(job)
+	require.NoError(t, err)
+	close(release)
+	finished := ts.waitForJob(t, job.ID)
+	assert.Equal(t, models.JobStatusSucceeded, finished.Status)
+
+	assert.Contains(t, string(encoded), models.JobStatusPending)
+	assert.Equal(t, models.JobStatusPending, job.Status)
+	assert.Nil(t, job.StartedAt)
+	assert.Nil(t, job.FinishedAt)
+	assert.Nil(t, job.Result)
+}
+
+func TestJobService_Cancel(t *testing.T) {
+	configuration := &config.Configuration{}
+	configuration.Server.JobConfig.Workers = 1
+	ts := setupTestServicesWithConfig(t, configuration)
+	started := make(chan struct{}, 1)
+	ran := 0
+	ts.jobService.RegisterHandler("block", func(ctx context.Context, job *models.Job, progress *JobProgress) error {
+		ran++
+		started <- struct{}{}
+		<-ctx.Done()
+		return ctx.Err()
+	}, false)
+
+	running, err := ts.jobService.Enqueue("block", nil)
+	require.NoError(t, err)
+	<-started
+	// The only worker is busy, so the second job waits
+	pending, err := ts.jobService.Enqueue("block", nil)
+	require.NoError(t, err)
+
+	_, err = ts.jobService.CancelJob(pending.ID)
+	assert.NoError(t, err)
+	job := ts.waitForJob(t, pending.ID)
+	assert.Equal(t, models.JobStatusCancelled, job.Status)
+	assert.Nil(t, job.StartedAt)
+
+	_, err = ts.jobService.CancelJob(running.ID)
+	assert.NoError(t, err)
+	job = ts.waitForJob(t, running.ID)
+	assert.Equal(t, models.JobStatusCancelled, job.Status)
+	assert.Equal(t, 1, ran)
+
+	_, err = ts.jobService.CancelJob(running.ID)
+	assert.ErrorIs(t, err, ErrJobFinished)
+}
+
+func TestJobService_ResumeInterrupted(t *testing.T) {
+	ts := setupTestServices(t)
+	ts.jobService.RegisterHandler("resumable", func(ctx context.Context, job *models.Job, progress *JobProgress) error {
+		return nil
+	}, true)
+	ts.jobService.RegisterHandler("once", func(ctx context.Context, job *models.Job, progress *JobProgress) error {
+		return nil
+	}, false)
+
+	// Jobs a previous process left behind
+	interrupted := []*models.Job{
+		{Type: "resumable", Status: models.JobStatusRunning},
+		{Type: "once", Status: models.JobStatusPending},
+		{Type: "once", Status: models.JobStatusRunning},
+		{Type: "gone", Status: models.JobStatusPending},
+	}
+	for _, job := range interrupted {
+		require.NoError(t, ts.db.Create(job).Error)
+	}
+
+	require.NoError(t, ts.jobService.ResumeInterrupted())
+	assert.Equal(t, models.JobStatusSucceeded, ts.waitForJob(t, interrupted[0].ID).Status)
+	assert.Equal(t, models.JobStatusSucceeded, ts.waitForJob(t, interrupted[1].ID).Status)
+	job := ts.waitForJob(t, interrupted[2].ID)
+	assert.Equal(t, models.JobStatusFailed, job.Status)
+	assert.Equal(t, errJobInterrupted, job.Error)
+	assert.Equal(t, models.JobStatusFailed, ts.waitForJob(t, interrupted[3].ID).Status)
+}
@@ -0,0 +1,289 @@
+package services
+
+import (
+	"Boxed/internal/config"
+	"Boxed/internal/models"
+	"Boxed/internal/repository"
+	"Boxed/internal/storage"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const rotateKeysJobType = "rotate_keys"
+
+var ErrKeyUnavailable = errors.New("encryption key unavailable")
+
+// KeyStatus tells which master keys are configured and how many data keys each of them wraps. A master
+// key that wraps no data key any more can be removed from the configuration.
+type KeyStatus struct {
+	ActiveKey      string           `json:"active_key"`
+	ConfiguredKeys []string         `json:"configured_keys"`
+	DataKeys       map[string]int64 `json:"data_keys"`
+}
+
+// KeyService manages the data keys of boxes with the "encrypted" property. Every box gets a data key
+// of its own, which is only stored wrapped by a master key of the configuration. Rotating re-wraps the
+// data keys with the active master key, the encrypted content stays as it is.
+type KeyService interface {
+	// Encrypted reports whether new content of the box is encrypted
+	Encrypted(box *models.Box) bool
+	// DataKey returns the data key new content of the box is encrypted with, it is created on first use
+	DataKey(box *models.Box) (uint64, []byte, error)
+	// Key returns the data key with the given id, ErrKeyUnavailable when its master key is not configured
+	Key(id uint64) ([]byte, error)
+	// Status reports the master keys and the data keys they wrap
+	Status() (*KeyStatus, error)
+	// RotateAsync starts a job re-wrapping every data key with the active master key
+	RotateAsync() (*models.Job, error)
+}
+
+type KeyServiceImpl struct {
+	dataKeyRepo repository.DataKeyRepository
+	jobService  JobService
+	logService  LogService
+	masterKeys  map[string][]byte
+	activeKey   string
+	keys        map[uint64][]byte
+	keysLock    sync.Mutex
+	createLock  sync.Mutex
+}
+
+// NewKeyService loads the master keys of the configuration, a key that cannot be loaded stops the server
+// rather than leaving content unreadable later on
+func NewKeyService(
+	dataKeyRepo repository.DataKeyRepository,
+	jobService JobService,
+	logService LogService,
+	configuration *config.Configuration,
+) (KeyService, error) {
+	encryption := configuration.Storage.Encryption
+	masterKeys := make(map[string][]byte, len(encryption.Keys))
+	for _, keyConfig := range encryption.Keys {
+		if keyConfig.ID == "" {
+			return nil, errors.New("encryption: every master key needs an id")
+		}
+		if _, ok := masterKeys[keyConfig.ID]; ok {
+			return nil, fmt.Errorf("encryption: master key %q is configured twice", keyConfig.ID)
+		}
+		key, err := loadMasterKey(keyConfig)
+		if err != nil {
+			return nil, fmt.Errorf("encryption: master key %q: %w", keyConfig.ID, err)
+		}
+		masterKeys[keyConfig.ID] = key
+	}
+	activeKey := encryption.ActiveKey
+	if activeKey == "" && len(encryption.Keys) == 1 {
+		activeKey = encryption.Keys[0].ID
+	}
+	if _, ok := masterKeys[activeKey]; activeKey != "" && !ok {
+		return nil, fmt.Errorf("encryption: the active key %q is not configured", activeKey)
+	}
+	if activeKey == "" && len(masterKeys) > 0 {
+		return nil, errors.New("encryption: activeKey has to name one of the master keys")
+	}
+
+	s := &KeyServiceImpl{
+		dataKeyRepo: dataKeyRepo,
+		jobService:  jobService,
+		logService:  logService,
+		masterKeys:  masterKeys,
+		activeKey:   activeKey,
+		keys:        make(map[uint64][]byte),
+	}
+	// Re-wrapping a data key twice does no harm, so an interrupted rotation simply starts over
+	jobService.RegisterHandler(rotateKeysJobType, s.runRotateJob, true)
+	return s, nil
+}
+
+func (s *KeyServiceImpl) Encrypted(box *models.Box) bool {
+	var properties map[string]interface{}
+	if err := json.Unmarshal(box.Properties, &properties); err != nil {
+		return false
+	}
+	switch value := properties["encrypted"].(type) {
+	case bool:
+		return value
+	case string:
+		return strings.EqualFold(value, "true")
+	}
+	return false
+}
+
+func (s *KeyServiceImpl) DataKey(box *models.Box) (uint64, []byte, error) {
+	if s.activeKey == "" {
+		return 0, nil, fmt.Errorf("%w: box %s is encrypted but no master key is configured", ErrKeyUnavailable, box.Name)
+	}
+	s.createLock.Lock()
+	defer s.createLock.Unlock()
+	dataKey, err := s.dataKeyRepo.FindLatestByBoxID(box.ID)
+	if err != nil {
+		return 0, nil, err
+	}
+	if dataKey != nil {
+		key, err := s.Key(uint64(dataKey.ID))
+		return uint64(dataKey.ID), key, err
+	}
+
+	key, err := storage.NewDataKey()
+	if err != nil {
+		return 0, nil, err
+	}
+	wrapped, err := storage.WrapKey(s.masterKeys[s.activeKey], key, dataKeyContext(box.ID))
+	if err != nil {
+		return 0, nil, err
+	}
+	dataKey = &models.DataKey{BoxID: box.ID, MasterKeyID: s.activeKey, WrappedKey: wrapped}
+	if err := s.dataKeyRepo.Create(dataKey); err != nil {
+		return 0, nil, err
+	}
+	s.keysLock.Lock()
+	s.keys[uint64(dataKey.ID)] = key
+	s.keysLock.Unlock()
+	s.logService.Log.WithFields(logrus.Fields{
+		"box":        box.Name,
+		"master_key": s.activeKey,
+	}).Info("Data key created")
+	return uint64(dataKey.ID), key, nil
+}
+
+func (s *KeyServiceImpl) Key(id uint64) ([]byte, error) {
+	s.keysLock.Lock()
+	key, ok := s.keys[id]
+	s.keysLock.Unlock()
+	if ok {
+		return key, nil
+	}
+	dataKey, err := s.dataKeyRepo.FindByID(uint(id))
+	if err != nil {
+		return nil, fmt.Errorf("%w: data key %d not found", ErrKeyUnavailable, id)
+	}
+	key, err = s.unwrap(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	// Rotating re-wraps the data key but keeps it, so it can stay cached
+	s.keysLock.Lock()
+	s.keys[id] = key
+	s.keysLock.Unlock()
+	return key, nil
+}
+
+func (s *KeyServiceImpl) Status() (*KeyStatus, error) {
+	counts, err := s.dataKeyRepo.CountByMasterKey()
+	if err != nil {
+		return nil, err
+	}
+	configured := make([]string, 0, len(s.masterKeys))
+	for id := range s.masterKeys {
+		configured = append(configured, id)
+	}
+	sort.Strings(configured)
+	return &KeyStatus{ActiveKey: s.activeKey, ConfiguredKeys: configured, DataKeys: counts}, nil
+}
+
+func (s *KeyServiceImpl) RotateAsync() (*models.Job, error) {
+	if s.activeKey == "" {
+		return nil, fmt.Errorf("%w: no master key is configured", ErrKeyUnavailable)
+	}
+	return s.jobService.Enqueue(rotateKeysJobType, struct{}{})
+}
+
+func (s *KeyServiceImpl) runRotateJob(ctx context.Context, _ *models.Job, progress *JobProgress) error {
+	if s.activeKey == "" {
+		return fmt.Errorf("%w: no master key is configured", ErrKeyUnavailable)
+	}
+	dataKeys, err := s.dataKeyRepo.FindNotWrappedWith(s.activeKey)
+	if err != nil {
+		return err
+	}
+	progress.AddTotal(int64(len(dataKeys)))
+	var rewrapped, failed int
+	for i := range dataKeys {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		dataKey := &dataKeys[i]
+		if err := s.rewrap(dataKey); err != nil {
+			// The other data keys are still re-wrapped, the job fails at the end
+			progress.AddError(fmt.Errorf("data key %d of box %d: %w", dataKey.ID, dataKey.BoxID, err))
+			failed++
+			continue
+		}
+		rewrapped++
+		progress.AddItems(1)
+	}
+	progress.SetResult(map[string]interface{}{"rewrapped": rewrapped, "failed": failed, "master_key": s.activeKey})
+	s.logService.Log.WithFields(logrus.Fields{
+		"job":        rotateKeysJobType,
+		"rewrapped":  rewrapped,
+		"failed":     failed,
+		"master_key": s.activeKey,
+	}).Info("Data keys rotated")
+	if failed > 0 {
+		return fmt.Errorf("%w: %d data keys could not be re-wrapped", ErrKeyUnavailable, failed)
+	}
+	return nil
+}
+
+// rewrap wraps a data key with the active master key
+func (s *KeyServiceImpl) rewrap(dataKey *models.DataKey) error {
+	key, err := s.unwrap(dataKey)
+	if err != nil {
+		return err
+	}
+	wrapped, err := storage.WrapKey(s.masterKeys[s.activeKey], key, dataKeyContext(dataKey.BoxID))
+	if err != nil {
+		return err
+	}
+	dataKey.MasterKeyID = s.activeKey
+	dataKey.WrappedKey = wrapped
+	return s.dataKeyRepo.Update(dataKey)
+}
+
+func (s *KeyServiceImpl) unwrap(dataKey *models.DataKey) ([]byte, error) {
+	masterKey, ok := s.masterKeys[dataKey.MasterKeyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: data key %d is wrapped with master key %q, which is not configured", ErrKeyUnavailable, dataKey.ID, dataKey.MasterKeyID)
+	}
+	key, err := storage.UnwrapKey(masterKey, dataKey.WrappedKey, dataKeyContext(dataKey.BoxID))
+	if err != nil {
+		return nil, fmt.Errorf("%w: data key %d: %v", ErrKeyUnavailable, dataKey.ID, err)
+	}
+	return key, nil
+}
+
+// dataKeyContext binds a wrapped data key to its box, so it cannot be moved to another one
+func dataKeyContext(boxID uint) []byte {
+	return []byte(fmt.Sprintf("boxed data key of box %d", boxID))
+}
+
+// loadMasterKey decodes the inline key, or the content of the key file when there is none
+func loadMasterKey(keyConfig config.MasterKeyConfig) ([]byte, error) {
+	encoded := keyConfig.Key
+	if encoded == "" {
+		if keyConfig.KeyFile == "" {
+			return nil, errors.New("neither key nor keyFile is set")
+		}
+		content, err := os.ReadFile(keyConfig.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		encoded = string(content)
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("not valid base64: %w", err)
+	}
+	if len(key) != storage.DataKeySize {
+		return nil, fmt.Errorf("has %d bytes, expected %d", len(key), storage.DataKeySize)
+	}
+	return key, nil
+}
@@ -0,0 +1,101 @@
+package services
+
+import (
+	"Boxed/internal/config"
+	"Boxed/internal/models"
+	"Boxed/internal/repository"
+	"bytes"
+	"encoding/base64"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"testing"
+)
+
+func masterKey(id string, fill byte) config.MasterKeyConfig {
+	return config.MasterKeyConfig{ID: id, Key: base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{fill}, 32))}
+}
+
+// restartWithKeys wires the key, job and file services again on the same database and storage, like a
+// restart with another encryption configuration
+func (ts *testServices) restartWithKeys(t *testing.T, activeKey string, keys ...config.MasterKeyConfig) *testServices {
+	configuration := *ts.configuration
+	configuration.Storage.Encryption = config.EncryptionConfig{ActiveKey: activeKey, Keys: keys}
+	restarted := *ts
+	restarted.configuration = &configuration
+	restarted.jobService = NewJobService(repository.NewJobRepository(ts.db), ts.logService, &configuration)
+	var err error
+	restarted.keyService, err = NewKeyService(repository.NewDataKeyRepository(ts.db), restarted.jobService, ts.logService, &configuration)
+	require.NoError(t, err)
+	restarted.fileService = NewFileService(ts.itemService, ts.boxService, ts.blobStore, restarted.keyService, ts.logService, &configuration)
+	return &restarted
+}
+
+func TestKeyService_Rotate(t *testing.T) {
+	configuration := &config.Configuration{}
+	configuration.Storage.Encryption.Keys = []config.MasterKeyConfig{masterKey("old", 1)}
+	ts := setupTestServicesWithConfig(t, configuration)
+	box := ts.createBox(t, "secret", map[string]interface{}{"encrypted": true})
+	file := ts.storeFile(t, box, "plans.txt", "the secret plans")
+
+	raw, err := ts.blobStore.Get(box, file.SHA256)
+	require.NoError(t, err)
+	stored, err := io.ReadAll(raw)
+	assert.NoError(t, raw.Close())
+	require.NoError(t, err)
+	assert.NotContains(t, string(stored), "the secret plans")
+
+	rotated := ts.restartWithKeys(t, "new", masterKey("old", 1), masterKey("new", 2))
+	assert.Equal(t, "the secret plans", rotated.fileContent(t, box, "plans.txt"))
+	job, err := rotated.keyService.RotateAsync()
+	require.NoError(t, err)
+	job = rotated.waitForJob(t, job.ID)
+	assert.Equal(t, models.JobStatusSucceeded, job.Status)
+	assert.Equal(t, int64(1), job.ItemsProcessed)
+	status, err := rotated.keyService.Status()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int64{"new": 1}, status.DataKeys)
+	assert.Equal(t, []string{"new", "old"}, status.ConfiguredKeys)
+
+	// Once rotated, the old master key can go
+	onlyNew := ts.restartWithKeys(t, "new", masterKey("new", 2))
+	assert.Equal(t, "the secret plans", onlyNew.fileContent(t, box, "plans.txt"))
+	onlyNew.storeFile(t, box, "more.txt", "more plans")
+	assert.Equal(t, "more plans", onlyNew.fileContent(t, box, "more.txt"))
+}
+
+func TestKeyService_MissingKey(t *testing.T) {
+	configuration := &config.Configuration{}
+	configuration.Storage.Encryption.Keys = []config.MasterKeyConfig{masterKey("old", 1)}
+	ts := setupTestServicesWithConfig(t, configuration)
+	box := ts.createBox(t, "secret", map[string]interface{}{"encrypted": true})
+	file := ts.storeFile(t, box, "plans.txt", "the secret plans")
+
+	// The master key the data key is wrapped with is gone
+	other := ts.restartWithKeys(t, "other", masterKey("other", 3))
+	_, err := other.fileService.OpenBlob(box, file.SHA256)
+	assert.ErrorIs(t, err, ErrKeyUnavailable)
+	job, err := other.keyService.RotateAsync()
+	require.NoError(t, err)
+	job = other.waitForJob(t, job.ID)
+	assert.Equal(t, models.JobStatusFailed, job.Status)
+	assert.Contains(t, string(job.Errors), `not configured`)
+	status, err := other.keyService.Status()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int64{"old": 1}, status.DataKeys)
+
+	// Without any master key encrypted boxes take no new content
+	none := ts.restartWithKeys(t, "")
+	_, err = none.fileService.CreateFileFromReader(box, "new.txt", bytes.NewReader([]byte("new")), false, "")
+	assert.ErrorIs(t, err, ErrKeyUnavailable)
+	_, err = none.keyService.RotateAsync()
+	assert.ErrorIs(t, err, ErrKeyUnavailable)
+
+	// Keys that cannot be loaded stop the server
+	configuration.Storage.Encryption = config.EncryptionConfig{ActiveKey: "missing", Keys: []config.MasterKeyConfig{masterKey("old", 1)}}
+	_, err = NewKeyService(repository.NewDataKeyRepository(ts.db), ts.jobService, ts.logService, configuration)
+	assert.Error(t, err)
+	configuration.Storage.Encryption = config.EncryptionConfig{Keys: []config.MasterKeyConfig{{ID: "short", Key: "c2hvcnQ="}}}
+	_, err = NewKeyService(repository.NewDataKeyRepository(ts.db), ts.jobService, ts.logService, configuration)
+	assert.Error(t, err)
+}
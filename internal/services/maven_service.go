@@ -0,0 +1,337 @@
+package services
+
+import (
+	"Boxed/internal/dto"
+	"Boxed/internal/helpers"
+	"Boxed/internal/models"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	MavenMetadataFile    = "maven-metadata.xml"
+	mavenSnapshotSuffix  = "-SNAPSHOT"
+	mavenTimestampFormat = "20060102150405"
+)
+
+var (
+	ErrArtifactNotFound = errors.New("artifact not found")
+	ErrInvalidMavenPath = errors.New("invalid maven path")
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+	// checksumExtensions maps the sidecar extensions to the checksum algorithm they carry
+	checksumExtensions = map[string]string{
+		".md5":    "md5",
+		".sha1":   "sha1",
+		".sha256": "sha256",
+		".sha512": "sha512",
+	}
+	mavenTimestampPattern = regexp.MustCompile(`^(\d{8}\.\d{6})-(\d+)(?:-([^.]+))?\.(.+)$`)
+	mavenPlainPattern     = regexp.MustCompile(`^(?:-([^.]+))?\.(.+)$`)
+)
+
+// MavenService maps a box of type maven onto the Maven 2 repository layout
+// groupId/artifactId/version/artifactId-version[-classifier].extension
+type MavenService interface {
+	Deploy(box *models.Box, artifactPath string, body io.Reader) (*dto.ItemGetDTO, error)
+	GetArtifact(box *models.Box, artifactPath string) (*models.Item, error)
+	Metadata(box *models.Box, directory string) ([]byte, error)
+	Checksum(box *models.Box, item *models.Item, algorithm string) (string, error)
+}
+
+type MavenServiceImpl struct {
+	itemService ItemService
+	fileService FileService
+	logService  LogService
+}
+
+func NewMavenService(
+	itemService ItemService,
+	fileService FileService,
+	logService LogService,
+) MavenService {
+	return &MavenServiceImpl{
+		itemService: itemService,
+		fileService: fileService,
+		logService:  logService,
+	}
+}
+
+// SplitChecksumPath separates a checksum sidecar extension from the path of the file it belongs to
+func SplitChecksumPath(filePath string) (string, string) {
+	if algorithm, ok := checksumExtensions[path.Ext(filePath)]; ok {
+		return strings.TrimSuffix(filePath, path.Ext(filePath)), algorithm
+	}
+	return filePath, ""
+}
+
+// Deploy stores an uploaded file. Checksum sidecars are verified against the stored artifact instead
+// of becoming items, uploaded metadata is dropped since the server generates its own.
+// The returned item is nil for those.
+func (s *MavenServiceImpl) Deploy(box *models.Box, artifactPath string, body io.Reader) (*dto.ItemGetDTO, error) {
+	artifactPath = strings.Trim(artifactPath, "/")
+	base, algorithm := SplitChecksumPath(artifactPath)
+	if path.Base(base) == MavenMetadataFile {
+		_, err := io.Copy(io.Discard, body)
+		return nil, err
+	}
+	if len(strings.Split(base, "/")) < 4 || strings.Contains(base, "..") {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidMavenPath, artifactPath)
+	}
+	if algorithm != "" {
+		return nil, s.verifyChecksum(box, base, algorithm, body)
+	}
+
+	item, err := s.fileService.CreateFileFromReader(box, base, body, false, "")
+	if err != nil {
+		return nil, err
+	}
+	s.logService.Log.WithFields(logrus.Fields{
+		"box":  box.Name,
+		"path": base,
+	}).Info("Maven artifact deployed")
+	return item, nil
+}
+
+// verifyChecksum compares an uploaded sidecar with the stored artifact. Sidecars arriving before
+// their artifact cannot be checked and are accepted.
+func (s *MavenServiceImpl) verifyChecksum(box *models.Box, artifactPath string, algorithm string, body io.Reader) error {
+	content, err := io.ReadAll(io.LimitReader(body, 1024))
+	if err != nil {
+		return err
+	}
+	fields := strings.Fields(string(content))
+	if len(fields) == 0 {
+		return fmt.Errorf("%w: empty checksum", ErrChecksumMismatch)
+	}
+
+	item, err := s.itemService.FindByPathAndBoxId(artifactPath, box.ID)
+	if err != nil || item == nil || item.Type != "file" {
+		return err
+	}
+	expected, err := s.Checksum(box, item, algorithm)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(fields[0], expected) {
+		return fmt.Errorf("%w: %s of %s is %s", ErrChecksumMismatch, algorithm, artifactPath, expected)
+	}
+	return nil
+}
+
+func (s *MavenServiceImpl) GetArtifact(box *models.Box, artifactPath string) (*models.Item, error) {
+	item, err := s.itemService.FindByPathAndBoxId(strings.Trim(artifactPath, "/"), box.ID)
+	if err != nil {
+		return nil, err
+	}
+	if item == nil {
+		return nil, fmt.Errorf("%w: %s", ErrArtifactNotFound, artifactPath)
+	}
+	return item, nil
+}
+
+// Checksum returns the digest of a stored file. SHA256 and SHA512 are known from the upload,
+// the legacy algorithms are computed from the blob.
+func (s *MavenServiceImpl) Checksum(box *models.Box, item *models.Item, algorithm string) (string, error) {
+	switch algorithm {
+	case "sha256":
+		return item.SHA256, nil
+	case "sha512":
+		return item.SHA512, nil
+	}
+	blob, err := s.fileService.OpenBlob(box, item.SHA256)
+	if err != nil {
+		return "", fmt.Errorf("content of %s not found: %w", item.Name, err)
+	}
+	defer blob.Close()
+	return helpers.ChecksumOf(algorithm, blob)
+}
+
+type mavenMetadata struct {
+	XMLName      xml.Name        `xml:"metadata"`
+	ModelVersion string          `xml:"modelVersion,attr,omitempty"`
+	GroupID      string          `xml:"groupId"`
+	ArtifactID   string          `xml:"artifactId"`
+	Version      string          `xml:"version,omitempty"`
+	Versioning   mavenVersioning `xml:"versioning"`
+}
+
+type mavenVersioning struct {
+	Latest           string                 `xml:"latest,omitempty"`
+	Release          string                 `xml:"release,omitempty"`
+	Snapshot         *mavenSnapshot         `xml:"snapshot,omitempty"`
+	Versions         *mavenVersions         `xml:"versions,omitempty"`
+	LastUpdated      string                 `xml:"lastUpdated"`
+	SnapshotVersions *mavenSnapshotVersions `xml:"snapshotVersions,omitempty"`
+}
+
+type mavenVersions struct {
+	Version []string `xml:"version"`
+}
+
+type mavenSnapshotVersions struct {
+	SnapshotVersion []mavenSnapshotVersion `xml:"snapshotVersion"`
+}
+
+type mavenSnapshot struct {
+	Timestamp   string `xml:"timestamp"`
+	BuildNumber int    `xml:"buildNumber"`
+}
+
+type mavenSnapshotVersion struct {
+	Classifier string `xml:"classifier,omitempty"`
+	Extension  string `xml:"extension"`
+	Value      string `xml:"value"`
+	Updated    string `xml:"updated"`
+}
+
+// Metadata generates maven-metadata.xml for an artifact directory (groupId/artifactId) listing its
+// versions, or for a SNAPSHOT version directory listing its timestamped builds
+func (s *MavenServiceImpl) Metadata(box *models.Box, directory string) ([]byte, error) {
+	directory = strings.Trim(directory, "/")
+	parts := strings.Split(directory, "/")
+	folder, err := s.itemService.FindByPathAndBoxId(directory, box.ID)
+	if err != nil {
+		return nil, err
+	}
+	if folder == nil || folder.Type != "folder" || len(parts) < 2 {
+		return nil, fmt.Errorf("%w: %s", ErrArtifactNotFound, directory)
+	}
+	children, err := s.itemService.FindItemsByParentID(&folder.ID, box.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var metadata *mavenMetadata
+	if strings.HasSuffix(parts[len(parts)-1], mavenSnapshotSuffix) && len(parts) >= 3 {
+		metadata = snapshotMetadata(parts, children)
+	} else {
+		metadata = artifactMetadata(parts, children)
+	}
+	if metadata == nil {
+		return nil, fmt.Errorf("%w: %s", ErrArtifactNotFound, directory)
+	}
+
+	content, err := xml.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), content...), nil
+}
+
+func artifactMetadata(parts []string, children []models.Item) *mavenMetadata {
+	var versions []string
+	var lastUpdated time.Time
+	for _, child := range children {
+		if child.Type != "folder" {
+			continue
+		}
+		versions = append(versions, child.Name)
+		if child.UpdatedAt.After(lastUpdated) {
+			lastUpdated = child.UpdatedAt
+		}
+	}
+	if len(versions) == 0 {
+		return nil
+	}
+	sort.Slice(versions, func(i, j int) bool { return helpers.CompareMavenVersions(versions[i], versions[j]) < 0 })
+
+	versioning := mavenVersioning{
+		Latest:      versions[len(versions)-1],
+		Versions:    &mavenVersions{Version: versions},
+		LastUpdated: lastUpdated.UTC().Format(mavenTimestampFormat),
+	}
+	for i := len(versions) - 1; i >= 0; i-- {
+		if !strings.HasSuffix(versions[i], mavenSnapshotSuffix) {
+			versioning.Release = versions[i]
+			break
+		}
+	}
+	return &mavenMetadata{
+		GroupID:    strings.Join(parts[:len(parts)-1], "."),
+		ArtifactID: parts[len(parts)-1],
+		Versioning: versioning,
+	}
+}
+
+func snapshotMetadata(parts []string, children []models.Item) *mavenMetadata {
+	version := parts[len(parts)-1]
+	artifactID := parts[len(parts)-2]
+	timestampedPrefix := artifactID + "-" + strings.TrimSuffix(version, mavenSnapshotSuffix) + "-"
+	plainPrefix := artifactID + "-" + version
+
+	var latest *mavenSnapshot
+	var lastUpdated time.Time
+	snapshotVersions := make(map[string]mavenSnapshotVersion)
+	snapshotBuilds := make(map[string]string)
+	for _, child := range children {
+		if child.Type != "file" {
+			continue
+		}
+		var classifier, extension, value, build string
+		if rest, ok := strings.CutPrefix(child.Name, plainPrefix); ok && mavenPlainPattern.MatchString(rest) {
+			// Snapshots deployed without unique versions
+			match := mavenPlainPattern.FindStringSubmatch(rest)
+			classifier, extension, value = match[1], match[2], version
+		} else if rest, ok := strings.CutPrefix(child.Name, timestampedPrefix); ok && mavenTimestampPattern.MatchString(rest) {
+			match := mavenTimestampPattern.FindStringSubmatch(rest)
+			buildNumber, _ := strconv.Atoi(match[2])
+			classifier, extension = match[3], match[4]
+			value = timestampedPrefix[len(artifactID)+1:] + match[1] + "-" + match[2]
+			build = fmt.Sprintf("%s-%08d", match[1], buildNumber)
+			if latest == nil || build > fmt.Sprintf("%s-%08d", latest.Timestamp, latest.BuildNumber) {
+				latest = &mavenSnapshot{Timestamp: match[1], BuildNumber: buildNumber}
+			}
+		} else {
+			continue
+		}
+
+		updated := child.UpdatedAt.UTC()
+		if updated.After(lastUpdated) {
+			lastUpdated = updated
+		}
+		key := classifier + ":" + extension
+		if existing, ok := snapshotBuilds[key]; ok && existing > build {
+			continue
+		}
+		snapshotBuilds[key] = build
+		snapshotVersions[key] = mavenSnapshotVersion{
+			Classifier: classifier,
+			Extension:  extension,
+			Value:      value,
+			Updated:    updated.Format(mavenTimestampFormat),
+		}
+	}
+	if len(snapshotVersions) == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(snapshotVersions))
+	for key := range snapshotVersions {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	versioning := mavenVersioning{
+		Snapshot:         latest,
+		LastUpdated:      lastUpdated.Format(mavenTimestampFormat),
+		SnapshotVersions: &mavenSnapshotVersions{},
+	}
+	for _, key := range keys {
+		versioning.SnapshotVersions.SnapshotVersion = append(versioning.SnapshotVersions.SnapshotVersion, snapshotVersions[key])
+	}
+	return &mavenMetadata{
+		ModelVersion: "1.1.0",
+		GroupID:      strings.Join(parts[:len(parts)-2], "."),
+		ArtifactID:   artifactID,
+		Version:      version,
+		Versioning:   versioning,
+	}
+}
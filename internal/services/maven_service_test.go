@@ -0,0 +1,145 @@
+package services
+
+import (
+	"Boxed/internal/models"
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/xml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func setupTestMaven(t *testing.T) (*testServices, MavenService, *models.Box) {
+	ts := setupTestServices(t)
+	box, err := ts.boxService.CreateBox("releases", nil, filepath.Join(ts.configuration.Storage.Path, "releases"), models.BoxTypeMaven)
+	require.NoError(t, err)
+	return ts, NewMavenService(ts.itemService, ts.fileService, ts.logService), box
+}
+
+func mavenMetadataOf(t *testing.T, maven MavenService, box *models.Box, directory string) mavenMetadata {
+	content, err := maven.Metadata(box, directory)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(content), xml.Header))
+	var metadata mavenMetadata
+	require.NoError(t, xml.Unmarshal(content, &metadata))
+	return metadata
+}
+
+func TestMavenService_DeployAndResolve(t *testing.T) {
+	ts, maven, box := setupTestMaven(t)
+
+	for _, version := range []string{"1.0", "1.10", "1.9.1"} {
+		jar := "com/example/my-lib/" + version + "/my-lib-" + version + ".jar"
+		item, err := maven.Deploy(box, "/"+jar, strings.NewReader("jar "+version))
+		require.NoError(t, err)
+		require.NotNil(t, item)
+		assert.Equal(t, "my-lib-"+version+".jar", item.Name)
+	}
+
+	// The files sit at groupId/artifactId/version in the box
+	artifact, err := maven.GetArtifact(box, "com/example/my-lib/1.9.1/my-lib-1.9.1.jar")
+	require.NoError(t, err)
+	assert.Equal(t, "jar 1.9.1", ts.fileContent(t, box, "com/example/my-lib/1.9.1/my-lib-1.9.1.jar"))
+	sha1sum, err := maven.Checksum(box, artifact, "sha1")
+	require.NoError(t, err)
+	sum := sha1.Sum([]byte("jar 1.9.1"))
+	assert.Equal(t, hex.EncodeToString(sum[:]), sha1sum)
+	_, err = maven.GetArtifact(box, "com/example/my-lib/2.0/my-lib-2.0.jar")
+	assert.ErrorIs(t, err, ErrArtifactNotFound)
+
+	// Versions are ordered the Maven way, not as strings
+	metadata := mavenMetadataOf(t, maven, box, "com/example/my-lib")
+	assert.Equal(t, "com.example", metadata.GroupID)
+	assert.Equal(t, "my-lib", metadata.ArtifactID)
+	assert.Equal(t, []string{"1.0", "1.9.1", "1.10"}, metadata.Versioning.Versions.Version)
+	assert.Equal(t, "1.10", metadata.Versioning.Latest)
+	assert.Equal(t, "1.10", metadata.Versioning.Release)
+
+	// Uploaded metadata is dropped, the server generates its own
+	item, err := maven.Deploy(box, "com/example/my-lib/maven-metadata.xml", strings.NewReader("<metadata/>"))
+	assert.NoError(t, err)
+	assert.Nil(t, item)
+	_, err = ts.fileService.GetFileItem(box, "com/example/my-lib/maven-metadata.xml")
+	assert.Error(t, err)
+
+	_, err = maven.Deploy(box, "my-lib/1.0/my-lib-1.0.jar", strings.NewReader("jar"))
+	assert.ErrorIs(t, err, ErrInvalidMavenPath)
+	_, err = maven.Deploy(box, "com/example/../my-lib/1.0/my-lib-1.0.jar", strings.NewReader("jar"))
+	assert.ErrorIs(t, err, ErrInvalidMavenPath)
+}
+
+func TestMavenService_DeployVerifiesChecksums(t *testing.T) {
+	ts, maven, box := setupTestMaven(t)
+	jar := "com/example/app/1.0/app-1.0.jar"
+
+	// A sidecar ahead of its artifact cannot be checked
+	item, err := maven.Deploy(box, jar+".md5", strings.NewReader("0123"))
+	assert.NoError(t, err)
+	assert.Nil(t, item)
+
+	_, err = maven.Deploy(box, jar, strings.NewReader("app"))
+	require.NoError(t, err)
+	md5sum := md5.Sum([]byte("app"))
+	sha1sum := sha1.Sum([]byte("app"))
+
+	// Sidecars are checked against the stored artifact and never become items
+	_, err = maven.Deploy(box, jar+".md5", strings.NewReader(hex.EncodeToString(md5sum[:])+"  app-1.0.jar\n"))
+	assert.NoError(t, err)
+	_, err = maven.Deploy(box, jar+".sha1", strings.NewReader(strings.ToUpper(hex.EncodeToString(sha1sum[:]))))
+	assert.NoError(t, err)
+	_, err = maven.Deploy(box, jar+".sha1", strings.NewReader("da39a3ee5e6b4b0d3255bfef95601890afd80709"))
+	assert.ErrorIs(t, err, ErrChecksumMismatch)
+	_, err = maven.Deploy(box, jar+".sha256", strings.NewReader(""))
+	assert.ErrorIs(t, err, ErrChecksumMismatch)
+	_, err = ts.fileService.GetFileItem(box, jar+".sha1")
+	assert.Error(t, err)
+}
+
+func TestMavenService_SnapshotMetadata(t *testing.T) {
+	_, maven, box := setupTestMaven(t)
+	directory := "com/example/app/1.0-SNAPSHOT"
+
+	for _, name := range []string{
+		"app-1.0-20260101.120000-1.jar",
+		"app-1.0-20260101.120000-1.pom",
+		"app-1.0-20260102.080000-2.jar",
+		"app-1.0-20260102.080000-2-sources.jar",
+	} {
+		_, err := maven.Deploy(box, directory+"/"+name, strings.NewReader(name))
+		require.NoError(t, err)
+	}
+	_, err := maven.Deploy(box, "com/example/app/0.9/app-0.9.jar", strings.NewReader("release"))
+	require.NoError(t, err)
+
+	// The version directory lists the newest build of every file
+	metadata := mavenMetadataOf(t, maven, box, directory)
+	assert.Equal(t, "1.1.0", metadata.ModelVersion)
+	assert.Equal(t, "com.example", metadata.GroupID)
+	assert.Equal(t, "app", metadata.ArtifactID)
+	assert.Equal(t, "1.0-SNAPSHOT", metadata.Version)
+	require.NotNil(t, metadata.Versioning.Snapshot)
+	assert.Equal(t, "20260102.080000", metadata.Versioning.Snapshot.Timestamp)
+	assert.Equal(t, 2, metadata.Versioning.Snapshot.BuildNumber)
+	values := make(map[string]string)
+	for _, snapshot := range metadata.Versioning.SnapshotVersions.SnapshotVersion {
+		values[snapshot.Classifier+":"+snapshot.Extension] = snapshot.Value
+	}
+	assert.Equal(t, map[string]string{
+		":jar":        "1.0-20260102.080000-2",
+		":pom":        "1.0-20260101.120000-1",
+		"sources:jar": "1.0-20260102.080000-2",
+	}, values)
+
+	// A snapshot is never the release
+	metadata = mavenMetadataOf(t, maven, box, "com/example/app")
+	assert.Equal(t, []string{"0.9", "1.0-SNAPSHOT"}, metadata.Versioning.Versions.Version)
+	assert.Equal(t, "1.0-SNAPSHOT", metadata.Versioning.Latest)
+	assert.Equal(t, "0.9", metadata.Versioning.Release)
+
+	_, err = maven.Metadata(box, "com/example/missing")
+	assert.ErrorIs(t, err, ErrArtifactNotFound)
+}
@@ -2,138 +2,502 @@ package services
 
 import (
 	"Boxed/internal/config"
+	"Boxed/internal/dto"
+	"Boxed/internal/helpers"
 	"Boxed/internal/models"
+	"context"
+	"encoding/json"
 	"errors"
-	"io"
-	"os"
-	"path/filepath"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"path"
 	"strings"
-	"time"
 )
 
-type MoverService interface{}
+var (
+	ErrBoxNotFound       = errors.New("box not found")
+	ErrSourceNotFound    = errors.New("source item not found")
+	ErrDestinationExists = errors.New("destination already exists")
+	ErrInvalidMovePath   = errors.New("invalid path")
+)
+
+const (
+	copyJobType = "copy"
+	moveJobType = "move"
+)
+
+type MoverService interface {
+	CopyItem(sourcePath string, destinationPath string, force bool, properties string) (*dto.ItemGetDTO, error)
+	MoveItem(sourcePath string, destinationPath string, force bool) (*dto.ItemGetDTO, error)
+	CopyItemAsync(sourcePath string, destinationPath string, force bool, properties string) (*models.Job, error)
+	MoveItemAsync(sourcePath string, destinationPath string, force bool) (*models.Job, error)
+}
 
 type MoverServiceImpl struct {
 	itemService   ItemService
 	boxService    BoxService
+	fileService   FileService
+	jobService    JobService
 	configuration config.Configuration
 	logService    LogService
 }
 
-func NewMoverServiceImpl(
+// moverJobPayload is the persisted payload of copy and move jobs
+type moverJobPayload struct {
+	From       string `json:"from"`
+	To         string `json:"to"`
+	Force      bool   `json:"force"`
+	Properties string `json:"properties,omitempty"`
+}
+
+func NewMoverService(
 	itemService ItemService,
 	boxService BoxService,
-	configuration config.Configuration,
+	fileService FileService,
+	jobService JobService,
 	logService LogService,
-) *MoverServiceImpl {
-	return &MoverServiceImpl{
+	configuration *config.Configuration,
+) MoverService {
+	m := &MoverServiceImpl{
 		itemService:   itemService,
 		boxService:    boxService,
-		configuration: configuration,
+		fileService:   fileService,
+		jobService:    jobService,
+		configuration: *configuration,
 		logService:    logService,
 	}
+	// A half finished copy or move cannot be told apart from a conflict, so they are not resumed
+	jobService.RegisterHandler(copyJobType, m.runCopyJob, false)
+	jobService.RegisterHandler(moveJobType, m.runMoveJob, false)
+	return m
 }
 
-type ProgressWriter struct {
-	Writer       io.Writer
-	BytesWritten int64
-	ProgressChan chan int64
+func (m *MoverServiceImpl) CopyItemAsync(sourcePath string, destinationPath string, force bool, properties string) (*models.Job, error) {
+	return m.jobService.Enqueue(copyJobType, moverJobPayload{From: sourcePath, To: destinationPath, Force: force, Properties: properties})
 }
 
-func (pw *ProgressWriter) Write(p []byte) (int, error) {
-	n, err := pw.Writer.Write(p)
-	if err != nil {
-		return n, err
+func (m *MoverServiceImpl) MoveItemAsync(sourcePath string, destinationPath string, force bool) (*models.Job, error) {
+	return m.jobService.Enqueue(moveJobType, moverJobPayload{From: sourcePath, To: destinationPath, Force: force})
+}
+
+func (m *MoverServiceImpl) runCopyJob(ctx context.Context, job *models.Job, progress *JobProgress) error {
+	var payload moverJobPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return err
 	}
-	pw.BytesWritten += int64(n)
-	if pw.ProgressChan != nil {
-		pw.ProgressChan <- pw.BytesWritten
+	item, err := m.copyItem(ctx, progress, payload.From, payload.To, payload.Force, payload.Properties)
+	if err != nil {
+		return err
 	}
-	return n, nil
+	progress.SetResult(item)
+	return nil
 }
 
-func (m *MoverServiceImpl) CopyItem(sourcePath string, destinationPath string) error {
-	item, box, err := m.getItemAndBox(sourcePath)
+func (m *MoverServiceImpl) runMoveJob(ctx context.Context, job *models.Job, progress *JobProgress) error {
+	var payload moverJobPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return err
+	}
+	item, err := m.moveItem(ctx, progress, payload.From, payload.To, payload.Force)
 	if err != nil {
 		return err
 	}
+	progress.SetResult(item)
+	return nil
+}
+
+// CopyItem copies a file or a whole folder subtree. Paths are given as "box/path/to/item".
+// Since blobs are content addressed only database rows are added, blobs are shared.
+// A destination ending with "/" copies the item into that folder keeping its name.
+func (m *MoverServiceImpl) CopyItem(sourcePath string, destinationPath string, force bool, properties string) (*dto.ItemGetDTO, error) {
+	return m.copyItem(context.Background(), nil, sourcePath, destinationPath, force, properties)
+}
 
-	sourceDir := filepath.Join(m.configuration.Storage.Path, box.Name, item.Path)
-	srcItem, err := os.Open(sourceDir)
+func (m *MoverServiceImpl) copyItem(
+	ctx context.Context,
+	progress *JobProgress,
+	sourcePath string,
+	destinationPath string,
+	force bool,
+	properties string,
+) (*dto.ItemGetDTO, error) {
+	item, box, sourceItemPath, err := m.getItemAndBox(sourcePath)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	destinationBox, itemPath, err := m.resolveDestination(destinationPath, item.Name)
+	if err != nil {
+		return nil, err
+	}
+	if box.ID == destinationBox.ID && isSubPath(itemPath, sourceItemPath) {
+		return nil, fmt.Errorf("%w: cannot copy %s into itself", ErrInvalidMovePath, sourceItemPath)
+	}
+
+	var propertiesOverride []byte
+	if properties != "" {
+		propertiesOverride, err = helpers.PropertiesToJSON(properties)
+		if err != nil {
+			return nil, err
+		}
 	}
-	defer srcItem.Close()
 
-	dstItem, err := os.Create(destinationPath)
+	parentID, err := m.ensureParent(destinationBox, itemPath)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer dstItem.Close()
 
-	progressChan := make(chan int64)
-	defer close(progressChan)
+	copyLog := m.logService.Log.WithFields(logrus.Fields{
+		"job":         "copy",
+		"source":      sourcePath,
+		"destination": destinationPath,
+	})
+	copyLog.Debug("Copying item")
+	progress.AddTotal(1)
+	copied, err := m.copyTree(ctx, progress, item, box, destinationBox, parentID, itemPath, force, propertiesOverride)
+	if err != nil {
+		copyLog.WithError(err).Error("Failed to copy item")
+		return nil, err
+	}
+	copyLog.Info("Item copied")
+	return m.itemService.GetItemByID(copied.ID)
+}
 
-	go func() {
-		ticker := time.NewTicker(10 * time.Second)
-		defer ticker.Stop()
+func (m *MoverServiceImpl) copyTree(
+	ctx context.Context,
+	progress *JobProgress,
+	source *models.Item,
+	sourceBox *models.Box,
+	destinationBox *models.Box,
+	parentID *uint,
+	itemPath string,
+	force bool,
+	propertiesOverride []byte,
+) (*models.Item, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	existing, err := m.itemService.FindByPathAndBoxId(itemPath, destinationBox.ID)
+	if err != nil {
+		return nil, err
+	}
+	existing, err = m.resolveConflict(existing, source, destinationBox, itemPath, force)
+	if err != nil {
+		return nil, err
+	}
 
-		for {
-			select {
-			case <-ticker.C:
-				progress := <-progressChan
-				m.logService.Log.Info(item.ID, progress)
+	if source.Type == "folder" {
+		folder := existing
+		if folder == nil {
+			folder = &models.Item{
+				Name:       path.Base(itemPath),
+				Type:       "folder",
+				BoxID:      destinationBox.ID,
+				ParentID:   parentID,
+				Properties: source.Properties,
 			}
+			if err := m.itemService.Create(folder); err != nil {
+				return nil, err
+			}
+		}
+		progress.AddItems(1)
+		children, err := m.itemService.FindItemsByParentID(&source.ID, sourceBox.ID)
+		if err != nil {
+			return nil, err
 		}
-	}()
+		progress.AddTotal(int64(len(children)))
+		for i := range children {
+			childPath := itemPath + "/" + children[i].Name
+			if _, err := m.copyTree(ctx, progress, &children[i], sourceBox, destinationBox, &folder.ID, childPath, force, propertiesOverride); err != nil {
+				return nil, err
+			}
+		}
+		return folder, nil
+	}
 
-	pw := &ProgressWriter{
-		Writer:       dstItem,
-		ProgressChan: progressChan,
+	if err := m.fileService.EnsureBlob(sourceBox, destinationBox, source.SHA256); err != nil {
+		return nil, err
+	}
+	properties := source.Properties
+	if propertiesOverride != nil {
+		properties = propertiesOverride
+	}
+
+	if existing != nil {
+		existing.Size = source.Size
+		existing.SHA256 = source.SHA256
+		existing.SHA512 = source.SHA512
+		existing.Properties = properties
+		if err := m.itemService.UpdateItem(existing); err != nil {
+			return nil, err
+		}
+		progress.AddItems(1)
+		progress.AddBytes(source.Size)
+		return existing, nil
 	}
 
-	_, err = io.Copy(pw, srcItem)
+	name := path.Base(itemPath)
+	newFile := &models.Item{
+		Name:       name,
+		Type:       "file",
+		Extension:  helpers.GetFileType(name),
+		BoxID:      destinationBox.ID,
+		ParentID:   parentID,
+		Size:       source.Size,
+		SHA256:     source.SHA256,
+		SHA512:     source.SHA512,
+		Properties: properties,
+	}
+	if err := m.itemService.Create(newFile); err != nil {
+		return nil, err
+	}
+	progress.AddItems(1)
+	progress.AddBytes(source.Size)
+	return newFile, nil
+}
+
+// MoveItem moves a file or folder subtree, within a box or across boxes.
+// Moving onto an existing folder with force merges the two folders.
+func (m *MoverServiceImpl) MoveItem(sourcePath string, destinationPath string, force bool) (*dto.ItemGetDTO, error) {
+	return m.moveItem(context.Background(), nil, sourcePath, destinationPath, force)
+}
+
+func (m *MoverServiceImpl) moveItem(
+	ctx context.Context,
+	progress *JobProgress,
+	sourcePath string,
+	destinationPath string,
+	force bool,
+) (*dto.ItemGetDTO, error) {
+	item, box, sourceItemPath, err := m.getItemAndBox(sourcePath)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	destinationBox, itemPath, err := m.resolveDestination(destinationPath, item.Name)
+	if err != nil {
+		return nil, err
+	}
+	if box.ID == destinationBox.ID && isSubPath(itemPath, sourceItemPath) {
+		if isSubPath(sourceItemPath, itemPath) {
+			return m.itemService.GetItemByID(item.ID)
+		}
+		return nil, fmt.Errorf("%w: cannot move %s into itself", ErrInvalidMovePath, sourceItemPath)
 	}
 
-	m.logService.Log.Info(item.ID, pw.BytesWritten)
-	return nil
+	moveLog := m.logService.Log.WithFields(logrus.Fields{
+		"job":         "move",
+		"source":      sourcePath,
+		"destination": destinationPath,
+	})
+	moveLog.Debug("Moving item")
+	progress.AddTotal(1)
+	moved, err := m.moveTree(ctx, progress, item, box, destinationBox, itemPath, force)
+	if err != nil {
+		moveLog.WithError(err).Error("Failed to move item")
+		return nil, err
+	}
+	moveLog.Info("Item moved")
+	return m.itemService.GetItemByID(moved.ID)
 }
 
-func (m *MoverServiceImpl) MoveItem(sourcePath string, destinationPath string) error {
-	item, _, err := m.getItemAndBox(sourcePath)
+func (m *MoverServiceImpl) moveTree(
+	ctx context.Context,
+	progress *JobProgress,
+	source *models.Item,
+	sourceBox *models.Box,
+	destinationBox *models.Box,
+	itemPath string,
+	force bool,
+) (*models.Item, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	existing, err := m.itemService.FindByPathAndBoxId(itemPath, destinationBox.ID)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if existing != nil && existing.Type == "folder" && source.Type == "folder" {
+		if !force {
+			return nil, fmt.Errorf("%w: %s", ErrDestinationExists, itemPath)
+		}
+		// Merge the folders by moving every child and dropping the emptied source folder
+		children, err := m.itemService.FindItemsByParentID(&source.ID, sourceBox.ID)
+		if err != nil {
+			return nil, err
+		}
+		progress.AddTotal(int64(len(children)))
+		for i := range children {
+			if _, err := m.moveTree(ctx, progress, &children[i], sourceBox, destinationBox, itemPath+"/"+children[i].Name, force); err != nil {
+				return nil, err
+			}
+		}
+		// Only the folder itself goes, HardDelete would take every item at a path below it
+		if err := m.itemService.PurgeItem(source); err != nil {
+			return nil, err
+		}
+		return existing, nil
 	}
-	if item.Type == "folder" {
-		// TODO: Move folder
+	if _, err := m.resolveConflict(existing, source, destinationBox, itemPath, force); err != nil {
+		return nil, err
+	}
+	if existing != nil && existing.Type == "file" && source.Type == "file" {
+		// The existing file is replaced by the moved one
+		if err := m.fileService.DeleteItemOnDisk(*existing, destinationBox); err != nil {
+			return nil, err
+		}
+	}
+
+	parentID, err := m.ensureParent(destinationBox, itemPath)
+	if err != nil {
+		return nil, err
+	}
+	if sourceBox.ID != destinationBox.ID {
+		if err := m.ensureSubtreeBlobs(source, sourceBox, destinationBox); err != nil {
+			return nil, err
+		}
 	}
+	if err := m.itemService.MoveItem(source, parentID, destinationBox.ID, path.Base(itemPath)); err != nil {
+		return nil, err
+	}
+	progress.AddItems(1)
+	progress.AddBytes(source.Size)
+	return source, nil
+}
+
+// resolveConflict applies the force policy to an item occupying the destination path.
+// Items of the same type are kept so they can be updated or merged, mismatching types are removed.
+func (m *MoverServiceImpl) resolveConflict(
+	existing *models.Item,
+	source *models.Item,
+	destinationBox *models.Box,
+	itemPath string,
+	force bool,
+) (*models.Item, error) {
+	if existing == nil {
+		return nil, nil
+	}
+	if !force {
+		return nil, fmt.Errorf("%w: %s", ErrDestinationExists, itemPath)
+	}
+	if existing.Type == source.Type {
+		return existing, nil
+	}
+	if err := m.fileService.DeleteItemOnDisk(*existing, destinationBox); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func (m *MoverServiceImpl) ensureSubtreeBlobs(item *models.Item, sourceBox *models.Box, destinationBox *models.Box) error {
 	if item.Type == "file" {
-		// TODO: Move file
+		return m.fileService.EnsureBlob(sourceBox, destinationBox, item.SHA256)
+	}
+	descendants, err := m.itemService.GetAllDescendants(item.ID, -1)
+	if err != nil {
+		return err
+	}
+	for i := range descendants {
+		if descendants[i].Type != "file" {
+			continue
+		}
+		if err := m.fileService.EnsureBlob(sourceBox, destinationBox, descendants[i].SHA256); err != nil {
+			return err
+		}
 	}
-	// TODO: Add moving job to database
 	return nil
 }
 
-func (m *MoverServiceImpl) getItemAndBox(sourcePath string) (*models.Item, *models.Box, error) {
-	cleanSource := filepath.Clean(sourcePath)
-	boxAndItemPath := strings.SplitN(cleanSource, string(filepath.Separator), 2)
-	if boxName := boxAndItemPath[0]; boxName != "" {
-		return nil, nil, errors.New("invalid path: top-level directory (boxName) is missing")
+// ensureParent creates the folders leading up to itemPath and returns the ID of the direct parent
+func (m *MoverServiceImpl) ensureParent(box *models.Box, itemPath string) (*uint, error) {
+	parentPath := path.Dir(itemPath)
+	if parentPath == "." || parentPath == "/" {
+		return nil, nil
+	}
+	parent, err := m.fileService.CreateFileStructure(box, parentPath, nil, false, "")
+	if err != nil {
+		return nil, err
+	}
+	if parent.Type != "folder" {
+		return nil, fmt.Errorf("%w: %s is not a folder", ErrInvalidMovePath, parentPath)
+	}
+	return &parent.ID, nil
+}
+
+// resolveDestination splits "box/path" into the destination box and item path.
+// When the destination names a folder (trailing slash or box root) the source name is appended.
+func (m *MoverServiceImpl) resolveDestination(destinationPath string, sourceName string) (*models.Box, string, error) {
+	intoFolder := strings.HasSuffix(destinationPath, "/")
+	boxName, itemPath, err := splitBoxPath(destinationPath)
+	if err != nil {
+		return nil, "", err
 	}
-	if itemPath := boxAndItemPath[1]; itemPath != "" {
-		return nil, nil, errors.New("invalid path: path to item is missing")
+	if itemPath == "" {
+		itemPath = sourceName
+	} else if intoFolder {
+		itemPath = itemPath + "/" + sourceName
 	}
-	boxName := boxAndItemPath[0]
-	itemPath := boxAndItemPath[1]
 	box, err := m.boxService.GetBoxByPath(boxName)
 	if err != nil {
-		return nil, nil, err
+		return nil, "", err
+	}
+	if box == nil {
+		return nil, "", fmt.Errorf("%w: %s", ErrBoxNotFound, boxName)
+	}
+	return box, itemPath, nil
+}
+
+// getItemAndBox looks up the item of "box/path" and returns it with its box and its path in the box
+func (m *MoverServiceImpl) getItemAndBox(sourcePath string) (*models.Item, *models.Box, string, error) {
+	boxName, itemPath, err := splitBoxPath(sourcePath)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	if itemPath == "" {
+		return nil, nil, "", fmt.Errorf("%w: path to item is missing", ErrInvalidMovePath)
+	}
+	box, err := m.boxService.GetBoxByPath(boxName)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	if box == nil {
+		return nil, nil, "", fmt.Errorf("%w: %s", ErrBoxNotFound, boxName)
 	}
 	item, err := m.itemService.FindByPathAndBoxId(itemPath, box.ID)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, "", err
+	}
+	if item == nil {
+		return nil, nil, "", fmt.Errorf("%w: %s", ErrSourceNotFound, sourcePath)
+	}
+	return item, box, itemPath, nil
+}
+
+// splitBoxPath splits "box/path/to/item" into the box name and the item path
+func splitBoxPath(fullPath string) (string, string, error) {
+	cleanPath := strings.Trim(path.Clean("/"+fullPath), "/")
+	if strings.Contains(fullPath, "..") {
+		return "", "", fmt.Errorf("%w: %s", ErrInvalidMovePath, fullPath)
+	}
+	boxAndItemPath := strings.SplitN(cleanPath, "/", 2)
+	if boxAndItemPath[0] == "" {
+		return "", "", fmt.Errorf("%w: top-level directory (boxName) is missing", ErrInvalidMovePath)
+	}
+	if len(boxAndItemPath) == 1 {
+		return boxAndItemPath[0], "", nil
+	}
+	return boxAndItemPath[0], boxAndItemPath[1], nil
+}
+
+// isSubPath reports whether itemPath equals parentPath or lies beneath it, both are user paths
+func isSubPath(itemPath string, parentPath string) bool {
+	itemSegments := strings.Split(itemPath, "/")
+	parentSegments := strings.Split(parentPath, "/")
+	if len(itemSegments) < len(parentSegments) {
+		return false
+	}
+	for i := range parentSegments {
+		if itemSegments[i] != parentSegments[i] {
+			return false
+		}
 	}
-	return item, box, nil
+	return true
 }
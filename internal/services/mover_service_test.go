@@ -0,0 +1,162 @@
+package services
+
+import (
+	"Boxed/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func setupTestMover(t *testing.T) (*testServices, MoverService) {
+	ts := setupTestServices(t)
+	mover := NewMoverService(ts.itemService, ts.boxService, ts.fileService, ts.jobService, ts.logService, ts.configuration)
+	return ts, mover
+}
+
+func (ts *testServices) findItem(t *testing.T, box *models.Box, itemPath string) *models.Item {
+	item, err := ts.itemService.FindByPathAndBoxId(itemPath, box.ID)
+	require.NoError(t, err)
+	return item
+}
+
+// waitForJob polls the job until it finished
+func (ts *testServices) waitForJob(t *testing.T, id uint) *models.Job {
+	var job *models.Job
+	require.Eventually(t, func() bool {
+		var err error
+		job, err = ts.jobService.GetJob(id)
+		require.NoError(t, err)
+		return job.IsFinished()
+	}, 5*time.Second, 10*time.Millisecond)
+	return job
+}
+
+func TestMoverService_CopyItem(t *testing.T) {
+	ts, mover := setupTestMover(t)
+	source := ts.createBox(t, "source", nil)
+	destination := ts.createBox(t, "destination", nil)
+	file := ts.storeFile(t, source, "docs/api/index.md", "index")
+	ts.storeFile(t, source, "docs/readme.md", "readme")
+
+	copied, err := mover.CopyItem("source/docs", "destination/backup/", false, "")
+	assert.NoError(t, err)
+	assert.Equal(t, "docs", copied.Name)
+
+	copiedFile := ts.findItem(t, destination, "backup/docs/api/index.md")
+	require.NotNil(t, copiedFile)
+	assert.Equal(t, file.SHA256, copiedFile.SHA256)
+	assert.NotNil(t, ts.findItem(t, destination, "backup/docs/readme.md"))
+	assert.NotNil(t, ts.findItem(t, source, "docs/api/index.md"))
+	// The content is stored for the destination box too
+	assert.True(t, ts.blobExists(t, destination, file.SHA256))
+
+	// Copying again needs force to overwrite
+	_, err = mover.CopyItem("source/docs", "destination/backup/", false, "")
+	assert.ErrorIs(t, err, ErrDestinationExists)
+	_, err = mover.CopyItem("source/docs", "destination/backup/", true, "")
+	assert.NoError(t, err)
+}
+
+func TestMoverService_CopyIntoItself(t *testing.T) {
+	ts, mover := setupTestMover(t)
+	box := ts.createBox(t, "box", nil)
+	ts.storeFile(t, box, "my_dir/sub_dir/file.txt", "content")
+
+	// The stored path of the folder reads my-dir/sub-dir, the check must not be fooled by it
+	_, err := mover.CopyItem("box/my_dir/sub_dir", "box/my_dir/sub_dir/inner/", false, "")
+	assert.ErrorIs(t, err, ErrInvalidMovePath)
+	_, err = mover.MoveItem("box/my_dir/sub_dir", "box/my_dir/sub_dir/inner/", false)
+	assert.ErrorIs(t, err, ErrInvalidMovePath)
+	_, err = mover.MoveItem("box/my_dir", "box/my_dir/sub_dir/", false)
+	assert.ErrorIs(t, err, ErrInvalidMovePath)
+
+	// Moving an item onto itself changes nothing
+	moved, err := mover.MoveItem("box/my_dir/sub_dir", "box/my_dir/sub_dir", false)
+	assert.NoError(t, err)
+	assert.Equal(t, "sub_dir", moved.Name)
+	assert.NotNil(t, ts.findItem(t, box, "my_dir/sub_dir/file.txt"))
+}
+
+func TestMoverService_MoveItem(t *testing.T) {
+	ts, mover := setupTestMover(t)
+	source := ts.createBox(t, "source", nil)
+	destination := ts.createBox(t, "destination", nil)
+	file := ts.storeFile(t, source, "docs/index.md", "index")
+
+	moved, err := mover.MoveItem("source/docs", "destination/manuals", false)
+	assert.NoError(t, err)
+	assert.Equal(t, "manuals", moved.Name)
+
+	movedFile := ts.findItem(t, destination, "manuals/index.md")
+	require.NotNil(t, movedFile)
+	assert.Equal(t, file.ID, movedFile.ID)
+	assert.Nil(t, ts.findItem(t, source, "docs"))
+	assert.Nil(t, ts.findItem(t, source, "docs/index.md"))
+	assert.True(t, ts.blobExists(t, destination, file.SHA256))
+
+	_, err = mover.MoveItem("source/docs", "destination/manuals", false)
+	assert.ErrorIs(t, err, ErrSourceNotFound)
+}
+
+func TestMoverService_MoveMergesFolders(t *testing.T) {
+	ts, mover := setupTestMover(t)
+	box := ts.createBox(t, "box", nil)
+	other := ts.createBox(t, "other", nil)
+	ts.storeFile(t, box, "docs/old.md", "old")
+	ts.storeFile(t, box, "incoming/docs/new.md", "new")
+	// The other box has a folder at the same path as the merged one
+	kept := ts.storeFile(t, other, "incoming/docs/kept.md", "kept")
+
+	_, err := mover.MoveItem("box/incoming/docs", "box/docs", false)
+	assert.ErrorIs(t, err, ErrDestinationExists)
+
+	merged, err := mover.MoveItem("box/incoming/docs", "box/docs", true)
+	assert.NoError(t, err)
+	assert.Equal(t, "docs", merged.Name)
+	assert.NotNil(t, ts.findItem(t, box, "docs/old.md"))
+	assert.NotNil(t, ts.findItem(t, box, "docs/new.md"))
+	assert.Nil(t, ts.findItem(t, box, "incoming/docs"))
+
+	keptItem := ts.findItem(t, other, "incoming/docs/kept.md")
+	require.NotNil(t, keptItem)
+	assert.Equal(t, kept.ID, keptItem.ID)
+	assert.NotNil(t, ts.findItem(t, other, "incoming/docs"))
+}
+
+func TestMoverService_MoveReplacesFile(t *testing.T) {
+	ts, mover := setupTestMover(t)
+	box := ts.createBox(t, "box", nil)
+	replaced := ts.storeFile(t, box, "current.txt", "current")
+	next := ts.storeFile(t, box, "next.txt", "next")
+
+	_, err := mover.MoveItem("box/next.txt", "box/current.txt", false)
+	assert.ErrorIs(t, err, ErrDestinationExists)
+
+	moved, err := mover.MoveItem("box/next.txt", "box/current.txt", true)
+	assert.NoError(t, err)
+	assert.Equal(t, next.ID, moved.ID)
+	assert.Equal(t, next.SHA256, moved.SHA256)
+	// Nothing references the content of the replaced file any more
+	assert.False(t, ts.blobExists(t, box, replaced.SHA256))
+}
+
+func TestMoverService_CopyItemAsync(t *testing.T) {
+	ts, mover := setupTestMover(t)
+	box := ts.createBox(t, "box", nil)
+	ts.storeFile(t, box, "docs/a.md", "a")
+	ts.storeFile(t, box, "docs/b.md", "b")
+
+	job, err := mover.CopyItemAsync("box/docs", "box/copy", false, "")
+	require.NoError(t, err)
+	job = ts.waitForJob(t, job.ID)
+	assert.Equal(t, models.JobStatusSucceeded, job.Status)
+	assert.Equal(t, int64(3), job.ItemsProcessed)
+	assert.NotNil(t, ts.findItem(t, box, "copy/b.md"))
+
+	job, err = mover.MoveItemAsync("box/missing", "box/elsewhere", false)
+	require.NoError(t, err)
+	job = ts.waitForJob(t, job.ID)
+	assert.Equal(t, models.JobStatusFailed, job.Status)
+	assert.Contains(t, job.Error, ErrSourceNotFound.Error())
+}
@@ -0,0 +1,349 @@
+package services
+
+import (
+	"Boxed/internal/helpers"
+	"Boxed/internal/models"
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	ErrPackageNotFound     = errors.New("package not found")
+	ErrInvalidPackage      = errors.New("invalid package")
+	ErrVersionExists       = errors.New("version already exists")
+	npmPackageNamePattern  = regexp.MustCompile(`^(@[a-z0-9-~][a-z0-9-._~]*/)?[a-z0-9-~][a-z0-9-._~]*$`)
+	npmLatestTag           = "latest"
+	npmMaxPublishBodyBytes = int64(1 << 30)
+)
+
+// NpmPackument is the package document npm reads for install and view
+type NpmPackument struct {
+	ID          string                     `json:"_id"`
+	Name        string                     `json:"name"`
+	Description string                     `json:"description,omitempty"`
+	DistTags    map[string]string          `json:"dist-tags"`
+	Versions    map[string]json.RawMessage `json:"versions"`
+	Time        map[string]string          `json:"time"`
+}
+
+// NpmService implements the npm registry protocol on boxes of type npm. Every package is a folder
+// holding its tarballs. The version manifests and dist-tags live in the item properties, so packages
+// can be found through the item search, e.g. properties.keywords eq "cli".
+type NpmService interface {
+	Packument(box *models.Box, name string, baseURL string) (*NpmPackument, error)
+	Publish(box *models.Box, name string, body io.Reader) error
+	Tarball(box *models.Box, name string, filename string) (*models.Item, error)
+	DistTags(box *models.Box, name string) (map[string]string, error)
+	SetDistTag(box *models.Box, name string, tag string, version string) error
+	RemoveDistTag(box *models.Box, name string, tag string) error
+}
+
+type NpmServiceImpl struct {
+	itemService ItemService
+	fileService FileService
+	logService  LogService
+}
+
+func NewNpmService(
+	itemService ItemService,
+	fileService FileService,
+	logService LogService,
+) NpmService {
+	return &NpmServiceImpl{
+		itemService: itemService,
+		fileService: fileService,
+		logService:  logService,
+	}
+}
+
+type npmPublishRequest struct {
+	Name        string                            `json:"name"`
+	DistTags    map[string]string                 `json:"dist-tags"`
+	Versions    map[string]map[string]interface{} `json:"versions"`
+	Attachments map[string]npmAttachment          `json:"_attachments"`
+}
+
+type npmAttachment struct {
+	Data   string `json:"data"`
+	Length int64  `json:"length"`
+}
+
+func (s *NpmServiceImpl) Packument(box *models.Box, name string, baseURL string) (*NpmPackument, error) {
+	folder, err := s.packageFolder(box, name)
+	if err != nil {
+		return nil, err
+	}
+	children, err := s.itemService.FindItemsByParentID(&folder.ID, box.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	packument := &NpmPackument{
+		ID:       name,
+		Name:     name,
+		DistTags: npmDistTags(folder),
+		Versions: make(map[string]json.RawMessage),
+		Time:     make(map[string]string),
+	}
+	var versions []string
+	for i := range children {
+		version, manifest, err := npmVersionManifest(&children[i], name, baseURL+"/"+name+"/-/"+children[i].Name)
+		if err != nil || version == "" {
+			continue
+		}
+		packument.Versions[version] = manifest
+		packument.Time[version] = children[i].CreatedAt.UTC().Format(time.RFC3339)
+		versions = append(versions, version)
+	}
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrPackageNotFound, name)
+	}
+	sort.Slice(versions, func(i, j int) bool { return helpers.CompareSemver(versions[i], versions[j]) < 0 })
+	if _, ok := packument.DistTags[npmLatestTag]; !ok {
+		packument.DistTags[npmLatestTag] = versions[len(versions)-1]
+	}
+	packument.Time["created"] = folder.CreatedAt.UTC().Format(time.RFC3339)
+	packument.Time["modified"] = folder.UpdatedAt.UTC().Format(time.RFC3339)
+
+	var latest struct {
+		Description string `json:"description"`
+	}
+	_ = json.Unmarshal(packument.Versions[packument.DistTags[npmLatestTag]], &latest)
+	packument.Description = latest.Description
+	return packument, nil
+}
+
+// npmVersionManifest rebuilds the manifest of a tarball item with a dist section pointing at this server
+func npmVersionManifest(item *models.Item, name string, tarballURL string) (string, json.RawMessage, error) {
+	properties := helpers.PropertiesFromJSON(item.Properties)
+	if item.Type != "file" || len(properties["manifest"]) == 0 || len(properties["version"]) == 0 {
+		return "", nil, nil
+	}
+	var manifest map[string]interface{}
+	if err := json.Unmarshal([]byte(properties["manifest"][0]), &manifest); err != nil {
+		return "", nil, err
+	}
+	sha512sum, err := hex.DecodeString(item.SHA512)
+	if err != nil {
+		return "", nil, err
+	}
+	dist := map[string]interface{}{
+		"tarball":   tarballURL,
+		"integrity": "sha512-" + base64.StdEncoding.EncodeToString(sha512sum),
+	}
+	if len(properties["shasum"]) > 0 {
+		dist["shasum"] = properties["shasum"][0]
+	}
+	manifest["dist"] = dist
+	manifest["_id"] = name + "@" + properties["version"][0]
+	encoded, err := json.Marshal(manifest)
+	return properties["version"][0], encoded, err
+}
+
+// Publish stores the tarballs attached to an npm publish request. Published versions are immutable.
+func (s *NpmServiceImpl) Publish(box *models.Box, name string, body io.Reader) error {
+	if !npmPackageNamePattern.MatchString(name) {
+		return fmt.Errorf("%w: invalid name %q", ErrInvalidPackage, name)
+	}
+	var request npmPublishRequest
+	if err := json.NewDecoder(io.LimitReader(body, npmMaxPublishBodyBytes)).Decode(&request); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidPackage, err)
+	}
+	if request.Name != name || len(request.Versions) == 0 {
+		return fmt.Errorf("%w: document does not describe %s", ErrInvalidPackage, name)
+	}
+
+	for version, manifest := range request.Versions {
+		filename := npmTarballName(name, version)
+		attachment, ok := request.Attachments[filename]
+		if !ok {
+			return fmt.Errorf("%w: attachment %s is missing", ErrInvalidPackage, filename)
+		}
+		if err := s.publishVersion(box, name, version, filename, manifest, attachment); err != nil {
+			return err
+		}
+	}
+
+	folder, err := s.packageFolder(box, name)
+	if err != nil {
+		return err
+	}
+	distTags := npmDistTags(folder)
+	for tag, version := range request.DistTags {
+		distTags[tag] = version
+	}
+	if err := s.saveDistTags(folder, name, distTags); err != nil {
+		return err
+	}
+	s.logService.Log.WithFields(logrus.Fields{
+		"box":     box.Name,
+		"package": name,
+	}).Info("npm package published")
+	return nil
+}
+
+func (s *NpmServiceImpl) publishVersion(
+	box *models.Box,
+	name string,
+	version string,
+	filename string,
+	manifest map[string]interface{},
+	attachment npmAttachment,
+) error {
+	tarballPath := name + "/" + filename
+	existing, err := s.itemService.FindByPathAndBoxId(tarballPath, box.ID)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return fmt.Errorf("%w: %s@%s", ErrVersionExists, name, version)
+	}
+
+	tarball, err := base64.StdEncoding.DecodeString(attachment.Data)
+	if err != nil {
+		return fmt.Errorf("%w: attachment %s is not base64", ErrInvalidPackage, filename)
+	}
+	shasum := sha1.Sum(tarball)
+
+	item, err := s.fileService.CreateFileFromReader(box, tarballPath, bytes.NewReader(tarball), false, "")
+	if err != nil {
+		return err
+	}
+
+	// The dist section is rebuilt on read, it depends on the URL the registry is reached through
+	delete(manifest, "dist")
+	manifestJSON, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	properties := map[string][]string{
+		"name":     {name},
+		"version":  {version},
+		"shasum":   {hex.EncodeToString(shasum[:])},
+		"manifest": {string(manifestJSON)},
+	}
+	if description, ok := manifest["description"].(string); ok && description != "" {
+		properties["description"] = []string{description}
+	}
+	if license, ok := manifest["license"].(string); ok && license != "" {
+		properties["license"] = []string{license}
+	}
+	if keywords, ok := manifest["keywords"].([]interface{}); ok {
+		for _, keyword := range keywords {
+			if keyword, ok := keyword.(string); ok {
+				properties["keywords"] = append(properties["keywords"], keyword)
+			}
+		}
+	}
+	propertiesJSON, err := json.Marshal(properties)
+	if err != nil {
+		return err
+	}
+	return s.itemService.UpdateProperties(item.ID, propertiesJSON)
+}
+
+func (s *NpmServiceImpl) Tarball(box *models.Box, name string, filename string) (*models.Item, error) {
+	item, err := s.itemService.FindByPathAndBoxId(name+"/"+filename, box.ID)
+	if err != nil {
+		return nil, err
+	}
+	if item == nil || item.Type != "file" {
+		return nil, fmt.Errorf("%w: %s/-/%s", ErrPackageNotFound, name, filename)
+	}
+	return item, nil
+}
+
+func (s *NpmServiceImpl) DistTags(box *models.Box, name string) (map[string]string, error) {
+	packument, err := s.Packument(box, name, "")
+	if err != nil {
+		return nil, err
+	}
+	return packument.DistTags, nil
+}
+
+func (s *NpmServiceImpl) SetDistTag(box *models.Box, name string, tag string, version string) error {
+	packument, err := s.Packument(box, name, "")
+	if err != nil {
+		return err
+	}
+	if _, ok := packument.Versions[version]; !ok {
+		return fmt.Errorf("%w: %s@%s", ErrPackageNotFound, name, version)
+	}
+	folder, err := s.packageFolder(box, name)
+	if err != nil {
+		return err
+	}
+	distTags := npmDistTags(folder)
+	distTags[tag] = version
+	return s.saveDistTags(folder, name, distTags)
+}
+
+func (s *NpmServiceImpl) RemoveDistTag(box *models.Box, name string, tag string) error {
+	if tag == npmLatestTag {
+		return fmt.Errorf("%w: the latest tag cannot be removed", ErrInvalidPackage)
+	}
+	folder, err := s.packageFolder(box, name)
+	if err != nil {
+		return err
+	}
+	distTags := npmDistTags(folder)
+	delete(distTags, tag)
+	return s.saveDistTags(folder, name, distTags)
+}
+
+func (s *NpmServiceImpl) packageFolder(box *models.Box, name string) (*models.Item, error) {
+	folder, err := s.itemService.FindByPathAndBoxId(name, box.ID)
+	if err != nil {
+		return nil, err
+	}
+	if folder == nil || folder.Type != "folder" {
+		return nil, fmt.Errorf("%w: %s", ErrPackageNotFound, name)
+	}
+	return folder, nil
+}
+
+// saveDistTags stores the tags on the package folder as dist_tags=tag=version entries
+func (s *NpmServiceImpl) saveDistTags(folder *models.Item, name string, distTags map[string]string) error {
+	tags := make([]string, 0, len(distTags))
+	for tag, version := range distTags {
+		tags = append(tags, tag+"="+version)
+	}
+	sort.Strings(tags)
+	properties, err := json.Marshal(map[string][]string{
+		"name":      {name},
+		"dist_tags": tags,
+	})
+	if err != nil {
+		return err
+	}
+	return s.itemService.UpdateProperties(folder.ID, properties)
+}
+
+func npmDistTags(folder *models.Item) map[string]string {
+	distTags := make(map[string]string)
+	for _, entry := range helpers.PropertiesFromJSON(folder.Properties)["dist_tags"] {
+		if tag, version, ok := strings.Cut(entry, "="); ok {
+			distTags[tag] = version
+		}
+	}
+	return distTags
+}
+
+// npmTarballName returns the file name npm uses for a version, scoped packages drop the scope
+func npmTarballName(name string, version string) string {
+	if index := strings.LastIndex(name, "/"); index >= 0 {
+		name = name[index+1:]
+	}
+	return name + "-" + version + ".tgz"
+}
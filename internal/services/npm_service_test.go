@@ -0,0 +1,48 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func npmPublishBody(t *testing.T, name string, version string, tarball string) *strings.Reader {
+	body, err := json.Marshal(npmPublishRequest{
+		Name:     name,
+		DistTags: map[string]string{"latest": version},
+		Versions: map[string]map[string]interface{}{
+			version: {"name": name, "version": version},
+		},
+		Attachments: map[string]npmAttachment{
+			npmTarballName(name, version): {Data: base64.StdEncoding.EncodeToString([]byte(tarball))},
+		},
+	})
+	require.NoError(t, err)
+	return strings.NewReader(string(body))
+}
+
+func TestNpmService_PublishVersionsThatDifferInPunctuation(t *testing.T) {
+	ts := setupTestServices(t)
+	box := ts.createBox(t, "packages", nil)
+	npm := NewNpmService(ts.itemService, ts.fileService, ts.logService)
+
+	// "+" and "-" get labels of their own in the path of the tarball
+	assert.NoError(t, npm.Publish(box, "@scope/pkg", npmPublishBody(t, "@scope/pkg", "1.0.0+build", "plus")))
+	assert.NoError(t, npm.Publish(box, "@scope/pkg", npmPublishBody(t, "@scope/pkg", "1.0.0-build", "minus")))
+	err := npm.Publish(box, "@scope/pkg", npmPublishBody(t, "@scope/pkg", "1.0.0-build", "again"))
+	assert.ErrorIs(t, err, ErrVersionExists)
+
+	plus, err := npm.Tarball(box, "@scope/pkg", "pkg-1.0.0+build.tgz")
+	require.NoError(t, err)
+	minus, err := npm.Tarball(box, "@scope/pkg", "pkg-1.0.0-build.tgz")
+	require.NoError(t, err)
+	assert.NotEqual(t, plus.ID, minus.ID)
+	assert.NotEqual(t, plus.SHA256, minus.SHA256)
+
+	packument, err := npm.Packument(box, "@scope/pkg", "http://localhost")
+	require.NoError(t, err)
+	assert.Len(t, packument.Versions, 2)
+}
@@ -0,0 +1,491 @@
+package services
+
+import (
+	"Boxed/internal/helpers"
+	"Boxed/internal/models"
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	nugetMaxNuspec   = 1 << 20
+	nugetMaxIDLength = 100
+)
+
+var nugetIDPattern = regexp.MustCompile(`^\w+([_.-]\w+)*$`)
+
+// NugetPackage is the part of the .nuspec the feed validates and serves in its registrations
+type NugetPackage struct {
+	ID                       string                 `json:"id"`
+	Version                  string                 `json:"version"`
+	Title                    string                 `json:"title,omitempty"`
+	Authors                  string                 `json:"authors,omitempty"`
+	Description              string                 `json:"description,omitempty"`
+	Summary                  string                 `json:"summary,omitempty"`
+	Tags                     []string               `json:"tags,omitempty"`
+	ProjectURL               string                 `json:"projectUrl,omitempty"`
+	IconURL                  string                 `json:"iconUrl,omitempty"`
+	LicenseURL               string                 `json:"licenseUrl,omitempty"`
+	LicenseExpression        string                 `json:"licenseExpression,omitempty"`
+	RequireLicenseAcceptance bool                   `json:"requireLicenseAcceptance"`
+	DependencyGroups         []NugetDependencyGroup `json:"dependencyGroups,omitempty"`
+}
+
+type NugetDependencyGroup struct {
+	TargetFramework string            `json:"targetFramework,omitempty"`
+	Dependencies    []NugetDependency `json:"dependencies,omitempty"`
+}
+
+type NugetDependency struct {
+	ID    string `json:"id"`
+	Range string `json:"range,omitempty"`
+}
+
+// NugetRegistrationIndex is the registration index of a package id, all versions fit into one inlined page
+type NugetRegistrationIndex struct {
+	ID    string                  `json:"@id"`
+	Count int                     `json:"count"`
+	Items []NugetRegistrationPage `json:"items"`
+}
+
+type NugetRegistrationPage struct {
+	ID    string                  `json:"@id"`
+	Count int                     `json:"count"`
+	Lower string                  `json:"lower"`
+	Upper string                  `json:"upper"`
+	Items []NugetRegistrationLeaf `json:"items"`
+}
+
+type NugetRegistrationLeaf struct {
+	ID             string            `json:"@id"`
+	CatalogEntry   NugetCatalogEntry `json:"catalogEntry"`
+	PackageContent string            `json:"packageContent"`
+	Registration   string            `json:"registration"`
+}
+
+type NugetCatalogEntry struct {
+	ID             string `json:"@id"`
+	Listed         bool   `json:"listed"`
+	Published      string `json:"published"`
+	PackageContent string `json:"packageContent"`
+	NugetPackage
+}
+
+// NugetRegistrationDocument is the registration leaf of a single package version
+type NugetRegistrationDocument struct {
+	ID             string `json:"@id"`
+	CatalogEntry   string `json:"catalogEntry"`
+	Listed         bool   `json:"listed"`
+	PackageContent string `json:"packageContent"`
+	Published      string `json:"published"`
+	Registration   string `json:"registration"`
+}
+
+// NugetService keeps boxes of type nuget as NuGet v3 feeds. A package version is stored as
+// <id>/<version>/<id>.<version>.nupkg next to its <id>.nuspec, both lower case as the package base
+// address resource expects. The .nuspec fields are the properties of the .nupkg item, so packages
+// can be found through the item search, e.g. properties.authors eq "Contoso".
+type NugetService interface {
+	Push(box *models.Box, body io.Reader) (*NugetPackage, error)
+	Delete(box *models.Box, id string, version string) error
+	Versions(box *models.Box, id string) ([]string, error)
+	File(box *models.Box, id string, version string, filename string) (*models.Item, error)
+	Registration(box *models.Box, id string, baseURL string) (*NugetRegistrationIndex, error)
+	RegistrationLeaf(box *models.Box, id string, version string, baseURL string) (*NugetRegistrationDocument, error)
+}
+
+type NugetServiceImpl struct {
+	itemService ItemService
+	fileService FileService
+	logService  LogService
+}
+
+func NewNugetService(
+	itemService ItemService,
+	fileService FileService,
+	logService LogService,
+) NugetService {
+	return &NugetServiceImpl{
+		itemService: itemService,
+		fileService: fileService,
+		logService:  logService,
+	}
+}
+
+// Push stores a .nupkg and its .nuspec. A package version can only be pushed once.
+func (s *NugetServiceImpl) Push(box *models.Box, body io.Reader) (*NugetPackage, error) {
+	blob, err := s.fileService.StoreBlob(box, ".nupkg", body)
+	if err != nil {
+		return nil, err
+	}
+	nupkg, err := s.fileService.OpenBlob(box, blob.SHA256)
+	if err != nil {
+		return nil, err
+	}
+	pkg, nuspec, err := readNugetPackage(nupkg, nupkg.Size())
+	_ = nupkg.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	id, version := strings.ToLower(pkg.ID), strings.ToLower(pkg.Version)
+	packagePath := nugetPackagePath(id, version)
+	existing, err := s.itemService.FindByPathAndBoxId(packagePath, box.ID)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, fmt.Errorf("%w: %s %s", ErrVersionExists, pkg.ID, pkg.Version)
+	}
+
+	item, err := s.fileService.CreateFileFromBlob(box, packagePath, blob, false, "")
+	if err != nil {
+		return nil, err
+	}
+	nuspecPath := id + "/" + version + "/" + id + ".nuspec"
+	if _, err := s.fileService.CreateFileFromReader(box, nuspecPath, bytes.NewReader(nuspec), false, ""); err != nil {
+		return nil, err
+	}
+	propertiesJSON, err := nugetProperties(pkg)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.itemService.UpdateProperties(item.ID, propertiesJSON); err != nil {
+		return nil, err
+	}
+
+	s.logService.Log.WithFields(logrus.Fields{
+		"box":     box.Name,
+		"package": pkg.ID,
+		"version": pkg.Version,
+	}).Info("NuGet package pushed")
+	return pkg, nil
+}
+
+// Delete removes the folder of a package version together with its .nupkg and .nuspec
+func (s *NugetServiceImpl) Delete(box *models.Box, id string, version string) error {
+	item, err := s.packageItem(box, id, version)
+	if err != nil {
+		return err
+	}
+	if item.ParentID == nil {
+		return s.itemService.DeleteItem(item.ID, false)
+	}
+	// Deleting a folder leaves its children in place
+	files, err := s.itemService.FindItemsByParentID(item.ParentID, box.ID)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if err := s.itemService.DeleteItem(file.ID, false); err != nil {
+			return err
+		}
+	}
+	return s.itemService.DeleteItem(*item.ParentID, true)
+}
+
+// Versions lists the lower case versions of a package id in ascending order
+func (s *NugetServiceImpl) Versions(box *models.Box, id string) ([]string, error) {
+	packages, err := s.packages(box, id)
+	if err != nil {
+		return nil, err
+	}
+	versions := make([]string, 0, len(packages))
+	for _, pkg := range packages {
+		versions = append(versions, strings.ToLower(pkg.Version))
+	}
+	return versions, nil
+}
+
+// File returns the .nupkg or the .nuspec of a package version, named as the package base address resource names them
+func (s *NugetServiceImpl) File(box *models.Box, id string, version string, filename string) (*models.Item, error) {
+	id, version, filename = strings.ToLower(id), strings.ToLower(version), strings.ToLower(filename)
+	if filename != id+"."+version+".nupkg" && filename != id+".nuspec" {
+		return nil, fmt.Errorf("%w: %s", ErrPackageNotFound, filename)
+	}
+	item, err := s.itemService.FindByPathAndBoxId(id+"/"+version+"/"+filename, box.ID)
+	if err != nil {
+		return nil, err
+	}
+	if item == nil || item.Type != "file" {
+		return nil, fmt.Errorf("%w: %s", ErrPackageNotFound, filename)
+	}
+	return item, nil
+}
+
+func (s *NugetServiceImpl) Registration(box *models.Box, id string, baseURL string) (*NugetRegistrationIndex, error) {
+	packages, err := s.packages(box, id)
+	if err != nil {
+		return nil, err
+	}
+	id = strings.ToLower(id)
+	indexURL := baseURL + "/registration/" + id + "/index.json"
+	page := NugetRegistrationPage{
+		ID:    indexURL + "#page/" + packages[0].Version + "/" + packages[len(packages)-1].Version,
+		Count: len(packages),
+		Lower: packages[0].Version,
+		Upper: packages[len(packages)-1].Version,
+	}
+	for _, pkg := range packages {
+		version := strings.ToLower(pkg.Version)
+		leafURL := baseURL + "/registration/" + id + "/" + version + ".json"
+		contentURL := nugetContentURL(baseURL, id, version)
+		page.Items = append(page.Items, NugetRegistrationLeaf{
+			ID: leafURL,
+			CatalogEntry: NugetCatalogEntry{
+				ID:             leafURL,
+				Listed:         true,
+				Published:      pkg.published,
+				PackageContent: contentURL,
+				NugetPackage:   pkg.NugetPackage,
+			},
+			PackageContent: contentURL,
+			Registration:   indexURL,
+		})
+	}
+	return &NugetRegistrationIndex{ID: indexURL, Count: 1, Items: []NugetRegistrationPage{page}}, nil
+}
+
+func (s *NugetServiceImpl) RegistrationLeaf(box *models.Box, id string, version string, baseURL string) (*NugetRegistrationDocument, error) {
+	item, err := s.packageItem(box, id, version)
+	if err != nil {
+		return nil, err
+	}
+	id, version = strings.ToLower(id), strings.ToLower(version)
+	leafURL := baseURL + "/registration/" + id + "/" + version + ".json"
+	return &NugetRegistrationDocument{
+		ID:             leafURL,
+		CatalogEntry:   leafURL,
+		Listed:         true,
+		PackageContent: nugetContentURL(baseURL, id, version),
+		Published:      item.CreatedAt.UTC().Format(time.RFC3339),
+		Registration:   baseURL + "/registration/" + id + "/index.json",
+	}, nil
+}
+
+func (s *NugetServiceImpl) packageItem(box *models.Box, id string, version string) (*models.Item, error) {
+	normalized, ok := helpers.NormalizeNugetVersion(version)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s %s", ErrPackageNotFound, id, version)
+	}
+	id, version = strings.ToLower(id), strings.ToLower(normalized)
+	return s.File(box, id, version, id+"."+version+".nupkg")
+}
+
+type nugetStoredPackage struct {
+	NugetPackage
+	published string
+}
+
+// packages reads the stored versions of a package id from the properties of their .nupkg items
+func (s *NugetServiceImpl) packages(box *models.Box, id string) ([]nugetStoredPackage, error) {
+	folder, err := s.itemService.FindByPathAndBoxId(strings.ToLower(id), box.ID)
+	if err != nil {
+		return nil, err
+	}
+	if folder == nil || folder.Type != "folder" {
+		return nil, fmt.Errorf("%w: %s", ErrPackageNotFound, id)
+	}
+	versionFolders, err := s.itemService.FindItemsByParentID(&folder.ID, box.ID)
+	if err != nil {
+		return nil, err
+	}
+	var items []models.Item
+	for _, versionFolder := range versionFolders {
+		if versionFolder.Type != "folder" {
+			continue
+		}
+		files, err := s.itemService.FindItemsByParentID(&versionFolder.ID, box.ID)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, files...)
+	}
+
+	var packages []nugetStoredPackage
+	for _, item := range items {
+		metadata := helpers.PropertiesFromJSON(item.Properties)["metadata"]
+		if item.Type != "file" || !strings.HasSuffix(item.Name, ".nupkg") || len(metadata) == 0 {
+			continue
+		}
+		pkg := nugetStoredPackage{published: item.CreatedAt.UTC().Format(time.RFC3339)}
+		if err := json.Unmarshal([]byte(metadata[0]), &pkg.NugetPackage); err != nil {
+			continue
+		}
+		packages = append(packages, pkg)
+	}
+	if len(packages) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrPackageNotFound, id)
+	}
+	sort.Slice(packages, func(i, j int) bool {
+		return helpers.CompareSemver(packages[i].Version, packages[j].Version) < 0
+	})
+	return packages, nil
+}
+
+func nugetPackagePath(id string, version string) string {
+	return id + "/" + version + "/" + id + "." + version + ".nupkg"
+}
+
+func nugetContentURL(baseURL string, id string, version string) string {
+	return baseURL + "/v3-flatcontainer/" + id + "/" + version + "/" + id + "." + version + ".nupkg"
+}
+
+func nugetProperties(pkg *NugetPackage) ([]byte, error) {
+	metadata, err := json.Marshal(pkg)
+	if err != nil {
+		return nil, err
+	}
+	properties := map[string][]string{
+		"id":       {pkg.ID},
+		"version":  {pkg.Version},
+		"metadata": {string(metadata)},
+	}
+	for _, author := range strings.Split(pkg.Authors, ",") {
+		if author = strings.TrimSpace(author); author != "" {
+			properties["authors"] = append(properties["authors"], author)
+		}
+	}
+	for key, value := range map[string]string{
+		"title":       pkg.Title,
+		"description": pkg.Description,
+		"summary":     pkg.Summary,
+		"project_url": pkg.ProjectURL,
+		"license":     pkg.LicenseExpression,
+	} {
+		if value != "" {
+			properties[key] = []string{value}
+		}
+	}
+	if len(pkg.Tags) > 0 {
+		properties["tags"] = pkg.Tags
+	}
+	for _, group := range pkg.DependencyGroups {
+		for _, dependency := range group.Dependencies {
+			properties["dependencies"] = append(properties["dependencies"], strings.TrimSpace(dependency.ID+" "+dependency.Range))
+		}
+	}
+	return json.Marshal(properties)
+}
+
+type nuspecDocument struct {
+	Metadata struct {
+		ID                       string `xml:"id"`
+		Version                  string `xml:"version"`
+		Title                    string `xml:"title"`
+		Authors                  string `xml:"authors"`
+		Description              string `xml:"description"`
+		Summary                  string `xml:"summary"`
+		Tags                     string `xml:"tags"`
+		ProjectURL               string `xml:"projectUrl"`
+		IconURL                  string `xml:"iconUrl"`
+		LicenseURL               string `xml:"licenseUrl"`
+		RequireLicenseAcceptance bool   `xml:"requireLicenseAcceptance"`
+		License                  struct {
+			Type  string `xml:"type,attr"`
+			Value string `xml:",chardata"`
+		} `xml:"license"`
+		Dependencies struct {
+			Dependencies []nuspecDependency `xml:"dependency"`
+			Groups       []struct {
+				TargetFramework string             `xml:"targetFramework,attr"`
+				Dependencies    []nuspecDependency `xml:"dependency"`
+			} `xml:"group"`
+		} `xml:"dependencies"`
+	} `xml:"metadata"`
+}
+
+type nuspecDependency struct {
+	ID      string `xml:"id,attr"`
+	Version string `xml:"version,attr"`
+}
+
+// readNugetPackage reads the .nuspec at the root of a .nupkg and returns the package with the raw .nuspec
+func readNugetPackage(nupkg io.ReaderAt, size int64) (*NugetPackage, []byte, error) {
+	reader, err := zip.NewReader(nupkg, size)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: package is not a zip archive", ErrInvalidPackage)
+	}
+
+	for _, file := range reader.File {
+		if strings.Contains(file.Name, "/") || !strings.HasSuffix(strings.ToLower(file.Name), ".nuspec") {
+			continue
+		}
+		entry, err := file.Open()
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", ErrInvalidPackage, err)
+		}
+		content, err := io.ReadAll(io.LimitReader(entry, nugetMaxNuspec))
+		_ = entry.Close()
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", ErrInvalidPackage, err)
+		}
+		pkg, err := parseNuspec(content)
+		if err != nil {
+			return nil, nil, err
+		}
+		return pkg, content, nil
+	}
+	return nil, nil, fmt.Errorf("%w: .nuspec not found", ErrInvalidPackage)
+}
+
+func parseNuspec(content []byte) (*NugetPackage, error) {
+	var document nuspecDocument
+	if err := xml.Unmarshal(content, &document); err != nil {
+		return nil, fmt.Errorf("%w: .nuspec: %v", ErrInvalidPackage, err)
+	}
+	metadata := document.Metadata
+	id := strings.TrimSpace(metadata.ID)
+	if len(id) > nugetMaxIDLength || !nugetIDPattern.MatchString(id) {
+		return nil, fmt.Errorf("%w: invalid package id %q", ErrInvalidPackage, id)
+	}
+	version, ok := helpers.NormalizeNugetVersion(metadata.Version)
+	if !ok {
+		return nil, fmt.Errorf("%w: invalid version %q", ErrInvalidPackage, metadata.Version)
+	}
+
+	pkg := &NugetPackage{
+		ID:                       id,
+		Version:                  version,
+		Title:                    strings.TrimSpace(metadata.Title),
+		Authors:                  strings.TrimSpace(metadata.Authors),
+		Description:              strings.TrimSpace(metadata.Description),
+		Summary:                  strings.TrimSpace(metadata.Summary),
+		Tags:                     strings.FieldsFunc(metadata.Tags, func(r rune) bool { return r == ' ' || r == ',' || r == ';' }),
+		ProjectURL:               strings.TrimSpace(metadata.ProjectURL),
+		IconURL:                  strings.TrimSpace(metadata.IconURL),
+		LicenseURL:               strings.TrimSpace(metadata.LicenseURL),
+		RequireLicenseAcceptance: metadata.RequireLicenseAcceptance,
+	}
+	if metadata.License.Type == "expression" {
+		pkg.LicenseExpression = strings.TrimSpace(metadata.License.Value)
+	}
+	// Dependencies without a group apply to every target framework
+	if len(metadata.Dependencies.Dependencies) > 0 {
+		pkg.DependencyGroups = append(pkg.DependencyGroups, nugetDependencyGroup("", metadata.Dependencies.Dependencies))
+	}
+	for _, group := range metadata.Dependencies.Groups {
+		pkg.DependencyGroups = append(pkg.DependencyGroups, nugetDependencyGroup(group.TargetFramework, group.Dependencies))
+	}
+	return pkg, nil
+}
+
+func nugetDependencyGroup(targetFramework string, dependencies []nuspecDependency) NugetDependencyGroup {
+	group := NugetDependencyGroup{TargetFramework: strings.TrimSpace(targetFramework)}
+	for _, dependency := range dependencies {
+		group.Dependencies = append(group.Dependencies, NugetDependency{
+			ID:    strings.TrimSpace(dependency.ID),
+			Range: strings.TrimSpace(dependency.Version),
+		})
+	}
+	return group
+}
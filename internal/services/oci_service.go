@@ -0,0 +1,372 @@
+package services
+
+import (
+	"Boxed/internal/helpers"
+	"Boxed/internal/models"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	// Repositories keep their content in folders whose names can not collide with repository
+	// components, which never start with an underscore
+	ociBlobsFolder     = "_blobs"
+	ociManifestsFolder = "_manifests"
+	ociTagsFolder      = "_tags"
+	ociUploadsFolder   = "_uploads"
+	ociMaxManifest     = 4 << 20
+)
+
+var (
+	ErrBlobUnknown         = errors.New("blob unknown to registry")
+	ErrManifestUnknown     = errors.New("manifest unknown")
+	ErrManifestInvalid     = errors.New("manifest invalid")
+	ErrManifestBlobUnknown = errors.New("manifest references unknown blob")
+	ErrDigestInvalid       = errors.New("provided digest did not match uploaded content")
+	ErrNameInvalid         = errors.New("invalid repository name")
+	ErrNameUnknown         = errors.New("repository name not known to registry")
+	ErrTagInvalid          = errors.New("invalid tag")
+	ociComponentPattern    = regexp.MustCompile(`^[a-z0-9]+((\.|_|__|-+)[a-z0-9]+)*$`)
+	ociTagPattern          = regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9._-]{0,127}$`)
+	ociDigestPattern       = regexp.MustCompile(`^sha256:[a-f0-9]{64}$`)
+)
+
+// OciManifest is a stored manifest together with the headers it is served with
+type OciManifest struct {
+	Digest    string
+	MediaType string
+	Content   []byte
+}
+
+type ociManifestDocument struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType"`
+	Config        *ociDescriptor    `json:"config"`
+	Layers        []ociDescriptor   `json:"layers"`
+	Manifests     []ociDescriptor   `json:"manifests"`
+	Annotations   map[string]string `json:"annotations"`
+}
+
+type ociDescriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+}
+
+// OciService implements the OCI distribution spec on boxes of type oci. A repository is a folder
+// path in the box. Blobs are items in <repository>/_blobs named by their digest, so every layer
+// lives once in the hash storage however many repositories reference it. Manifests are items in
+// <repository>/_manifests, tags are items in <repository>/_tags holding the tagged manifest.
+type OciService interface {
+	Blob(box *models.Box, repository string, digest string) (*models.Item, error)
+	MountBlob(box *models.Box, repository string, digest string, fromBox *models.Box, fromRepository string) (*models.Item, error)
+	StartUpload(box *models.Box, repository string) (*models.UploadSession, error)
+	GetUpload(box *models.Box, repository string, id string) (*models.UploadSession, error)
+	WriteUpload(box *models.Box, repository string, id string, offset int64, reader io.Reader) (*models.UploadSession, error)
+	CompleteUpload(box *models.Box, repository string, id string, digest string) error
+	CancelUpload(box *models.Box, repository string, id string) error
+	PutManifest(box *models.Box, repository string, reference string, mediaType string, body io.Reader) (string, error)
+	Manifest(box *models.Box, repository string, reference string) (*OciManifest, error)
+	Tags(box *models.Box, repository string) ([]string, error)
+}
+
+type OciServiceImpl struct {
+	itemService   ItemService
+	fileService   FileService
+	uploadService UploadService
+	logService    LogService
+}
+
+func NewOciService(
+	itemService ItemService,
+	fileService FileService,
+	uploadService UploadService,
+	logService LogService,
+) OciService {
+	return &OciServiceImpl{
+		itemService:   itemService,
+		fileService:   fileService,
+		uploadService: uploadService,
+		logService:    logService,
+	}
+}
+
+// CheckOciRepository validates a repository name below the box, every component follows the distribution spec
+func CheckOciRepository(repository string) error {
+	if repository == "" {
+		return fmt.Errorf("%w: a repository below the box is required", ErrNameInvalid)
+	}
+	for _, component := range strings.Split(repository, "/") {
+		if !ociComponentPattern.MatchString(component) {
+			return fmt.Errorf("%w: %s", ErrNameInvalid, repository)
+		}
+	}
+	return nil
+}
+
+// IsOciDigest reports whether reference is a digest the registry can address, only sha256 is supported
+func IsOciDigest(reference string) bool {
+	return ociDigestPattern.MatchString(reference)
+}
+
+func (s *OciServiceImpl) Blob(box *models.Box, repository string, digest string) (*models.Item, error) {
+	if !IsOciDigest(digest) {
+		return nil, fmt.Errorf("%w: %s", ErrDigestInvalid, digest)
+	}
+	item, err := s.find(box, ociPath(repository, ociBlobsFolder, digest))
+	if err != nil {
+		return nil, err
+	}
+	if item == nil || item.Type != "file" {
+		return nil, fmt.Errorf("%w: %s", ErrBlobUnknown, digest)
+	}
+	return item, nil
+}
+
+// MountBlob links a blob of another repository, possibly of another box, into repository
+func (s *OciServiceImpl) MountBlob(box *models.Box, repository string, digest string, fromBox *models.Box, fromRepository string) (*models.Item, error) {
+	source, err := s.Blob(fromBox, fromRepository, digest)
+	if err != nil {
+		return nil, err
+	}
+	if fromBox.ID != box.ID {
+		if err := s.fileService.EnsureBlob(fromBox, box, source.SHA256); err != nil {
+			return nil, err
+		}
+	}
+	blob := &StoredBlob{SHA256: source.SHA256, SHA512: source.SHA512, Size: source.Size, StoredSize: source.StoredSize}
+	if _, err := s.fileService.CreateFileFromBlob(box, ociPath(repository, ociBlobsFolder, digest), blob, false, ""); err != nil {
+		return nil, err
+	}
+	return s.Blob(box, repository, digest)
+}
+
+func (s *OciServiceImpl) StartUpload(box *models.Box, repository string) (*models.UploadSession, error) {
+	return s.uploadService.CreateSession(box, repository+"/"+ociUploadsFolder, -1, false, "")
+}
+
+// GetUpload returns the upload session, which has to belong to the repository
+func (s *OciServiceImpl) GetUpload(box *models.Box, repository string, id string) (*models.UploadSession, error) {
+	session, err := s.uploadService.GetSession(id)
+	if err != nil {
+		return nil, err
+	}
+	if session.BoxID != box.ID || session.Path != repository+"/"+ociUploadsFolder || session.IsComplete() {
+		return nil, ErrUploadNotFound
+	}
+	return session, nil
+}
+
+// WriteUpload appends a chunk at offset, a negative offset appends at the current end of the upload
+func (s *OciServiceImpl) WriteUpload(box *models.Box, repository string, id string, offset int64, reader io.Reader) (*models.UploadSession, error) {
+	session, err := s.GetUpload(box, repository, id)
+	if err != nil {
+		return nil, err
+	}
+	if offset < 0 {
+		offset = session.Offset
+	}
+	return s.uploadService.WriteChunk(id, offset, reader)
+}
+
+func (s *OciServiceImpl) CompleteUpload(box *models.Box, repository string, id string, digest string) error {
+	if !IsOciDigest(digest) {
+		return fmt.Errorf("%w: %s", ErrDigestInvalid, digest)
+	}
+	if _, err := s.GetUpload(box, repository, id); err != nil {
+		return err
+	}
+	_, err := s.uploadService.FinalizeSessionAt(id, ociPath(repository, ociBlobsFolder, digest), strings.TrimPrefix(digest, "sha256:"))
+	if errors.Is(err, ErrChecksumMismatch) {
+		return fmt.Errorf("%w: %v", ErrDigestInvalid, err)
+	}
+	return err
+}
+
+func (s *OciServiceImpl) CancelUpload(box *models.Box, repository string, id string) error {
+	if _, err := s.GetUpload(box, repository, id); err != nil {
+		return err
+	}
+	return s.uploadService.AbortSession(id)
+}
+
+// PutManifest stores a manifest by digest and, when reference is a tag, points the tag at it.
+// Every blob or manifest the manifest references has to be present in the repository already.
+func (s *OciServiceImpl) PutManifest(box *models.Box, repository string, reference string, mediaType string, body io.Reader) (string, error) {
+	isDigest := IsOciDigest(reference)
+	if !isDigest && !ociTagPattern.MatchString(reference) {
+		return "", fmt.Errorf("%w: %s", ErrTagInvalid, reference)
+	}
+	content, err := io.ReadAll(io.LimitReader(body, ociMaxManifest+1))
+	if err != nil {
+		return "", err
+	}
+	if len(content) > ociMaxManifest {
+		return "", fmt.Errorf("%w: manifest exceeds %d bytes", ErrManifestInvalid, ociMaxManifest)
+	}
+	sum := sha256.Sum256(content)
+	digest := "sha256:" + hex.EncodeToString(sum[:])
+	if isDigest && reference != digest {
+		return "", fmt.Errorf("%w: manifest hashes to %s", ErrDigestInvalid, digest)
+	}
+
+	var document ociManifestDocument
+	if err := json.Unmarshal(content, &document); err != nil || document.SchemaVersion != 2 {
+		return "", fmt.Errorf("%w: expected a schemaVersion 2 manifest", ErrManifestInvalid)
+	}
+	if mediaType == "" || strings.HasPrefix(mediaType, "application/json") {
+		mediaType = document.MediaType
+	}
+	if mediaType == "" {
+		return "", fmt.Errorf("%w: the media type is missing", ErrManifestInvalid)
+	}
+	if err := s.checkReferences(box, repository, &document); err != nil {
+		return "", err
+	}
+
+	properties := map[string][]string{
+		"repository": {repository},
+		"digest":     {digest},
+		"media_type": {mediaType},
+	}
+	if err := s.saveManifest(box, ociPath(repository, ociManifestsFolder, digest), content, properties); err != nil {
+		return "", err
+	}
+	if !isDigest {
+		properties["tag"] = []string{reference}
+		if err := s.saveManifest(box, ociPath(repository, ociTagsFolder, reference), content, properties); err != nil {
+			return "", err
+		}
+	}
+
+	s.logService.Log.WithFields(logrus.Fields{
+		"box":        box.Name,
+		"repository": repository,
+		"reference":  reference,
+		"digest":     digest,
+	}).Info("OCI manifest pushed")
+	return digest, nil
+}
+
+func (s *OciServiceImpl) checkReferences(box *models.Box, repository string, document *ociManifestDocument) error {
+	blobs := document.Layers
+	if document.Config != nil {
+		blobs = append(blobs, *document.Config)
+	}
+	for _, descriptor := range blobs {
+		if _, err := s.Blob(box, repository, descriptor.Digest); err != nil {
+			return fmt.Errorf("%w: %s", ErrManifestBlobUnknown, descriptor.Digest)
+		}
+	}
+	for _, descriptor := range document.Manifests {
+		if _, err := s.Manifest(box, repository, descriptor.Digest); err != nil {
+			return fmt.Errorf("%w: %s", ErrManifestBlobUnknown, descriptor.Digest)
+		}
+	}
+	return nil
+}
+
+func (s *OciServiceImpl) saveManifest(box *models.Box, filePath string, content []byte, properties map[string][]string) error {
+	item, err := s.fileService.CreateFileFromReader(box, filePath, bytes.NewReader(content), false, "")
+	if err != nil {
+		return err
+	}
+	propertiesJSON, err := json.Marshal(properties)
+	if err != nil {
+		return err
+	}
+	return s.itemService.UpdateProperties(item.ID, propertiesJSON)
+}
+
+// Manifest returns the manifest a tag points at, or the manifest with the given digest
+func (s *OciServiceImpl) Manifest(box *models.Box, repository string, reference string) (*OciManifest, error) {
+	folder := ociTagsFolder
+	if IsOciDigest(reference) {
+		folder = ociManifestsFolder
+	} else if !ociTagPattern.MatchString(reference) {
+		return nil, fmt.Errorf("%w: %s", ErrTagInvalid, reference)
+	}
+	item, err := s.find(box, ociPath(repository, folder, reference))
+	if err != nil {
+		return nil, err
+	}
+	if item == nil || item.Type != "file" {
+		return nil, fmt.Errorf("%w: %s", ErrManifestUnknown, reference)
+	}
+
+	blob, err := s.fileService.OpenBlob(box, item.SHA256)
+	if err != nil {
+		return nil, err
+	}
+	content, err := io.ReadAll(blob)
+	_ = blob.Close()
+	if err != nil {
+		return nil, err
+	}
+	properties := helpers.PropertiesFromJSON(item.Properties)
+	manifest := &OciManifest{Digest: "sha256:" + item.SHA256, Content: content}
+	if len(properties["media_type"]) > 0 {
+		manifest.MediaType = properties["media_type"][0]
+	}
+	return manifest, nil
+}
+
+func (s *OciServiceImpl) Tags(box *models.Box, repository string) ([]string, error) {
+	repositoryFolder, err := s.find(box, repository)
+	if err != nil {
+		return nil, err
+	}
+	if repositoryFolder == nil || repositoryFolder.Type != "folder" {
+		return nil, fmt.Errorf("%w: %s", ErrNameUnknown, repository)
+	}
+	folder, err := s.find(box, repository+"/"+ociTagsFolder)
+	if err != nil {
+		return nil, err
+	}
+	if folder == nil {
+		return []string{}, nil
+	}
+	items, err := s.itemService.FindItemsByParentID(&folder.ID, box.ID)
+	if err != nil {
+		return nil, err
+	}
+	tags := make([]string, 0, len(items))
+	for _, item := range items {
+		if item.Type == "file" {
+			tags = append(tags, item.Name)
+		}
+	}
+	sort.Strings(tags)
+	return tags, nil
+}
+
+// find returns the item at a path in the box. Finding items by path also accepts the spelling they are
+// shown with, hyphens for underscores, which would let "my-app" pull "my_app" or tag "1.0-rc" serve
+// "1.0_rc", so the names are matched one by one.
+func (s *OciServiceImpl) find(box *models.Box, itemPath string) (*models.Item, error) {
+	var item *models.Item
+	for _, name := range strings.Split(itemPath, "/") {
+		var parentID *uint
+		if item != nil {
+			parentID = &item.ID
+		}
+		next, err := s.itemService.FindByNameAndParent(name, parentID, box.ID)
+		if err != nil || next == nil {
+			return nil, err
+		}
+		item = next
+	}
+	return item, nil
+}
+
+func ociPath(repository string, folder string, name string) string {
+	return repository + "/" + folder + "/" + name
+}
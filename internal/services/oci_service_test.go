@@ -0,0 +1,72 @@
+package services
+
+import (
+	"Boxed/internal/models"
+	"Boxed/internal/repository"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func setupTestOci(t *testing.T) (*testServices, OciService, *models.Box) {
+	ts := setupTestServices(t)
+	uploadService := NewUploadService(
+		repository.NewUploadSessionRepository(ts.db), ts.fileService, ts.boxService, ts.itemService, ts.logService, ts.configuration,
+	)
+	oci := NewOciService(ts.itemService, ts.fileService, uploadService, ts.logService)
+	return ts, oci, ts.createBox(t, "registry", nil)
+}
+
+// pushImage uploads a config blob and pushes a manifest referencing it, it returns the manifest digest
+func pushImage(t *testing.T, oci OciService, box *models.Box, repository string, tag string, config string) string {
+	sum := sha256.Sum256([]byte(config))
+	configDigest := "sha256:" + hex.EncodeToString(sum[:])
+	session, err := oci.StartUpload(box, repository)
+	require.NoError(t, err)
+	_, err = oci.WriteUpload(box, repository, session.UUID, 0, strings.NewReader(config))
+	require.NoError(t, err)
+	require.NoError(t, oci.CompleteUpload(box, repository, session.UUID, configDigest))
+
+	manifest := fmt.Sprintf(
+		`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","config":{"mediaType":"application/vnd.oci.image.config.v1+json","digest":%q},"layers":[]}`,
+		configDigest,
+	)
+	digest, err := oci.PutManifest(box, repository, tag, "", strings.NewReader(manifest))
+	require.NoError(t, err)
+	return digest
+}
+
+func TestOciService_NamesThatDifferInPunctuation(t *testing.T) {
+	_, oci, box := setupTestOci(t)
+	underscore := pushImage(t, oci, box, "team/my_app", "1.0_rc", `{"app":"underscore"}`)
+
+	// Neither the repository nor the tag is known under the other spelling
+	_, err := oci.Manifest(box, "team/my-app", "1.0_rc")
+	assert.ErrorIs(t, err, ErrManifestUnknown)
+	_, err = oci.Manifest(box, "team/my_app", "1.0-rc")
+	assert.ErrorIs(t, err, ErrManifestUnknown)
+	_, err = oci.Tags(box, "team/my-app")
+	assert.ErrorIs(t, err, ErrNameUnknown)
+
+	hyphen := pushImage(t, oci, box, "team/my-app", "1.0-rc", `{"app":"hyphen"}`)
+	assert.NotEqual(t, underscore, hyphen)
+	pushImage(t, oci, box, "team/my_app", "1.0-rc", `{"app":"underscore, hyphen tag"}`)
+
+	manifest, err := oci.Manifest(box, "team/my_app", "1.0_rc")
+	require.NoError(t, err)
+	assert.Equal(t, underscore, manifest.Digest)
+	manifest, err = oci.Manifest(box, "team/my-app", "1.0-rc")
+	require.NoError(t, err)
+	assert.Equal(t, hyphen, manifest.Digest)
+
+	tags, err := oci.Tags(box, "team/my-app")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1.0-rc"}, tags)
+	tags, err = oci.Tags(box, "team/my_app")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1.0-rc", "1.0_rc"}, tags)
+}
@@ -0,0 +1,288 @@
+package services
+
+import (
+	"Boxed/internal/dto"
+	"Boxed/internal/helpers"
+	"Boxed/internal/models"
+	"Boxed/internal/storage"
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"io"
+	"net/mail"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// pythonMaxMetadataBytes bounds the METADATA or PKG-INFO file read from a distribution
+const pythonMaxMetadataBytes = 1 << 20
+
+// PypiFile is one distribution file of a project as the simple index lists it
+type PypiFile struct {
+	Filename       string
+	Version        string
+	SHA256         string
+	Size           int64
+	RequiresPython string
+	UploadTime     time.Time
+}
+
+// PypiService implements the PyPI legacy upload API and the simple repository API on boxes of type
+// pypi. Every project is a folder named by its normalized name holding the distribution files, whose
+// core metadata is stored in the item properties.
+type PypiService interface {
+	Upload(box *models.Box, fields map[string]string, filename string, blob *StoredBlob) (*dto.ItemGetDTO, error)
+	Projects(box *models.Box) ([]string, error)
+	Files(box *models.Box, project string) ([]PypiFile, error)
+	File(box *models.Box, project string, filename string) (*models.Item, error)
+}
+
+type PypiServiceImpl struct {
+	itemService ItemService
+	fileService FileService
+	logService  LogService
+}
+
+func NewPypiService(
+	itemService ItemService,
+	fileService FileService,
+	logService LogService,
+) PypiService {
+	return &PypiServiceImpl{
+		itemService: itemService,
+		fileService: fileService,
+		logService:  logService,
+	}
+}
+
+// Upload stores a distribution sent by twine. The core metadata inside the file wins over the form
+// fields, which are only used when the file carries none. Files are immutable once uploaded.
+func (s *PypiServiceImpl) Upload(box *models.Box, fields map[string]string, filename string, blob *StoredBlob) (*dto.ItemGetDTO, error) {
+	filetype := pythonFiletype(filename)
+	if filetype == "" || filename != path.Base(filename) {
+		return nil, fmt.Errorf("%w: unsupported distribution file %q", ErrInvalidPackage, filename)
+	}
+	if digest := fields["sha256_digest"]; digest != "" && !strings.EqualFold(digest, blob.SHA256) {
+		return nil, fmt.Errorf("%w: sha256 of %s", ErrChecksumMismatch, filename)
+	}
+
+	distribution, err := s.fileService.OpenBlob(box, blob.SHA256)
+	if err != nil {
+		return nil, err
+	}
+	metadata, err := readPythonMetadata(distribution, filename)
+	_ = distribution.Close()
+	if err != nil {
+		s.logService.Log.WithFields(logrus.Fields{
+			"box":   box.Name,
+			"file":  filename,
+			"error": err,
+		}).Warn("Could not read the core metadata of the distribution, using the upload fields")
+		metadata = mail.Header{}
+	}
+	name := firstNonEmpty(metadata.Get("Name"), fields["name"])
+	version := firstNonEmpty(metadata.Get("Version"), fields["version"])
+	project := helpers.NormalizePythonName(name)
+	if project == "" || version == "" {
+		return nil, fmt.Errorf("%w: name and version are required", ErrInvalidPackage)
+	}
+	if !strings.HasPrefix(helpers.NormalizePythonName(filename), project+"-") {
+		return nil, fmt.Errorf("%w: %s does not belong to %s", ErrInvalidPackage, filename, name)
+	}
+
+	filePath := project + "/" + filename
+	existing, err := s.itemService.FindByPathAndBoxId(filePath, box.ID)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, fmt.Errorf("%w: %s", ErrVersionExists, filename)
+	}
+
+	item, err := s.fileService.CreateFileFromBlob(box, filePath, blob, false, "")
+	if err != nil {
+		return nil, err
+	}
+	properties := map[string][]string{
+		"name":     {name},
+		"project":  {project},
+		"version":  {version},
+		"filetype": {filetype},
+	}
+	if requiresPython := firstNonEmpty(metadata.Get("Requires-Python"), fields["requires_python"]); requiresPython != "" {
+		properties["requires_python"] = []string{requiresPython}
+	}
+	if summary := firstNonEmpty(metadata.Get("Summary"), fields["summary"]); summary != "" {
+		properties["summary"] = []string{summary}
+	}
+	if pyversion := fields["pyversion"]; pyversion != "" {
+		properties["python_version"] = []string{pyversion}
+	}
+	if requiresDist := metadata["Requires-Dist"]; len(requiresDist) > 0 {
+		properties["requires_dist"] = requiresDist
+	}
+	propertiesJSON, err := json.Marshal(properties)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.itemService.UpdateProperties(item.ID, propertiesJSON); err != nil {
+		return nil, err
+	}
+
+	s.logService.Log.WithFields(logrus.Fields{
+		"box":     box.Name,
+		"project": project,
+		"file":    filename,
+	}).Info("Python distribution uploaded")
+	return item, nil
+}
+
+func (s *PypiServiceImpl) Projects(box *models.Box) ([]string, error) {
+	items, err := s.itemService.FindItemsByParentID(nil, box.ID)
+	if err != nil {
+		return nil, err
+	}
+	var projects []string
+	for _, item := range items {
+		if item.Type == "folder" {
+			projects = append(projects, item.Name)
+		}
+	}
+	sort.Strings(projects)
+	return projects, nil
+}
+
+func (s *PypiServiceImpl) Files(box *models.Box, project string) ([]PypiFile, error) {
+	folder, err := s.itemService.FindByPathAndBoxId(project, box.ID)
+	if err != nil {
+		return nil, err
+	}
+	if folder == nil || folder.Type != "folder" {
+		return nil, fmt.Errorf("%w: %s", ErrPackageNotFound, project)
+	}
+	items, err := s.itemService.FindItemsByParentID(&folder.ID, box.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []PypiFile
+	for _, item := range items {
+		if item.Type != "file" {
+			continue
+		}
+		properties := helpers.PropertiesFromJSON(item.Properties)
+		file := PypiFile{
+			Filename:   item.Name,
+			SHA256:     item.SHA256,
+			Size:       item.Size,
+			UploadTime: item.CreatedAt,
+		}
+		if len(properties["version"]) > 0 {
+			file.Version = properties["version"][0]
+		}
+		if len(properties["requires_python"]) > 0 {
+			file.RequiresPython = properties["requires_python"][0]
+		}
+		files = append(files, file)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Filename < files[j].Filename })
+	return files, nil
+}
+
+func (s *PypiServiceImpl) File(box *models.Box, project string, filename string) (*models.Item, error) {
+	item, err := s.itemService.FindByPathAndBoxId(project+"/"+filename, box.ID)
+	if err != nil {
+		return nil, err
+	}
+	if item == nil || item.Type != "file" {
+		return nil, fmt.Errorf("%w: %s/%s", ErrPackageNotFound, project, filename)
+	}
+	return item, nil
+}
+
+// pythonFiletype returns the twine filetype of a distribution file name, empty when unsupported
+func pythonFiletype(filename string) string {
+	switch {
+	case strings.HasSuffix(filename, ".whl"):
+		return "bdist_wheel"
+	case strings.HasSuffix(filename, ".tar.gz"), strings.HasSuffix(filename, ".zip"):
+		return "sdist"
+	}
+	return ""
+}
+
+// readPythonMetadata reads the core metadata of a wheel (*.dist-info/METADATA) or of an
+// sdist (<name>-<version>/PKG-INFO)
+func readPythonMetadata(blob storage.Blob, filename string) (mail.Header, error) {
+	if strings.HasSuffix(filename, ".tar.gz") {
+		return readTarMetadata(blob)
+	}
+
+	archive, err := zip.NewReader(blob, blob.Size())
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range archive.File {
+		dir, base := path.Split(file.Name)
+		if strings.Count(file.Name, "/") != 1 {
+			continue
+		}
+		if (base == "METADATA" && strings.HasSuffix(dir, ".dist-info/")) || base == "PKG-INFO" {
+			reader, err := file.Open()
+			if err != nil {
+				return nil, err
+			}
+			defer reader.Close()
+			return parsePythonMetadata(reader)
+		}
+	}
+	return nil, errors.New("no core metadata found")
+}
+
+func readTarMetadata(file io.Reader) (mail.Header, error) {
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, err
+	}
+	defer gzipReader.Close()
+
+	reader := tar.NewReader(gzipReader)
+	for {
+		header, err := reader.Next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, errors.New("no core metadata found")
+			}
+			return nil, err
+		}
+		name := strings.TrimPrefix(header.Name, "./")
+		if header.Typeflag == tar.TypeReg && strings.Count(name, "/") == 1 && path.Base(name) == "PKG-INFO" {
+			return parsePythonMetadata(reader)
+		}
+	}
+}
+
+// parsePythonMetadata parses the RFC 822 style headers of a core metadata file, the description body is ignored
+func parsePythonMetadata(reader io.Reader) (mail.Header, error) {
+	message, err := mail.ReadMessage(bufio.NewReader(io.LimitReader(reader, pythonMaxMetadataBytes)))
+	if err != nil {
+		return nil, err
+	}
+	return message.Header, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			return value
+		}
+	}
+	return ""
+}
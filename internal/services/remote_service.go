@@ -0,0 +1,346 @@
+package services
+
+import (
+	"Boxed/internal/config"
+	"Boxed/internal/helpers"
+	"Boxed/internal/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRemoteTimeout     = 30 * time.Second
+	defaultRemoteMetadataTTL = 24 * time.Hour
+	defaultRemoteNegativeTTL = 5 * time.Minute
+)
+
+var (
+	ErrRemoteNotFound      = errors.New("not found upstream")
+	ErrUpstreamUnavailable = errors.New("upstream unavailable")
+	ErrRemoteNotConfigured = errors.New("remote box has no valid upstream")
+	errRemoteIncomplete    = errors.New("upstream response ended early")
+)
+
+// RemoteDownload is a file on its way from the upstream of a remote box. Reading Body to the end
+// stores the file in the box, closing it earlier drops what was read.
+type RemoteDownload struct {
+	Body         io.ReadCloser
+	Size         int64
+	ContentType  string
+	LastModified string
+}
+
+// RemoteService runs boxes of type remote as pull-through caches of an upstream HTTP repository. The
+// upstream base URL is the "upstream" property of the box, "metadata_ttl", "negative_ttl" and "offline"
+// override the defaults of the configuration. Cached files keep the ETag and Last-Modified of the
+// upstream and the time they were fetched as properties.
+type RemoteService interface {
+	// Open returns the cached item at filePath when it is fresh, otherwise it asks the upstream. A new
+	// or changed file comes back as a download, the item is nil then.
+	Open(box *models.Box, filePath string) (*models.Item, *RemoteDownload, error)
+}
+
+type RemoteServiceImpl struct {
+	itemService   ItemService
+	fileService   FileService
+	logService    LogService
+	configuration config.Configuration
+	client        *http.Client
+	misses        map[string]time.Time
+	missesLock    sync.Mutex
+	storeLock     sync.Mutex
+}
+
+func NewRemoteService(
+	itemService ItemService,
+	fileService FileService,
+	logService LogService,
+	configuration *config.Configuration,
+) RemoteService {
+	timeout := parseRemoteDuration(configuration.Server.RemoteConfig.Timeout, defaultRemoteTimeout)
+	return &RemoteServiceImpl{
+		itemService:   itemService,
+		fileService:   fileService,
+		logService:    logService,
+		configuration: *configuration,
+		// No overall timeout, the body of a large artifact may take long to stream
+		client: &http.Client{Transport: &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			DialContext:           (&net.Dialer{Timeout: timeout}).DialContext,
+			TLSHandshakeTimeout:   timeout,
+			ResponseHeaderTimeout: timeout,
+		}},
+		misses: make(map[string]time.Time),
+	}
+}
+
+type remoteSettings struct {
+	upstream    string
+	metadataTTL time.Duration
+	negativeTTL time.Duration
+	offline     bool
+}
+
+func (s *RemoteServiceImpl) Open(box *models.Box, filePath string) (*models.Item, *RemoteDownload, error) {
+	settings := s.settings(box)
+	item, err := s.itemService.FindByPathAndBoxId(filePath, box.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if item != nil && (item.Type == "folder" || settings.offline || s.fresh(item, settings)) {
+		return item, nil, nil
+	}
+	if item == nil && settings.offline {
+		return nil, nil, fmt.Errorf("%w: %s is not cached and the box is offline", ErrRemoteNotFound, filePath)
+	}
+	if item == nil && s.knownMiss(box, filePath) {
+		return nil, nil, fmt.Errorf("%w: %s", ErrRemoteNotFound, filePath)
+	}
+
+	upstreamURL, err := helpers.UpstreamURL(settings.upstream, filePath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrRemoteNotConfigured, err)
+	}
+	var validators helpers.UpstreamValidators
+	if item != nil {
+		properties := helpers.PropertiesFromJSON(item.Properties)
+		validators.ETag = firstProperty(properties, "upstream_etag")
+		validators.LastModified = firstProperty(properties, "upstream_last_modified")
+	}
+
+	remoteLog := s.logService.Log.WithFields(logrus.Fields{
+		"box":      box.Name,
+		"path":     filePath,
+		"upstream": upstreamURL,
+	})
+	response, err := helpers.FetchUpstream(s.client, upstreamURL, validators)
+	if err != nil {
+		if item != nil {
+			remoteLog.WithError(err).Warn("Upstream unavailable, serving the cached file")
+			return item, nil, nil
+		}
+		return nil, nil, fmt.Errorf("%w: %v", ErrUpstreamUnavailable, err)
+	}
+
+	switch {
+	case response.StatusCode == http.StatusOK:
+		s.forgetMiss(box, filePath)
+		return nil, s.download(box, filePath, response, remoteLog), nil
+	case response.StatusCode == http.StatusNotModified && item != nil:
+		_ = response.Body.Close()
+		properties := helpers.PropertiesFromJSON(item.Properties)
+		properties["fetched_at"] = []string{time.Now().UTC().Format(time.RFC3339)}
+		if err := s.updateProperties(item.ID, properties); err != nil {
+			remoteLog.WithError(err).Warn("Failed to record the revalidation")
+		}
+		return item, nil, nil
+	}
+	_ = response.Body.Close()
+	if item != nil {
+		remoteLog.WithField("status", response.StatusCode).Warn("Upstream did not confirm the cached file, serving it anyway")
+		return item, nil, nil
+	}
+	if response.StatusCode == http.StatusNotFound || response.StatusCode == http.StatusGone {
+		s.rememberMiss(box, filePath, settings.negativeTTL)
+		return nil, nil, fmt.Errorf("%w: %s", ErrRemoteNotFound, filePath)
+	}
+	return nil, nil, fmt.Errorf("%w: upstream answered %d", ErrUpstreamUnavailable, response.StatusCode)
+}
+
+// download streams the body of an upstream response to the caller and into the hash storage at the same time
+func (s *RemoteServiceImpl) download(box *models.Box, filePath string, response *http.Response, remoteLog *logrus.Entry) *RemoteDownload {
+	pipeReader, pipeWriter := io.Pipe()
+	reader := &remoteCacheReader{
+		upstream: response.Body,
+		pipe:     pipeWriter,
+		expected: response.ContentLength,
+		stored:   make(chan struct{}),
+	}
+	properties := map[string][]string{
+		"upstream_url": {response.Request.URL.String()},
+		"fetched_at":   {time.Now().UTC().Format(time.RFC3339)},
+	}
+	if etag := response.Header.Get("ETag"); etag != "" {
+		properties["upstream_etag"] = []string{etag}
+	}
+	if lastModified := response.Header.Get("Last-Modified"); lastModified != "" {
+		properties["upstream_last_modified"] = []string{lastModified}
+	}
+
+	go func() {
+		defer close(reader.stored)
+		blob, err := s.fileService.StoreBlob(box, filePath, pipeReader)
+		if err != nil {
+			// Unblocks the writes of the reader, the caller keeps getting the upstream content
+			_ = pipeReader.CloseWithError(err)
+			if !errors.Is(err, errRemoteIncomplete) {
+				remoteLog.WithError(err).Error("Failed to cache the upstream file")
+			}
+			return
+		}
+		s.storeLock.Lock()
+		defer s.storeLock.Unlock()
+		item, err := s.fileService.CreateFileFromBlob(box, filePath, blob, false, "")
+		if err == nil {
+			err = s.updateProperties(item.ID, properties)
+		}
+		if err != nil {
+			remoteLog.WithError(err).Error("Failed to record the upstream file")
+			return
+		}
+		remoteLog.WithField("size", blob.Size).Info("Upstream file cached")
+	}()
+
+	return &RemoteDownload{
+		Body:         reader,
+		Size:         response.ContentLength,
+		ContentType:  response.Header.Get("Content-Type"),
+		LastModified: response.Header.Get("Last-Modified"),
+	}
+}
+
+func (s *RemoteServiceImpl) updateProperties(id uint, properties map[string][]string) error {
+	propertiesJSON, err := json.Marshal(properties)
+	if err != nil {
+		return err
+	}
+	return s.itemService.UpdateProperties(id, propertiesJSON)
+}
+
+// fresh reports whether a cached file was fetched or revalidated within the metadata TTL
+func (s *RemoteServiceImpl) fresh(item *models.Item, settings *remoteSettings) bool {
+	fetchedAt, err := time.Parse(time.RFC3339, firstProperty(helpers.PropertiesFromJSON(item.Properties), "fetched_at"))
+	if err != nil {
+		// Uploaded into the box rather than fetched, there is nothing to revalidate
+		return true
+	}
+	return time.Since(fetchedAt) < settings.metadataTTL
+}
+
+func (s *RemoteServiceImpl) knownMiss(box *models.Box, filePath string) bool {
+	s.missesLock.Lock()
+	defer s.missesLock.Unlock()
+	key := remoteMissKey(box, filePath)
+	expiry, ok := s.misses[key]
+	if ok && time.Now().After(expiry) {
+		delete(s.misses, key)
+		return false
+	}
+	return ok
+}
+
+func (s *RemoteServiceImpl) rememberMiss(box *models.Box, filePath string, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+	s.missesLock.Lock()
+	defer s.missesLock.Unlock()
+	now := time.Now()
+	// Expired entries are dropped on the way, so paths asked for only once do not pile up
+	for key, expiry := range s.misses {
+		if now.After(expiry) {
+			delete(s.misses, key)
+		}
+	}
+	s.misses[remoteMissKey(box, filePath)] = now.Add(ttl)
+}
+
+func (s *RemoteServiceImpl) forgetMiss(box *models.Box, filePath string) {
+	s.missesLock.Lock()
+	defer s.missesLock.Unlock()
+	delete(s.misses, remoteMissKey(box, filePath))
+}
+
+func remoteMissKey(box *models.Box, filePath string) string {
+	return strconv.FormatUint(uint64(box.ID), 10) + "/" + filePath
+}
+
+// settings reads the upstream and the overrides from the properties of the box
+func (s *RemoteServiceImpl) settings(box *models.Box) *remoteSettings {
+	defaults := s.configuration.Server.RemoteConfig
+	settings := &remoteSettings{
+		metadataTTL: parseRemoteDuration(defaults.MetadataTTL, defaultRemoteMetadataTTL),
+		negativeTTL: parseRemoteDuration(defaults.NegativeTTL, defaultRemoteNegativeTTL),
+		offline:     defaults.Offline,
+	}
+	var properties map[string]interface{}
+	if err := json.Unmarshal(box.Properties, &properties); err != nil {
+		return settings
+	}
+	settings.upstream, _ = properties["upstream"].(string)
+	if value, ok := properties["metadata_ttl"]; ok {
+		settings.metadataTTL = parseRemoteDuration(value, settings.metadataTTL)
+	}
+	if value, ok := properties["negative_ttl"]; ok {
+		settings.negativeTTL = parseRemoteDuration(value, settings.negativeTTL)
+	}
+	if offline, ok := properties["offline"].(bool); ok {
+		settings.offline = offline
+	}
+	return settings
+}
+
+// parseRemoteDuration takes a duration such as "10m" or a number of seconds, zero is a valid TTL
+func parseRemoteDuration(value interface{}, fallback time.Duration) time.Duration {
+	switch value := value.(type) {
+	case float64:
+		if value >= 0 {
+			return time.Duration(value * float64(time.Second))
+		}
+	case string:
+		if duration, err := time.ParseDuration(value); err == nil && duration >= 0 {
+			return duration
+		}
+	}
+	return fallback
+}
+
+func firstProperty(properties map[string][]string, key string) string {
+	if values := properties[key]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// remoteCacheReader hands out the upstream body and copies it into the pipe StoreBlob reads from.
+// The file is only stored when the body was read to the end and had the announced length.
+type remoteCacheReader struct {
+	upstream io.ReadCloser
+	pipe     *io.PipeWriter
+	expected int64
+	read     int64
+	complete bool
+	pipeErr  error
+	stored   chan struct{}
+}
+
+func (r *remoteCacheReader) Read(p []byte) (int, error) {
+	n, err := r.upstream.Read(p)
+	r.read += int64(n)
+	if n > 0 && r.pipeErr == nil {
+		_, r.pipeErr = r.pipe.Write(p[:n])
+	}
+	if errors.Is(err, io.EOF) {
+		r.complete = true
+	}
+	return n, err
+}
+
+func (r *remoteCacheReader) Close() error {
+	err := r.upstream.Close()
+	if r.complete && (r.expected < 0 || r.read == r.expected) {
+		_ = r.pipe.Close()
+	} else {
+		_ = r.pipe.CloseWithError(errRemoteIncomplete)
+	}
+	<-r.stored
+	return err
+}
@@ -0,0 +1,102 @@
+package services
+
+import (
+	"Boxed/internal/models"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+// remoteUpstream serves pkg/a.txt with an ETag and answers 404 for everything else
+func remoteUpstream(t *testing.T, requests *atomic.Int32) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.URL.Path != "/repo/pkg/a.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		_, _ = io.WriteString(w, "upstream content")
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func setRemoteProperties(t *testing.T, box *models.Box, properties map[string]interface{}) {
+	propertiesJSON, err := json.Marshal(properties)
+	require.NoError(t, err)
+	box.Properties = propertiesJSON
+}
+
+func TestRemoteService_Open(t *testing.T) {
+	ts := setupTestServices(t)
+	var requests atomic.Int32
+	upstream := remoteUpstream(t, &requests)
+	box, err := ts.boxService.CreateBox("remote", map[string]interface{}{"upstream": upstream.URL + "/repo/"},
+		filepath.Join(ts.configuration.Storage.Path, "remote"), models.BoxTypeRemote)
+	require.NoError(t, err)
+	remote := NewRemoteService(ts.itemService, ts.fileService, ts.logService, ts.configuration)
+
+	// A miss streams the upstream file and caches it once it was read to the end
+	item, download, err := remote.Open(box, "pkg/a.txt")
+	require.NoError(t, err)
+	assert.Nil(t, item)
+	require.NotNil(t, download)
+	content, err := io.ReadAll(download.Body)
+	assert.NoError(t, err)
+	assert.NoError(t, download.Body.Close())
+	assert.Equal(t, "upstream content", string(content))
+	assert.Equal(t, "upstream content", ts.fileContent(t, box, "pkg/a.txt"))
+	assert.Equal(t, int32(1), requests.Load())
+
+	// A fresh hit does not ask the upstream
+	item, download, err = remote.Open(box, "pkg/a.txt")
+	require.NoError(t, err)
+	assert.Nil(t, download)
+	require.NotNil(t, item)
+	assert.Contains(t, string(item.Properties), `\"v1\"`)
+	assert.Equal(t, int32(1), requests.Load())
+
+	// A stale hit is revalidated, the upstream answers 304
+	setRemoteProperties(t, box, map[string]interface{}{"upstream": upstream.URL + "/repo/", "metadata_ttl": 0})
+	item, download, err = remote.Open(box, "pkg/a.txt")
+	require.NoError(t, err)
+	assert.Nil(t, download)
+	assert.NotNil(t, item)
+	assert.Equal(t, int32(2), requests.Load())
+
+	// A 404 is remembered for the negative TTL
+	_, _, err = remote.Open(box, "pkg/missing.txt")
+	assert.ErrorIs(t, err, ErrRemoteNotFound)
+	_, _, err = remote.Open(box, "pkg/missing.txt")
+	assert.ErrorIs(t, err, ErrRemoteNotFound)
+	assert.Equal(t, int32(3), requests.Load())
+
+	// Offline boxes serve what they have and never ask the upstream
+	setRemoteProperties(t, box, map[string]interface{}{"upstream": upstream.URL + "/repo/", "metadata_ttl": 0, "offline": true})
+	item, _, err = remote.Open(box, "pkg/a.txt")
+	assert.NoError(t, err)
+	assert.NotNil(t, item)
+	_, _, err = remote.Open(box, "pkg/other.txt")
+	assert.ErrorIs(t, err, ErrRemoteNotFound)
+	assert.Equal(t, int32(3), requests.Load())
+
+	// An unreachable upstream still leaves the cached files
+	upstream.Close()
+	setRemoteProperties(t, box, map[string]interface{}{"upstream": upstream.URL + "/repo/", "metadata_ttl": 0})
+	item, _, err = remote.Open(box, "pkg/a.txt")
+	assert.NoError(t, err)
+	assert.NotNil(t, item)
+	_, _, err = remote.Open(box, "pkg/other.txt")
+	assert.ErrorIs(t, err, ErrUpstreamUnavailable)
+}
@@ -0,0 +1,626 @@
+package services
+
+import (
+	"Boxed/internal/helpers"
+	"Boxed/internal/models"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	rpmRepodataDir = "repodata"
+	// rpmChangelogLimit follows the default of createrepo, only the newest entries are published
+	rpmChangelogLimit = 10
+	rpmSearchPage     = 1000
+)
+
+// Dependency flags of the rpm header
+const (
+	rpmSenseLess       = 1 << 1
+	rpmSenseGreater    = 1 << 2
+	rpmSenseEqual      = 1 << 3
+	rpmSensePrereq     = 1 << 6
+	rpmSenseScriptPre  = 1 << 9
+	rpmSenseScriptPost = 1 << 10
+	rpmFileGhost       = 1 << 6
+)
+
+// rpmPrimaryFiles matches the files listed in primary.xml next to filelists.xml, the ones
+// dependencies commonly point at
+var rpmPrimaryFiles = regexp.MustCompile(`^/etc/|bin/|^/usr/lib/sendmail$`)
+
+// RpmPackage identifies a package of the repository
+type RpmPackage struct {
+	Name     string `json:"name"`
+	Epoch    string `json:"epoch"`
+	Version  string `json:"version"`
+	Release  string `json:"release"`
+	Arch     string `json:"arch"`
+	Location string `json:"location"`
+}
+
+// RpmService keeps boxes of type rpm as YUM/DNF repositories. Every .rpm stored in the box, through
+// this service or the generic file API, gets the fields of its header as properties together with its
+// entries of the repository metadata. repodata/ is assembled from those entries whenever a package is
+// added or deleted, so only the changed package is read.
+type RpmService interface {
+	Upload(box *models.Box, filePath string, body io.Reader) (*RpmPackage, error)
+	Delete(box *models.Box, filePath string) error
+	File(box *models.Box, filePath string) (*models.Item, error)
+	RegenerateRepodata(box *models.Box) error
+}
+
+type RpmServiceImpl struct {
+	itemService ItemService
+	fileService FileService
+	logService  LogService
+	lock        sync.Mutex
+}
+
+func NewRpmService(
+	itemService ItemService,
+	fileService FileService,
+	logService LogService,
+) RpmService {
+	service := &RpmServiceImpl{
+		itemService: itemService,
+		fileService: fileService,
+		logService:  logService,
+	}
+	fileService.AddFileListener(service)
+	return service
+}
+
+// Upload stores a package at filePath, the file listener indexes it. Packages are immutable once uploaded.
+func (s *RpmServiceImpl) Upload(box *models.Box, filePath string, body io.Reader) (*RpmPackage, error) {
+	if !strings.HasSuffix(filePath, ".rpm") || strings.HasPrefix(filePath, rpmRepodataDir+"/") {
+		return nil, fmt.Errorf("%w: %s is not a package path", ErrInvalidPackage, filePath)
+	}
+	existing, err := s.itemService.FindByPathAndBoxId(filePath, box.ID)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, fmt.Errorf("%w: %s", ErrVersionExists, filePath)
+	}
+
+	blob, err := s.fileService.StoreBlob(box, filePath, body)
+	if err != nil {
+		return nil, err
+	}
+	header, err := s.readRpmBlob(box, blob.SHA256)
+	if err != nil {
+		return nil, err
+	}
+	rpmPackage := &RpmPackage{
+		Name:     header.String(helpers.RpmTagName),
+		Epoch:    rpmEpoch(header),
+		Version:  header.String(helpers.RpmTagVersion),
+		Release:  header.String(helpers.RpmTagRelease),
+		Arch:     rpmArch(header),
+		Location: filePath,
+	}
+	if rpmPackage.Name == "" || rpmPackage.Version == "" || rpmPackage.Release == "" || rpmPackage.Arch == "" {
+		return nil, fmt.Errorf("%w: header lacks name, version, release or arch", ErrInvalidPackage)
+	}
+	if _, err := s.fileService.CreateFileFromBlob(box, filePath, blob, false, ""); err != nil {
+		return nil, err
+	}
+	return rpmPackage, nil
+}
+
+// Delete removes a package through the FileService, the file listener updates repodata
+func (s *RpmServiceImpl) Delete(box *models.Box, filePath string) error {
+	item, err := s.File(box, filePath)
+	if err != nil {
+		return err
+	}
+	if !strings.HasSuffix(item.Name, ".rpm") {
+		return fmt.Errorf("%w: %s is not a package", ErrInvalidPackage, filePath)
+	}
+	return s.fileService.DeleteItemOnDisk(*item, box)
+}
+
+func (s *RpmServiceImpl) File(box *models.Box, filePath string) (*models.Item, error) {
+	item, err := s.itemService.FindByPathAndBoxId(filePath, box.ID)
+	if err != nil {
+		return nil, err
+	}
+	if item == nil || item.Type != "file" {
+		return nil, fmt.Errorf("%w: %s", ErrPackageNotFound, filePath)
+	}
+	return item, nil
+}
+
+func (s *RpmServiceImpl) RegenerateRepodata(box *models.Box) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.regenerateRepodata(box)
+}
+
+// FileStored indexes packages stored in rpm boxes
+func (s *RpmServiceImpl) FileStored(box *models.Box, filePath string, item models.Item) {
+	if box.Type != models.BoxTypeRpm || !strings.HasSuffix(strings.ToLower(item.Name), ".rpm") {
+		return
+	}
+	rpmLog := s.logService.Log.WithFields(logrus.Fields{
+		"box":  box.Name,
+		"path": filePath,
+	})
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if err := s.indexPackage(box, filePath, item); err != nil {
+		rpmLog.WithError(err).Warn("Failed to index rpm package")
+	}
+	// A failed package is left out, even when it replaced one that was indexed
+	if err := s.regenerateRepodata(box); err != nil {
+		rpmLog.WithError(err).Error("Failed to regenerate repodata")
+		return
+	}
+	rpmLog.Info("Rpm package indexed")
+}
+
+// FileDeleted updates repodata when packages, or folders that may hold some, are deleted from rpm boxes
+func (s *RpmServiceImpl) FileDeleted(box *models.Box, item models.Item) {
+	if box.Type != models.BoxTypeRpm || item.Type != "folder" && !strings.HasSuffix(strings.ToLower(item.Name), ".rpm") {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.regenerateRepodata(box); err != nil {
+		s.logService.Log.WithFields(logrus.Fields{
+			"box":  box.Name,
+			"item": item.Name,
+		}).WithError(err).Error("Failed to regenerate repodata")
+	}
+}
+
+// indexPackage reads the header of a stored package into its properties, next to the properties it already has
+func (s *RpmServiceImpl) indexPackage(box *models.Box, filePath string, item models.Item) error {
+	header, err := s.readRpmBlob(box, item.SHA256)
+	if err != nil {
+		return err
+	}
+	properties := helpers.PropertiesFromJSON(item.Properties)
+	for key, values := range rpmProperties(header, filePath, item) {
+		properties[key] = values
+	}
+	propertiesJSON, err := json.Marshal(properties)
+	if err != nil {
+		return err
+	}
+	return s.itemService.UpdateProperties(item.ID, propertiesJSON)
+}
+
+// regenerateRepodata assembles primary, filelists and other from the entries of the indexed packages
+// and writes repomd.xml describing them
+func (s *RpmServiceImpl) regenerateRepodata(box *models.Box) error {
+	filter := fmt.Sprintf(`box_id eq "%d" and extension eq "rpm" and type eq "file"`, box.ID)
+	var items []models.Item
+	for offset := 0; ; offset += rpmSearchPage {
+		page, err := s.itemService.ItemsSearch(filter, "id", rpmSearchPage, offset)
+		if err != nil {
+			return err
+		}
+		items = append(items, page...)
+		if len(page) < rpmSearchPage {
+			break
+		}
+	}
+
+	documents := []struct {
+		kind     string
+		property string
+		open     string
+		close    string
+		content  bytes.Buffer
+	}{
+		{kind: "primary", property: "primary_xml", open: `<metadata xmlns="http://linux.duke.edu/metadata/common" xmlns:rpm="http://linux.duke.edu/metadata/rpm" packages="%d">`, close: "</metadata>"},
+		{kind: "filelists", property: "filelists_xml", open: `<filelists xmlns="http://linux.duke.edu/metadata/filelists" packages="%d">`, close: "</filelists>"},
+		{kind: "other", property: "other_xml", open: `<otherdata xmlns="http://linux.duke.edu/metadata/other" packages="%d">`, close: "</otherdata>"},
+	}
+	count := 0
+	for _, item := range items {
+		properties := helpers.PropertiesFromJSON(item.Properties)
+		if len(properties["primary_xml"]) == 0 || len(properties["filelists_xml"]) == 0 || len(properties["other_xml"]) == 0 {
+			continue
+		}
+		count++
+		for i := range documents {
+			documents[i].content.WriteString(properties[documents[i].property][0] + "\n")
+		}
+	}
+
+	now := time.Now().Unix()
+	repomd := rpmRepomd{
+		Xmlns:    "http://linux.duke.edu/metadata/repo",
+		XmlnsRpm: "http://linux.duke.edu/metadata/rpm",
+		Revision: strconv.FormatInt(now, 10),
+	}
+	for i := range documents {
+		document := &documents[i]
+		var content bytes.Buffer
+		content.WriteString(xml.Header)
+		fmt.Fprintf(&content, document.open+"\n", count)
+		content.Write(document.content.Bytes())
+		content.WriteString(document.close + "\n")
+
+		var compressed bytes.Buffer
+		gzipWriter := gzip.NewWriter(&compressed)
+		if _, err := gzipWriter.Write(content.Bytes()); err != nil {
+			return err
+		}
+		if err := gzipWriter.Close(); err != nil {
+			return err
+		}
+		location := rpmRepodataDir + "/" + document.kind + ".xml.gz"
+		if _, err := s.fileService.CreateFileFromReader(box, location, bytes.NewReader(compressed.Bytes()), false, ""); err != nil {
+			return err
+		}
+		repomd.Data = append(repomd.Data, rpmRepomdData{
+			Type:         document.kind,
+			Checksum:     rpmChecksum{Type: "sha256", Value: sha256Hex(compressed.Bytes())},
+			OpenChecksum: rpmChecksum{Type: "sha256", Value: sha256Hex(content.Bytes())},
+			Location:     rpmLocation{Href: location},
+			Timestamp:    now,
+			Size:         int64(compressed.Len()),
+			OpenSize:     int64(content.Len()),
+		})
+	}
+
+	repomdXML, err := xml.MarshalIndent(repomd, "", "  ")
+	if err != nil {
+		return err
+	}
+	repomdXML = append([]byte(xml.Header), append(repomdXML, '\n')...)
+	_, err = s.fileService.CreateFileFromReader(box, rpmRepodataDir+"/repomd.xml", bytes.NewReader(repomdXML), false, "")
+	return err
+}
+
+func sha256Hex(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *RpmServiceImpl) readRpmBlob(box *models.Box, sha256sum string) (*helpers.RpmHeader, error) {
+	file, err := s.fileService.OpenBlob(box, sha256sum)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	header, err := helpers.ReadRpmHeader(file)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPackage, err)
+	}
+	return header, nil
+}
+
+// rpmArch is the architecture createrepo lists, source packages have no source rpm of their own
+func rpmArch(header *helpers.RpmHeader) string {
+	if !header.Has(helpers.RpmTagSourceRpm) {
+		return "src"
+	}
+	return header.String(helpers.RpmTagArch)
+}
+
+func rpmEpoch(header *helpers.RpmHeader) string {
+	epoch, _ := header.Int(helpers.RpmTagEpoch)
+	return strconv.FormatInt(epoch, 10)
+}
+
+// rpmProperties returns the header fields and the metadata entries stored with a package
+func rpmProperties(header *helpers.RpmHeader, filePath string, item models.Item) map[string][]string {
+	version := rpmVersion{
+		Epoch: rpmEpoch(header),
+		Ver:   header.String(helpers.RpmTagVersion),
+		Rel:   header.String(helpers.RpmTagRelease),
+	}
+	name, arch := header.String(helpers.RpmTagName), rpmArch(header)
+	provides := rpmDependencies(header, helpers.RpmTagProvideName, helpers.RpmTagProvideFlags, helpers.RpmTagProvideVersion)
+	requires := rpmDependencies(header, helpers.RpmTagRequireName, helpers.RpmTagRequireFlags, helpers.RpmTagRequireVersion)
+
+	var files, primaryFiles []rpmFile
+	modes, flags := header.Ints(helpers.RpmTagFileModes), header.Ints(helpers.RpmTagFileFlags)
+	for i, filePath := range header.Files() {
+		file := rpmFile{Path: filePath}
+		if i < len(flags) && flags[i]&rpmFileGhost != 0 {
+			file.Type = "ghost"
+		} else if i < len(modes) && modes[i]&0o170000 == 0o040000 {
+			file.Type = "dir"
+		}
+		files = append(files, file)
+		if rpmPrimaryFiles.MatchString(filePath) {
+			primaryFiles = append(primaryFiles, file)
+		}
+	}
+
+	installedSize, ok := header.Int(helpers.RpmTagLongSize)
+	if !ok {
+		installedSize, _ = header.Int(helpers.RpmTagSize)
+	}
+	archiveSize, _ := header.Int(helpers.RpmTagArchiveSize)
+	buildTime, _ := header.Int(helpers.RpmTagBuildTime)
+	primary := rpmPrimaryPackage{
+		Type:        "rpm",
+		Name:        name,
+		Arch:        arch,
+		Version:     version,
+		Checksum:    rpmChecksum{Type: "sha256", Pkgid: "YES", Value: item.SHA256},
+		Summary:     header.String(helpers.RpmTagSummary),
+		Description: header.String(helpers.RpmTagDescription),
+		Packager:    header.String(helpers.RpmTagPackager),
+		URL:         header.String(helpers.RpmTagURL),
+		Time:        rpmTime{File: item.CreatedAt.Unix(), Build: buildTime},
+		Size:        rpmSize{Package: item.Size, Installed: installedSize, Archive: archiveSize},
+		Location:    rpmLocation{Href: filePath},
+		Format: rpmFormat{
+			License:     header.String(helpers.RpmTagLicense),
+			Vendor:      header.String(helpers.RpmTagVendor),
+			Group:       header.String(helpers.RpmTagGroup),
+			BuildHost:   header.String(helpers.RpmTagBuildHost),
+			SourceRpm:   header.String(helpers.RpmTagSourceRpm),
+			HeaderRange: rpmHeaderRange{Start: header.Start, End: header.End},
+			Provides:    rpmEntryList(provides),
+			Requires:    rpmEntryList(requires),
+			Conflicts:   rpmEntryList(rpmDependencies(header, helpers.RpmTagConflictName, helpers.RpmTagConflictFlags, helpers.RpmTagConflictVersion)),
+			Obsoletes:   rpmEntryList(rpmDependencies(header, helpers.RpmTagObsoleteName, helpers.RpmTagObsoleteFlags, helpers.RpmTagObsoleteVersion)),
+			Files:       primaryFiles,
+		},
+	}
+	filelists := rpmFilelistsPackage{Pkgid: item.SHA256, Name: name, Arch: arch, Version: version, Files: files}
+	other := rpmOtherPackage{Pkgid: item.SHA256, Name: name, Arch: arch, Version: version}
+	times := header.Ints(helpers.RpmTagChangelogTime)
+	authors := header.Strings(helpers.RpmTagChangelogName)
+	texts := header.Strings(helpers.RpmTagChangelogText)
+	// The header keeps the newest entry first, the metadata lists them oldest first
+	for i := min(len(times), len(authors), len(texts), rpmChangelogLimit) - 1; i >= 0; i-- {
+		other.Changelogs = append(other.Changelogs, rpmChangelog{Author: authors[i], Date: times[i], Text: texts[i]})
+	}
+
+	properties := map[string][]string{
+		"name":          {name},
+		"epoch":         {version.Epoch},
+		"version":       {version.Ver},
+		"release":       {version.Rel},
+		"arch":          {arch},
+		"location":      {filePath},
+		"primary_xml":   {rpmMarshal(primary)},
+		"filelists_xml": {rpmMarshal(filelists)},
+		"other_xml":     {rpmMarshal(other)},
+	}
+	for key, tag := range map[string]int{"summary": helpers.RpmTagSummary, "license": helpers.RpmTagLicense, "sourcerpm": helpers.RpmTagSourceRpm} {
+		if value := header.String(tag); value != "" {
+			properties[key] = []string{value}
+		}
+	}
+	for _, entry := range provides {
+		properties["provides"] = append(properties["provides"], entry.String())
+	}
+	for _, entry := range requires {
+		properties["requires"] = append(properties["requires"], entry.String())
+	}
+	return properties
+}
+
+// rpmDependencies reads one kind of dependency, leaving out the rpmlib() features of rpm itself
+func rpmDependencies(header *helpers.RpmHeader, nameTag int, flagsTag int, versionTag int) []rpmEntry {
+	names, flags, versions := header.Strings(nameTag), header.Ints(flagsTag), header.Strings(versionTag)
+	seen := make(map[rpmEntry]bool)
+	var entries []rpmEntry
+	for i, name := range names {
+		if strings.HasPrefix(name, "rpmlib(") {
+			continue
+		}
+		entry := rpmEntry{Name: name}
+		if i < len(flags) {
+			entry.Flags = rpmFlagName(flags[i])
+			if flags[i]&(rpmSensePrereq|rpmSenseScriptPre|rpmSenseScriptPost) != 0 {
+				entry.Pre = "1"
+			}
+		}
+		if i < len(versions) && versions[i] != "" {
+			entry.Epoch, entry.Ver, entry.Rel = rpmSplitEVR(versions[i])
+		}
+		if !seen[entry] {
+			seen[entry] = true
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+func rpmFlagName(flags int64) string {
+	switch flags & (rpmSenseLess | rpmSenseGreater | rpmSenseEqual) {
+	case rpmSenseLess:
+		return "LT"
+	case rpmSenseGreater:
+		return "GT"
+	case rpmSenseEqual:
+		return "EQ"
+	case rpmSenseLess | rpmSenseEqual:
+		return "LE"
+	case rpmSenseGreater | rpmSenseEqual:
+		return "GE"
+	}
+	return ""
+}
+
+// rpmSplitEVR splits [epoch:]version[-release], the epoch defaults to 0
+func rpmSplitEVR(evr string) (string, string, string) {
+	epoch := "0"
+	if before, after, found := strings.Cut(evr, ":"); found {
+		epoch, evr = before, after
+	}
+	version, release := evr, ""
+	if i := strings.LastIndex(evr, "-"); i >= 0 {
+		version, release = evr[:i], evr[i+1:]
+	}
+	return epoch, version, release
+}
+
+func rpmMarshal(value interface{}) string {
+	content, err := xml.Marshal(value)
+	if err != nil {
+		return ""
+	}
+	return string(content)
+}
+
+func rpmEntryList(entries []rpmEntry) *rpmEntries {
+	if len(entries) == 0 {
+		return nil
+	}
+	return &rpmEntries{Entries: entries}
+}
+
+type rpmVersion struct {
+	Epoch string `xml:"epoch,attr"`
+	Ver   string `xml:"ver,attr"`
+	Rel   string `xml:"rel,attr"`
+}
+
+type rpmChecksum struct {
+	Type  string `xml:"type,attr"`
+	Pkgid string `xml:"pkgid,attr,omitempty"`
+	Value string `xml:",chardata"`
+}
+
+type rpmLocation struct {
+	Href string `xml:"href,attr"`
+}
+
+type rpmTime struct {
+	File  int64 `xml:"file,attr"`
+	Build int64 `xml:"build,attr"`
+}
+
+type rpmSize struct {
+	Package   int64 `xml:"package,attr"`
+	Installed int64 `xml:"installed,attr"`
+	Archive   int64 `xml:"archive,attr"`
+}
+
+type rpmHeaderRange struct {
+	Start int64 `xml:"start,attr"`
+	End   int64 `xml:"end,attr"`
+}
+
+type rpmEntry struct {
+	Name  string `xml:"name,attr"`
+	Flags string `xml:"flags,attr,omitempty"`
+	Epoch string `xml:"epoch,attr,omitempty"`
+	Ver   string `xml:"ver,attr,omitempty"`
+	Rel   string `xml:"rel,attr,omitempty"`
+	Pre   string `xml:"pre,attr,omitempty"`
+}
+
+// String writes the entry the way rpm -q --requires does, e.g. "glibc >= 2.34"
+func (e rpmEntry) String() string {
+	operators := map[string]string{"LT": "<", "GT": ">", "EQ": "=", "LE": "<=", "GE": ">="}
+	if e.Flags == "" || e.Ver == "" {
+		return e.Name
+	}
+	evr := e.Ver
+	if e.Epoch != "" && e.Epoch != "0" {
+		evr = e.Epoch + ":" + evr
+	}
+	if e.Rel != "" {
+		evr += "-" + e.Rel
+	}
+	return e.Name + " " + operators[e.Flags] + " " + evr
+}
+
+type rpmEntries struct {
+	Entries []rpmEntry `xml:"rpm:entry"`
+}
+
+type rpmFile struct {
+	Type string `xml:"type,attr,omitempty"`
+	Path string `xml:",chardata"`
+}
+
+type rpmFormat struct {
+	License     string         `xml:"rpm:license"`
+	Vendor      string         `xml:"rpm:vendor"`
+	Group       string         `xml:"rpm:group"`
+	BuildHost   string         `xml:"rpm:buildhost"`
+	SourceRpm   string         `xml:"rpm:sourcerpm"`
+	HeaderRange rpmHeaderRange `xml:"rpm:header-range"`
+	Provides    *rpmEntries    `xml:"rpm:provides,omitempty"`
+	Requires    *rpmEntries    `xml:"rpm:requires,omitempty"`
+	Conflicts   *rpmEntries    `xml:"rpm:conflicts,omitempty"`
+	Obsoletes   *rpmEntries    `xml:"rpm:obsoletes,omitempty"`
+	Files       []rpmFile      `xml:"file"`
+}
+
+type rpmPrimaryPackage struct {
+	XMLName     xml.Name    `xml:"package"`
+	Type        string      `xml:"type,attr"`
+	Name        string      `xml:"name"`
+	Arch        string      `xml:"arch"`
+	Version     rpmVersion  `xml:"version"`
+	Checksum    rpmChecksum `xml:"checksum"`
+	Summary     string      `xml:"summary"`
+	Description string      `xml:"description"`
+	Packager    string      `xml:"packager"`
+	URL         string      `xml:"url"`
+	Time        rpmTime     `xml:"time"`
+	Size        rpmSize     `xml:"size"`
+	Location    rpmLocation `xml:"location"`
+	Format      rpmFormat   `xml:"format"`
+}
+
+type rpmFilelistsPackage struct {
+	XMLName xml.Name   `xml:"package"`
+	Pkgid   string     `xml:"pkgid,attr"`
+	Name    string     `xml:"name,attr"`
+	Arch    string     `xml:"arch,attr"`
+	Version rpmVersion `xml:"version"`
+	Files   []rpmFile  `xml:"file"`
+}
+
+type rpmChangelog struct {
+	Author string `xml:"author,attr"`
+	Date   int64  `xml:"date,attr"`
+	Text   string `xml:",chardata"`
+}
+
+type rpmOtherPackage struct {
+	XMLName    xml.Name       `xml:"package"`
+	Pkgid      string         `xml:"pkgid,attr"`
+	Name       string         `xml:"name,attr"`
+	Arch       string         `xml:"arch,attr"`
+	Version    rpmVersion     `xml:"version"`
+	Changelogs []rpmChangelog `xml:"changelog"`
+}
+
+type rpmRepomdData struct {
+	Type         string      `xml:"type,attr"`
+	Checksum     rpmChecksum `xml:"checksum"`
+	OpenChecksum rpmChecksum `xml:"open-checksum"`
+	Location     rpmLocation `xml:"location"`
+	Timestamp    int64       `xml:"timestamp"`
+	Size         int64       `xml:"size"`
+	OpenSize     int64       `xml:"open-size"`
+}
+
+type rpmRepomd struct {
+	XMLName  xml.Name        `xml:"repomd"`
+	Xmlns    string          `xml:"xmlns,attr"`
+	XmlnsRpm string          `xml:"xmlns:rpm,attr"`
+	Revision string          `xml:"revision"`
+	Data     []rpmRepomdData `xml:"data"`
+}
@@ -0,0 +1,374 @@
+package services
+
+import (
+	"Boxed/internal/config"
+	"Boxed/internal/helpers"
+	"Boxed/internal/models"
+	"Boxed/internal/storage"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/robfig/cron/v3"
+	"github.com/sirupsen/logrus"
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	scrubJobType = "scrub"
+	// scrubFindingsLimit caps the findings kept in the report, the counters cover every blob
+	scrubFindingsLimit = 100
+	// orphanedBlobGrace keeps content that was just stored from being reported before its item is created
+	orphanedBlobGrace = 24 * time.Hour
+)
+
+const (
+	ScrubMissing  = "missing"
+	ScrubCorrupt  = "corrupt"
+	ScrubOrphaned = "orphaned"
+)
+
+// ScrubFinding is a blob the scrub found missing, corrupt or orphaned, Items are the paths of the items
+// referencing it and Versions the number of prior revisions doing so
+type ScrubFinding struct {
+	Kind     string   `json:"kind"`
+	Box      string   `json:"box"`
+	SHA256   string   `json:"sha256"`
+	Items    []string `json:"items,omitempty"`
+	Versions int      `json:"versions,omitempty"`
+	Detail   string   `json:"detail,omitempty"`
+}
+
+// ScrubReport is the result of a scrub job. Unverified blobs could not be read, their errors are the
+// errors of the job.
+type ScrubReport struct {
+	Boxes      int            `json:"boxes"`
+	Verified   int            `json:"verified"`
+	Unverified int            `json:"unverified"`
+	Missing    int            `json:"missing"`
+	Corrupt    int            `json:"corrupt"`
+	Orphaned   int            `json:"orphaned"`
+	Findings   []ScrubFinding `json:"findings,omitempty"`
+	Truncated  bool           `json:"truncated,omitempty"`
+}
+
+func (r *ScrubReport) add(finding ScrubFinding) {
+	switch finding.Kind {
+	case ScrubMissing:
+		r.Missing++
+	case ScrubCorrupt:
+		r.Corrupt++
+	case ScrubOrphaned:
+		r.Orphaned++
+	}
+	if len(r.Findings) >= scrubFindingsLimit {
+		r.Truncated = true
+		return
+	}
+	r.Findings = append(r.Findings, finding)
+}
+
+// Scrubber re-verifies the checksums of the stored content of every box. Corrupt content is moved to the
+// quarantine of the blob store and the items referencing it are flagged, so downloading them fails with
+// a clear error until the content is stored again. Orphaned content is only reported, never deleted.
+type Scrubber struct {
+	itemService   ItemService
+	boxService    BoxService
+	fileService   FileService
+	jobService    JobService
+	blobStore     storage.BlobStore
+	logService    LogService
+	configuration *config.Configuration
+	scrubbing     bool
+	mutex         sync.Mutex
+	cron          *cron.Cron
+}
+
+func NewScrubService(
+	itemService ItemService,
+	boxService BoxService,
+	fileService FileService,
+	jobService JobService,
+	blobStore storage.BlobStore,
+	logService LogService,
+	configuration *config.Configuration,
+) *Scrubber {
+	s := &Scrubber{
+		itemService:   itemService,
+		boxService:    boxService,
+		fileService:   fileService,
+		jobService:    jobService,
+		blobStore:     blobStore,
+		logService:    logService,
+		configuration: configuration,
+		cron:          cron.New(),
+	}
+	// Verifying a blob twice does no harm, so an interrupted scrub simply starts over
+	jobService.RegisterHandler(scrubJobType, s.runScrubJob, true)
+	return s
+}
+
+// ForceScrub starts a scrub job right away
+func (s *Scrubber) ForceScrub() (*models.Job, error) {
+	if s.IsScrubbing() {
+		return nil, errors.New("scrubbing is in progress")
+	}
+	return s.jobService.Enqueue(scrubJobType, struct{}{})
+}
+
+// StartScrubCycle schedules the scrub job, nothing is scheduled without a schedule in the configuration
+func (s *Scrubber) StartScrubCycle() {
+	schedule := s.configuration.Server.ScrubConfig.Schedule
+	if schedule == "" {
+		return
+	}
+	_, err := s.cron.AddFunc(schedule, func() {
+		if s.IsScrubbing() {
+			return
+		}
+		if _, err := s.jobService.Enqueue(scrubJobType, struct{}{}); err != nil {
+			s.logService.Log.WithFields(logrus.Fields{
+				"job":   scrubJobType,
+				"error": err.Error(),
+			}).Error("Failed to enqueue scrub job")
+		}
+	})
+	if err != nil {
+		s.logService.Log.WithFields(logrus.Fields{
+			"job":   scrubJobType,
+			"cron":  schedule,
+			"error": err.Error(),
+		}).Error("Failed to schedule scrub job")
+		return
+	}
+	s.cron.Start()
+}
+
+func (s *Scrubber) IsScrubbing() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.scrubbing
+}
+
+func (s *Scrubber) runScrubJob(ctx context.Context, _ *models.Job, progress *JobProgress) error {
+	s.mutex.Lock()
+	if s.scrubbing {
+		s.mutex.Unlock()
+		return errors.New("scrubbing is in progress")
+	}
+	s.scrubbing = true
+	s.mutex.Unlock()
+	defer func() {
+		s.mutex.Lock()
+		s.scrubbing = false
+		s.mutex.Unlock()
+	}()
+
+	boxes, err := s.boxService.GetBoxes()
+	if err != nil {
+		return err
+	}
+	report := &ScrubReport{}
+	for i := range boxes {
+		if err := s.scrubBox(ctx, &boxes[i], report, progress); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			progress.AddError(fmt.Errorf("box %s: %w", boxes[i].Name, err))
+			continue
+		}
+		report.Boxes++
+	}
+	progress.SetResult(report)
+
+	logFields := logrus.Fields{
+		"job":        scrubJobType,
+		"boxes":      report.Boxes,
+		"verified":   report.Verified,
+		"unverified": report.Unverified,
+		"missing":    report.Missing,
+		"corrupt":    report.Corrupt,
+		"orphaned":   report.Orphaned,
+	}
+	if report.Missing > 0 || report.Corrupt > 0 {
+		s.logService.Log.WithFields(logFields).Warn("Scrub found damaged content")
+	} else {
+		s.logService.Log.WithFields(logFields).Info("Scrub finished")
+	}
+	return nil
+}
+
+// scrubBox verifies every blob stored for the box and reports the referenced ones that are not stored
+func (s *Scrubber) scrubBox(ctx context.Context, box *models.Box, report *ScrubReport, progress *JobProgress) error {
+	cutoff := time.Now().Add(-orphanedBlobGrace)
+	listed := make(map[string]bool)
+	err := s.blobStore.List(box, func(info storage.BlobInfo) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		listed[info.Digest] = true
+		items, versions, err := s.itemService.FindBlobReferences(box.ID, info.Digest)
+		if err != nil {
+			return err
+		}
+		if len(items) == 0 && len(versions) == 0 {
+			// Content stored just now may not have its item yet
+			if info.ModTime.Before(cutoff) {
+				report.add(ScrubFinding{Kind: ScrubOrphaned, Box: box.Name, SHA256: info.Digest})
+			}
+			return nil
+		}
+		return s.verify(box, info.Digest, items, versions, report, progress)
+	})
+	if err != nil {
+		return err
+	}
+
+	referenced, err := s.itemService.FindReferencedBlobs(box.ID)
+	if err != nil {
+		return err
+	}
+	for _, digest := range referenced {
+		if listed[digest] {
+			continue
+		}
+		// Content stored while listing is not missing
+		if _, err := s.blobStore.Stat(box, digest); !errors.Is(err, storage.ErrBlobNotFound) {
+			if err != nil {
+				progress.AddError(fmt.Errorf("box %s, blob %s: %w", box.Name, digest, err))
+				report.Unverified++
+			}
+			continue
+		}
+		items, versions, err := s.itemService.FindBlobReferences(box.ID, digest)
+		if err != nil {
+			return err
+		}
+		report.add(s.finding(ScrubMissing, box, digest, items, versions, "the content is not stored"))
+	}
+	return nil
+}
+
+// verify recomputes the checksums of a blob and quarantines it when they do not match its references
+func (s *Scrubber) verify(
+	box *models.Box,
+	digest string,
+	items []models.Item,
+	versions []models.ItemVersion,
+	report *ScrubReport,
+	progress *JobProgress,
+) error {
+	detail, err := s.check(box, digest, items, versions, progress)
+	switch {
+	case errors.Is(err, storage.ErrBlobNotFound):
+		// Released while listing, it is not referenced anymore
+		return nil
+	case errors.Is(err, storage.ErrInvalidCompression), errors.Is(err, storage.ErrInvalidEncryption):
+		detail = err.Error()
+	case err != nil:
+		// An unavailable key or a failing store says nothing about the content, it stays where it is
+		progress.AddError(fmt.Errorf("box %s, blob %s: %w", box.Name, digest, err))
+		report.Unverified++
+		return nil
+	}
+	progress.AddItems(1)
+	if detail == "" {
+		report.Verified++
+		return s.release(box, digest, items)
+	}
+
+	if err := s.blobStore.Quarantine(box, digest); err != nil && !errors.Is(err, storage.ErrBlobNotFound) {
+		return err
+	}
+	if err := s.itemService.SetQuarantined(box.ID, digest, true); err != nil {
+		return err
+	}
+	finding := s.finding(ScrubCorrupt, box, digest, items, versions, detail)
+	s.logService.Log.WithFields(logrus.Fields{
+		"job":    scrubJobType,
+		"box":    box.Name,
+		"sha256": digest,
+		"items":  finding.Items,
+		"detail": detail,
+	}).Error("Corrupt content quarantined")
+	report.add(finding)
+	return nil
+}
+
+// check reads the content of a blob and returns why it does not match its references, nothing when it does
+func (s *Scrubber) check(
+	box *models.Box,
+	digest string,
+	items []models.Item,
+	versions []models.ItemVersion,
+	progress *JobProgress,
+) (string, error) {
+	blob, err := s.fileService.OpenBlob(box, digest)
+	if err != nil {
+		return "", err
+	}
+	sha256sum, sha512sum, size, err := helpers.CopyAndComputeChecksums(io.Discard, blob)
+	_ = blob.Close()
+	progress.AddBytes(size)
+	if err != nil {
+		return "", err
+	}
+	if sha256sum != digest {
+		return fmt.Sprintf("the content has the SHA256 %s", sha256sum), nil
+	}
+	for _, item := range items {
+		if detail := mismatch(item.SHA512, item.Size, sha512sum, size); detail != "" {
+			return detail, nil
+		}
+	}
+	for _, version := range versions {
+		if detail := mismatch(version.SHA512, version.Size, sha512sum, size); detail != "" {
+			return detail, nil
+		}
+	}
+	return "", nil
+}
+
+// mismatch compares the recorded checksum and size of a reference with the ones of the content
+func mismatch(recordedSHA512 string, recordedSize int64, sha512sum string, size int64) string {
+	if recordedSHA512 != "" && recordedSHA512 != sha512sum {
+		return fmt.Sprintf("the content has the SHA512 %s, %s was recorded", sha512sum, recordedSHA512)
+	}
+	if recordedSize != size {
+		return fmt.Sprintf("the content has %d bytes, %d were recorded", size, recordedSize)
+	}
+	return ""
+}
+
+// release clears the flag of items whose content verifies again, as after it was put back by hand
+func (s *Scrubber) release(box *models.Box, digest string, items []models.Item) error {
+	for _, item := range items {
+		if item.Quarantined {
+			return s.itemService.SetQuarantined(box.ID, digest, false)
+		}
+	}
+	return nil
+}
+
+func (s *Scrubber) finding(
+	kind string,
+	box *models.Box,
+	digest string,
+	items []models.Item,
+	versions []models.ItemVersion,
+	detail string,
+) ScrubFinding {
+	paths := make([]string, 0, len(items))
+	for i := range items {
+		paths = append(paths, helpers.LtreeToUserPath(&items[i]))
+	}
+	return ScrubFinding{
+		Kind:     kind,
+		Box:      box.Name,
+		SHA256:   digest,
+		Items:    paths,
+		Versions: len(versions),
+		Detail:   detail,
+	}
+}
@@ -0,0 +1,111 @@
+package services
+
+import (
+	"Boxed/internal/models"
+	"Boxed/internal/storage"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// scrub runs a scrub job to the end and returns its report
+func (ts *testServices) scrub(t *testing.T, scrubber *Scrubber) *ScrubReport {
+	job, err := scrubber.ForceScrub()
+	require.NoError(t, err)
+	job = ts.waitForJob(t, job.ID)
+	require.Equal(t, models.JobStatusSucceeded, job.Status, job.Error)
+	var report ScrubReport
+	require.NoError(t, json.Unmarshal(job.Result, &report))
+	return &report
+}
+
+// blobPath is where the local blob store keeps content
+func blobPath(box *models.Box, digest string) string {
+	return filepath.Join(box.Path, digest[2:4], digest[:2], digest)
+}
+
+func TestScrubber_QuarantineAndRelease(t *testing.T) {
+	ts := setupTestServices(t)
+	scrubber := NewScrubService(ts.itemService, ts.boxService, ts.fileService, ts.jobService, ts.blobStore, ts.logService, ts.configuration)
+	box := ts.createBox(t, "files", nil)
+	good := ts.storeFile(t, box, "good.txt", "good content")
+	bad := ts.storeFile(t, box, "bad.txt", "bad content")
+	missing := ts.storeFile(t, box, "missing.txt", "missing content")
+
+	require.NoError(t, os.WriteFile(blobPath(box, bad.SHA256), []byte("tampered"), 0600))
+	require.NoError(t, os.Remove(blobPath(box, missing.SHA256)))
+	// Content no item references, stored long enough ago to not be on its way into the box
+	orphanSum := sha256.Sum256([]byte("orphan"))
+	orphan := hex.EncodeToString(orphanSum[:])
+	require.NoError(t, ts.blobStore.Put(box, orphan, strings.NewReader("orphan")))
+	old := time.Now().Add(-2 * orphanedBlobGrace)
+	require.NoError(t, os.Chtimes(blobPath(box, orphan), old, old))
+
+	report := ts.scrub(t, scrubber)
+	assert.Equal(t, 1, report.Boxes)
+	assert.Equal(t, 1, report.Verified)
+	assert.Equal(t, 1, report.Corrupt)
+	assert.Equal(t, 1, report.Missing)
+	assert.Equal(t, 1, report.Orphaned)
+	kinds := make(map[string]ScrubFinding)
+	for _, finding := range report.Findings {
+		kinds[finding.Kind] = finding
+	}
+	assert.Equal(t, bad.SHA256, kinds[ScrubCorrupt].SHA256)
+	assert.Equal(t, []string{"bad.txt"}, kinds[ScrubCorrupt].Items)
+	assert.Equal(t, missing.SHA256, kinds[ScrubMissing].SHA256)
+	assert.Equal(t, orphan, kinds[ScrubOrphaned].SHA256)
+
+	// Corrupt content is moved aside and its items are flagged
+	assert.True(t, ts.item(t, bad.ID).Quarantined)
+	assert.False(t, ts.item(t, good.ID).Quarantined)
+	assert.False(t, ts.blobExists(t, box, bad.SHA256))
+	quarantined, err := os.ReadDir(filepath.Join(box.Path, "quarantine"))
+	require.NoError(t, err)
+	require.Len(t, quarantined, 1)
+	assert.True(t, strings.HasPrefix(quarantined[0].Name(), bad.SHA256))
+
+	// Storing the content again releases the items
+	ts.storeFile(t, box, "bad.txt", "bad content")
+	assert.False(t, ts.item(t, bad.ID).Quarantined)
+
+	// So does content that verifies again after it was put back by hand
+	require.NoError(t, ts.itemService.SetQuarantined(box.ID, good.SHA256, true))
+	report = ts.scrub(t, scrubber)
+	assert.Equal(t, 2, report.Verified)
+	assert.Zero(t, report.Corrupt)
+	assert.False(t, ts.item(t, good.ID).Quarantined)
+}
+
+func TestScrubber_UnreadableContentStays(t *testing.T) {
+	ts := setupTestServices(t)
+	box := ts.createBox(t, "files", nil)
+	file := ts.storeFile(t, box, "file.txt", "content")
+	// A store that cannot be read says nothing about the content
+	failing := &failingBlobStore{BlobStore: ts.blobStore}
+	fileService := NewFileService(ts.itemService, ts.boxService, failing, ts.keyService, ts.logService, ts.configuration)
+	scrubber := NewScrubService(ts.itemService, ts.boxService, fileService, ts.jobService, failing, ts.logService, ts.configuration)
+
+	report := ts.scrub(t, scrubber)
+	assert.Equal(t, 1, report.Unverified)
+	assert.Zero(t, report.Corrupt)
+	assert.False(t, ts.item(t, file.ID).Quarantined)
+	assert.True(t, ts.blobExists(t, box, file.SHA256))
+}
+
+// failingBlobStore lists and stats the content of the wrapped store but fails to read it
+type failingBlobStore struct {
+	storage.BlobStore
+}
+
+func (s *failingBlobStore) Get(*models.Box, string) (storage.Blob, error) {
+	return nil, errors.New("store unavailable")
+}
@@ -0,0 +1,87 @@
+package services
+
+import (
+	"Boxed/internal/dto"
+	"Boxed/internal/helpers"
+	"Boxed/internal/mapper"
+	"Boxed/internal/models"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrTrashNotFound = errors.New("not found in the trash")
+	ErrTrashConflict = errors.New("cannot be restored")
+)
+
+// TrashService gives access to the items deleted in a box until the Janitor purges them. A deleted
+// folder takes everything below it along and brings it back when it is restored.
+type TrashService interface {
+	// List returns the deleted items of a box, the latest deletion first
+	List(box *models.Box) ([]dto.TrashItemDTO, error)
+	// Restore takes the deleted item with the given id out of the trash, its path must be free
+	Restore(box *models.Box, id uint) (*dto.ItemGetDTO, error)
+}
+
+type TrashServiceImpl struct {
+	itemService ItemService
+	fileService FileService
+}
+
+func NewTrashService(itemService ItemService, fileService FileService) TrashService {
+	return &TrashServiceImpl{itemService: itemService, fileService: fileService}
+}
+
+func (s *TrashServiceImpl) List(box *models.Box) ([]dto.TrashItemDTO, error) {
+	items, err := s.itemService.FindTrash(box.ID)
+	if err != nil {
+		return nil, err
+	}
+	trash := make([]dto.TrashItemDTO, 0, len(items))
+	for i := range items {
+		itemDTO, err := mapper.ToItemGetDTO(&items[i])
+		if err != nil {
+			return nil, err
+		}
+		trash = append(trash, dto.TrashItemDTO{
+			ItemGetDTO: *itemDTO,
+			DeletedAt:  items[i].DeletedAt.Time,
+			DeletedBy:  items[i].DeletedBy,
+		})
+	}
+	return trash, nil
+}
+
+func (s *TrashServiceImpl) Restore(box *models.Box, id uint) (*dto.ItemGetDTO, error) {
+	item, err := s.itemService.FindDeletedByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if item == nil || item.BoxID != box.ID {
+		return nil, fmt.Errorf("%w: item %d", ErrTrashNotFound, id)
+	}
+	if item.TrashedWith != nil {
+		return nil, fmt.Errorf("%w: it was deleted with the folder %d, restore that one", ErrTrashConflict, *item.TrashedWith)
+	}
+	if item.ParentID != nil {
+		parent, err := s.itemService.FindDeletedByID(*item.ParentID)
+		if err != nil {
+			return nil, err
+		}
+		if parent != nil {
+			return nil, fmt.Errorf("%w: its folder %d is in the trash, restore that one first", ErrTrashConflict, parent.ID)
+		}
+	}
+	itemPath := helpers.LtreeToUserPath(item)
+	existing, err := s.itemService.FindByPathAndBoxId(itemPath, box.ID)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, fmt.Errorf("%w: %s exists again", ErrTrashConflict, itemPath)
+	}
+	if err := s.fileService.RestoreItem(item, box); err != nil {
+		return nil, err
+	}
+	return s.itemService.GetItemByID(item.ID)
+}
@@ -0,0 +1,327 @@
+package services
+
+import (
+	"Boxed/internal/config"
+	"Boxed/internal/dto"
+	"Boxed/internal/helpers"
+	"Boxed/internal/models"
+	"Boxed/internal/repository"
+	"Boxed/internal/storage"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrUploadNotFound       = errors.New("upload session not found")
+	ErrUploadOffsetMismatch = errors.New("upload offset mismatch")
+	ErrUploadTooLarge       = errors.New("upload exceeds announced length")
+	ErrUploadIncomplete     = errors.New("upload is incomplete")
+	ErrUploadCompleted      = errors.New("upload already completed")
+	defaultSessionExpiry    = 24 * time.Hour
+)
+
+// UploadService manages resumable upload sessions. Chunks are appended to a staging file,
+// which is moved into the hash storage once the upload is finalized.
+type UploadService interface {
+	CreateSession(box *models.Box, filePath string, length int64, flat bool, properties string) (*models.UploadSession, error)
+	GetSession(id string) (*models.UploadSession, error)
+	SetLength(id string, length int64) (*models.UploadSession, error)
+	WriteChunk(id string, offset int64, reader io.Reader) (*models.UploadSession, error)
+	FinalizeSession(id string) (*dto.ItemGetDTO, error)
+	FinalizeSessionAt(id string, filePath string, sha256sum string) (*dto.ItemGetDTO, error)
+	AbortSession(id string) error
+	CleanupExpired() (int, error)
+}
+
+type uploadServiceImpl struct {
+	sessionRepo   repository.UploadSessionRepository
+	fileService   FileService
+	boxService    BoxService
+	itemService   ItemService
+	logService    LogService
+	configuration config.Configuration
+	locks         sync.Map
+}
+
+func NewUploadService(
+	sessionRepo repository.UploadSessionRepository,
+	fileService FileService,
+	boxService BoxService,
+	itemService ItemService,
+	logService LogService,
+	configuration *config.Configuration,
+) UploadService {
+	return &uploadServiceImpl{
+		sessionRepo:   sessionRepo,
+		fileService:   fileService,
+		boxService:    boxService,
+		itemService:   itemService,
+		logService:    logService,
+		configuration: *configuration,
+	}
+}
+
+func (s *uploadServiceImpl) CreateSession(box *models.Box, filePath string, length int64, flat bool, properties string) (*models.UploadSession, error) {
+	filePath = strings.Trim(filePath, "/")
+	if filePath == "" || strings.Contains(filePath, "..") {
+		return nil, fmt.Errorf("invalid path: %s", filePath)
+	}
+	session := &models.UploadSession{
+		UUID:       uuid.NewString(),
+		BoxID:      box.ID,
+		Path:       filePath,
+		Length:     length,
+		Flat:       flat,
+		Properties: properties,
+		ExpiresAt:  time.Now().Add(s.sessionExpiry()),
+	}
+	if err := os.MkdirAll(s.stagingDir(), 0750); err != nil {
+		return nil, fmt.Errorf("failed to create upload staging directory: %w", err)
+	}
+	stagingFile, err := os.OpenFile(s.stagingPath(session.UUID), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create upload staging file: %w", err)
+	}
+	if err := stagingFile.Close(); err != nil {
+		return nil, err
+	}
+	if err := s.sessionRepo.Create(session); err != nil {
+		_ = os.Remove(s.stagingPath(session.UUID))
+		return nil, err
+	}
+	s.logService.Log.WithFields(logrus.Fields{
+		"job":    "upload",
+		"upload": session.UUID,
+		"box":    box.Name,
+		"path":   filePath,
+	}).Debug("Upload session created")
+	return session, nil
+}
+
+func (s *uploadServiceImpl) GetSession(id string) (*models.UploadSession, error) {
+	session, err := s.sessionRepo.FindByUUID(id)
+	if err != nil {
+		return nil, err
+	}
+	if session == nil || session.ExpiresAt.Before(time.Now()) {
+		return nil, ErrUploadNotFound
+	}
+	return session, nil
+}
+
+// SetLength announces the final size of an upload created with a deferred length
+func (s *uploadServiceImpl) SetLength(id string, length int64) (*models.UploadSession, error) {
+	unlock := s.lock(id)
+	defer unlock()
+
+	session, err := s.GetSession(id)
+	if err != nil {
+		return nil, err
+	}
+	if session.LengthKnown() {
+		if session.Length != length {
+			return nil, fmt.Errorf("upload length is already set to %d", session.Length)
+		}
+		return session, nil
+	}
+	if length < session.Offset {
+		return nil, ErrUploadTooLarge
+	}
+	session.Length = length
+	if err := s.sessionRepo.Update(session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// WriteChunk appends the chunk at offset, which must match the current offset of the session
+func (s *uploadServiceImpl) WriteChunk(id string, offset int64, reader io.Reader) (*models.UploadSession, error) {
+	unlock := s.lock(id)
+	defer unlock()
+
+	session, err := s.GetSession(id)
+	if err != nil {
+		return nil, err
+	}
+	if session.IsComplete() {
+		return nil, ErrUploadCompleted
+	}
+	if offset != session.Offset {
+		return nil, fmt.Errorf("%w: expected %d, got %d", ErrUploadOffsetMismatch, session.Offset, offset)
+	}
+
+	stagingFile, err := os.OpenFile(s.stagingPath(session.UUID), os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open upload staging file: %w", err)
+	}
+	defer stagingFile.Close()
+	// Drop whatever a previously interrupted chunk left behind the stored offset
+	if err := stagingFile.Truncate(session.Offset); err != nil {
+		return nil, err
+	}
+	if _, err := stagingFile.Seek(session.Offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	source := reader
+	if session.LengthKnown() {
+		// Read one byte more than allowed to detect chunks overflowing the announced length
+		source = io.LimitReader(reader, session.Length-session.Offset+1)
+	}
+	written, copyErr := io.Copy(stagingFile, source)
+	if session.LengthKnown() && session.Offset+written > session.Length {
+		_ = stagingFile.Truncate(session.Offset)
+		return nil, ErrUploadTooLarge
+	}
+
+	// Keep what arrived even if the connection dropped, the client resumes from the stored offset
+	session.Offset += written
+	session.ExpiresAt = time.Now().Add(s.sessionExpiry())
+	if err := s.sessionRepo.Update(session); err != nil {
+		return nil, err
+	}
+	if copyErr != nil {
+		return session, fmt.Errorf("failed to write chunk: %w", copyErr)
+	}
+	return session, nil
+}
+
+// FinalizeSession hashes the assembled file into the hash storage and creates or updates the item
+func (s *uploadServiceImpl) FinalizeSession(id string) (*dto.ItemGetDTO, error) {
+	return s.FinalizeSessionAt(id, "", "")
+}
+
+// FinalizeSessionAt finalizes the upload like FinalizeSession, but stores it at filePath instead of the
+// path of the session when one is given. A non-empty sha256sum must match the assembled file, otherwise
+// the upload is rejected before anything reaches the hash storage.
+func (s *uploadServiceImpl) FinalizeSessionAt(id string, filePath string, sha256sum string) (*dto.ItemGetDTO, error) {
+	unlock := s.lock(id)
+	defer unlock()
+
+	session, err := s.GetSession(id)
+	if err != nil {
+		return nil, err
+	}
+	if session.IsComplete() {
+		return s.itemService.GetItemByID(*session.ItemID)
+	}
+	if session.LengthKnown() && session.Offset != session.Length {
+		return nil, fmt.Errorf("%w: %d of %d bytes received", ErrUploadIncomplete, session.Offset, session.Length)
+	}
+	if sha256sum != "" {
+		assembled, _, err := helpers.ComputeChecksums(s.stagingPath(session.UUID))
+		if err != nil {
+			return nil, err
+		}
+		if assembled != sha256sum {
+			return nil, fmt.Errorf("%w: upload hashes to sha256:%s", ErrChecksumMismatch, assembled)
+		}
+	}
+	if filePath != "" {
+		session.Path = filePath
+	}
+	box, err := s.boxService.GetBoxByID(session.BoxID)
+	if err != nil {
+		return nil, err
+	}
+
+	item, err := s.fileService.CreateFileFromPath(box, session.Path, s.stagingPath(session.UUID), session.Flat, session.Properties)
+	if err != nil {
+		return nil, err
+	}
+
+	// The session is kept until it expires so clients can still query the final offset
+	session.ItemID = &item.ID
+	session.Length = session.Offset
+	if err := s.sessionRepo.Update(session); err != nil {
+		return nil, err
+	}
+	s.logService.Log.WithFields(logrus.Fields{
+		"job":    "upload",
+		"upload": session.UUID,
+		"path":   session.Path,
+		"size":   session.Length,
+	}).Info("Upload finalized")
+	return item, nil
+}
+
+func (s *uploadServiceImpl) AbortSession(id string) error {
+	unlock := s.lock(id)
+	defer unlock()
+
+	session, err := s.GetSession(id)
+	if err != nil {
+		return err
+	}
+	return s.removeSession(session)
+}
+
+// CleanupExpired removes expired sessions together with their staging files
+func (s *uploadServiceImpl) CleanupExpired() (int, error) {
+	sessions, err := s.sessionRepo.FindExpired(time.Now())
+	if err != nil {
+		return 0, err
+	}
+	var removed int
+	for i := range sessions {
+		unlock := s.lock(sessions[i].UUID)
+		err := s.removeSession(&sessions[i])
+		unlock()
+		if err != nil {
+			s.logService.Log.WithFields(logrus.Fields{
+				"job":    "clean",
+				"upload": sessions[i].UUID,
+			}).WithError(err).Error("Failed to remove expired upload session")
+			continue
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+func (s *uploadServiceImpl) removeSession(session *models.UploadSession) error {
+	if err := os.Remove(s.stagingPath(session.UUID)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := s.sessionRepo.HardDelete(session); err != nil {
+		return err
+	}
+	s.locks.Delete(session.UUID)
+	return nil
+}
+
+// lock serializes operations on a single upload session
+func (s *uploadServiceImpl) lock(id string) func() {
+	if _, err := uuid.Parse(id); err != nil {
+		// Not a session ID, the lookup that follows fails anyway
+		return func() {}
+	}
+	value, _ := s.locks.LoadOrStore(id, &sync.Mutex{})
+	mutex := value.(*sync.Mutex)
+	mutex.Lock()
+	return mutex.Unlock
+}
+
+func (s *uploadServiceImpl) sessionExpiry() time.Duration {
+	expiry, err := time.ParseDuration(s.configuration.Server.UploadConfig.SessionExpiry)
+	if err != nil || expiry <= 0 {
+		return defaultSessionExpiry
+	}
+	return expiry
+}
+
+func (s *uploadServiceImpl) stagingDir() string {
+	return storage.StagingDir(s.configuration.Storage.Path, "uploads")
+}
+
+func (s *uploadServiceImpl) stagingPath(id string) string {
+	return filepath.Join(s.stagingDir(), id)
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"Boxed/internal/config"
+	"Boxed/internal/repository"
+	"Boxed/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func setupTestUpload(t *testing.T, configuration *config.Configuration) (*testServices, UploadService) {
+	ts := setupTestServicesWithConfig(t, configuration)
+	upload := NewUploadService(repository.NewUploadSessionRepository(ts.db), ts.fileService, ts.boxService,
+		ts.itemService, ts.logService, ts.configuration)
+	return ts, upload
+}
+
+func TestUploadService_SessionLifecycle(t *testing.T) {
+	ts, upload := setupTestUpload(t, &config.Configuration{})
+	box := ts.createBox(t, "files", nil)
+
+	session, err := upload.CreateSession(box, "/docs/report.txt/", 11, false, "kind=report")
+	require.NoError(t, err)
+	assert.Equal(t, "docs/report.txt", session.Path)
+	// Staged chunks stay out of the way of the boxes
+	stagingPath := filepath.Join(storage.StagingDir(ts.configuration.Storage.Path, "uploads"), session.UUID)
+	assert.FileExists(t, stagingPath)
+
+	session, err = upload.WriteChunk(session.UUID, 0, strings.NewReader("hello "))
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), session.Offset)
+	_, err = upload.WriteChunk(session.UUID, 0, strings.NewReader("again"))
+	assert.ErrorIs(t, err, ErrUploadOffsetMismatch)
+	_, err = upload.WriteChunk(session.UUID, 6, strings.NewReader("world and more"))
+	assert.ErrorIs(t, err, ErrUploadTooLarge)
+	_, err = upload.FinalizeSession(session.UUID)
+	assert.ErrorIs(t, err, ErrUploadIncomplete)
+
+	_, err = upload.WriteChunk(session.UUID, 6, strings.NewReader("world"))
+	require.NoError(t, err)
+	item, err := upload.FinalizeSession(session.UUID)
+	require.NoError(t, err)
+	assert.Equal(t, "report.txt", item.Name)
+	assert.Equal(t, "hello world", ts.fileContent(t, box, "docs/report.txt"))
+	assert.Contains(t, string(ts.findItem(t, box, "docs/report.txt").Properties), "report")
+	assert.NoFileExists(t, stagingPath)
+
+	// The finished session still answers, with the item it created
+	again, err := upload.FinalizeSession(session.UUID)
+	assert.NoError(t, err)
+	assert.Equal(t, item.ID, again.ID)
+	_, err = upload.WriteChunk(session.UUID, 11, strings.NewReader("!"))
+	assert.ErrorIs(t, err, ErrUploadCompleted)
+}
+
+func TestUploadService_DeferredLengthAndAbort(t *testing.T) {
+	ts, upload := setupTestUpload(t, &config.Configuration{})
+	box := ts.createBox(t, "files", nil)
+
+	session, err := upload.CreateSession(box, "stream.bin", -1, false, "")
+	require.NoError(t, err)
+	_, err = upload.WriteChunk(session.UUID, 0, strings.NewReader("abc"))
+	require.NoError(t, err)
+	_, err = upload.SetLength(session.UUID, 2)
+	assert.Error(t, err)
+	session, err = upload.SetLength(session.UUID, 4)
+	require.NoError(t, err)
+	assert.True(t, session.LengthKnown())
+	_, err = upload.FinalizeSession(session.UUID)
+	assert.ErrorIs(t, err, ErrUploadIncomplete)
+
+	require.NoError(t, upload.AbortSession(session.UUID))
+	_, err = upload.GetSession(session.UUID)
+	assert.ErrorIs(t, err, ErrUploadNotFound)
+	assert.NoFileExists(t, filepath.Join(storage.StagingDir(ts.configuration.Storage.Path, "uploads"), session.UUID))
+	assert.Nil(t, ts.findItem(t, box, "stream.bin"))
+}
+
+func TestUploadService_CleanupExpired(t *testing.T) {
+	configuration := &config.Configuration{}
+	configuration.Server.UploadConfig.SessionExpiry = "1ns"
+	ts, upload := setupTestUpload(t, configuration)
+	box := ts.createBox(t, "files", nil)
+
+	session, err := upload.CreateSession(box, "late.txt", 4, false, "")
+	require.NoError(t, err)
+	_, err = upload.WriteChunk(session.UUID, 0, strings.NewReader("late"))
+	assert.ErrorIs(t, err, ErrUploadNotFound)
+
+	removed, err := upload.CleanupExpired()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, removed)
+	assert.NoFileExists(t, filepath.Join(storage.StagingDir(ts.configuration.Storage.Path, "uploads"), session.UUID))
+}
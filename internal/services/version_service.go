@@ -0,0 +1,180 @@
+package services
+
+import (
+	"Boxed/internal/dto"
+	"Boxed/internal/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"strconv"
+)
+
+var ErrVersionNotFound = errors.New("version not found")
+
+// VersionService gives access to the prior revisions of files, which are kept whenever a file is
+// overwritten. The "keep_versions" property of a box limits how many prior revisions of each file
+// are kept, the Janitor drops the older ones.
+type VersionService interface {
+	// Versions returns the file at filePath and its prior revisions, the newest first
+	Versions(box *models.Box, filePath string) (*dto.ItemGetDTO, []models.ItemVersion, error)
+	// Version returns a revision of the file at filePath as an item, the current one included
+	Version(box *models.Box, filePath string, version int) (*models.Item, error)
+	// Restore makes a prior revision the current content of the file at filePath
+	Restore(box *models.Box, filePath string, version int) (*dto.ItemGetDTO, error)
+	// Prune drops the prior revisions beyond the "keep_versions" of the box and returns how many
+	// revisions were dropped and how much of their content was freed
+	Prune(box *models.Box) (int, int64, error)
+}
+
+type VersionServiceImpl struct {
+	itemService ItemService
+	fileService FileService
+	logService  LogService
+}
+
+func NewVersionService(itemService ItemService, fileService FileService, logService LogService) VersionService {
+	return &VersionServiceImpl{itemService: itemService, fileService: fileService, logService: logService}
+}
+
+func (s *VersionServiceImpl) Versions(box *models.Box, filePath string) (*dto.ItemGetDTO, []models.ItemVersion, error) {
+	item, err := s.file(box, filePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	versions, err := s.itemService.FindVersions(item.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	current, err := s.itemService.GetItemByID(item.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return current, versions, nil
+}
+
+func (s *VersionServiceImpl) Version(box *models.Box, filePath string, version int) (*models.Item, error) {
+	item, err := s.file(box, filePath)
+	if err != nil {
+		return nil, err
+	}
+	if version == item.Version {
+		return item, nil
+	}
+	itemVersion, err := s.itemService.FindVersion(item.ID, version)
+	if err != nil {
+		return nil, err
+	}
+	if itemVersion == nil {
+		return nil, fmt.Errorf("%w: %s has no version %d", ErrVersionNotFound, filePath, version)
+	}
+	revision := *item
+	revision.Version = itemVersion.Version
+	revision.Size = itemVersion.Size
+	revision.SHA256 = itemVersion.SHA256
+	revision.SHA512 = itemVersion.SHA512
+	revision.Properties = itemVersion.Properties
+	revision.Uploader = itemVersion.Uploader
+	revision.UpdatedAt = itemVersion.UploadedAt
+	// Only the current content of a file is flagged by the scrubber
+	revision.Quarantined = revision.Quarantined && revision.SHA256 == item.SHA256
+	return &revision, nil
+}
+
+func (s *VersionServiceImpl) Restore(box *models.Box, filePath string, version int) (*dto.ItemGetDTO, error) {
+	item, err := s.file(box, filePath)
+	if err != nil {
+		return nil, err
+	}
+	itemVersion, err := s.itemService.FindVersion(item.ID, version)
+	if err != nil {
+		return nil, err
+	}
+	if itemVersion == nil {
+		return nil, fmt.Errorf("%w: %s has no prior version %d", ErrVersionNotFound, filePath, version)
+	}
+	restored, err := s.fileService.CreateFileFromVersion(box, filePath, itemVersion)
+	if err != nil {
+		return nil, err
+	}
+	s.logService.Log.WithFields(logrus.Fields{
+		"box":     box.Name,
+		"path":    filePath,
+		"version": version,
+	}).Info("Version restored")
+	return restored, nil
+}
+
+func (s *VersionServiceImpl) Prune(box *models.Box) (int, int64, error) {
+	keep, ok := keepVersions(box)
+	if !ok {
+		return 0, 0, nil
+	}
+	itemIDs, err := s.itemService.FindItemIDsWithMoreVersions(box.ID, keep)
+	if err != nil {
+		return 0, 0, err
+	}
+	var removed int
+	var freed int64
+	for _, itemID := range itemIDs {
+		versions, err := s.itemService.FindVersions(itemID)
+		if err != nil {
+			return removed, freed, err
+		}
+		for i := keep; i < len(versions); i++ {
+			if err := s.itemService.DeleteVersion(&versions[i]); err != nil {
+				return removed, freed, err
+			}
+			removed++
+			// Content shared with other revisions or items stays, so it is only counted when it is gone
+			references, err := s.itemService.CountBlobReferences(box.ID, versions[i].SHA256)
+			if err != nil {
+				return removed, freed, err
+			}
+			if references == 0 {
+				if err := s.fileService.ReleaseBlob(box, versions[i].SHA256); err != nil {
+					return removed, freed, err
+				}
+				stored := versions[i].StoredSize
+				if stored == 0 {
+					// Kept before the stored size was recorded, the content was stored as it is then
+					stored = versions[i].Size
+				}
+				freed += stored
+			}
+		}
+	}
+	return removed, freed, nil
+}
+
+// file returns the file item at filePath, only files have revisions
+func (s *VersionServiceImpl) file(box *models.Box, filePath string) (*models.Item, error) {
+	item, err := s.itemService.FindByPathAndBoxId(filePath, box.ID)
+	if err != nil {
+		return nil, err
+	}
+	if item == nil || item.Type != "file" {
+		return nil, fmt.Errorf("%w: no file at %s", ErrVersionNotFound, filePath)
+	}
+	return item, nil
+}
+
+// keepVersions reads the "keep_versions" property of a box, a number or a numeric string. Without it
+// every revision is kept.
+func keepVersions(box *models.Box) (int, bool) {
+	var properties map[string]interface{}
+	if err := json.Unmarshal(box.Properties, &properties); err != nil {
+		return 0, false
+	}
+	switch value := properties["keep_versions"].(type) {
+	case float64:
+		if value >= 0 {
+			return int(value), true
+		}
+	case string:
+		if keep, err := strconv.Atoi(value); err == nil && keep >= 0 {
+			return keep, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,253 @@
+package services
+
+import (
+	"Boxed/internal/helpers"
+	"Boxed/internal/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrVirtualNotFound      = errors.New("not found in any member")
+	ErrVirtualNotConfigured = errors.New("virtual box is not configured")
+	ErrVirtualNotWritable   = errors.New("virtual box does not accept the path")
+)
+
+// VirtualMember is a box a virtual box resolves against. A path is only resolved against the member
+// when it matches one of the include patterns, if there are any, and none of the exclude patterns.
+type VirtualMember struct {
+	Box     *models.Box
+	Include []string
+	Exclude []string
+}
+
+// Accepts reports whether the patterns of the member route filePath to it
+func (m VirtualMember) Accepts(filePath string) bool {
+	if len(m.Include) > 0 && !helpers.MatchAnyGlob(m.Include, filePath) {
+		return false
+	}
+	return !helpers.MatchAnyGlob(m.Exclude, filePath)
+}
+
+// lists reports whether a child of the member shows up in listings. A folder may hold files matching
+// the include patterns further down, so only the exclude patterns hide it.
+func (m VirtualMember) lists(child models.Item, childPath string) bool {
+	if child.Type == "folder" {
+		return !helpers.MatchAnyGlob(m.Exclude, childPath)
+	}
+	return m.Accepts(childPath)
+}
+
+// VirtualService puts several boxes behind the path of one box of type virtual. The "members" property
+// of the box lists them in priority order, as {"box": name, "include": patterns, "exclude": patterns}
+// with the patterns given as a list or a comma separated string. The member named by the "default"
+// property receives the writes.
+type VirtualService interface {
+	// Members returns the members of a virtual box in priority order
+	Members(box *models.Box) ([]VirtualMember, error)
+	// Open resolves filePath against the members in priority order. A remote member that has to fetch
+	// the file answers with a download, the item is nil then.
+	Open(box *models.Box, filePath string) (*models.Box, *models.Item, *RemoteDownload, error)
+	// Find returns the item at filePath of the first member having it, without asking any upstream
+	Find(box *models.Box, filePath string) (*models.Box, *models.Item, error)
+	// List returns the folder at folderPath with the children of that folder in all members, on a name
+	// clash the child of the member with the higher priority is kept
+	List(box *models.Box, folderPath string) (*models.Item, error)
+	// WriteTarget returns the member that stores a file written to filePath
+	WriteTarget(box *models.Box, filePath string) (*models.Box, error)
+}
+
+type VirtualServiceImpl struct {
+	itemService   ItemService
+	fileService   FileService
+	remoteService RemoteService
+	logService    LogService
+}
+
+func NewVirtualService(
+	itemService ItemService,
+	fileService FileService,
+	remoteService RemoteService,
+	logService LogService,
+) VirtualService {
+	return &VirtualServiceImpl{
+		itemService:   itemService,
+		fileService:   fileService,
+		remoteService: remoteService,
+		logService:    logService,
+	}
+}
+
+type virtualProperties struct {
+	Members []struct {
+		Box     string          `json:"box"`
+		Include json.RawMessage `json:"include"`
+		Exclude json.RawMessage `json:"exclude"`
+	} `json:"members"`
+	Default string `json:"default"`
+}
+
+func (s *VirtualServiceImpl) Members(box *models.Box) ([]VirtualMember, error) {
+	properties, err := s.properties(box)
+	if err != nil {
+		return nil, err
+	}
+	members := make([]VirtualMember, 0, len(properties.Members))
+	for _, member := range properties.Members {
+		memberBox, err := s.fileService.FindBoxByPath(member.Box)
+		if err != nil || memberBox == nil {
+			return nil, fmt.Errorf("%w: member %q not found", ErrVirtualNotConfigured, member.Box)
+		}
+		// Virtual members would allow cycles, they are not supported
+		if memberBox.Type == models.BoxTypeVirtual {
+			return nil, fmt.Errorf("%w: member %q is virtual", ErrVirtualNotConfigured, member.Box)
+		}
+		include, err := helpers.ParseGlobList(member.Include)
+		if err != nil {
+			return nil, fmt.Errorf("%w: include of %q: %v", ErrVirtualNotConfigured, member.Box, err)
+		}
+		exclude, err := helpers.ParseGlobList(member.Exclude)
+		if err != nil {
+			return nil, fmt.Errorf("%w: exclude of %q: %v", ErrVirtualNotConfigured, member.Box, err)
+		}
+		members = append(members, VirtualMember{Box: memberBox, Include: include, Exclude: exclude})
+	}
+	return members, nil
+}
+
+func (s *VirtualServiceImpl) Open(box *models.Box, filePath string) (*models.Box, *models.Item, *RemoteDownload, error) {
+	members, err := s.Members(box)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	var unavailable error
+	for _, member := range members {
+		if !member.Accepts(filePath) {
+			continue
+		}
+		if member.Box.Type == models.BoxTypeRemote {
+			item, download, err := s.remoteService.Open(member.Box, filePath)
+			switch {
+			case err == nil:
+				return member.Box, item, download, nil
+			case errors.Is(err, ErrRemoteNotFound):
+				continue
+			}
+			// The next members may still have the file, the error is only reported when none has
+			unavailable = err
+			continue
+		}
+		item, err := s.itemService.FindByPathAndBoxId(filePath, member.Box.ID)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if item != nil {
+			return member.Box, item, nil, nil
+		}
+	}
+	if unavailable != nil {
+		return nil, nil, nil, unavailable
+	}
+	return nil, nil, nil, fmt.Errorf("%w: %s", ErrVirtualNotFound, filePath)
+}
+
+func (s *VirtualServiceImpl) Find(box *models.Box, filePath string) (*models.Box, *models.Item, error) {
+	members, err := s.Members(box)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, member := range members {
+		if !member.Accepts(filePath) {
+			continue
+		}
+		item, err := s.itemService.FindByPathAndBoxId(filePath, member.Box.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if item != nil {
+			return member.Box, item, nil
+		}
+	}
+	return nil, nil, fmt.Errorf("%w: %s", ErrVirtualNotFound, filePath)
+}
+
+func (s *VirtualServiceImpl) List(box *models.Box, folderPath string) (*models.Item, error) {
+	members, err := s.Members(box)
+	if err != nil {
+		return nil, err
+	}
+	folderPath = strings.Trim(folderPath, "/")
+	folder := &models.Item{Name: box.Name, Type: "folder", BoxID: box.ID, Path: ""}
+	found := folderPath == ""
+	names := make(map[string]bool)
+	for _, member := range members {
+		var parentID *uint
+		if folderPath != "" {
+			item, err := s.itemService.FindByPathAndBoxId(folderPath, member.Box.ID)
+			if err != nil {
+				return nil, err
+			}
+			if item == nil || item.Type != "folder" {
+				continue
+			}
+			if !found {
+				folder.Name, folder.Path, found = item.Name, item.Path, true
+			}
+			parentID = &item.ID
+		}
+		children, err := s.itemService.FindItemsByParentID(parentID, member.Box.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, child := range children {
+			if names[child.Name] || !member.lists(child, strings.TrimPrefix(folderPath+"/"+child.Name, "/")) {
+				continue
+			}
+			names[child.Name] = true
+			folder.Children = append(folder.Children, child)
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("%w: %s", ErrVirtualNotFound, folderPath)
+	}
+	return folder, nil
+}
+
+func (s *VirtualServiceImpl) WriteTarget(box *models.Box, filePath string) (*models.Box, error) {
+	properties, err := s.properties(box)
+	if err != nil {
+		return nil, err
+	}
+	if properties.Default == "" {
+		return nil, fmt.Errorf("%w: no default member", ErrVirtualNotWritable)
+	}
+	members, err := s.Members(box)
+	if err != nil {
+		return nil, err
+	}
+	for _, member := range members {
+		if member.Box.Name != properties.Default {
+			continue
+		}
+		if member.Box.Type == models.BoxTypeRemote {
+			return nil, fmt.Errorf("%w: the default member %q is remote", ErrVirtualNotWritable, member.Box.Name)
+		}
+		if !member.Accepts(strings.Trim(filePath, "/")) {
+			return nil, fmt.Errorf("%w: %s is not routed to the default member %q", ErrVirtualNotWritable, filePath, member.Box.Name)
+		}
+		return member.Box, nil
+	}
+	return nil, fmt.Errorf("%w: the default %q is not a member", ErrVirtualNotConfigured, properties.Default)
+}
+
+func (s *VirtualServiceImpl) properties(box *models.Box) (*virtualProperties, error) {
+	var properties virtualProperties
+	if len(box.Properties) > 0 {
+		if err := json.Unmarshal(box.Properties, &properties); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrVirtualNotConfigured, err)
+		}
+	}
+	return &properties, nil
+}
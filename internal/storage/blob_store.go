@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"Boxed/internal/config"
+	"Boxed/internal/models"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	ErrBlobNotFound  = errors.New("blob not found")
+	ErrInvalidDigest = errors.New("invalid blob digest")
+)
+
+// BlobInfo describes stored content
+type BlobInfo struct {
+	Digest  string
+	Size    int64
+	ModTime time.Time
+}
+
+// Blob is stored content opened for reading, it supports sequential and random access
+type Blob interface {
+	io.ReadSeekCloser
+	io.ReaderAt
+	Size() int64
+}
+
+// BlobWriter stages new content. The digest is only known once everything was written, Commit stores
+// the content under it.
+type BlobWriter interface {
+	io.Writer
+	// Commit stores what was written under digest, content already stored under it is kept
+	Commit(digest string) error
+	// Abort drops what was written
+	Abort() error
+}
+
+// BlobStore keeps the content of the files of a box, addressed by the hex SHA256 of the content
+type BlobStore interface {
+	// Writer starts staging new content for the box
+	Writer(box *models.Box) (BlobWriter, error)
+	// Put stores the content of reader under digest
+	Put(box *models.Box, digest string, reader io.Reader) error
+	// Import moves a local file into the store under digest, the file is gone afterwards
+	Import(box *models.Box, digest string, localPath string) error
+	// Get opens the content stored under digest, ErrBlobNotFound when there is none
+	Get(box *models.Box, digest string) (Blob, error)
+	// Stat describes the content stored under digest, ErrBlobNotFound when there is none
+	Stat(box *models.Box, digest string) (*BlobInfo, error)
+	// Delete removes the content stored under digest, content that is already gone is no error
+	Delete(box *models.Box, digest string) error
+	// Copy makes the content stored under digest in source available in destination as well
+	Copy(source *models.Box, destination *models.Box, digest string) error
+	// List calls fn for all content stored for the box, an error returned by fn stops the listing
+	List(box *models.Box, fn func(info BlobInfo) error) error
+	// Quarantine moves the content stored under digest aside, it is kept for inspection but no longer
+	// found under digest. Content that is already gone is no error.
+	Quarantine(box *models.Box, digest string) error
+}
+
+// quarantineDir holds quarantined content next to the hash directories of a box
+const quarantineDir = "quarantine"
+
+// ReservedDir is the directory below the storage path that holds the files Boxed stages, no box may
+// be placed in it
+const ReservedDir = ".boxed"
+
+// StagingDir returns the directory below the reserved directory that files staged for purpose go to
+func StagingDir(storagePath string, purpose string) string {
+	return filepath.Join(storagePath, ReservedDir, purpose)
+}
+
+// IsReservedPath reports whether a box at boxPath could share a directory with staged files
+func IsReservedPath(boxPath string) bool {
+	for _, element := range strings.Split(filepath.ToSlash(filepath.Clean(boxPath)), "/") {
+		if element == ReservedDir {
+			return true
+		}
+	}
+	return false
+}
+
+// quarantineName is the name quarantined content is kept under, the time keeps repeated quarantines apart
+func quarantineName(digest string) string {
+	return digest + "." + time.Now().UTC().Format("20060102T150405.000000000")
+}
+
+// NewBlobStore returns the blob store selected by the storage configuration, the local filesystem
+// unless the backend is set to "s3"
+func NewBlobStore(configuration *config.Configuration) (BlobStore, error) {
+	stagingDir := StagingDir(configuration.Storage.Path, "blobs")
+	switch strings.ToLower(configuration.Storage.Backend) {
+	case "", "local":
+		return NewLocalBlobStore(stagingDir), nil
+	case "s3":
+		return NewS3BlobStore(configuration.Storage.S3, stagingDir)
+	}
+	return nil, fmt.Errorf("unknown storage backend %q", configuration.Storage.Backend)
+}
+
+// ValidDigest reports whether digest is a lowercase hex SHA256, the only names the stores accept
+func ValidDigest(digest string) bool {
+	if len(digest) != 64 {
+		return false
+	}
+	for _, c := range digest {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func checkDigest(digest string) error {
+	if !ValidDigest(digest) {
+		return fmt.Errorf("%w: %q", ErrInvalidDigest, digest)
+	}
+	return nil
+}
@@ -0,0 +1,349 @@
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression is how content is compressed at rest. A compressed blob is framed by a header naming
+// the compression and a trailer with the size of the original content, so it can be read back
+// whatever the box asks for today. Content without the header is stored as it is.
+type Compression string
+
+const (
+	CompressionNone Compression = "none"
+	CompressionZstd Compression = "zstd"
+	CompressionGzip Compression = "gzip"
+)
+
+var ErrInvalidCompression = errors.New("invalid compressed blob")
+
+// blobMagic starts every framed blob, the byte after it names the compression
+var blobMagic = [FrameMagicSize]byte{0x00, 'B', 'O', 'X', 'E', 'D', 0x1a, 0x0a}
+
+const (
+	frameHeaderSize  = 9
+	frameTrailerSize = 8
+)
+
+var compressionCodes = map[Compression]byte{
+	CompressionNone: 'n',
+	CompressionZstd: 'z',
+	CompressionGzip: 'g',
+}
+
+// FrameMagicSize is how much of the start of content IsFramed looks at
+const FrameMagicSize = 8
+
+// IsFramed reports whether content starting with head would be taken for a framed blob
+func IsFramed(head []byte) bool {
+	return bytes.HasPrefix(head, blobMagic[:])
+}
+
+// ParseCompression accepts the names of the compressions, an empty name means none
+func ParseCompression(name string) (Compression, error) {
+	switch Compression(name) {
+	case "", CompressionNone:
+		return CompressionNone, nil
+	case CompressionZstd, CompressionGzip:
+		return Compression(name), nil
+	}
+	return "", fmt.Errorf("unknown compression %q", name)
+}
+
+// NewEncoder returns a writer that compresses what is written to it into w. Close writes the end of
+// the frame but leaves w open. Content that is not compressed goes to w as it is, unless it starts like
+// a framed or an encrypted blob, it is framed then so it is not mistaken for one.
+func NewEncoder(w io.Writer, compression Compression) (io.WriteCloser, error) {
+	if _, ok := compressionCodes[compression]; !ok {
+		return nil, fmt.Errorf("unknown compression %q", compression)
+	}
+	return &encoder{target: w, compression: compression}, nil
+}
+
+type encoder struct {
+	target      io.Writer
+	compression Compression
+	head        []byte
+	started     bool
+	framed      bool
+	compressor  io.WriteCloser
+	size        uint64
+}
+
+func (e *encoder) Write(p []byte) (int, error) {
+	written := len(p)
+	if !e.started {
+		// Plain content is only framed when it starts with the magic, which takes its first bytes to tell
+		if e.compression == CompressionNone && len(e.head)+len(p) < FrameMagicSize {
+			e.head = append(e.head, p...)
+			return written, nil
+		}
+		p = append(e.head, p...)
+		e.head = nil
+		if err := e.start(p); err != nil {
+			return 0, err
+		}
+	}
+	if err := e.write(p); err != nil {
+		return 0, err
+	}
+	return written, nil
+}
+
+func (e *encoder) Close() error {
+	if !e.started {
+		head := e.head
+		e.head = nil
+		if err := e.start(head); err != nil {
+			return err
+		}
+		if err := e.write(head); err != nil {
+			return err
+		}
+	}
+	if !e.framed {
+		return nil
+	}
+	if e.compressor != nil {
+		if err := e.compressor.Close(); err != nil {
+			return err
+		}
+	}
+	trailer := make([]byte, frameTrailerSize)
+	binary.BigEndian.PutUint64(trailer, e.size)
+	_, err := e.target.Write(trailer)
+	return err
+}
+
+func (e *encoder) start(head []byte) error {
+	e.started = true
+	e.framed = e.compression != CompressionNone || IsFramed(head) || IsEncrypted(head)
+	if !e.framed {
+		return nil
+	}
+	header := append(blobMagic[:], compressionCodes[e.compression])
+	if _, err := e.target.Write(header); err != nil {
+		return err
+	}
+	switch e.compression {
+	case CompressionZstd:
+		compressor, err := zstd.NewWriter(e.target)
+		if err != nil {
+			return err
+		}
+		e.compressor = compressor
+	case CompressionGzip:
+		e.compressor = gzip.NewWriter(e.target)
+	}
+	return nil
+}
+
+func (e *encoder) write(p []byte) error {
+	e.size += uint64(len(p))
+	if e.compressor != nil {
+		_, err := e.compressor.Write(p)
+		return err
+	}
+	_, err := e.target.Write(p)
+	return err
+}
+
+// Decode returns the original content of a stored blob, a framed blob is unpacked and anything else
+// is returned as it is. A compressed blob is read sequentially, moving backwards starts over.
+func Decode(blob Blob) (Blob, error) {
+	if blob.Size() < frameHeaderSize+frameTrailerSize {
+		return blob, nil
+	}
+	header := make([]byte, frameHeaderSize)
+	if _, err := blob.ReadAt(header, 0); err != nil {
+		return nil, err
+	}
+	if !IsFramed(header) {
+		return blob, nil
+	}
+	trailer := make([]byte, frameTrailerSize)
+	if _, err := blob.ReadAt(trailer, blob.Size()-frameTrailerSize); err != nil {
+		return nil, err
+	}
+	size := int64(binary.BigEndian.Uint64(trailer))
+	payloadSize := blob.Size() - frameHeaderSize - frameTrailerSize
+	var compression Compression
+	for name, code := range compressionCodes {
+		if code == header[FrameMagicSize] {
+			compression = name
+		}
+	}
+	switch compression {
+	case "":
+		return nil, fmt.Errorf("%w: unknown compression %q", ErrInvalidCompression, header[FrameMagicSize])
+	case CompressionNone:
+		if size != payloadSize {
+			return nil, fmt.Errorf("%w: size does not match", ErrInvalidCompression)
+		}
+		return &sectionBlob{SectionReader: io.NewSectionReader(blob, frameHeaderSize, size), blob: blob}, nil
+	}
+	return &compressedBlob{blob: blob, compression: compression, payloadSize: payloadSize, size: size}, nil
+}
+
+// sectionBlob is the plain content inside of a frame
+type sectionBlob struct {
+	*io.SectionReader
+	blob Blob
+}
+
+func (b *sectionBlob) Close() error {
+	return b.blob.Close()
+}
+
+// compressedBlob decompresses the payload of a frame while it is read
+type compressedBlob struct {
+	lock         sync.Mutex
+	blob         Blob
+	compression  Compression
+	payloadSize  int64
+	size         int64
+	offset       int64
+	decompressed int64
+	reader       io.Reader
+	closer       func()
+	payload      *payloadReader
+}
+
+func (b *compressedBlob) Size() int64 {
+	return b.size
+}
+
+func (b *compressedBlob) Read(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	n, err := b.readAt(p, b.offset)
+	b.offset += int64(n)
+	return n, err
+}
+
+func (b *compressedBlob) ReadAt(p []byte, offset int64) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	n, err := b.readAt(p, offset)
+	if err == nil && n < len(p) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (b *compressedBlob) Seek(offset int64, whence int) (int64, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	switch whence {
+	case io.SeekCurrent:
+		offset += b.offset
+	case io.SeekEnd:
+		offset += b.size
+	}
+	if offset < 0 {
+		return 0, errors.New("seek before the start of the blob")
+	}
+	b.offset = offset
+	return offset, nil
+}
+
+func (b *compressedBlob) Close() error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.reset()
+	return b.blob.Close()
+}
+
+// readAt reads from the decompressed stream at offset, skipping ahead or starting over as needed
+func (b *compressedBlob) readAt(p []byte, offset int64) (int, error) {
+	if offset >= b.size {
+		return 0, io.EOF
+	}
+	if b.reader == nil || offset < b.decompressed {
+		if err := b.open(); err != nil {
+			return 0, err
+		}
+	}
+	if skip := offset - b.decompressed; skip > 0 {
+		skipped, err := io.CopyN(io.Discard, b.reader, skip)
+		b.decompressed += skipped
+		if err != nil {
+			return 0, b.unexpected(err)
+		}
+	}
+	if remaining := b.size - offset; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+	n, err := io.ReadFull(b.reader, p)
+	b.decompressed += int64(n)
+	if err != nil {
+		return n, b.unexpected(err)
+	}
+	return n, nil
+}
+
+func (b *compressedBlob) open() error {
+	b.reset()
+	if _, err := b.blob.Seek(frameHeaderSize, io.SeekStart); err != nil {
+		return err
+	}
+	payload := &payloadReader{reader: io.LimitReader(b.blob, b.payloadSize)}
+	b.payload = payload
+	switch b.compression {
+	case CompressionZstd:
+		decoder, err := zstd.NewReader(payload, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidCompression, err)
+		}
+		b.reader, b.closer = decoder, decoder.Close
+	case CompressionGzip:
+		decoder, err := gzip.NewReader(payload)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidCompression, err)
+		}
+		b.reader, b.closer = decoder, func() { _ = decoder.Close() }
+	}
+	b.decompressed = 0
+	return nil
+}
+
+func (b *compressedBlob) reset() {
+	if b.closer != nil {
+		b.closer()
+	}
+	b.reader, b.closer = nil, nil
+}
+
+// unexpected reports a stream that ends before the size in the trailer, or that does not decompress, as
+// broken. Errors reading the stored content are passed on as they are.
+func (b *compressedBlob) unexpected(err error) error {
+	if b.payload != nil && b.payload.err != nil {
+		return b.payload.err
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("%w: content ends early", ErrInvalidCompression)
+	}
+	return fmt.Errorf("%w: %v", ErrInvalidCompression, err)
+}
+
+// payloadReader keeps the error reading the stored content, which tells it apart from a broken stream
+type payloadReader struct {
+	reader io.Reader
+	err    error
+}
+
+func (r *payloadReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	return n, err
+}
@@ -0,0 +1,150 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// bytesBlob is stored content held in memory
+type bytesBlob struct {
+	*bytes.Reader
+}
+
+func (b bytesBlob) Close() error {
+	return nil
+}
+
+func encode(t *testing.T, content []byte, compression Compression) []byte {
+	var stored bytes.Buffer
+	encoder, err := NewEncoder(&stored, compression)
+	assert.NoError(t, err)
+	// Written in small pieces, the frame must not depend on how the content arrives
+	for start := 0; start < len(content); start += 3 {
+		end := start + 3
+		if end > len(content) {
+			end = len(content)
+		}
+		_, err := encoder.Write(content[start:end])
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, encoder.Close())
+	return stored.Bytes()
+}
+
+func decode(t *testing.T, stored []byte) Blob {
+	blob, err := Decode(bytesBlob{bytes.NewReader(stored)})
+	assert.NoError(t, err)
+	return blob
+}
+
+func TestCompression_RoundTrip(t *testing.T) {
+	content := []byte(strings.Repeat("compressible content ", 2000))
+	for _, compression := range []Compression{CompressionNone, CompressionZstd, CompressionGzip} {
+		stored := encode(t, content, compression)
+		if compression == CompressionNone {
+			assert.Equal(t, content, stored)
+		} else {
+			assert.Less(t, len(stored), len(content)/10, compression)
+		}
+
+		blob := decode(t, stored)
+		assert.Equal(t, int64(len(content)), blob.Size(), compression)
+		decoded, err := io.ReadAll(blob)
+		assert.NoError(t, err)
+		assert.Equal(t, content, decoded, compression)
+		assert.NoError(t, blob.Close())
+	}
+}
+
+func TestCompression_Empty(t *testing.T) {
+	for _, compression := range []Compression{CompressionNone, CompressionZstd, CompressionGzip} {
+		blob := decode(t, encode(t, nil, compression))
+		decoded, err := io.ReadAll(blob)
+		assert.NoError(t, err)
+		assert.Empty(t, decoded, compression)
+	}
+}
+
+func TestCompression_Seek(t *testing.T) {
+	content := []byte(strings.Repeat("0123456789", 10000))
+	blob := decode(t, encode(t, content, CompressionZstd))
+
+	_, err := blob.Seek(50000, io.SeekStart)
+	assert.NoError(t, err)
+	part := make([]byte, 10)
+	_, err = io.ReadFull(blob, part)
+	assert.NoError(t, err)
+	assert.Equal(t, "0123456789", string(part))
+
+	// Going back starts the decompression over
+	_, err = blob.ReadAt(part, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, "3456789012", string(part))
+
+	offset, err := blob.Seek(-4, io.SeekEnd)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(content)-4), offset)
+	rest, err := io.ReadAll(blob)
+	assert.NoError(t, err)
+	assert.Equal(t, "6789", string(rest))
+
+	n, err := blob.ReadAt(part, int64(len(content)-5))
+	assert.Equal(t, 5, n)
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestCompression_FramesContentLookingFramed(t *testing.T) {
+	content := append(append([]byte{}, blobMagic[:]...), "zzzzzzzzzzzzzzzzzz"...)
+	stored := encode(t, content, CompressionNone)
+	assert.NotEqual(t, content, stored)
+
+	decoded, err := io.ReadAll(decode(t, stored))
+	assert.NoError(t, err)
+	assert.Equal(t, content, decoded)
+
+	encryptedLooking := append(append([]byte{}, encryptedMagic[:]...), "zzzzzzzzzzzzzzzzzz"...)
+	stored = encode(t, encryptedLooking, CompressionNone)
+	assert.False(t, IsEncrypted(stored))
+	decoded, err = io.ReadAll(decode(t, stored))
+	assert.NoError(t, err)
+	assert.Equal(t, encryptedLooking, decoded)
+
+	// Short plain content is left as it is
+	assert.Equal(t, []byte("short"), encode(t, []byte("short"), CompressionNone))
+}
+
+func TestCompression_Broken(t *testing.T) {
+	stored := encode(t, []byte(strings.Repeat("content ", 1000)), CompressionGzip)
+	truncated := append(append([]byte{}, stored[:len(stored)/2]...), stored[len(stored)-frameTrailerSize:]...)
+	_, err := io.ReadAll(decode(t, truncated))
+	assert.True(t, errors.Is(err, ErrInvalidCompression))
+
+	// A flipped bit fails the checksum of the stream
+	for _, compression := range []Compression{CompressionZstd, CompressionGzip} {
+		flipped := encode(t, []byte(strings.Repeat("content ", 1000)), compression)
+		flipped[frameHeaderSize+(len(flipped)-frameHeaderSize-frameTrailerSize)/2] ^= 0xff
+		_, err = io.ReadAll(decode(t, flipped))
+		assert.True(t, errors.Is(err, ErrInvalidCompression), string(compression))
+	}
+
+	unknown := append([]byte{}, stored...)
+	unknown[FrameMagicSize] = 'x'
+	_, err = Decode(bytesBlob{bytes.NewReader(unknown)})
+	assert.True(t, errors.Is(err, ErrInvalidCompression))
+}
+
+func TestParseCompression(t *testing.T) {
+	compression, err := ParseCompression("")
+	assert.NoError(t, err)
+	assert.Equal(t, CompressionNone, compression)
+	compression, err = ParseCompression("zstd")
+	assert.NoError(t, err)
+	assert.Equal(t, CompressionZstd, compression)
+	_, err = ParseCompression("lzma")
+	assert.Error(t, err)
+}
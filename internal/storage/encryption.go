@@ -0,0 +1,315 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// DataKeySize is the size of the AES-256 keys content is encrypted with
+const DataKeySize = 32
+
+// Encrypted content starts with a header naming the data key, the content follows in segments that are
+// sealed one by one with AES-GCM. A segment can be decrypted on its own, which keeps random access cheap.
+// The nonce of a segment is the nonce prefix of the header followed by the index of the segment, the
+// header and a flag marking the last segment are authenticated with it, so segments can neither be
+// reordered, mixed between blobs nor cut off.
+const (
+	encryptedSegmentSize = 64 * 1024
+	encryptedHeaderSize  = FrameMagicSize + 8 + 8
+)
+
+var ErrInvalidEncryption = errors.New("invalid encrypted blob")
+
+// encryptedMagic starts every encrypted blob
+var encryptedMagic = [FrameMagicSize]byte{0x00, 'B', 'O', 'X', 'E', 'N', 'C', 0x0a}
+
+// IsEncrypted reports whether content starting with head would be taken for an encrypted blob
+func IsEncrypted(head []byte) bool {
+	return bytes.HasPrefix(head, encryptedMagic[:])
+}
+
+// KeyLookup returns the data key with the given id, the id is the one content was encrypted with
+type KeyLookup func(keyID uint64) ([]byte, error)
+
+// NewEncrypter returns a writer that encrypts what is written to it into w with the data key keyID.
+// Close writes the last segment but leaves w open.
+func NewEncrypter(w io.Writer, key []byte, keyID uint64) (io.WriteCloser, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, encryptedHeaderSize)
+	copy(header, encryptedMagic[:])
+	binary.BigEndian.PutUint64(header[FrameMagicSize:], keyID)
+	if _, err := io.ReadFull(rand.Reader, header[FrameMagicSize+8:]); err != nil {
+		return nil, err
+	}
+	return &encrypter{target: w, aead: aead, header: header, segment: make([]byte, 0, encryptedSegmentSize)}, nil
+}
+
+type encrypter struct {
+	target  io.Writer
+	aead    cipher.AEAD
+	header  []byte
+	started bool
+	index   uint32
+	segment []byte
+}
+
+func (e *encrypter) Write(p []byte) (int, error) {
+	written := len(p)
+	for len(p) > 0 {
+		// A full segment is only sealed once more content follows, the last one is sealed by Close
+		if len(e.segment) == encryptedSegmentSize {
+			if err := e.seal(false); err != nil {
+				return 0, err
+			}
+		}
+		n := copy(e.segment[len(e.segment):encryptedSegmentSize], p)
+		e.segment = e.segment[:len(e.segment)+n]
+		p = p[n:]
+	}
+	return written, nil
+}
+
+func (e *encrypter) Close() error {
+	return e.seal(true)
+}
+
+func (e *encrypter) seal(last bool) error {
+	if !e.started {
+		if _, err := e.target.Write(e.header); err != nil {
+			return err
+		}
+		e.started = true
+	}
+	if e.index == ^uint32(0) {
+		return errors.New("content too large to encrypt")
+	}
+	sealed := e.aead.Seal(nil, segmentNonce(e.header, e.index), e.segment, segmentData(e.header, last))
+	if _, err := e.target.Write(sealed); err != nil {
+		return err
+	}
+	e.index++
+	e.segment = e.segment[:0]
+	return nil
+}
+
+// Decrypt returns the content of a stored blob, an encrypted blob is decrypted with the key found by
+// keys and anything else is returned as it is
+func Decrypt(blob Blob, keys KeyLookup) (Blob, error) {
+	if blob.Size() < FrameMagicSize {
+		return blob, nil
+	}
+	header := make([]byte, encryptedHeaderSize)
+	n, err := blob.ReadAt(header, 0)
+	if n < FrameMagicSize {
+		return nil, err
+	}
+	if !IsEncrypted(header[:n]) {
+		return blob, nil
+	}
+	if n < encryptedHeaderSize {
+		return nil, fmt.Errorf("%w: header ends early", ErrInvalidEncryption)
+	}
+	key, err := keys(binary.BigEndian.Uint64(header[FrameMagicSize:]))
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	sealedSize := int64(encryptedSegmentSize + aead.Overhead())
+	payload := blob.Size() - encryptedHeaderSize
+	segments := (payload + sealedSize - 1) / sealedSize
+	if segments == 0 || payload-(segments-1)*sealedSize < int64(aead.Overhead()) {
+		return nil, fmt.Errorf("%w: content ends early", ErrInvalidEncryption)
+	}
+	return &encryptedBlob{
+		blob:       blob,
+		aead:       aead,
+		header:     header,
+		sealedSize: sealedSize,
+		segments:   segments,
+		size:       payload - segments*int64(aead.Overhead()),
+		cached:     -1,
+	}, nil
+}
+
+// encryptedBlob decrypts the segments of an encrypted blob as they are read, the last one is kept
+type encryptedBlob struct {
+	lock       sync.Mutex
+	blob       Blob
+	aead       cipher.AEAD
+	header     []byte
+	sealedSize int64
+	segments   int64
+	size       int64
+	offset     int64
+	cached     int64
+	plain      []byte
+	sealed     []byte
+}
+
+func (b *encryptedBlob) Size() int64 {
+	return b.size
+}
+
+func (b *encryptedBlob) Read(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	n, err := b.readAt(p, b.offset)
+	b.offset += int64(n)
+	if err == nil && n == 0 && len(p) > 0 {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (b *encryptedBlob) ReadAt(p []byte, offset int64) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	n, err := b.readAt(p, offset)
+	if err == nil && n < len(p) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (b *encryptedBlob) Seek(offset int64, whence int) (int64, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	switch whence {
+	case io.SeekCurrent:
+		offset += b.offset
+	case io.SeekEnd:
+		offset += b.size
+	}
+	if offset < 0 {
+		return 0, errors.New("seek before the start of the blob")
+	}
+	b.offset = offset
+	return offset, nil
+}
+
+func (b *encryptedBlob) Close() error {
+	return b.blob.Close()
+}
+
+func (b *encryptedBlob) readAt(p []byte, offset int64) (int, error) {
+	var read int
+	for read < len(p) && offset < b.size {
+		index := offset / encryptedSegmentSize
+		if err := b.open(index); err != nil {
+			return read, err
+		}
+		n := copy(p[read:], b.plain[offset-index*encryptedSegmentSize:])
+		read += n
+		offset += int64(n)
+	}
+	return read, nil
+}
+
+// open decrypts the segment with the given index, unless it is the one decrypted last
+func (b *encryptedBlob) open(index int64) error {
+	if index == b.cached {
+		return nil
+	}
+	start := encryptedHeaderSize + index*b.sealedSize
+	length := b.sealedSize
+	if index == b.segments-1 {
+		length = b.blob.Size() - start
+	}
+	if int64(cap(b.sealed)) < length {
+		b.sealed = make([]byte, b.sealedSize)
+	}
+	sealed := b.sealed[:length]
+	if n, err := b.blob.ReadAt(sealed, start); int64(n) < length {
+		if err == nil || errors.Is(err, io.EOF) {
+			err = fmt.Errorf("%w: content ends early", ErrInvalidEncryption)
+		}
+		return err
+	}
+	plain, err := b.aead.Open(b.plain[:0], segmentNonce(b.header, uint32(index)), sealed, segmentData(b.header, index == b.segments-1))
+	if err != nil {
+		b.cached = -1
+		return fmt.Errorf("%w: segment %d does not authenticate", ErrInvalidEncryption, index)
+	}
+	b.plain, b.cached = plain, index
+	return nil
+}
+
+// WrapKey seals a data key with a master key. context is authenticated along, unwrapping needs the same.
+func WrapKey(masterKey []byte, dataKey []byte, context []byte) ([]byte, error) {
+	aead, err := newAEAD(masterKey)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, dataKey, context), nil
+}
+
+// UnwrapKey opens a data key sealed by WrapKey
+func UnwrapKey(masterKey []byte, wrapped []byte, context []byte) ([]byte, error) {
+	aead, err := newAEAD(masterKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(wrapped) < aead.NonceSize() {
+		return nil, errors.New("wrapped key is too short")
+	}
+	dataKey, err := aead.Open(nil, wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():], context)
+	if err != nil {
+		return nil, errors.New("wrapped key does not authenticate with the master key")
+	}
+	return dataKey, nil
+}
+
+// NewDataKey returns a new random data key
+func NewDataKey() ([]byte, error) {
+	key := make([]byte, DataKeySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != DataKeySize {
+		return nil, fmt.Errorf("key has %d bytes, expected %d", len(key), DataKeySize)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// segmentNonce is the nonce prefix of the header followed by the index of the segment
+func segmentNonce(header []byte, index uint32) []byte {
+	nonce := make([]byte, 12)
+	copy(nonce, header[FrameMagicSize+8:])
+	binary.BigEndian.PutUint32(nonce[8:], index)
+	return nonce
+}
+
+// segmentData is the header followed by a flag marking the last segment
+func segmentData(header []byte, last bool) []byte {
+	data := append(append(make([]byte, 0, len(header)+1), header...), 0)
+	if last {
+		data[len(header)] = 1
+	}
+	return data
+}
@@ -0,0 +1,125 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func encrypt(t *testing.T, content []byte, key []byte) []byte {
+	var stored bytes.Buffer
+	encrypter, err := NewEncrypter(&stored, key, 7)
+	assert.NoError(t, err)
+	_, err = encrypter.Write(content)
+	assert.NoError(t, err)
+	assert.NoError(t, encrypter.Close())
+	return stored.Bytes()
+}
+
+func decrypt(t *testing.T, stored []byte, key []byte) (Blob, error) {
+	return Decrypt(bytesBlob{bytes.NewReader(stored)}, func(keyID uint64) ([]byte, error) {
+		assert.Equal(t, uint64(7), keyID)
+		return key, nil
+	})
+}
+
+func TestEncryption_RoundTrip(t *testing.T) {
+	key, err := NewDataKey()
+	assert.NoError(t, err)
+	for _, size := range []int{0, 1, encryptedSegmentSize, encryptedSegmentSize + 1, 3*encryptedSegmentSize - 5} {
+		content := make([]byte, size)
+		rand.New(rand.NewSource(int64(size))).Read(content)
+		stored := encrypt(t, content, key)
+		assert.True(t, IsEncrypted(stored))
+
+		blob, err := decrypt(t, stored, key)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(size), blob.Size())
+		decrypted, err := io.ReadAll(blob)
+		assert.NoError(t, err)
+		assert.Equal(t, content, decrypted, size)
+	}
+}
+
+func TestEncryption_RandomAccess(t *testing.T) {
+	key, _ := NewDataKey()
+	content := make([]byte, 2*encryptedSegmentSize+100)
+	rand.New(rand.NewSource(1)).Read(content)
+	blob, err := decrypt(t, encrypt(t, content, key), key)
+	assert.NoError(t, err)
+
+	// Across the border of two segments
+	part := make([]byte, 20)
+	_, err = blob.ReadAt(part, encryptedSegmentSize-10)
+	assert.NoError(t, err)
+	assert.Equal(t, content[encryptedSegmentSize-10:encryptedSegmentSize+10], part)
+
+	_, err = blob.Seek(-50, io.SeekEnd)
+	assert.NoError(t, err)
+	rest, err := io.ReadAll(blob)
+	assert.NoError(t, err)
+	assert.Equal(t, content[len(content)-50:], rest)
+}
+
+func TestEncryption_Tampered(t *testing.T) {
+	key, _ := NewDataKey()
+	content := make([]byte, 2*encryptedSegmentSize)
+	stored := encrypt(t, content, key)
+
+	flipped := append([]byte{}, stored...)
+	flipped[encryptedHeaderSize+10] ^= 1
+	blob, err := decrypt(t, flipped, key)
+	assert.NoError(t, err)
+	_, err = io.ReadAll(blob)
+	assert.True(t, errors.Is(err, ErrInvalidEncryption))
+
+	// Cut off after the first segment, which then lacks the flag of the last one
+	truncated := stored[:encryptedHeaderSize+encryptedSegmentSize+16]
+	blob, err = decrypt(t, truncated, key)
+	assert.NoError(t, err)
+	_, err = io.ReadAll(blob)
+	assert.True(t, errors.Is(err, ErrInvalidEncryption))
+
+	otherKey, _ := NewDataKey()
+	blob, err = decrypt(t, stored, otherKey)
+	assert.NoError(t, err)
+	_, err = io.ReadAll(blob)
+	assert.True(t, errors.Is(err, ErrInvalidEncryption))
+}
+
+func TestEncryption_MissingKey(t *testing.T) {
+	key, _ := NewDataKey()
+	missing := errors.New("missing")
+	_, err := Decrypt(bytesBlob{bytes.NewReader(encrypt(t, []byte("secret"), key))}, func(uint64) ([]byte, error) {
+		return nil, missing
+	})
+	assert.Equal(t, missing, err)
+
+	// Plain content needs no key
+	blob, err := Decrypt(bytesBlob{bytes.NewReader([]byte("plain content"))}, nil)
+	assert.NoError(t, err)
+	plain, _ := io.ReadAll(blob)
+	assert.Equal(t, "plain content", string(plain))
+}
+
+func TestWrapKey(t *testing.T) {
+	masterKey, _ := NewDataKey()
+	dataKey, _ := NewDataKey()
+	wrapped, err := WrapKey(masterKey, dataKey, []byte("box 1"))
+	assert.NoError(t, err)
+	assert.NotContains(t, string(wrapped), string(dataKey))
+
+	unwrapped, err := UnwrapKey(masterKey, wrapped, []byte("box 1"))
+	assert.NoError(t, err)
+	assert.Equal(t, dataKey, unwrapped)
+
+	_, err = UnwrapKey(masterKey, wrapped, []byte("box 2"))
+	assert.Error(t, err)
+	otherKey, _ := NewDataKey()
+	_, err = UnwrapKey(otherKey, wrapped, []byte("box 1"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,285 @@
+package storage
+
+import (
+	"Boxed/internal/helpers"
+	"Boxed/internal/models"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// LocalBlobStore keeps the content in the directory of each box, as <box path>/<hash[2:4]>/<hash[0:2]>/<hash>.
+// New content is staged in stagingDir first, so a blob only shows up once it is complete.
+type LocalBlobStore struct {
+	stagingDir string
+}
+
+func NewLocalBlobStore(stagingDir string) *LocalBlobStore {
+	return &LocalBlobStore{stagingDir: stagingDir}
+}
+
+func (s *LocalBlobStore) Writer(box *models.Box) (BlobWriter, error) {
+	file, err := createStagingFile(s.stagingDir)
+	if err != nil {
+		return nil, err
+	}
+	return &localBlobWriter{file: file, commit: func(digest string) error {
+		return s.Import(box, digest, file.Name())
+	}}, nil
+}
+
+func (s *LocalBlobStore) Put(box *models.Box, digest string, reader io.Reader) error {
+	return putWithWriter(s, box, digest, reader)
+}
+
+func (s *LocalBlobStore) Import(box *models.Box, digest string, localPath string) error {
+	if err := checkDigest(digest); err != nil {
+		return err
+	}
+	finalPath := s.path(box, digest)
+	if _, err := os.Stat(finalPath); err == nil {
+		return os.Remove(localPath)
+	}
+	if err := os.MkdirAll(filepath.Dir(finalPath), 0750); err != nil {
+		return fmt.Errorf("failed to create hash directory: %w", err)
+	}
+	if err := os.Rename(localPath, finalPath); err == nil {
+		return os.Chmod(finalPath, 0644)
+	}
+	// Rename fails across filesystems, copy into a file next to the blob and rename that one
+	if err := s.copyInto(localPath, finalPath); err != nil {
+		return fmt.Errorf("failed to move file to hash storage: %w", err)
+	}
+	return os.Remove(localPath)
+}
+
+func (s *LocalBlobStore) Get(box *models.Box, digest string) (Blob, error) {
+	if err := checkDigest(digest); err != nil {
+		return nil, err
+	}
+	file, err := os.Open(s.path(box, digest))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("%w: %s", ErrBlobNotFound, digest)
+		}
+		return nil, err
+	}
+	fileInfo, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return &localBlob{File: file, size: fileInfo.Size()}, nil
+}
+
+func (s *LocalBlobStore) Stat(box *models.Box, digest string) (*BlobInfo, error) {
+	if err := checkDigest(digest); err != nil {
+		return nil, err
+	}
+	fileInfo, err := os.Stat(s.path(box, digest))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("%w: %s", ErrBlobNotFound, digest)
+		}
+		return nil, err
+	}
+	return &BlobInfo{Digest: digest, Size: fileInfo.Size(), ModTime: fileInfo.ModTime()}, nil
+}
+
+func (s *LocalBlobStore) Delete(box *models.Box, digest string) error {
+	if err := checkDigest(digest); err != nil {
+		return err
+	}
+	blobPath := s.path(box, digest)
+	if err := os.Remove(blobPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete file from hash storage: %w", err)
+	}
+	// The hash directories go with their last blob, a directory that is still in use is left alone
+	hashDir := filepath.Dir(blobPath)
+	if err := os.Remove(hashDir); err == nil {
+		_ = os.Remove(filepath.Dir(hashDir))
+	}
+	return nil
+}
+
+func (s *LocalBlobStore) Copy(source *models.Box, destination *models.Box, digest string) error {
+	if err := checkDigest(digest); err != nil {
+		return err
+	}
+	destinationPath := s.path(destination, digest)
+	if _, err := os.Stat(destinationPath); err == nil {
+		return nil
+	}
+	sourcePath := s.path(source, digest)
+	if _, err := os.Stat(sourcePath); err != nil {
+		return fmt.Errorf("%w: %s in box %s", ErrBlobNotFound, digest, source.Name)
+	}
+	if err := os.MkdirAll(filepath.Dir(destinationPath), 0750); err != nil {
+		return fmt.Errorf("failed to create hash directory: %w", err)
+	}
+	// Prefer a hard link, blobs are immutable so sharing the inode is safe
+	if err := os.Link(sourcePath, destinationPath); err == nil || os.IsExist(err) {
+		return nil
+	}
+	if err := s.copyInto(sourcePath, destinationPath); err != nil {
+		return fmt.Errorf("failed to copy blob to box %s: %w", destination.Name, err)
+	}
+	return nil
+}
+
+func (s *LocalBlobStore) List(box *models.Box, fn func(info BlobInfo) error) error {
+	outerDirs, err := os.ReadDir(box.Path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	for _, outerDir := range outerDirs {
+		if !outerDir.IsDir() || len(outerDir.Name()) != 2 {
+			continue
+		}
+		innerDirs, err := os.ReadDir(filepath.Join(box.Path, outerDir.Name()))
+		if err != nil {
+			return err
+		}
+		for _, innerDir := range innerDirs {
+			if !innerDir.IsDir() || len(innerDir.Name()) != 2 {
+				continue
+			}
+			entries, err := os.ReadDir(filepath.Join(box.Path, outerDir.Name(), innerDir.Name()))
+			if err != nil {
+				return err
+			}
+			for _, entry := range entries {
+				digest := entry.Name()
+				// Anything not laid out like a blob belongs to someone else
+				if !entry.Type().IsRegular() || !ValidDigest(digest) || digest[2:4] != outerDir.Name() || digest[:2] != innerDir.Name() {
+					continue
+				}
+				fileInfo, err := entry.Info()
+				if err != nil {
+					continue
+				}
+				if err := fn(BlobInfo{Digest: digest, Size: fileInfo.Size(), ModTime: fileInfo.ModTime()}); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (s *LocalBlobStore) Quarantine(box *models.Box, digest string) error {
+	if err := checkDigest(digest); err != nil {
+		return err
+	}
+	blobPath := s.path(box, digest)
+	if _, err := os.Stat(blobPath); os.IsNotExist(err) {
+		return nil
+	}
+	quarantinePath := filepath.Join(box.Path, quarantineDir, quarantineName(digest))
+	if err := os.MkdirAll(filepath.Dir(quarantinePath), 0750); err != nil {
+		return fmt.Errorf("failed to create quarantine directory: %w", err)
+	}
+	if err := os.Rename(blobPath, quarantinePath); err != nil {
+		return fmt.Errorf("failed to quarantine blob %s: %w", digest, err)
+	}
+	return s.Delete(box, digest)
+}
+
+// path returns the hash-based location of a blob inside the box storage
+func (s *LocalBlobStore) path(box *models.Box, digest string) string {
+	return filepath.Join(box.Path, digest[2:4], digest[:2], digest)
+}
+
+// copyInto copies a file next to finalPath and renames it into place, so a partial copy never
+// takes the name of the blob
+func (s *LocalBlobStore) copyInto(sourcePath string, finalPath string) error {
+	partialPath := finalPath + ".partial"
+	if err := helpers.CopyFile(sourcePath, partialPath); err != nil {
+		_ = os.Remove(partialPath)
+		return err
+	}
+	if err := os.Rename(partialPath, finalPath); err != nil {
+		_ = os.Remove(partialPath)
+		return err
+	}
+	return os.Chmod(finalPath, 0644)
+}
+
+type localBlob struct {
+	*os.File
+	size int64
+}
+
+func (b *localBlob) Size() int64 {
+	return b.size
+}
+
+// localBlobWriter writes to a staging file and hands it to commit once the digest is known
+type localBlobWriter struct {
+	file   *os.File
+	commit func(digest string) error
+}
+
+func (w *localBlobWriter) Write(p []byte) (int, error) {
+	return w.file.Write(p)
+}
+
+func (w *localBlobWriter) Commit(digest string) error {
+	if err := w.file.Close(); err != nil {
+		_ = os.Remove(w.file.Name())
+		return err
+	}
+	if err := w.commit(digest); err != nil {
+		_ = os.Remove(w.file.Name())
+		return err
+	}
+	return nil
+}
+
+func (w *localBlobWriter) Abort() error {
+	_ = w.file.Close()
+	if err := os.Remove(w.file.Name()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func createStagingFile(stagingDir string) (*os.File, error) {
+	if err := os.MkdirAll(stagingDir, 0750); err != nil {
+		return nil, fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	file, err := os.CreateTemp(stagingDir, "ingest-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create staging file: %w", err)
+	}
+	return file, nil
+}
+
+// putWithWriter stores the content of reader through a writer of the store, content that does not
+// match the digest is dropped
+func putWithWriter(store BlobStore, box *models.Box, digest string, reader io.Reader) error {
+	if err := checkDigest(digest); err != nil {
+		return err
+	}
+	writer, err := store.Writer(box)
+	if err != nil {
+		return err
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(writer, hash), reader); err != nil {
+		_ = writer.Abort()
+		return err
+	}
+	if actual := hex.EncodeToString(hash.Sum(nil)); actual != digest {
+		_ = writer.Abort()
+		return fmt.Errorf("%w: content has digest %s, not %s", ErrInvalidDigest, actual, digest)
+	}
+	return writer.Commit(digest)
+}
@@ -0,0 +1,131 @@
+package storage
+
+import (
+	"Boxed/internal/models"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func digestOf(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// testBlobStore runs the behaviour every BlobStore shares against store
+func testBlobStore(t *testing.T, store BlobStore, box *models.Box, other *models.Box) {
+	content := "hello blob"
+	digest := digestOf(content)
+
+	_, err := store.Get(box, digest)
+	assert.True(t, errors.Is(err, ErrBlobNotFound))
+
+	writer, err := store.Writer(box)
+	assert.NoError(t, err)
+	_, err = io.WriteString(writer, content)
+	assert.NoError(t, err)
+	assert.NoError(t, writer.Commit(digest))
+
+	info, err := store.Stat(box, digest)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(content)), info.Size)
+
+	blob, err := store.Get(box, digest)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(content)), blob.Size())
+	read, err := io.ReadAll(blob)
+	assert.NoError(t, err)
+	assert.Equal(t, content, string(read))
+	part := make([]byte, 4)
+	n, err := blob.ReadAt(part, 6)
+	assert.NoError(t, err)
+	assert.Equal(t, "blob", string(part[:n]))
+	_, err = blob.Seek(6, io.SeekStart)
+	assert.NoError(t, err)
+	read, err = io.ReadAll(blob)
+	assert.NoError(t, err)
+	assert.Equal(t, "blob", string(read))
+	assert.NoError(t, blob.Close())
+
+	// Content that does not match its digest is rejected
+	assert.True(t, errors.Is(store.Put(box, digestOf("other"), bytes.NewReader([]byte("not other"))), ErrInvalidDigest))
+	assert.NoError(t, store.Put(box, digestOf("other"), bytes.NewReader([]byte("other"))))
+	_, err = store.Get(box, "../../etc/passwd")
+	assert.True(t, errors.Is(err, ErrInvalidDigest))
+
+	var listed []string
+	assert.NoError(t, store.List(box, func(info BlobInfo) error {
+		listed = append(listed, info.Digest)
+		return nil
+	}))
+	assert.ElementsMatch(t, []string{digest, digestOf("other")}, listed)
+
+	assert.NoError(t, store.Copy(box, other, digest))
+	_, err = store.Stat(other, digest)
+	assert.NoError(t, err)
+
+	assert.NoError(t, store.Delete(box, digest))
+	assert.NoError(t, store.Delete(box, digest))
+	_, err = store.Stat(box, digest)
+	assert.True(t, errors.Is(err, ErrBlobNotFound))
+	_, err = store.Stat(other, digest)
+	assert.NoError(t, err)
+
+	// Quarantined content is no longer found or listed
+	assert.NoError(t, store.Quarantine(box, digestOf("other")))
+	assert.NoError(t, store.Quarantine(box, digestOf("other")))
+	_, err = store.Stat(box, digestOf("other"))
+	assert.True(t, errors.Is(err, ErrBlobNotFound))
+	listed = nil
+	assert.NoError(t, store.List(box, func(info BlobInfo) error {
+		listed = append(listed, info.Digest)
+		return nil
+	}))
+	assert.Empty(t, listed)
+
+	writer, err = store.Writer(box)
+	assert.NoError(t, err)
+	_, _ = io.WriteString(writer, "dropped")
+	assert.NoError(t, writer.Abort())
+	_, err = store.Stat(box, digestOf("dropped"))
+	assert.True(t, errors.Is(err, ErrBlobNotFound))
+}
+
+func TestLocalBlobStore(t *testing.T) {
+	root := t.TempDir()
+	store := NewLocalBlobStore(filepath.Join(root, "staging"))
+	box := &models.Box{BaseModel: models.BaseModel{ID: 1}, Name: "one", Path: filepath.Join(root, "one")}
+	other := &models.Box{BaseModel: models.BaseModel{ID: 2}, Name: "two", Path: filepath.Join(root, "two")}
+	testBlobStore(t, store, box, other)
+
+	// The layout stays the one of the existing storage, quarantined content is kept next to it
+	digest := digestOf("hello blob")
+	_, err := os.Stat(filepath.Join(other.Path, digest[2:4], digest[:2], digest))
+	assert.NoError(t, err)
+	quarantined, _ := os.ReadDir(filepath.Join(box.Path, quarantineDir))
+	assert.Len(t, quarantined, 1)
+	staged, _ := os.ReadDir(filepath.Join(root, "staging"))
+	assert.Empty(t, staged)
+}
+
+func TestLocalBlobStore_Import(t *testing.T) {
+	root := t.TempDir()
+	store := NewLocalBlobStore(filepath.Join(root, "staging"))
+	box := &models.Box{Name: "one", Path: filepath.Join(root, "one")}
+	localPath := filepath.Join(root, "upload")
+	assert.NoError(t, os.WriteFile(localPath, []byte("uploaded"), 0644))
+
+	assert.NoError(t, store.Import(box, digestOf("uploaded"), localPath))
+	_, err := os.Stat(localPath)
+	assert.True(t, os.IsNotExist(err))
+	info, err := store.Stat(box, digestOf("uploaded"))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(8), info.Size)
+}
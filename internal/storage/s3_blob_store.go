@@ -0,0 +1,393 @@
+package storage
+
+import (
+	"Boxed/internal/config"
+	"Boxed/internal/models"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// S3BlobStore keeps the content in a bucket of an S3 compatible service, under
+// <prefix><box id>/<hash[2:4]>/<hash[0:2]>/<hash>. New content is staged in stagingDir until its
+// digest is known and uploaded from there.
+type S3BlobStore struct {
+	client     *http.Client
+	signer     *s3Signer
+	endpoint   *url.URL
+	bucket     string
+	prefix     string
+	pathStyle  bool
+	stagingDir string
+}
+
+func NewS3BlobStore(s3Config config.S3Config, stagingDir string) (*S3BlobStore, error) {
+	endpoint, err := url.Parse(strings.TrimRight(s3Config.Endpoint, "/"))
+	if err != nil || endpoint.Scheme != "http" && endpoint.Scheme != "https" || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid s3 endpoint %q", s3Config.Endpoint)
+	}
+	if s3Config.Bucket == "" {
+		return nil, errors.New("the s3 storage backend needs a bucket")
+	}
+	region := s3Config.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	return &S3BlobStore{
+		client:     &http.Client{},
+		signer:     &s3Signer{accessKey: s3Config.AccessKey, secretKey: s3Config.SecretKey, region: region},
+		endpoint:   endpoint,
+		bucket:     s3Config.Bucket,
+		prefix:     s3Config.Prefix,
+		pathStyle:  s3Config.PathStyle,
+		stagingDir: stagingDir,
+	}, nil
+}
+
+func (s *S3BlobStore) Writer(box *models.Box) (BlobWriter, error) {
+	file, err := createStagingFile(s.stagingDir)
+	if err != nil {
+		return nil, err
+	}
+	return &localBlobWriter{file: file, commit: func(digest string) error {
+		return s.Import(box, digest, file.Name())
+	}}, nil
+}
+
+func (s *S3BlobStore) Put(box *models.Box, digest string, reader io.Reader) error {
+	return putWithWriter(s, box, digest, reader)
+}
+
+func (s *S3BlobStore) Import(box *models.Box, digest string, localPath string) error {
+	if err := checkDigest(digest); err != nil {
+		return err
+	}
+	// The content of a key never changes, there is no need to upload it twice
+	if _, err := s.Stat(box, digest); err == nil {
+		return os.Remove(localPath)
+	} else if !errors.Is(err, ErrBlobNotFound) {
+		return err
+	}
+	file, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	fileInfo, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	request, err := s.request(http.MethodPut, s.key(box, digest), nil, file)
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	request.ContentLength = fileInfo.Size()
+	request.Header.Set("Content-Type", "application/octet-stream")
+	response, err := s.do(request, http.StatusOK)
+	if err != nil {
+		_ = file.Close()
+		return fmt.Errorf("failed to upload blob %s: %w", digest, err)
+	}
+	_ = response.Body.Close()
+	_ = file.Close()
+	return os.Remove(localPath)
+}
+
+func (s *S3BlobStore) Get(box *models.Box, digest string) (Blob, error) {
+	info, err := s.Stat(box, digest)
+	if err != nil {
+		return nil, err
+	}
+	return &s3Blob{store: s, key: s.key(box, digest), size: info.Size}, nil
+}
+
+func (s *S3BlobStore) Stat(box *models.Box, digest string) (*BlobInfo, error) {
+	if err := checkDigest(digest); err != nil {
+		return nil, err
+	}
+	request, err := s.request(http.MethodHead, s.key(box, digest), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := s.do(request, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	_ = response.Body.Close()
+	info := &BlobInfo{Digest: digest, Size: response.ContentLength}
+	info.ModTime, _ = http.ParseTime(response.Header.Get("Last-Modified"))
+	return info, nil
+}
+
+func (s *S3BlobStore) Delete(box *models.Box, digest string) error {
+	if err := checkDigest(digest); err != nil {
+		return err
+	}
+	request, err := s.request(http.MethodDelete, s.key(box, digest), nil, nil)
+	if err != nil {
+		return err
+	}
+	response, err := s.do(request, http.StatusNoContent, http.StatusOK)
+	if err != nil && !errors.Is(err, ErrBlobNotFound) {
+		return fmt.Errorf("failed to delete blob %s: %w", digest, err)
+	}
+	if response != nil {
+		_ = response.Body.Close()
+	}
+	return nil
+}
+
+func (s *S3BlobStore) Copy(source *models.Box, destination *models.Box, digest string) error {
+	if _, err := s.Stat(destination, digest); err == nil {
+		return nil
+	} else if !errors.Is(err, ErrBlobNotFound) {
+		return err
+	}
+	if err := s.copyObject(s.key(source, digest), s.key(destination, digest)); err != nil {
+		return fmt.Errorf("failed to copy blob %s to box %s: %w", digest, destination.Name, err)
+	}
+	return nil
+}
+
+func (s *S3BlobStore) Quarantine(box *models.Box, digest string) error {
+	if _, err := s.Stat(box, digest); errors.Is(err, ErrBlobNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if err := s.copyObject(s.key(box, digest), s.boxPrefix(box)+quarantineDir+"/"+quarantineName(digest)); err != nil {
+		return fmt.Errorf("failed to quarantine blob %s: %w", digest, err)
+	}
+	return s.Delete(box, digest)
+}
+
+// copyObject copies an object inside of the bucket, the content does not pass through here
+func (s *S3BlobStore) copyObject(sourceKey string, destinationKey string) error {
+	request, err := s.request(http.MethodPut, destinationKey, nil, nil)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("X-Amz-Copy-Source", "/"+s.bucket+"/"+s3EscapePath(sourceKey))
+	response, err := s.do(request, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	// A copy may fail after the service answered 200, the error is in the body then
+	var result struct {
+		XMLName xml.Name
+		Message string `xml:"Message"`
+	}
+	if err := xml.NewDecoder(io.LimitReader(response.Body, 1<<20)).Decode(&result); err == nil && result.XMLName.Local == "Error" {
+		return errors.New(result.Message)
+	}
+	return nil
+}
+
+type s3ListResult struct {
+	Contents []struct {
+		Key          string    `xml:"Key"`
+		Size         int64     `xml:"Size"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+func (s *S3BlobStore) List(box *models.Box, fn func(info BlobInfo) error) error {
+	prefix := s.boxPrefix(box)
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		request, err := s.request(http.MethodGet, "", query, nil)
+		if err != nil {
+			return err
+		}
+		response, err := s.do(request, http.StatusOK)
+		if err != nil {
+			return fmt.Errorf("failed to list blobs: %w", err)
+		}
+		var result s3ListResult
+		err = xml.NewDecoder(response.Body).Decode(&result)
+		_ = response.Body.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read blob listing: %w", err)
+		}
+		for _, object := range result.Contents {
+			digest := object.Key[strings.LastIndex(object.Key, "/")+1:]
+			if !ValidDigest(digest) || object.Key != s.key(box, digest) {
+				continue
+			}
+			if err := fn(BlobInfo{Digest: digest, Size: object.Size, ModTime: object.LastModified}); err != nil {
+				return err
+			}
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+func (s *S3BlobStore) boxPrefix(box *models.Box) string {
+	return s.prefix + strconv.FormatUint(uint64(box.ID), 10) + "/"
+}
+
+func (s *S3BlobStore) key(box *models.Box, digest string) string {
+	return s.boxPrefix(box) + digest[2:4] + "/" + digest[:2] + "/" + digest
+}
+
+// request builds a request for an object key, or for the bucket when key is empty. It is signed when
+// it is sent.
+func (s *S3BlobStore) request(method string, key string, query url.Values, body io.Reader) (*http.Request, error) {
+	target := *s.endpoint
+	objectPath := "/" + key
+	if s.pathStyle {
+		objectPath = "/" + s.bucket + objectPath
+	} else {
+		target.Host = s.bucket + "." + target.Host
+	}
+	target.Path = strings.TrimRight(s.endpoint.Path, "/") + objectPath
+	target.RawPath = s3EscapePath(target.Path)
+	target.RawQuery = s3CanonicalQuery(query)
+	return http.NewRequest(method, target.String(), body)
+}
+
+// do signs and sends a request and turns answers other than the expected ones into errors, 404 into
+// ErrBlobNotFound
+func (s *S3BlobStore) do(request *http.Request, expected ...int) (*http.Response, error) {
+	s.signer.sign(request, time.Now())
+	response, err := s.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	for _, status := range expected {
+		if response.StatusCode == status {
+			return response, nil
+		}
+	}
+	message, _ := io.ReadAll(io.LimitReader(response.Body, 4096))
+	_ = response.Body.Close()
+	if response.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: %s", ErrBlobNotFound, request.URL.Path)
+	}
+	var s3Error struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	if xml.Unmarshal(message, &s3Error) == nil && s3Error.Code != "" {
+		return nil, fmt.Errorf("s3 answered %d %s: %s", response.StatusCode, s3Error.Code, s3Error.Message)
+	}
+	return nil, fmt.Errorf("s3 answered %d", response.StatusCode)
+}
+
+// s3Blob reads an object with ranged requests. Sequential reads share one request from the current
+// offset, which is dropped when the offset moves.
+type s3Blob struct {
+	store  *S3BlobStore
+	key    string
+	size   int64
+	offset int64
+	body   io.ReadCloser
+}
+
+func (b *s3Blob) Size() int64 {
+	return b.size
+}
+
+func (b *s3Blob) Read(p []byte) (int, error) {
+	if b.offset >= b.size {
+		return 0, io.EOF
+	}
+	if b.body == nil {
+		body, err := b.open(b.offset, b.size-1)
+		if err != nil {
+			return 0, err
+		}
+		b.body = body
+	}
+	n, err := b.body.Read(p)
+	b.offset += int64(n)
+	if errors.Is(err, io.EOF) && b.offset < b.size {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (b *s3Blob) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += b.offset
+	case io.SeekEnd:
+		offset += b.size
+	}
+	if offset < 0 {
+		return 0, errors.New("seek before the start of the blob")
+	}
+	if offset != b.offset {
+		b.closeBody()
+		b.offset = offset
+	}
+	return offset, nil
+}
+
+func (b *s3Blob) ReadAt(p []byte, offset int64) (int, error) {
+	if offset >= b.size {
+		return 0, io.EOF
+	}
+	end := offset + int64(len(p)) - 1
+	if end >= b.size {
+		end = b.size - 1
+	}
+	body, err := b.open(offset, end)
+	if err != nil {
+		return 0, err
+	}
+	defer body.Close()
+	n, err := io.ReadFull(body, p[:end-offset+1])
+	if err == nil && n < len(p) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (b *s3Blob) Close() error {
+	b.closeBody()
+	return nil
+}
+
+func (b *s3Blob) open(start int64, end int64) (io.ReadCloser, error) {
+	request, err := b.store.request(http.MethodGet, b.key, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+	expected := []int{http.StatusPartialContent}
+	if start == 0 {
+		// Some services answer a range covering the whole object with all of it
+		expected = append(expected, http.StatusOK)
+	}
+	response, err := b.store.do(request, expected...)
+	if err != nil {
+		return nil, err
+	}
+	return response.Body, nil
+}
+
+func (b *s3Blob) closeBody() {
+	if b.body != nil {
+		_ = b.body.Close()
+		b.body = nil
+	}
+}
@@ -0,0 +1,151 @@
+package storage
+
+import (
+	"Boxed/internal/config"
+	"Boxed/internal/models"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeS3 is an in-process stand-in for an S3 compatible service with path style addressing. It checks
+// the signature of every request and keeps the objects in memory.
+type fakeS3 struct {
+	t       *testing.T
+	bucket  string
+	signer  *s3Signer
+	lock    sync.Mutex
+	objects map[string][]byte
+}
+
+func newFakeS3(t *testing.T, bucket string, signer *s3Signer) *httptest.Server {
+	fake := &fakeS3{t: t, bucket: bucket, signer: signer, objects: make(map[string][]byte)}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	authorization := r.Header.Get("Authorization")
+	_, signature := f.signer.signature(r, r.Header.Get("X-Amz-Date"))
+	if !strings.HasSuffix(authorization, "Signature="+signature) {
+		f.t.Errorf("bad signature for %s %s", r.Method, r.URL)
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = io.WriteString(w, "<Error><Code>SignatureDoesNotMatch</Code><Message>bad signature</Message></Error>")
+		return
+	}
+	key, ok := strings.CutPrefix(r.URL.Path, "/"+f.bucket+"/")
+	if !ok && r.URL.Path != "/"+f.bucket {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	switch {
+	case r.Method == http.MethodGet && key == "":
+		f.list(w, r.URL.Query().Get("prefix"), r.URL.Query().Get("continuation-token"))
+	case r.Method == http.MethodPut && r.Header.Get("X-Amz-Copy-Source") != "":
+		source := strings.TrimPrefix(r.Header.Get("X-Amz-Copy-Source"), "/"+f.bucket+"/")
+		content, ok := f.objects[source]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		f.objects[key] = content
+		_, _ = io.WriteString(w, "<CopyObjectResult></CopyObjectResult>")
+	case r.Method == http.MethodPut:
+		content, _ := io.ReadAll(r.Body)
+		f.objects[key] = content
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodHead || r.Method == http.MethodGet:
+		content, ok := f.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+		var start, end int64 = 0, int64(len(content)) - 1
+		status := http.StatusOK
+		if rangeHeader := r.Header.Get("Range"); rangeHeader != "" {
+			_, _ = fmt.Sscanf(rangeHeader, "bytes=%d-%d", &start, &end)
+			status = http.StatusPartialContent
+		}
+		w.Header().Set("Content-Length", strconv.FormatInt(end-start+1, 10))
+		w.WriteHeader(status)
+		if r.Method == http.MethodGet {
+			_, _ = w.Write(content[start : end+1])
+		}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// list answers ListObjectsV2 with pages of one object, so the continuation is exercised
+func (f *fakeS3) list(w http.ResponseWriter, prefix string, token string) {
+	var keys []string
+	for key := range f.objects {
+		if strings.HasPrefix(key, prefix) && key > token {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	type object struct {
+		Key          string
+		Size         int
+		LastModified string
+	}
+	result := struct {
+		XMLName               xml.Name `xml:"ListBucketResult"`
+		Contents              []object
+		IsTruncated           bool
+		NextContinuationToken string `xml:",omitempty"`
+	}{}
+	if len(keys) > 0 {
+		result.Contents = []object{{Key: keys[0], Size: len(f.objects[keys[0]]), LastModified: time.Now().UTC().Format(time.RFC3339)}}
+		result.IsTruncated = len(keys) > 1
+		if result.IsTruncated {
+			result.NextContinuationToken = keys[0]
+		}
+	}
+	_ = xml.NewEncoder(w).Encode(result)
+}
+
+func TestS3BlobStore(t *testing.T) {
+	s3Config := config.S3Config{
+		Region:    "eu-central-1",
+		Bucket:    "boxed",
+		Prefix:    "blobs/",
+		AccessKey: "access",
+		SecretKey: "secret",
+		PathStyle: true,
+	}
+	server := newFakeS3(t, s3Config.Bucket, &s3Signer{accessKey: "access", secretKey: "secret", region: s3Config.Region})
+	s3Config.Endpoint = server.URL
+	store, err := NewS3BlobStore(s3Config, filepath.Join(t.TempDir(), "staging"))
+	assert.NoError(t, err)
+
+	box := &models.Box{BaseModel: models.BaseModel{ID: 1}, Name: "one"}
+	other := &models.Box{BaseModel: models.BaseModel{ID: 2}, Name: "two"}
+	testBlobStore(t, store, box, other)
+}
+
+func TestNewS3BlobStore_Invalid(t *testing.T) {
+	_, err := NewS3BlobStore(config.S3Config{Endpoint: "s3.example.com", Bucket: "boxed"}, "")
+	assert.Error(t, err)
+	_, err = NewS3BlobStore(config.S3Config{Endpoint: "https://s3.example.com"}, "")
+	assert.Error(t, err)
+}
@@ -0,0 +1,161 @@
+// Package testdb opens the sqlite databases the tests run on. The repositories query the item paths with
+// the ltree extension of Postgres, which sqlite does not have, so the ltree operators and functions they
+// use are translated here: the paths are kept as text and the functions are implemented in Go.
+package testdb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/mattn/go-sqlite3"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"regexp"
+	"strings"
+)
+
+const driverName = "sqlite3_ltree"
+
+// ltreeRewrites turn the ltree syntax sqlite cannot parse into calls of the functions registered below
+var ltreeRewrites = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	// Paths are plain text, there is nothing to cast
+	{regexp.MustCompile(`::ltree\b`), ""},
+	// a <@ b holds when a is b or below it
+	{regexp.MustCompile(`([\w.]+|\?) <@ ([\w.]+|\?)`), "ltree_descendant(${1}, ${2})"},
+	// Concatenating ltrees joins them with a dot
+	{regexp.MustCompile(`([\w.]+|\?) \|\| (subpath\((?:[^()]|\([^()]*\))*\))`), "ltree_concat(${1}, ${2})"},
+}
+
+func init() {
+	sql.Register(driverName, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			functions := map[string]interface{}{
+				"nlevel":           nlevel,
+				"subpath":          subpath,
+				"ltree_descendant": descendant,
+				"ltree_concat":     concat,
+			}
+			for name, function := range functions {
+				if err := conn.RegisterFunc(name, function, true); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+}
+
+// Open returns a sqlite dialector for the dsn, like sqlite.Open, that understands the ltree queries
+func Open(dsn string) gorm.Dialector {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		panic(err)
+	}
+	return sqlite.New(sqlite.Config{DriverName: driverName, DSN: dsn, Conn: &ltreePool{db: db}})
+}
+
+func translate(query string) string {
+	for _, rewrite := range ltreeRewrites {
+		query = rewrite.pattern.ReplaceAllString(query, rewrite.replacement)
+	}
+	return query
+}
+
+func labels(path string) []string {
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, ".")
+}
+
+func nlevel(path string) int64 {
+	return int64(len(labels(path)))
+}
+
+// subpath returns the labels of path from offset on, a negative offset counts from the end
+func subpath(path string, offset int64) (string, error) {
+	parts := labels(path)
+	if offset < 0 {
+		offset += int64(len(parts))
+	}
+	if offset < 0 || offset >= int64(len(parts)) {
+		return "", fmt.Errorf("invalid positions for subpath of %q", path)
+	}
+	return strings.Join(parts[offset:], "."), nil
+}
+
+func descendant(path string, ancestor string) bool {
+	return ancestor == "" || path == ancestor || strings.HasPrefix(path, ancestor+".")
+}
+
+func concat(a string, b string) string {
+	if a == "" || b == "" {
+		return a + b
+	}
+	return a + "." + b
+}
+
+// ltreePool translates the queries before they reach sqlite
+type ltreePool struct {
+	db *sql.DB
+}
+
+func (p *ltreePool) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return p.db.PrepareContext(ctx, translate(query))
+}
+
+func (p *ltreePool) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return p.db.ExecContext(ctx, translate(query), args...)
+}
+
+func (p *ltreePool) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return p.db.QueryContext(ctx, translate(query), args...)
+}
+
+func (p *ltreePool) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return p.db.QueryRowContext(ctx, translate(query), args...)
+}
+
+func (p *ltreePool) BeginTx(ctx context.Context, opts *sql.TxOptions) (gorm.ConnPool, error) {
+	tx, err := p.db.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &ltreeTx{tx: tx}, nil
+}
+
+// GetDBConn lets gorm's DB() return the underlying pool
+func (p *ltreePool) GetDBConn() (*sql.DB, error) {
+	return p.db, nil
+}
+
+type ltreeTx struct {
+	tx *sql.Tx
+}
+
+func (t *ltreeTx) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return t.tx.PrepareContext(ctx, translate(query))
+}
+
+func (t *ltreeTx) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return t.tx.ExecContext(ctx, translate(query), args...)
+}
+
+func (t *ltreeTx) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return t.tx.QueryContext(ctx, translate(query), args...)
+}
+
+func (t *ltreeTx) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return t.tx.QueryRowContext(ctx, translate(query), args...)
+}
+
+func (t *ltreeTx) Commit() error {
+	return t.tx.Commit()
+}
+
+func (t *ltreeTx) Rollback() error {
+	return t.tx.Rollback()
+}
@@ -16,7 +16,12 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
+	// All job handlers are registered by now, pick up what the last run left behind
+	if err := server.JobService.ResumeInterrupted(); err != nil {
+		log.Printf("Failed to resume interrupted jobs: %v", err)
+	}
 	server.JanitorService.StartCleanCycle()
+	server.ScrubService.StartScrubCycle()
 
 	cfg, db, err := bootstrap()
 	defer database.CloseDatabase(db)
@@ -24,6 +29,9 @@ func main() {
 		BodyLimit:   cfg.Server.RequestConfig.SizeLimit * 1024 * 1024,
 		Concurrency: cfg.Server.Concurrency * 1024,
 		AppName:     "Boxed",
+		// Uploads are streamed into the storage, so large bodies are never held in memory
+		StreamRequestBody:            true,
+		DisablePreParseMultipartForm: true,
 	})
 
 	app.Use(logger.New())
@@ -10,6 +10,7 @@ import (
 	"Boxed/internal/handlers"
 	"Boxed/internal/repository"
 	"Boxed/internal/services"
+	"Boxed/internal/storage"
 	"github.com/google/wire"
 )
 
@@ -28,9 +29,49 @@ func InitializeServer() (*cmd.Server, error) {
 		repository.NewItemRepository,
 		database.SetupDatabase,
 		services.NewFileService,
+		storage.NewBlobStore,
 		handlers.NewFileHandler,
 		services.NewLogService,
 		services.NewJanitorService,
+		services.NewScrubService,
+		services.NewMoverService,
+		repository.NewJobRepository,
+		services.NewJobService,
+		handlers.NewJobHandler,
+		repository.NewUploadSessionRepository,
+		repository.NewItemVersionRepository,
+		services.NewUploadService,
+		handlers.NewUploadHandler,
+		services.NewArchiveService,
+		services.NewMavenService,
+		handlers.NewMavenHandler,
+		services.NewNpmService,
+		handlers.NewNpmHandler,
+		services.NewPypiService,
+		handlers.NewPypiHandler,
+		services.NewGoproxyService,
+		handlers.NewGoproxyHandler,
+		services.NewOciService,
+		handlers.NewOciHandler,
+		services.NewHelmService,
+		handlers.NewHelmHandler,
+		services.NewDebianService,
+		handlers.NewDebianHandler,
+		services.NewRpmService,
+		handlers.NewRpmHandler,
+		services.NewNugetService,
+		handlers.NewNugetHandler,
+		services.NewCargoService,
+		handlers.NewCargoHandler,
+		services.NewRemoteService,
+		services.NewVirtualService,
+		services.NewVersionService,
+		handlers.NewVersionHandler,
+		services.NewTrashService,
+		handlers.NewTrashHandler,
+		repository.NewDataKeyRepository,
+		services.NewKeyService,
+		handlers.NewKeyHandler,
 		Provider,
 	)
 	return nil, nil
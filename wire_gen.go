@@ -13,6 +13,7 @@ import (
 	"Boxed/internal/handlers"
 	"Boxed/internal/repository"
 	"Boxed/internal/services"
+	"Boxed/internal/storage"
 )
 
 // Injectors from wire.go:
@@ -26,17 +27,63 @@ func InitializeServer() (*cmd.Server, error) {
 	boxService := services.NewBoxService(boxRepository)
 	boxHandler := handlers.NewBoxHandler(boxService)
 	itemRepository := repository.NewItemRepository(db)
-	itemService := services.NewItemService(itemRepository)
-	itemHandler := handlers.NewItemHandler(itemService)
+	itemVersionRepository := repository.NewItemVersionRepository(db)
+	itemService := services.NewItemService(itemRepository, itemVersionRepository)
 	configuration, err := Provider()
 	if err != nil {
 		return nil, err
 	}
 	logService := services.NewLogService(configuration)
-	fileService := services.NewFileService(itemService, boxService, logService, configuration)
-	fileHandler := handlers.NewFileHandler(fileService)
-	janitor := services.NewJanitorService(itemService, boxService, fileService, logService, configuration)
-	server := cmd.NewServer(boxService, boxHandler, itemService, itemHandler, fileService, fileHandler, logService, janitor)
+	blobStore, err := storage.NewBlobStore(configuration)
+	if err != nil {
+		return nil, err
+	}
+	jobRepository := repository.NewJobRepository(db)
+	jobService := services.NewJobService(jobRepository, logService, configuration)
+	dataKeyRepository := repository.NewDataKeyRepository(db)
+	keyService, err := services.NewKeyService(dataKeyRepository, jobService, logService, configuration)
+	if err != nil {
+		return nil, err
+	}
+	fileService := services.NewFileService(itemService, boxService, blobStore, keyService, logService, configuration)
+	moverService := services.NewMoverService(itemService, boxService, fileService, jobService, logService, configuration)
+	itemHandler := handlers.NewItemHandler(itemService, moverService)
+	archiveService := services.NewArchiveService(itemService, fileService, logService, configuration)
+	remoteService := services.NewRemoteService(itemService, fileService, logService, configuration)
+	virtualService := services.NewVirtualService(itemService, fileService, remoteService, logService)
+	fileHandler := handlers.NewFileHandler(fileService, archiveService, remoteService, virtualService)
+	uploadSessionRepository := repository.NewUploadSessionRepository(db)
+	uploadService := services.NewUploadService(uploadSessionRepository, fileService, boxService, itemService, logService, configuration)
+	versionService := services.NewVersionService(itemService, fileService, logService)
+	janitor := services.NewJanitorService(itemService, boxService, fileService, uploadService, jobService, versionService, logService, configuration)
+	scrubber := services.NewScrubService(itemService, boxService, fileService, jobService, blobStore, logService, configuration)
+	jobHandler := handlers.NewJobHandler(jobService)
+	uploadHandler := handlers.NewUploadHandler(uploadService, fileService)
+	mavenService := services.NewMavenService(itemService, fileService, logService)
+	mavenHandler := handlers.NewMavenHandler(mavenService, fileService)
+	npmService := services.NewNpmService(itemService, fileService, logService)
+	npmHandler := handlers.NewNpmHandler(npmService, fileService)
+	pypiService := services.NewPypiService(itemService, fileService, logService)
+	pypiHandler := handlers.NewPypiHandler(pypiService, fileService)
+	goproxyService := services.NewGoproxyService(itemService, fileService, logService)
+	goproxyHandler := handlers.NewGoproxyHandler(goproxyService, fileService)
+	ociService := services.NewOciService(itemService, fileService, uploadService, logService)
+	ociHandler := handlers.NewOciHandler(ociService, fileService)
+	helmService := services.NewHelmService(itemService, fileService, logService)
+	helmHandler := handlers.NewHelmHandler(helmService, fileService)
+	debianService := services.NewDebianService(itemService, fileService, logService, configuration)
+	debianHandler := handlers.NewDebianHandler(debianService, fileService)
+	rpmService := services.NewRpmService(itemService, fileService, logService)
+	rpmHandler := handlers.NewRpmHandler(rpmService, fileService)
+	nugetService := services.NewNugetService(itemService, fileService, logService)
+	nugetHandler := handlers.NewNugetHandler(nugetService, fileService)
+	cargoService := services.NewCargoService(itemService, fileService, logService)
+	cargoHandler := handlers.NewCargoHandler(cargoService, fileService)
+	versionHandler := handlers.NewVersionHandler(versionService, fileService)
+	trashService := services.NewTrashService(itemService, fileService)
+	trashHandler := handlers.NewTrashHandler(trashService, fileService)
+	keyHandler := handlers.NewKeyHandler(keyService)
+	server := cmd.NewServer(boxService, boxHandler, itemService, itemHandler, fileService, fileHandler, logService, janitor, scrubber, moverService, jobService, jobHandler, uploadService, uploadHandler, archiveService, mavenService, mavenHandler, npmService, npmHandler, pypiService, pypiHandler, goproxyService, goproxyHandler, ociService, ociHandler, helmService, helmHandler, debianService, debianHandler, rpmService, rpmHandler, nugetService, nugetHandler, cargoService, cargoHandler, remoteService, virtualService, versionService, versionHandler, trashService, trashHandler, keyService, keyHandler)
 	return server, nil
 }
 